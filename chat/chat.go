@@ -0,0 +1,50 @@
+// Package chat connects the application to chat platforms through a small
+// Bot interface, so the rest of the code does not depend on one provider.
+package chat
+
+import (
+	"context"
+	"time"
+)
+
+// Button is an inline button. Data is handed back in the Update when the
+// user presses it.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Message is an outgoing chat message. Buttons are laid out in rows.
+type Message struct {
+	ChatID  int64
+	Text    string
+	Buttons [][]Button
+}
+
+// Update is an incoming chat message or button press.
+type Update struct {
+	ID     int64
+	ChatID int64
+	// FromID is the platform's ID of the user who sent the update.
+	FromID   int64
+	Username string
+	// Private is set when the chat is a one-to-one chat with the bot.
+	Private bool
+	// Text is set for messages.
+	Text string
+	// CallbackID and CallbackData are set for button presses.
+	CallbackID   string
+	CallbackData string
+}
+
+// Bot talks to a chat platform. Updates arrive either through GetUpdates
+// (long polling) or through a webhook the platform calls.
+type Bot interface {
+	Send(ctx context.Context, msg Message) error
+	AnswerCallback(ctx context.Context, callbackID, text string) error
+	// GetUpdates waits up to timeout for updates with an ID of at least
+	// offset. Passing a higher offset confirms the earlier ones.
+	GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error)
+	SetWebhook(ctx context.Context, url, secret string) error
+	DeleteWebhook(ctx context.Context) error
+}
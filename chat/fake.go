@@ -0,0 +1,149 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeTelegram is an in-memory stand-in for the Telegram Bot API. Point a
+// TelegramBot at it to exercise the bot without Telegram:
+//
+//   - POST /fake/updates queues an incoming update (Telegram JSON);
+//   - GET /fake/sent lists the messages the bot sent.
+type FakeTelegram struct {
+	mu      sync.Mutex
+	wake    chan struct{}
+	nextID  int64
+	updates []tgUpdate
+	sent    []json.RawMessage
+	webhook string
+}
+
+func NewFakeTelegram() *FakeTelegram {
+	return &FakeTelegram{wake: make(chan struct{}), nextID: 1}
+}
+
+// Push queues an update as if a user had written to the bot. A missing
+// update_id is assigned.
+func (f *FakeTelegram) Push(u json.RawMessage) error {
+	var update tgUpdate
+	if err := json.Unmarshal(u, &update); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if update.UpdateID == 0 {
+		update.UpdateID = f.nextID
+	}
+	if update.UpdateID >= f.nextID {
+		f.nextID = update.UpdateID + 1
+	}
+	f.updates = append(f.updates, update)
+	close(f.wake)
+	f.wake = make(chan struct{})
+	return nil
+}
+
+// Sent returns the parameters of every sendMessage call so far.
+func (f *FakeTelegram) Sent() []json.RawMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]json.RawMessage(nil), f.sent...)
+}
+
+func (f *FakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/fake/updates" && r.Method == http.MethodPost:
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := f.Push(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	case r.URL.Path == "/fake/sent":
+		writeJSON(w, f.Sent())
+		return
+	case !strings.HasPrefix(r.URL.Path, "/bot"):
+		http.NotFound(w, r)
+		return
+	}
+
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	var params map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeJSON(w, tgResponse{Description: "Bad Request: " + err.Error()})
+		return
+	}
+
+	switch method {
+	case "sendMessage":
+		raw, _ := json.Marshal(params)
+		f.mu.Lock()
+		f.sent = append(f.sent, raw)
+		f.mu.Unlock()
+		writeResult(w, tgMessage{MessageID: int64(len(f.Sent()))})
+	case "answerCallbackQuery", "deleteWebhook":
+		writeResult(w, true)
+	case "setWebhook":
+		var url string
+		json.Unmarshal(params["url"], &url)
+		f.mu.Lock()
+		f.webhook = url
+		f.mu.Unlock()
+		writeResult(w, true)
+	case "getUpdates":
+		var offset, timeout int64
+		json.Unmarshal(params["offset"], &offset)
+		json.Unmarshal(params["timeout"], &timeout)
+		writeResult(w, f.waitUpdates(r, offset, time.Duration(timeout)*time.Second))
+	default:
+		writeJSON(w, tgResponse{Description: "Not Found: method " + method})
+	}
+}
+
+// waitUpdates drops confirmed updates and long-polls for new ones.
+func (f *FakeTelegram) waitUpdates(r *http.Request, offset int64, timeout time.Duration) []tgUpdate {
+	deadline := time.After(timeout)
+	for {
+		f.mu.Lock()
+		kept := f.updates[:0]
+		for _, u := range f.updates {
+			if u.UpdateID >= offset {
+				kept = append(kept, u)
+			}
+		}
+		f.updates = kept
+		pending := append([]tgUpdate{}, kept...)
+		wake := f.wake
+		f.mu.Unlock()
+
+		if len(pending) > 0 {
+			return pending
+		}
+		select {
+		case <-wake:
+		case <-deadline:
+			return pending
+		case <-r.Context().Done():
+			return pending
+		}
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	raw, _ := json.Marshal(result)
+	writeJSON(w, tgResponse{OK: true, Result: raw})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,195 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TelegramBot is a Bot backed by the Telegram Bot API. APIURL is
+// https://api.telegram.org in production and the address of a stand-in
+// such as FakeTelegram elsewhere.
+type TelegramBot struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+func NewTelegramBot(apiURL, token string) *TelegramBot {
+	return &TelegramBot{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+		client: &http.Client{},
+	}
+}
+
+// Telegram API types, limited to the fields we use.
+
+type tgUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username,omitempty"`
+}
+
+type tgChat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type tgMessage struct {
+	MessageID int64   `json:"message_id"`
+	From      *tgUser `json:"from,omitempty"`
+	Chat      tgChat  `json:"chat"`
+	Text      string  `json:"text,omitempty"`
+}
+
+type tgCallbackQuery struct {
+	ID      string     `json:"id"`
+	From    tgUser     `json:"from"`
+	Message *tgMessage `json:"message,omitempty"`
+	Data    string     `json:"data,omitempty"`
+}
+
+type tgUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       *tgMessage       `json:"message,omitempty"`
+	CallbackQuery *tgCallbackQuery `json:"callback_query,omitempty"`
+}
+
+type tgInlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type tgResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+func (b *TelegramBot) Send(ctx context.Context, msg Message) error {
+	params := map[string]interface{}{
+		"chat_id": msg.ChatID,
+		"text":    msg.Text,
+	}
+	if len(msg.Buttons) > 0 {
+		rows := make([][]tgInlineButton, len(msg.Buttons))
+		for i, row := range msg.Buttons {
+			for _, btn := range row {
+				rows[i] = append(rows[i], tgInlineButton{Text: btn.Text, CallbackData: btn.Data})
+			}
+		}
+		params["reply_markup"] = map[string]interface{}{"inline_keyboard": rows}
+	}
+	return b.call(ctx, "sendMessage", params, nil)
+}
+
+func (b *TelegramBot) AnswerCallback(ctx context.Context, callbackID, text string) error {
+	return b.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": callbackID,
+		"text":              text,
+	}, nil)
+}
+
+func (b *TelegramBot) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	var raw []tgUpdate
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &raw)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]Update, 0, len(raw))
+	for _, u := range raw {
+		updates = append(updates, u.toUpdate())
+	}
+	return updates, nil
+}
+
+func (b *TelegramBot) SetWebhook(ctx context.Context, url, secret string) error {
+	params := map[string]interface{}{
+		"url":             url,
+		"allowed_updates": []string{"message", "callback_query"},
+	}
+	if secret != "" {
+		params["secret_token"] = secret
+	}
+	return b.call(ctx, "setWebhook", params, nil)
+}
+
+func (b *TelegramBot) DeleteWebhook(ctx context.Context) error {
+	return b.call(ctx, "deleteWebhook", map[string]interface{}{}, nil)
+}
+
+// ParseTelegramUpdate decodes the body of a Telegram webhook request.
+func ParseTelegramUpdate(body []byte) (Update, error) {
+	var u tgUpdate
+	if err := json.Unmarshal(body, &u); err != nil {
+		return Update{}, err
+	}
+	return u.toUpdate(), nil
+}
+
+func (u tgUpdate) toUpdate() Update {
+	out := Update{ID: u.UpdateID}
+	switch {
+	case u.Message != nil:
+		out.ChatID = u.Message.Chat.ID
+		out.Private = u.Message.Chat.Type == "private"
+		out.Text = u.Message.Text
+		if u.Message.From != nil {
+			out.FromID = u.Message.From.ID
+			out.Username = u.Message.From.Username
+		}
+	case u.CallbackQuery != nil:
+		out.FromID = u.CallbackQuery.From.ID
+		out.Username = u.CallbackQuery.From.Username
+		out.CallbackID = u.CallbackQuery.ID
+		out.CallbackData = u.CallbackQuery.Data
+		if u.CallbackQuery.Message != nil {
+			out.ChatID = u.CallbackQuery.Message.Chat.ID
+			out.Private = u.CallbackQuery.Message.Chat.Type == "private"
+		} else {
+			// Private chats share the user's ID.
+			out.ChatID = u.CallbackQuery.From.ID
+			out.Private = true
+		}
+	}
+	return out
+}
+
+func (b *TelegramBot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/bot%s/%s", b.apiURL, b.token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var out tgResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("telegram %s: %s: %w", method, resp.Status, err)
+	}
+	if !out.OK {
+		return fmt.Errorf("telegram %s: %s", method, out.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(out.Result, result)
+	}
+	return nil
+}
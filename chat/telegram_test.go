@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTelegramUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Update
+	}{
+		{
+			"private message",
+			`{"update_id":1,"message":{"message_id":5,"from":{"id":42,"username":"ali"},"chat":{"id":42,"type":"private"},"text":"/link ABC"}}`,
+			Update{ID: 1, ChatID: 42, FromID: 42, Username: "ali", Private: true, Text: "/link ABC"},
+		},
+		{
+			"group message",
+			`{"update_id":2,"message":{"message_id":6,"from":{"id":42},"chat":{"id":-100,"type":"supergroup"},"text":"/pending"}}`,
+			Update{ID: 2, ChatID: -100, FromID: 42, Text: "/pending"},
+		},
+		{
+			"message without sender",
+			`{"update_id":3,"message":{"message_id":7,"chat":{"id":-100,"type":"channel"},"text":"hi"}}`,
+			Update{ID: 3, ChatID: -100, Text: "hi"},
+		},
+		{
+			"button in a group",
+			`{"update_id":4,"callback_query":{"id":"cb1","from":{"id":7,"username":"sara"},"message":{"message_id":8,"chat":{"id":-100,"type":"group"}},"data":"approve:9"}}`,
+			Update{ID: 4, ChatID: -100, FromID: 7, Username: "sara", CallbackID: "cb1", CallbackData: "approve:9"},
+		},
+		{
+			"button without its message",
+			`{"update_id":5,"callback_query":{"id":"cb2","from":{"id":7},"data":"apply:3"}}`,
+			Update{ID: 5, ChatID: 7, FromID: 7, Private: true, CallbackID: "cb2", CallbackData: "apply:3"},
+		},
+		{
+			"other update",
+			`{"update_id":6}`,
+			Update{ID: 6},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseTelegramUpdate([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ParseTelegramUpdate([]byte(`{"update_id":`)); err == nil {
+		t.Error("truncated body parsed without an error")
+	}
+}
+
+func TestTelegramBotAgainstFake(t *testing.T) {
+	fake := NewFakeTelegram()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	bot := NewTelegramBot(server.URL+"/", "token")
+	ctx := context.Background()
+
+	err := bot.Send(ctx, Message{ChatID: 42, Text: "Open slots", Buttons: [][]Button{
+		{{Text: "Apply", Data: "apply:1"}},
+		{{Text: "Approve", Data: "approve:2"}, {Text: "Reject", Data: "reject:2"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := fake.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	var params struct {
+		ChatID      int64  `json:"chat_id"`
+		Text        string `json:"text"`
+		ReplyMarkup struct {
+			InlineKeyboard [][]tgInlineButton `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+	if err := json.Unmarshal(sent[0], &params); err != nil {
+		t.Fatal(err)
+	}
+	wantKeyboard := [][]tgInlineButton{
+		{{Text: "Apply", CallbackData: "apply:1"}},
+		{{Text: "Approve", CallbackData: "approve:2"}, {Text: "Reject", CallbackData: "reject:2"}},
+	}
+	if params.ChatID != 42 || params.Text != "Open slots" || !reflect.DeepEqual(params.ReplyMarkup.InlineKeyboard, wantKeyboard) {
+		t.Errorf("sendMessage params %s", sent[0])
+	}
+
+	for _, raw := range []string{
+		`{"message":{"message_id":1,"from":{"id":42},"chat":{"id":42,"type":"private"},"text":"/slots"}}`,
+		`{"callback_query":{"id":"cb","from":{"id":42},"data":"apply:1"}}`,
+	} {
+		if err := fake.Push(json.RawMessage(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updates, err := bot.GetUpdates(ctx, 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 || updates[0].ID != 1 || updates[0].Text != "/slots" || !updates[0].Private || updates[1].CallbackData != "apply:1" {
+		t.Fatalf("GetUpdates = %+v", updates)
+	}
+	if err := bot.AnswerCallback(ctx, updates[1].CallbackID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A higher offset confirms the earlier updates.
+	updates, err = bot.GetUpdates(ctx, updates[1].ID+1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("confirmed updates came back: %+v", updates)
+	}
+
+	if err := bot.SetWebhook(ctx, "https://example.com/hook", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.DeleteWebhook(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.call(ctx, "noSuchMethod", map[string]interface{}{}, nil); err == nil {
+		t.Error("unknown method succeeded")
+	}
+}
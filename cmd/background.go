@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"shiftdony/config"
+	"shiftdony/jobs"
+	"shiftdony/repository"
+	"shiftdony/routes"
+
+	"github.com/uptrace/bun"
+)
+
+// newScheduler builds the job scheduler with every background job of the
+// application registered.
+func newScheduler(db *bun.DB, svc *routes.Services) (*jobs.Scheduler, error) {
+	sched := jobs.NewScheduler(repository.NewJobRepository(db))
+	cfg := config.C.Jobs
+
+	registry := []jobs.Job{
+		{
+			Name:        "escalate-stale-requests",
+			Description: "Escalate requests pending longer than the review SLA",
+			Schedule:    "@every " + config.C.Review.EscalationInterval.String(),
+			Run: func(ctx context.Context) error {
+				_, err := svc.Overtime.EscalateStaleRequests(ctx, config.C.Review.EscalationSLA)
+				return err
+			},
+		},
+		{
+			Name:        "advance-slot-statuses",
+			Description: "Open, close, start and complete slots on the wall clock",
+			Schedule:    "@every " + config.C.Slots.LifecycleInterval.String(),
+			Run: func(ctx context.Context) error {
+				_, err := svc.Overtime.AdvanceSlotStatuses(ctx)
+				return err
+			},
+		},
+		{
+			Name:        "expire-stale-requests",
+			Description: "Expire requests still pending when their slot starts",
+			Schedule:    cfg.ExpireRequestsSchedule,
+			Run: func(ctx context.Context) error {
+				_, err := svc.Overtime.ExpireStalePendingRequests(ctx)
+				return err
+			},
+		},
+		{
+			Name:        "dispatch-webhooks",
+			Description: "Fan out outbox events and deliver due webhooks",
+			Schedule:    config.C.Webhooks.DispatchSchedule,
+			Run:         svc.Webhook.Dispatch,
+		},
+		{
+			Name:        "dispatch-notifications",
+			Description: "Send notifications for new outbox events",
+			Schedule:    config.C.Notify.DispatchSchedule,
+			Run:         svc.Notification.ProcessEvents,
+		},
+		{
+			Name:        "send-reminders",
+			Description: "Schedule reminders for approved requests and send due ones",
+			Schedule:    config.C.Reminders.Schedule,
+			Run:         svc.Reminder.Process,
+		},
+		{
+			Name:        "prune-job-runs",
+			Description: "Delete finished job runs past their retention",
+			Schedule:    cfg.PruneRunsSchedule,
+			Run: func(ctx context.Context) error {
+				_, err := sched.PruneRuns(ctx, cfg.RunRetention)
+				return err
+			},
+		},
+		{
+			Name:        "prune-notifications",
+			Description: "Delete inbox notifications past their retention",
+			Schedule:    config.C.Notify.PruneSchedule,
+			Run: func(ctx context.Context) error {
+				_, err := svc.Notification.PruneNotifications(ctx)
+				return err
+			},
+		},
+	}
+
+	if config.C.Analytics.MaterializedViews {
+		registry = append(registry, jobs.Job{
+			Name:        "refresh-analytics",
+			Description: "Refresh the materialized views behind analytics",
+			Schedule:    config.C.Analytics.RefreshSchedule,
+			Run:         svc.Analytics.RefreshViews,
+		})
+	}
+
+	for _, job := range registry {
+		job.MaxAttempts = cfg.MaxAttempts
+		job.Backoff = cfg.Backoff
+		if err := sched.Register(job); err != nil {
+			return nil, err
+		}
+	}
+	return sched, nil
+}
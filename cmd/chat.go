@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"shiftdony/chat"
+
+	"github.com/spf13/cobra"
+)
+
+func Chat() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "chat bot tools",
+	}
+
+	var addr string
+	fake := &cobra.Command{
+		Use:   "fake-telegram",
+		Short: "run an in-memory stand-in for the Telegram Bot API",
+		Long: `Runs an in-memory stand-in for the Telegram Bot API. Set CHAT__API_URL to
+its address to use it. POST Telegram update JSON to /fake/updates to talk to
+the bot, and GET /fake/sent to see its replies.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Printf("fake telegram listening on %s\n", addr)
+			return http.ListenAndServe(addr, chat.NewFakeTelegram())
+		},
+	}
+	fake.Flags().StringVar(&addr, "addr", ":8081", "address to listen on")
+	cmd.AddCommand(fake)
+
+	return cmd
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"shiftdony/config"
+	postgres "shiftdony/database"
+	"shiftdony/routes"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func Jobs() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "inspect and run background jobs",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list background jobs with their schedule and last run",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listJobs(cmd.Context())
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "run <name>",
+		Short: "run a background job now",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runJob(cmd.Context(), args[0])
+		},
+	})
+
+	return cmd
+}
+
+func listJobs(ctx context.Context) error {
+	db, err := postgres.NewPostgres(config.C.Postgres)
+	if err != nil {
+		return err
+	}
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+
+	svc, err := routes.NewServices(db.DB())
+	if err != nil {
+		return err
+	}
+	sched, err := newScheduler(db.DB(), svc)
+	if err != nil {
+		return err
+	}
+	latest, err := sched.LatestRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tNEXT RUN\tLAST RUN\tSTATUS\tDESCRIPTION")
+	now := time.Now()
+	for _, job := range sched.Jobs() {
+		lastRun, status := "-", "-"
+		if run, ok := latest[job.Name]; ok {
+			lastRun = run.StartedAt.Format(time.RFC3339)
+			status = run.Status
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.Name, job.Schedule, job.NextRun(now).Format(time.RFC3339), lastRun, status, job.Description)
+	}
+	return w.Flush()
+}
+
+func runJob(ctx context.Context, name string) error {
+	db, err := postgres.NewPostgres(config.C.Postgres)
+	if err != nil {
+		return err
+	}
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+
+	svc, err := routes.NewServices(db.DB())
+	if err != nil {
+		return err
+	}
+	sched, err := newScheduler(db.DB(), svc)
+	if err != nil {
+		return err
+	}
+	if err := sched.RunNow(ctx, name); err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	fmt.Printf("job %s finished\n", name)
+	return nil
+}
@@ -2,11 +2,16 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
 	"shiftdony/config"
 	postgres "shiftdony/database"
 	"shiftdony/routes"
 
 	log "shiftdony/logs"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -40,13 +45,54 @@ func start() {
 		log.Error(op, "cannot connect to postgres", err)
 		return
 	}
-	db.Migrate(ctx)
+	if err := db.Migrate(ctx); err != nil {
+		log.Error(op, "cannot migrate the database", err)
+		return
+	}
 
-	
-	router := routes.SetupRouter(db.DB()) 
-	if err := router.Run(":8080"); err != nil {
-		log.Gl.Fatal("Failed to run server: " + err.Error())
+	svc, err := routes.NewServices(db.DB())
+	if err != nil {
+		log.Error(op, "cannot set up services", err)
+		return
 	}
+	// serverCtx lives until the process is told to stop.
+	serverCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Every replica relays outbox events to its own stream clients.
+	go svc.Stream.Run(serverCtx)
+
+	if cfg := config.C.Chat; cfg.Enabled {
+		if cfg.Mode == "webhook" {
+			if err := svc.ChatBot.SetupWebhook(ctx); err != nil {
+				log.Error(op, "cannot register chat webhook", err)
+			}
+		} else {
+			go svc.ChatBot.Poll(serverCtx)
+		}
+	}
+
+	if config.C.Jobs.Enabled {
+		sched, err := newScheduler(db.DB(), svc)
+		if err != nil {
+			log.Error(op, "cannot set up background jobs", err)
+			return
+		}
+		go sched.Start(serverCtx)
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: routes.SetupRouter(svc)}
+	go func() {
+		<-serverCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(op, "cannot shut down the server cleanly", err)
+		}
+	}()
 	log.Gl.Info("Starting shiftdoni web server...")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Gl.Fatal("Failed to run server: " + err.Error())
+	}
 
 }
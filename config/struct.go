@@ -1,8 +1,23 @@
 package config
 
+import "time"
+
 type Config struct {
-	Postgres Postgres `json:"postgres"`
-	JWT      JWT      `json:"jwt"`
+	Postgres  Postgres  `json:"postgres"`
+	JWT       JWT       `json:"jwt"`
+	Review    Review    `json:"review"`
+	Slots     Slots     `json:"slots"`
+	Jobs      Jobs      `json:"jobs"`
+	Webhooks  Webhooks  `json:"webhooks"`
+	Notify    Notify    `json:"notify"`
+	Stream    Stream    `json:"stream"`
+	Chat      Chat      `json:"chat"`
+	Reminders Reminders `json:"reminders"`
+	Calendar  Calendar  `json:"calendar"`
+	Holidays  Holidays  `json:"holidays"`
+	Dates     Dates     `json:"dates"`
+	Analytics Analytics `json:"analytics"`
+	Fairness  Fairness  `json:"fairness"`
 }
 
 type Postgres struct {
@@ -16,5 +31,161 @@ type Postgres struct {
 }
 
 type JWT struct {
-	Secret 	string `json:"secret" validate:"required"`
-}
\ No newline at end of file
+	Secret string `json:"secret" validate:"required"`
+}
+
+type Review struct {
+	RequireRejectionReason bool `json:"require_rejection_reason" default:"true"`
+	RequireApprovalReason  bool `json:"require_approval_reason" default:"false"`
+
+	// EscalationSLA is how long a request may stay pending before it is
+	// escalated to the next manager up.
+	EscalationSLA      time.Duration `json:"escalation_sla" default:"48h"`
+	EscalationInterval time.Duration `json:"escalation_interval" default:"5m"`
+}
+
+type Slots struct {
+	// LifecycleInterval is how often slot statuses are advanced against the
+	// wall clock.
+	LifecycleInterval time.Duration `json:"lifecycle_interval" default:"1m"`
+	// MaxDuration is the longest a slot may run; zero means no limit.
+	MaxDuration time.Duration `json:"max_duration" default:"24h"`
+}
+
+type Jobs struct {
+	Enabled     bool          `json:"enabled" default:"true"`
+	MaxAttempts int           `json:"max_attempts" default:"3"`
+	Backoff     time.Duration `json:"backoff" default:"10s"`
+
+	ExpireRequestsSchedule string `json:"expire_requests_schedule" default:"*/10 * * * *"`
+
+	// Finished runs are kept for RunRetention; the latest run of every job
+	// is always kept.
+	RunRetention      time.Duration `json:"run_retention" default:"168h"`
+	PruneRunsSchedule string        `json:"prune_runs_schedule" default:"@hourly"`
+}
+
+type Webhooks struct {
+	DispatchSchedule string        `json:"dispatch_schedule" default:"@every 5s"`
+	Timeout          time.Duration `json:"timeout" default:"10s"`
+	MaxAttempts      int           `json:"max_attempts" default:"8"`
+	BaseBackoff      time.Duration `json:"base_backoff" default:"30s"`
+	MaxBackoff       time.Duration `json:"max_backoff" default:"6h"`
+	BatchSize        int           `json:"batch_size" default:"100"`
+}
+
+type Notify struct {
+	// BaseURL is the public address of the API, used for links in
+	// notifications.
+	BaseURL          string        `json:"base_url" default:"http://localhost:8080"`
+	DefaultLocale    string        `json:"default_locale" default:"en"`
+	DispatchSchedule string        `json:"dispatch_schedule" default:"@every 10s"`
+	BatchSize        int           `json:"batch_size" default:"100"`
+	PasswordResetTTL time.Duration `json:"password_reset_ttl" default:"1h"`
+
+	// Read inbox entries are kept for InboxReadRetention, unread ones for
+	// InboxRetention.
+	InboxReadRetention time.Duration `json:"inbox_read_retention" default:"720h"`
+	InboxRetention     time.Duration `json:"inbox_retention" default:"2160h"`
+	PruneSchedule      string        `json:"prune_schedule" default:"@daily"`
+
+	SMTP SMTP `json:"smtp"`
+}
+
+type SMTP struct {
+	Enabled  bool          `json:"enabled" default:"false"`
+	Host     string        `json:"host" default:"localhost"`
+	Port     string        `json:"port" default:"1025"`
+	Username string        `json:"username"`
+	Password string        `json:"password"`
+	From     string        `json:"from" default:"Shiftdoni <no-reply@shiftdoni.local>"`
+	Timeout  time.Duration `json:"timeout" default:"10s"`
+}
+
+type Stream struct {
+	// Heartbeat is how often an idle stream sends a comment so proxies keep
+	// the connection open.
+	Heartbeat  time.Duration `json:"heartbeat" default:"15s"`
+	BufferSize int           `json:"buffer_size" default:"64"`
+	// ReplayLimit is the most events replayed to a resuming client, and
+	// ReplayScanLimit the most outbox events read to find them; past
+	// either the client gets a reset event.
+	ReplayLimit     int `json:"replay_limit" default:"500"`
+	ReplayScanLimit int `json:"replay_scan_limit" default:"10000"`
+	// TicketTTL is how long a stream ticket can be used to connect.
+	TicketTTL time.Duration `json:"ticket_ttl" default:"30s"`
+}
+
+type Chat struct {
+	Enabled  bool   `json:"enabled" default:"false"`
+	Provider string `json:"provider" default:"telegram"`
+	Token    string `json:"token"`
+	// APIURL can point at a stand-in such as chat.FakeTelegram.
+	APIURL string `json:"api_url" default:"https://api.telegram.org"`
+	// Mode is "polling" or "webhook". In webhook mode the provider calls
+	// WebhookURL, which must route to /api/chat/telegram/webhook, with
+	// WebhookSecret, which is then required.
+	Mode          string        `json:"mode" default:"polling"`
+	WebhookURL    string        `json:"webhook_url"`
+	WebhookSecret string        `json:"webhook_secret"`
+	PollTimeout   time.Duration `json:"poll_timeout" default:"30s"`
+	LinkCodeTTL   time.Duration `json:"link_code_ttl" default:"10m"`
+}
+
+type Reminders struct {
+	// Offsets lists how long before a slot starts its approved applicants
+	// are reminded, e.g. "24h,1h".
+	Offsets   string `json:"offsets" default:"24h,1h"`
+	Schedule  string `json:"schedule" default:"@every 1m"`
+	BatchSize int    `json:"batch_size" default:"200"`
+	// MaxAttempts is how often a reminder is tried before it is marked
+	// failed; the wait between attempts starts at RetryBackoff and
+	// doubles. A claim older than ClaimTimeout is taken over, as its
+	// sender is assumed dead.
+	MaxAttempts  int           `json:"max_attempts" default:"5"`
+	RetryBackoff time.Duration `json:"retry_backoff" default:"1m"`
+	ClaimTimeout time.Duration `json:"claim_timeout" default:"10m"`
+}
+
+type Calendar struct {
+	// UIDDomain is the right-hand side of event UIDs. Changing it makes
+	// subscribed calendars see every event as new.
+	UIDDomain string `json:"uid_domain" default:"shiftdoni"`
+	// History is how long ended slots stay in the feeds.
+	History         time.Duration `json:"history" default:"2160h"`
+	RefreshInterval time.Duration `json:"refresh_interval" default:"1h"`
+}
+
+type Holidays struct {
+	// Weekend applies while no default holiday calendar exists, and to new
+	// calendars that do not set their own. Such calendars use the
+	// organization time zone, Dates.Timezone.
+	Weekend string `json:"weekend" default:"thursday,friday"`
+	// MaxImportSize limits uploaded ICS files, in bytes.
+	MaxImportSize int64 `json:"max_import_size" default:"1048576"`
+}
+
+type Dates struct {
+	// DefaultCalendar is "gregorian" or "jalali", for users who did not
+	// pick one.
+	DefaultCalendar string `json:"default_calendar" default:"gregorian"`
+	// Timezone is the organization's IANA time zone. Times are shown in
+	// it, and input without an offset is read in it, unless the user or
+	// their team picked another zone. Pay periods follow it too.
+	Timezone string `json:"timezone" default:"UTC"`
+}
+
+type Analytics struct {
+	// MaterializedViews serves hour totals from a materialized view that
+	// the refresh-analytics job refreshes on RefreshSchedule, instead of
+	// aggregating the requests on every call. Totals then lag by up to one
+	// refresh.
+	MaterializedViews bool   `json:"materialized_views" default:"false"`
+	RefreshSchedule   string `json:"refresh_schedule" default:"@every 15m"`
+}
+
+type Fairness struct {
+	// Window is how far back fairness reports and the recent hours shown
+	// to reviewers look, ending now.
+	Window time.Duration `json:"window" default:"2160h"`
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
+	"reflect"
 	"shiftdony/config"
 	log "shiftdony/logs"
 	"shiftdony/models"
+	"time"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
@@ -21,14 +24,19 @@ type Postgres struct {
 }
 
 func NewPostgres(cfg config.Postgres) (*Postgres, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+	// The session time zone only decides how timestamptz values are shown
+	// in SQL, e.g. by date_trunc; instants read and written are unaffected.
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid postgres time zone %q: %w", cfg.Timezone, err)
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s&TimeZone=%s",
 		cfg.Username,
 		cfg.Password,
 		cfg.Host,
 		cfg.Port,
 		cfg.DB,
 		cfg.SSLMode,
-		// cfg.Timezone, // TODO: Timezone should be specified.
+		url.QueryEscape(cfg.Timezone),
 	)
 
 	// dsn := "host=localhost user=myuser password=mypass dbname=mydb port=5432 sslmode=disable"
@@ -49,48 +57,230 @@ func NewPostgres(cfg config.Postgres) (*Postgres, error) {
 	}, nil
 }
 
-func (pg *Postgres) Migrate(ctx context.Context) {
+func (pg *Postgres) Migrate(ctx context.Context) error {
 	pg.createTables(ctx)
+	if err := pg.convertTimestamps(ctx); err != nil {
+		return fmt.Errorf("cannot convert timestamp columns: %w", err)
+	}
+	pg.createViews(ctx)
+	return nil
 }
 
 func (p *Postgres) DB() *bun.DB {
 	return p.db
 }
-func (pg *Postgres) createTables(ctx context.Context) error {
-	// Create User table
-	_, err := pg.db.NewCreateTable().
-		Model((*models.User)(nil)).
-		IfNotExists().
-		Exec(ctx)
 
-	if err != nil {
-		log.Gl.Fatal(err.Error())
+// tables are the models of the app's tables.
+var tables = []interface{}{
+	(*models.User)(nil),
+	(*models.Team)(nil),
+	(*models.OvertimeSlot)(nil),
+	(*models.OvertimeRequest)(nil),
+	(*models.ApprovalChain)(nil),
+	(*models.ApprovalStep)(nil),
+	(*models.RequestApproval)(nil),
+	(*models.Delegation)(nil),
+	(*models.RequestComment)(nil),
+	(*models.JobRun)(nil),
+	(*models.OutboxEvent)(nil),
+	(*models.OutboxConsumer)(nil),
+	(*models.OutboxConsumption)(nil),
+	(*models.WebhookSubscription)(nil),
+	(*models.WebhookDelivery)(nil),
+	(*models.NotificationPreference)(nil),
+	(*models.PasswordReset)(nil),
+	(*models.Notification)(nil),
+	(*models.ChatLink)(nil),
+	(*models.ChatLinkCode)(nil),
+	(*models.Reminder)(nil),
+	(*models.CalendarToken)(nil),
+	(*models.HolidayCalendar)(nil),
+	(*models.Holiday)(nil),
+}
+
+func (pg *Postgres) createTables(ctx context.Context) error {
+	for _, model := range tables {
+		_, err := pg.db.NewCreateTable().
+			Model(model).
+			IfNotExists().
+			Exec(ctx)
+		if err != nil {
+			log.Gl.Fatal(err.Error())
+		}
 	}
 
-	// Create Team table
-	_, err = pg.db.NewCreateTable().
-		Model((*models.Team)(nil)).
-		IfNotExists().
-		Exec(ctx)
-	if err != nil {
-		log.Gl.Fatal(err.Error())
+	// Columns added after the first release. CREATE TABLE IF NOT EXISTS does
+	// not touch existing tables, so they are added here.
+	for _, stmt := range alterStatements {
+		if _, err := pg.db.ExecContext(ctx, stmt); err != nil {
+			log.Gl.Fatal(err.Error())
+		}
 	}
 
-	_, err = pg.db.NewCreateTable().
-		Model((*models.OvertimeSlot)(nil)).
-		IfNotExists().
-		Exec(ctx)
-	if err != nil {
-		log.Gl.Fatal(err.Error())
+	return nil
+}
+
+// convertTimestamps turns the app's time columns that early releases
+// created as timestamp without time zone into timestamptz. Those releases
+// wrote times in UTC, so the values are read as UTC. Converted columns are
+// not found again, so this runs once per column, and all columns convert
+// in one transaction.
+func (pg *Postgres) convertTimestamps(ctx context.Context) error {
+	names := make([]string, 0, len(tables))
+	timeColumns := make(map[string]bool)
+	for _, model := range tables {
+		table := pg.db.Table(reflect.TypeOf(model).Elem())
+		names = append(names, table.Name)
+		for _, field := range table.Fields {
+			if field.IndirectType == reflect.TypeOf(time.Time{}) {
+				timeColumns[table.Name+"."+field.Name] = true
+			}
+		}
 	}
 
-	_, err = pg.db.NewCreateTable().
-		Model((*models.OvertimeRequest)(nil)).
-		IfNotExists().
-		Exec(ctx)
+	return pg.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var columns []struct {
+			Table  string `bun:"table_name"`
+			Column string `bun:"column_name"`
+		}
+		err := tx.NewSelect().
+			TableExpr("information_schema.columns").
+			Column("table_name", "column_name").
+			Where("table_schema = current_schema()").
+			Where("table_name IN (?)", bun.In(names)).
+			Where("data_type = 'timestamp without time zone'").
+			Scan(ctx, &columns)
+		if err != nil {
+			return err
+		}
+		for _, c := range columns {
+			if !timeColumns[c.Table+"."+c.Column] {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `ALTER TABLE ? ALTER COLUMN ? TYPE TIMESTAMPTZ USING ? AT TIME ZONE 'UTC'`,
+				bun.Ident(c.Table), bun.Ident(c.Column), bun.Ident(c.Column))
+			if err != nil {
+				return err
+			}
+			log.Gl.Info("converted column to timestamptz: " + c.Table + "." + c.Column)
+		}
+		return nil
+	})
+}
+
+// createViews creates the materialized views analytics reads when they are
+// enabled. The daily hours view counts days in the organization time zone,
+// which its comment records, so it is rebuilt when the zone changes.
+func (pg *Postgres) createViews(ctx context.Context) {
+	if !config.C.Analytics.MaterializedViews {
+		return
+	}
+	zone := config.C.Dates.Timezone
+	var comment sql.NullString
+	err := pg.db.NewRaw("SELECT obj_description(to_regclass(?), 'pg_class')", models.DailyHoursView).Scan(ctx, &comment)
 	if err != nil {
 		log.Gl.Fatal(err.Error())
 	}
+	if comment.Valid && comment.String == zone {
+		return
+	}
+	view := bun.Ident(models.DailyHoursView)
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DROP MATERIALIZED VIEW IF EXISTS ?`, []interface{}{view}},
+		{`CREATE MATERIALIZED VIEW ? AS
+			SELECT (slot.start_time AT TIME ZONE ?)::date AS day, r.user_id, u.team_id,
+				COUNT(*) AS requests,
+				SUM(EXTRACT(EPOCH FROM (slot.end_time - slot.start_time)) / 3600) AS hours
+			FROM overtime_requests AS r
+			JOIN overtime_slots AS slot ON slot.id = r.slot_id
+			JOIN users AS u ON u.id = r.user_id
+			WHERE r.status = ?
+			GROUP BY 1, 2, 3`, []interface{}{view, zone, models.RequestStatusApproved}},
+		// REFRESH ... CONCURRENTLY needs a unique index.
+		{`CREATE UNIQUE INDEX ? ON ? (day, user_id)`, []interface{}{bun.Ident(models.DailyHoursView + "_idx"), view}},
+		{`COMMENT ON MATERIALIZED VIEW ? IS ?`, []interface{}{view, zone}},
+	}
+	for _, stmt := range statements {
+		if _, err := pg.db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			log.Gl.Fatal(err.Error())
+		}
+	}
+	log.Gl.Info("created materialized view " + models.DailyHoursView + " in time zone " + zone)
+}
 
-	return nil
+var alterStatements = []string{
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS is_holiday BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS chain_id BIGINT`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS current_step BIGINT NOT NULL DEFAULT 0`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS request_approvals_decision_idx ON request_approvals (request_id, step_position, approver_id)`,
+	`ALTER TABLE teams ADD COLUMN IF NOT EXISTS parent_id BIGINT`,
+	`ALTER TABLE request_approvals ADD COLUMN IF NOT EXISTS on_behalf_of BIGINT`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS escalated_to BIGINT`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS escalation_level BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS decision_reason VARCHAR`,
+	`ALTER TABLE request_approvals ADD COLUMN IF NOT EXISTS reason VARCHAR`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS allocation_strategy VARCHAR NOT NULL DEFAULT 'manual'`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS allocation_seed BIGINT`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS waitlist_size BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS allocated_at TIMESTAMPTZ`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS application_opens_at TIMESTAMPTZ`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS application_closes_at TIMESTAMPTZ`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS cancellation_cutoff TIMESTAMPTZ`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS waitlist_position BIGINT NOT NULL DEFAULT 0`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS job_runs_activation_idx ON job_runs (job_name, scheduled_for)`,
+	`CREATE INDEX IF NOT EXISTS job_runs_started_idx ON job_runs (job_name, started_at DESC)`,
+	`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at)`,
+	// Consumers that ran before outbox_consumers existed start at the
+	// first event they handled.
+	`INSERT INTO outbox_consumers (name, started_at)
+		SELECT oc.consumer, MIN(oe.created_at) FROM outbox_consumptions AS oc
+		JOIN outbox_events AS oe ON oe.id = oc.event_id
+		GROUP BY oc.consumer
+		ON CONFLICT DO NOTHING`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email)) WHERE email <> ''`,
+	`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS email_review_pending BOOLEAN NOT NULL DEFAULT true`,
+	`CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, id DESC)`,
+	`CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL`,
+	`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS chat_enabled BOOLEAN NOT NULL DEFAULT true`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS chat_links_user_idx ON chat_links (provider, user_id)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS chat_links_chat_idx ON chat_links (provider, chat_id)`,
+	`ALTER TABLE chat_links ADD COLUMN IF NOT EXISTS sender_id BIGINT NOT NULL DEFAULT 0`,
+	// Approved requests on slots cancelled before the cancelled status
+	// existed.
+	`UPDATE overtime_requests SET status = 'cancelled'
+		WHERE status = 'approved' AND slot_id IN (SELECT id FROM overtime_slots WHERE status = 'cancelled')`,
+	// Telegram private chats have the ID of their user; links made in
+	// groups cannot tell who linked them and have to be made again.
+	`UPDATE chat_links SET sender_id = chat_id WHERE sender_id = 0 AND provider = 'telegram' AND chat_id > 0`,
+	`DELETE FROM chat_links WHERE sender_id = 0 AND provider = 'telegram'`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS reminders_request_offset_idx ON reminders (request_id, offset_minutes)`,
+	`CREATE INDEX IF NOT EXISTS reminders_due_idx ON reminders (due_at) WHERE status = 'scheduled'`,
+	`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS retry_at TIMESTAMPTZ`,
+	`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ`,
+	`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS delivered VARCHAR[]`,
+	`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS last_error VARCHAR NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS reminders_sending_idx ON reminders (claimed_at) WHERE status = 'sending'`,
+	`ALTER TABLE overtime_slots ADD COLUMN IF NOT EXISTS sequence BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS sequence BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE teams ADD COLUMN IF NOT EXISTS calendar_id BIGINT`,
+	`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS calendar VARCHAR NOT NULL DEFAULT 'gregorian'`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS holidays_calendar_date_idx ON holidays (calendar_id, date)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS holiday_calendars_default_idx ON holiday_calendars (is_default) WHERE is_default`,
+	`ALTER TABLE teams ADD COLUMN IF NOT EXISTS timezone VARCHAR NOT NULL DEFAULT ''`,
+	`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS timezone VARCHAR NOT NULL DEFAULT ''`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ`,
+	`ALTER TABLE overtime_requests ADD COLUMN IF NOT EXISTS attendance VARCHAR NOT NULL DEFAULT ''`,
+	// Requests decided through approval steps before decided_at existed
+	// take the time of their last decision.
+	`UPDATE overtime_requests AS r SET decided_at = a.decided_at
+		FROM (SELECT request_id, MAX(decided_at) AS decided_at FROM request_approvals GROUP BY request_id) AS a
+		WHERE a.request_id = r.id AND r.decided_at IS NULL AND r.status IN ('approved', 'rejected')`,
+	`CREATE INDEX IF NOT EXISTS overtime_requests_slot_idx ON overtime_requests (slot_id, status)`,
+	`CREATE INDEX IF NOT EXISTS overtime_slots_start_idx ON overtime_slots (start_time)`,
 }
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"shiftdony/models"
+	"time"
 )
 
 // UserRepository defines the methods for interacting with user data.
@@ -10,22 +11,260 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByPersonnelCode(ctx context.Context, code string) (*models.User, error)
 	GetUserByID(ctx context.Context, userID int64) (*models.User, error)
+	GetUsersByIDs(ctx context.Context, userIDs []int64) ([]models.User, error)
+	GetUsersByRole(ctx context.Context, roles ...string) ([]models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	// EmailInUse reports whether a user other than exceptUserID has email,
+	// ignoring case.
+	EmailInUse(ctx context.Context, email string, exceptUserID int64) (bool, error)
 }
 
 // OvertimeRepository defines the methods for interacting with overtime data.
 
 type OvertimeRepository interface {
 	CreateOvertimeSlot(ctx context.Context, slot *models.OvertimeSlot) error
-	GetOvertimeSlots(ctx context.Context) ([]models.OvertimeSlot, error)
+	// ListOvertimeSlots returns a page of the slots matching filter.
+	ListOvertimeSlots(ctx context.Context, filter models.SlotFilter, opts models.ListOptions) ([]models.OvertimeSlot, *models.PageInfo, error)
 	GetAvailableOvertimeSlots(ctx context.Context) ([]models.OvertimeSlot, error)
 	GetOvertimeSlotByID(ctx context.Context, slotID int64) (*models.OvertimeSlot, error)
+	GetSlotByID(ctx context.Context, slotID int64) (*models.OvertimeSlot, error)
+	LockOvertimeSlot(ctx context.Context, slotID int64) (*models.OvertimeSlot, error)
 	UserHasPendingRequestForSlot(ctx context.Context, userID, slotID int64) (bool, error)
 	CountApprovedRequestsForSlot(ctx context.Context, slotID int64) (int, error)
 	CreateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) error
+	// UpdateOvertimeSlot saves slot and increments its Sequence.
 	UpdateOvertimeSlot(ctx context.Context, slot *models.OvertimeSlot) error
-	GetMyOvertimeRequests(ctx context.Context, userID int64) ([]models.OvertimeRequest, error)
-	GetAllOvertimeRequests(ctx context.Context) ([]models.OvertimeRequest, error)
+	// ListOvertimeRequests returns a page of the requests matching filter,
+	// with their slots and applicants.
+	ListOvertimeRequests(ctx context.Context, filter models.RequestFilter, opts models.ListOptions) ([]models.OvertimeRequest, *models.PageInfo, error)
+	// EachOvertimeRequest streams the requests matching filter to fn, see
+	// ListOvertimeRequests; the request passed to fn is reused.
+	EachOvertimeRequest(ctx context.Context, filter models.RequestFilter, opts models.ListOptions, fn func(*models.OvertimeRequest) error) error
+	// GetOvertimeRequestByID loads a request and locks its row until the
+	// surrounding transaction ends; GetRequestByID only reads it.
 	GetOvertimeRequestByID(ctx context.Context, requestID int64) (*models.OvertimeRequest, error)
+	GetRequestByID(ctx context.Context, requestID int64) (*models.OvertimeRequest, error)
+	// UpdateOvertimeRequest saves req and increments its Sequence.
 	UpdateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) error
-	GetApprovedRequests(ctx context.Context) ([]models.OvertimeRequest, error)
+	// EscalateOvertimeRequest saves the escalation fields of req if it is
+	// still pending, and reports whether it was.
+	EscalateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) (bool, error)
+	GetStalePendingRequests(ctx context.Context, before time.Time) ([]models.OvertimeRequest, error)
+	// GetPendingRequestsForApprover returns up to limit pending requests,
+	// oldest first and with their users, whose current step the user with
+	// approverID and role approves and has not decided yet: requests
+	// escalated to them, steps naming them or their role, and, for
+	// requests on the default chain, defaultRole.
+	GetPendingRequestsForApprover(ctx context.Context, approverID int64, role, defaultRole string, limit int) ([]models.OvertimeRequest, error)
+	GetPendingRequestsForSlot(ctx context.Context, slotID int64) ([]models.OvertimeRequest, error)
+	GetRequestsForSlot(ctx context.Context, slotID int64, statuses ...string) ([]models.OvertimeRequest, error)
+	ExpirePendingRequests(ctx context.Context, slotStartedBefore time.Time, reason string) ([]models.OvertimeRequest, error)
+	GetActiveSlots(ctx context.Context) ([]models.OvertimeSlot, error)
+	// GetSlotsEndingAfter returns the slots in the given statuses ending
+	// after t.
+	GetSlotsEndingAfter(ctx context.Context, t time.Time, statuses ...string) ([]models.OvertimeSlot, error)
+	// GetUserRequestsEndingAfter returns the user's requests in the given
+	// statuses on slots ending after t, with their slots.
+	GetUserRequestsEndingAfter(ctx context.Context, userID int64, t time.Time, statuses ...string) ([]models.OvertimeRequest, error)
+	CountApprovedRequestsBySlot(ctx context.Context, slotIDs []int64) (map[int64]int, error)
+	UpdateSlotStatus(ctx context.Context, slotID int64, status string) error
+	GetFirstWaitlistedRequest(ctx context.Context, slotID int64) (*models.OvertimeRequest, error)
+	GetApprovedHoursByUser(ctx context.Context, userIDs []int64, from, to time.Time) (map[int64]float64, error)
+	// GetApprovedDayParts sums approved overtime on slots starting in
+	// [from, to) per user, day of the slot start in zone and date of the
+	// user's holiday calendar, whose zone is defaultZone for teams without
+	// one.
+	GetApprovedDayParts(ctx context.Context, from, to time.Time, zone, defaultZone string) ([]models.DayPartHours, error)
+	GetLastApprovedSlotStart(ctx context.Context, userIDs []int64, before time.Time) (map[int64]time.Time, error)
+}
+
+// ApprovalRepository defines the methods for interacting with approval chains
+// and the decisions taken on them.
+type ApprovalRepository interface {
+	CreateApprovalChain(ctx context.Context, chain *models.ApprovalChain) error
+	GetApprovalChains(ctx context.Context) ([]models.ApprovalChain, error)
+	GetApprovalChainByID(ctx context.Context, chainID int64) (*models.ApprovalChain, error)
+	CreateRequestApproval(ctx context.Context, approval *models.RequestApproval) error
+	GetRequestApprovals(ctx context.Context, requestID int64) ([]models.RequestApproval, error)
+}
+
+// TeamRepository defines the methods for interacting with team data.
+type TeamRepository interface {
+	GetTeamByID(ctx context.Context, teamID int64) (*models.Team, error)
+	GetTeams(ctx context.Context) ([]models.Team, error)
+	UpdateTeamCalendar(ctx context.Context, teamID int64, calendarID *int64) error
+	UpdateTeamTimezone(ctx context.Context, teamID int64, timezone string) error
+}
+
+// DelegationRepository defines the methods for interacting with review
+// delegations.
+type DelegationRepository interface {
+	CreateDelegation(ctx context.Context, delegation *models.Delegation) error
+	GetDelegationsByManager(ctx context.Context, managerID int64) ([]models.Delegation, error)
+	GetActiveDelegationsForDelegate(ctx context.Context, delegateID int64, at time.Time) ([]models.Delegation, error)
+	RevokeDelegation(ctx context.Context, delegationID, managerID int64, at time.Time) (bool, error)
+}
+
+// CommentRepository defines the methods for interacting with request
+// discussion threads.
+type CommentRepository interface {
+	CreateRequestComment(ctx context.Context, comment *models.RequestComment) error
+	GetRequestComments(ctx context.Context, requestID int64) ([]models.RequestComment, error)
+	GetRequestCommentByID(ctx context.Context, commentID int64) (*models.RequestComment, error)
+}
+
+// JobRepository defines the methods for persisting background job runs and
+// electing the replica that runs a job.
+type JobRepository interface {
+	// CreateJobRun inserts run and reports false when a run for the same
+	// scheduled activation already exists.
+	CreateJobRun(ctx context.Context, run *models.JobRun) (bool, error)
+	UpdateJobRun(ctx context.Context, run *models.JobRun) error
+	GetLatestJobRuns(ctx context.Context) (map[string]models.JobRun, error)
+	// DeleteJobRuns prunes finished runs started before before, except the
+	// latest run of every job.
+	DeleteJobRuns(ctx context.Context, before time.Time) (int, error)
+	// TryAdvisoryLock takes a session level advisory lock on key. The
+	// returned release function must be called when ok is true.
+	TryAdvisoryLock(ctx context.Context, key int64) (release func(), ok bool, err error)
+}
+
+// OutboxRepository defines the methods for writing domain events and
+// letting consumers pick them up.
+type OutboxRepository interface {
+	CreateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	GetOutboxEventByID(ctx context.Context, eventID int64) (*models.OutboxEvent, error)
+	GetOutboxEvents(ctx context.Context, eventType string, beforeID int64, limit int) ([]models.OutboxEvent, error)
+	// GetUnconsumedEvents returns the events consumer has not marked yet,
+	// oldest first. A consumer starts with the events created from its
+	// first call on.
+	GetUnconsumedEvents(ctx context.Context, consumer string, limit int) ([]models.OutboxEvent, error)
+	MarkEventsConsumed(ctx context.Context, consumer string, eventIDs []int64) error
+	// GetOutboxEventsAfter returns events with an ID above afterID, oldest
+	// first.
+	GetOutboxEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.OutboxEvent, error)
+	// ListenOutboxEvents calls handle with the ID of every event committed
+	// from now on, by any replica, until ctx is done.
+	ListenOutboxEvents(ctx context.Context, handle func(eventID int64)) error
+}
+
+// WebhookRepository defines the methods for interacting with webhook
+// subscriptions and their deliveries.
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+	GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetSubscriptionByID(ctx context.Context, subID int64) (*models.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, subID int64) (bool, error)
+	CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	GetDueDeliveries(ctx context.Context, at time.Time, limit int) ([]models.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error)
+	GetDeliveryByID(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// NotificationRepository defines the methods for interacting with
+// notification preferences and password reset tokens.
+type NotificationRepository interface {
+	GetPreferences(ctx context.Context, userIDs []int64) (map[int64]models.NotificationPreference, error)
+	// CreateMissingPreferences inserts the given rows, keeping existing ones.
+	CreateMissingPreferences(ctx context.Context, prefs []models.NotificationPreference) error
+	GetPreferencesByToken(ctx context.Context, token string) (*models.NotificationPreference, error)
+	UpsertPreferences(ctx context.Context, pref *models.NotificationPreference) error
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	GetPasswordResetByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	UpdatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+
+	CreateNotification(ctx context.Context, n *models.Notification) error
+	GetNotifications(ctx context.Context, userID int64, unreadOnly bool, beforeID int64, limit int) ([]models.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID int64) (int, error)
+	// MarkNotificationsRead marks the given notifications of the user read,
+	// or all of them when ids is empty.
+	MarkNotificationsRead(ctx context.Context, userID int64, ids []int64, at time.Time) (int, error)
+	// DeleteNotifications prunes read notifications older than readBefore
+	// and any older than before.
+	DeleteNotifications(ctx context.Context, readBefore, before time.Time) (int, error)
+}
+
+// ChatRepository defines the methods for interacting with chat links.
+type ChatRepository interface {
+	CreateLinkCode(ctx context.Context, code *models.ChatLinkCode) error
+	GetLinkCode(ctx context.Context, codeHash string) (*models.ChatLinkCode, error)
+	UpdateLinkCode(ctx context.Context, code *models.ChatLinkCode) error
+	// SaveChatLink links the user to the chat, replacing any earlier link
+	// of either of them on the provider.
+	SaveChatLink(ctx context.Context, link *models.ChatLink) error
+	DeleteChatLink(ctx context.Context, provider string, userID int64) (bool, error)
+	GetChatLinkByChatID(ctx context.Context, provider string, chatID int64) (*models.ChatLink, error)
+	GetChatLinkByUserID(ctx context.Context, provider string, userID int64) (*models.ChatLink, error)
+}
+
+// ReminderRepository defines the methods for interacting with reminders.
+type ReminderRepository interface {
+	// ScheduleReminders inserts the reminders, rescheduling cancelled ones
+	// and leaving scheduled or sent ones alone.
+	ScheduleReminders(ctx context.Context, reminders []models.Reminder) error
+	CancelRequestReminders(ctx context.Context, requestID int64) error
+	CancelSlotReminders(ctx context.Context, slotID int64) error
+	// ClaimDueReminders marks up to limit reminders as sending and returns
+	// them: scheduled ones due, or due for a retry, by now, and ones whose
+	// claim was taken before staleBefore. Concurrent callers never claim
+	// the same one.
+	ClaimDueReminders(ctx context.Context, now, staleBefore time.Time, limit int) ([]models.Reminder, error)
+	UpdateReminder(ctx context.Context, reminder *models.Reminder) error
+	// GetUnremindedRequests returns approved requests, with their slots, on
+	// slots starting after t that are not cancelled and have no reminders.
+	GetUnremindedRequests(ctx context.Context, t time.Time) ([]models.OvertimeRequest, error)
+}
+
+// CalendarRepository defines the methods for interacting with calendar feed
+// tokens.
+type CalendarRepository interface {
+	// SaveCalendarToken stores the user's token, replacing any earlier one.
+	SaveCalendarToken(ctx context.Context, token *models.CalendarToken) error
+	GetCalendarTokenByHash(ctx context.Context, tokenHash string) (*models.CalendarToken, error)
+	DeleteCalendarToken(ctx context.Context, userID int64) (bool, error)
+}
+
+// HolidayRepository defines the methods for interacting with holiday
+// calendars.
+type HolidayRepository interface {
+	CreateHolidayCalendar(ctx context.Context, calendar *models.HolidayCalendar) error
+	GetHolidayCalendars(ctx context.Context) ([]models.HolidayCalendar, error)
+	GetHolidayCalendarByID(ctx context.Context, calendarID int64) (*models.HolidayCalendar, error)
+	GetDefaultHolidayCalendar(ctx context.Context) (*models.HolidayCalendar, error)
+	UpdateHolidayCalendar(ctx context.Context, calendar *models.HolidayCalendar) error
+	// ClearDefaultHolidayCalendar unsets the default flag of every calendar.
+	ClearDefaultHolidayCalendar(ctx context.Context) error
+	// UpsertHolidays adds the holidays, replacing any on the same date of
+	// the same calendar.
+	UpsertHolidays(ctx context.Context, holidays []models.Holiday) error
+	// GetHolidays returns the calendar's holidays between from and to,
+	// both inclusive and given as YYYY-MM-DD.
+	GetHolidays(ctx context.Context, calendarID int64, from, to string) ([]models.Holiday, error)
+	DeleteHoliday(ctx context.Context, calendarID, holidayID int64) (bool, error)
+}
+
+// AnalyticsRepository defines the aggregations behind the analytics
+// endpoints.
+type AnalyticsRepository interface {
+	// GetDailyHours sums approved overtime per day and per user, team or
+	// nothing (models.GroupBy*); fromView reads the daily hours view.
+	GetDailyHours(ctx context.Context, filter models.AnalyticsFilter, group string, fromView bool) ([]models.DailyTotal, error)
+	GetTopEarners(ctx context.Context, filter models.AnalyticsFilter, limit int, fromView bool) ([]models.UserTotal, error)
+	GetDailySlotFill(ctx context.Context, filter models.AnalyticsFilter) ([]models.SlotFillDay, error)
+	GetReviewerTotals(ctx context.Context, filter models.AnalyticsFilter) ([]models.ReviewerTotal, error)
+	GetDailyAttendance(ctx context.Context, filter models.AnalyticsFilter, now time.Time) ([]models.AttendanceDay, error)
+	RefreshDailyHours(ctx context.Context) error
+	// GetMemberTotals sums the overtime of every member of the team on slots
+	// starting in [from, to), members without any included.
+	GetMemberTotals(ctx context.Context, teamID int64, from, to time.Time) ([]models.MemberTotal, error)
+	// GetSlotSupply sums the slots starting in [from, to) that were not
+	// cancelled.
+	GetSlotSupply(ctx context.Context, from, to time.Time) (*models.SlotSupply, error)
+}
+
+// Transactor runs a function inside a database transaction.
+type Transactor interface {
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/models"
+	"shiftdony/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTopEarners is how many users the top earners chart lists unless
+// a limit is given.
+const defaultTopEarners = 10
+
+type AnalyticsHandler struct {
+	analyticsService *service.AnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *service.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{analyticsService: analyticsService}
+}
+
+// AnalyticsQuery selects the slots analytics cover by their start, in
+// inclusive days of the organization time zone, Gregorian or Jalali, and
+// the applicants' team. Monthly charts follow the viewer's calendar.
+type AnalyticsQuery struct {
+	From   string `form:"from"`
+	To     string `form:"to"`
+	TeamID int64  `form:"team_id" binding:"omitempty,min=1"`
+	Group  string `form:"group" binding:"omitempty,oneof=user team total"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+
+	list listQuery
+}
+
+func (q *AnalyticsQuery) validate(v *validation) {
+	q.list.parse(v, "", nil, q.From, q.To)
+}
+
+func (q *AnalyticsQuery) filter() models.AnalyticsFilter {
+	return models.AnalyticsFilter{TeamID: q.TeamID, From: q.list.from, To: q.list.to}
+}
+
+// FairnessQuery picks the team of a fairness report, the viewer's own by
+// default, and how many days back it looks.
+type FairnessQuery struct {
+	TeamID int64 `form:"team_id" binding:"omitempty,min=1"`
+	Days   int   `form:"days" binding:"omitempty,min=1,max=366"`
+}
+
+func analyticsCalendar(c *gin.Context) string {
+	if wantsJalali(c) {
+		return models.CalendarJalali
+	}
+	return models.CalendarGregorian
+}
+
+// Totals of every chart and the top earners
+func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	dashboard, err := h.analyticsService.Dashboard(c.Request.Context(), q.filter(), analyticsCalendar(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, dashboard)
+}
+
+// Approved overtime hours per month, per user, team or in total
+func (h *AnalyticsHandler) GetHours(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	if q.Group == "" {
+		q.Group = models.GroupByTeam
+	}
+	chart, err := h.analyticsService.Hours(c.Request.Context(), q.filter(), q.Group, analyticsCalendar(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, chart)
+}
+
+// Slot fill rate and time to fill per month
+func (h *AnalyticsHandler) GetSlots(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	chart, err := h.analyticsService.Slots(c.Request.Context(), q.filter(), analyticsCalendar(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, chart)
+}
+
+// Approval and rejection rates and review latency per reviewer
+func (h *AnalyticsHandler) GetReviewers(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	chart, err := h.analyticsService.Reviewers(c.Request.Context(), q.filter())
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, chart)
+}
+
+// Attendance and no-show rate per month
+func (h *AnalyticsHandler) GetAttendance(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	chart, err := h.analyticsService.Attendance(c.Request.Context(), q.filter(), analyticsCalendar(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, chart)
+}
+
+// Users with the most approved overtime hours
+func (h *AnalyticsHandler) GetTopEarners(c *gin.Context) {
+	var q AnalyticsQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultTopEarners
+	}
+	chart, err := h.analyticsService.TopEarners(c.Request.Context(), q.filter(), q.Limit)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, chart)
+}
+
+// How the team's overtime was shared among its members
+func (h *AnalyticsHandler) GetFairnessReport(c *gin.Context) {
+	var q FairnessQuery
+	if !bindQuery(c, &q) {
+		return
+	}
+	viewerIDVal, _ := c.Get("userID")
+	viewerID := int64(viewerIDVal.(float64))
+
+	window := time.Duration(q.Days) * 24 * time.Hour
+	report, err := h.analyticsService.Fairness(c.Request.Context(), q.TeamID, viewerID, window)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, report)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalHandler struct {
+	approvalService *service.ApprovalService
+}
+
+func NewApprovalHandler(approvalService *service.ApprovalService) *ApprovalHandler {
+	return &ApprovalHandler{approvalService: approvalService}
+}
+
+// Create an approval chain
+func (h *ApprovalHandler) CreateApprovalChain(c *gin.Context) {
+	var input CreateApprovalChainInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	chain := &models.ApprovalChain{
+		Name:        input.Name,
+		MinHours:    input.MinHours,
+		HolidayOnly: input.HolidayOnly,
+		Priority:    input.Priority,
+	}
+	for i, step := range input.Steps {
+		chain.Steps = append(chain.Steps, models.ApprovalStep{
+			Position:          i,
+			Name:              step.Name,
+			ApproverRole:      step.ApproverRole,
+			ApproverUserID:    step.ApproverUserID,
+			RequiredApprovals: step.RequiredApprovals,
+		})
+	}
+
+	if err := h.approvalService.CreateChain(c.Request.Context(), chain); err != nil {
+		SendError(c, err)
+		return
+	}
+
+	SendSuccessResponse(c, http.StatusCreated, chain)
+}
+
+// List approval chains
+func (h *ApprovalHandler) GetApprovalChains(c *gin.Context) {
+	chains, err := h.approvalService.GetChains(c.Request.Context())
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if chains == nil {
+		chains = make([]models.ApprovalChain, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, chains)
+}
+
+// Get the decisions recorded on a request
+func (h *ApprovalHandler) GetRequestApprovals(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID format", "INVALID_INPUT")
+		return
+	}
+
+	approvals, err := h.approvalService.GetRequestApprovals(c.Request.Context(), requestID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if approvals == nil {
+		approvals = make([]models.RequestApproval, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, approvals)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/config"
+	"shiftdony/ical"
+	log "shiftdony/logs"
+	"shiftdony/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type CalendarHandler struct {
+	calendarService *service.CalendarService
+}
+
+func NewCalendarHandler(calendarService *service.CalendarService) *CalendarHandler {
+	return &CalendarHandler{calendarService: calendarService}
+}
+
+// Create the caller's calendar feed URLs, revoking any earlier ones
+func (h *CalendarHandler) CreateFeedToken(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	token, err := h.calendarService.CreateFeedToken(c.Request.Context(), userID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	base := strings.TrimRight(config.C.Notify.BaseURL, "/") + "/api/calendar/" + token
+	SendSuccessResponse(c, http.StatusCreated, gin.H{
+		"personal_url": base + "/personal.ics",
+		"slots_url":    base + "/slots.ics",
+	})
+}
+
+// Revoke the caller's calendar feed URLs
+func (h *CalendarHandler) RevokeFeedToken(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	if err := h.calendarService.RevokeFeedToken(c.Request.Context(), userID); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Calendar feeds revoked",
+	})
+}
+
+// Serve the token owner's approved overtime
+func (h *CalendarHandler) PersonalFeed(c *gin.Context) {
+	cal, err := h.calendarService.PersonalFeed(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	writeCalendar(c, "overtime.ics", cal)
+}
+
+// Serve all published slots
+func (h *CalendarHandler) SlotsFeed(c *gin.Context) {
+	cal, err := h.calendarService.SlotsFeed(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	writeCalendar(c, "slots.ics", cal)
+}
+
+func writeCalendar(c *gin.Context, filename string, cal *ical.Calendar) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusOK)
+	if _, err := cal.WriteTo(c.Writer); err != nil {
+		log.Gl.Error("Failed to write calendar", zap.Error(err))
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"shiftdony/chat"
+	"shiftdony/config"
+	log "shiftdony/logs"
+	"shiftdony/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type ChatHandler struct {
+	chatBotService *service.ChatBotService
+}
+
+func NewChatHandler(chatBotService *service.ChatBotService) *ChatHandler {
+	return &ChatHandler{chatBotService: chatBotService}
+}
+
+// Create a one-time code for linking a chat to the caller's account
+func (h *ChatHandler) CreateLinkCode(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	code, expiresAt, err := h.chatBotService.CreateLinkCode(c.Request.Context(), userID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusCreated, gin.H{
+		"code":       code,
+		"expires_at": expiresAt,
+		"command":    "/link " + code,
+	})
+}
+
+// Unlink the caller's chat
+func (h *ChatHandler) Unlink(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	if err := h.chatBotService.Unlink(c.Request.Context(), userID); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Chat unlinked",
+	})
+}
+
+// Receive updates from Telegram in webhook mode
+func (h *ChatHandler) TelegramWebhook(c *gin.Context) {
+	secret := config.C.Chat.WebhookSecret
+	got := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+		SendErrorResponse(c, http.StatusUnauthorized, "Invalid webhook secret", "UNAUTHORIZED")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid update", "INVALID_INPUT")
+		return
+	}
+	update, err := chat.ParseTelegramUpdate(body)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid update", "INVALID_INPUT")
+		return
+	}
+
+	// Telegram retries on errors, so failures are only logged.
+	if err := h.chatBotService.HandleUpdate(c.Request.Context(), update); err != nil {
+		log.Gl.Error("Could not handle chat update", zap.Int64("update_id", update.ID), zap.Error(err))
+	}
+	c.Status(http.StatusOK)
+}
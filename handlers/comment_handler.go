@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CommentHandler struct {
+	commentService *service.CommentService
+}
+
+func NewCommentHandler(commentService *service.CommentService) *CommentHandler {
+	return &CommentHandler{commentService: commentService}
+}
+
+// Get the discussion thread of a request
+func (h *CommentHandler) GetRequestComments(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID format", "INVALID_INPUT")
+		return
+	}
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	comments, err := h.commentService.GetComments(c.Request.Context(), requestID, userID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if comments == nil {
+		comments = make([]models.RequestComment, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, comments)
+}
+
+// Add a comment or a reply to the discussion thread of a request
+func (h *CommentHandler) CreateRequestComment(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID format", "INVALID_INPUT")
+		return
+	}
+	var input CreateCommentInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	comment, err := h.commentService.AddComment(c.Request.Context(), requestID, userID, input.ParentID, input.Body)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusCreated, comment)
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"shiftdony/jalali"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DateTime is a time in request bodies. Besides RFC 3339 it accepts times
+// without an offset, e.g. "2025-03-30T08:30", and Jalali times such as
+// "1404-01-15T08:30:00+03:30" or "1404/01/15 08:30". Times without an
+// offset are local to the viewer's time zone; inputs place them in their
+// validate method, see validation.resolve.
+type DateTime struct {
+	time.Time
+	// floating is set while Time holds a wall clock, in UTC, that still
+	// needs a zone.
+	floating bool
+}
+
+func (d *DateTime) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	t, zoned, err := parseWall(s)
+	if err != nil {
+		return err
+	}
+	d.Time, d.floating = t, !zoned
+	return nil
+}
+
+// timePtr returns the time of an optional DateTime.
+func timePtr(d *DateTime) *time.Time {
+	if d == nil || d.IsZero() {
+		return nil
+	}
+	return &d.Time
+}
+
+// localLayouts are the Gregorian layouts accepted without an offset.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+var errInvalidTime = errors.New("time must be RFC 3339 or YYYY-MM-DD HH:MM, Gregorian or Jalali")
+
+// parseWall parses an RFC 3339 or Jalali time. Times without an offset
+// come back as their wall clock in UTC with zoned false.
+func parseWall(s string) (t time.Time, zoned bool, err error) {
+	if jalali.LooksJalali(s) {
+		if t, zoned, err := jalali.ParseWall(s); err == nil {
+			return t, zoned, nil
+		}
+		return time.Time{}, false, errInvalidTime
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, errInvalidTime
+}
+
+// resolveTimes places the times given without an offset in the viewer's
+// zone. It returns service.ErrNonexistentTime or service.ErrAmbiguousTime
+// for wall clocks a daylight saving change skips or repeats. Nil entries
+// are skipped.
+func resolveTimes(c *gin.Context, times ...*DateTime) error {
+	loc := viewerLocation(c)
+	for _, d := range times {
+		if d == nil || !d.floating {
+			continue
+		}
+		t, err := service.LocalTime(d.Time, loc)
+		if err != nil {
+			return err
+		}
+		d.Time, d.floating = t, false
+	}
+	return nil
+}
+
+// parseDate parses a YYYY-MM-DD date in either calendar and returns
+// midnight UTC of the Gregorian date.
+func parseDate(s string) (time.Time, error) {
+	if jalali.LooksJalali(s) {
+		t, err := jalali.Parse(s, time.UTC)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t, nil
+	}
+	return time.Parse(dateLayout, s)
+}
+
+// inOrgZone returns midnight of t's date in the organization time zone,
+// which pay periods follow.
+func inOrgZone(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, service.OrgLocation())
+}
+
+// viewerLocation returns the zone the request shows times in, see
+// middleware.ViewerMiddleware.
+func viewerLocation(c *gin.Context) *time.Location {
+	if v, ok := c.Get("location"); ok {
+		if loc, ok := v.(*time.Location); ok && loc != nil {
+			return loc
+		}
+	}
+	return service.OrgLocation()
+}
+
+// wantsJalali reports whether the request asked for Jalali dates, see
+// middleware.ViewerMiddleware.
+func wantsJalali(c *gin.Context) bool {
+	return c.GetString("calendar") == models.CalendarJalali
+}
+
+// formatTime formats t for exports in the request's calendar and zone.
+func formatTime(c *gin.Context, t time.Time) string {
+	return formatIn(t, viewerLocation(c), wantsJalali(c))
+}
+
+// formatShort formats t to the minute for printed reports, in the
+// request's calendar and zone.
+func formatShort(c *gin.Context, t time.Time) string {
+	t = t.In(viewerLocation(c))
+	if wantsJalali(c) {
+		return jalali.FormatDate(t) + t.Format(" 15:04")
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// formatDay formats the date of t in the request's calendar.
+func formatDay(c *gin.Context, t time.Time) string {
+	if wantsJalali(c) {
+		return jalali.FormatDate(t)
+	}
+	return t.Format(dateLayout)
+}
+
+// formatIn shows t in loc.
+func formatIn(t time.Time, loc *time.Location, useJalali bool) string {
+	t = t.In(loc)
+	if useJalali {
+		return jalali.Format(t)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// dateOnlyTag marks time.Time fields holding a plain date, stored as
+// midnight UTC of that date, e.g. `json:"date" format:"date"`. Responses
+// show them as YYYY-MM-DD in the request's calendar, without a zone.
+const dateOnlyTag = "date"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// renderDates returns the JSON form of data with every time.Time shown in
+// the request's zone, and as a Jalali time when Jalali dates are wanted.
+// Times are found by their type, so strings that merely look like times
+// are left alone. Types with their own JSON encoding are kept as they are.
+func renderDates(c *gin.Context, data interface{}) interface{} {
+	r := dateRenderer{loc: viewerLocation(c), useJalali: wantsJalali(c)}
+	return r.value(reflect.ValueOf(data), false)
+}
+
+type dateRenderer struct {
+	loc       *time.Location
+	useJalali bool
+}
+
+// value renders v the way encoding/json would encode it, with times
+// formatted; dateOnly is set for fields tagged with dateOnlyTag.
+func (r dateRenderer) value(v reflect.Value, dateOnly bool) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.value(v.Elem(), dateOnly)
+	}
+
+	t := v.Type()
+	switch {
+	case t == timeType:
+		tm := v.Interface().(time.Time)
+		switch {
+		case tm.IsZero():
+			return tm
+		case dateOnly && r.useJalali:
+			return jalali.FormatDate(tm.UTC())
+		case dateOnly:
+			return tm.UTC().Format(dateLayout)
+		}
+		return formatIn(tm, r.loc, r.useJalali)
+	case t.Implements(marshalerType), t.Implements(textMarshalerType):
+		return v.Interface()
+	case v.CanAddr() && (reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)):
+		return v.Addr().Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, t.NumField())
+		r.fields(out, v)
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			out[mapKey(iter.Key())] = r.value(iter.Value(), false)
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Encoded as base64.
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = r.value(v.Index(i), dateOnly)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// fields adds the fields of struct v to out under their JSON names. The
+// fields of embedded structs come first, so outer fields win as in
+// encoding/json.
+func (r dateRenderer) fields(out map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			fv := v.Field(i)
+			if f.Anonymous && name == "" && indirectKind(f.Type) == reflect.Struct {
+				if pass == 0 {
+					if f.Type.Kind() == reflect.Ptr {
+						if fv.IsNil() || !f.IsExported() {
+							continue
+						}
+						fv = fv.Elem()
+					}
+					r.fields(out, fv)
+				}
+				continue
+			}
+			if pass == 0 || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+				continue
+			}
+			out[name] = r.value(fv, f.Tag.Get("format") == dateOnlyTag)
+		}
+	}
+}
+
+func indirectKind(t reflect.Type) reflect.Kind {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+// isEmptyValue reports whether omitempty drops v.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// mapKey returns the JSON object key of a map key.
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if m, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"shiftdony/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenderDates(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	at := time.Date(2024, 3, 20, 4, 30, 0, 0, time.UTC)
+	type note struct {
+		Text    string     `json:"text"`
+		At      time.Time  `json:"at"`
+		Until   *time.Time `json:"until,omitempty"`
+		Skipped string     `json:"-"`
+	}
+	type page struct {
+		note
+		Text    string            `json:"title"`
+		Holiday models.Holiday    `json:"holiday"`
+		Extra   map[string]string `json:"extra"`
+		Raw     json.RawMessage   `json:"raw"`
+	}
+	data := []interface{}{
+		page{
+			note: note{Text: "2024-03-20T04:30:00Z", At: at, Skipped: "x"},
+			Text: "midnight 2024-03-20T00:00:00Z",
+			Holiday: models.Holiday{
+				Date:      time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC),
+				Name:      "Nowruz",
+				CreatedAt: time.Date(2024, 3, 19, 21, 0, 0, 0, time.UTC),
+			},
+			Extra: map[string]string{"note": "2024-03-20T04:30:00Z"},
+			Raw:   json.RawMessage(`{"at":"2024-03-20T04:30:00Z"}`),
+		},
+		gin.H{"expires_at": &at, "none": (*time.Time)(nil)},
+	}
+
+	tests := []struct {
+		calendar string
+		want     string
+	}{
+		{models.CalendarGregorian, `[{"at":"2024-03-20T08:00:00+03:30","extra":{"note":"2024-03-20T04:30:00Z"},` +
+			`"holiday":{"calendar_id":0,"closure":false,"created_at":"2024-03-20T00:30:00+03:30","date":"2024-03-20","id":0,"name":"Nowruz","source":""},` +
+			`"raw":{"at":"2024-03-20T04:30:00Z"},"text":"2024-03-20T04:30:00Z","title":"midnight 2024-03-20T00:00:00Z"},` +
+			`{"expires_at":"2024-03-20T08:00:00+03:30","none":null}]`},
+		{models.CalendarJalali, `[{"at":"1403-01-01T08:00:00+03:30","extra":{"note":"2024-03-20T04:30:00Z"},` +
+			`"holiday":{"calendar_id":0,"closure":false,"created_at":"1403-01-01T00:30:00+03:30","date":"1403-01-01","id":0,"name":"Nowruz","source":""},` +
+			`"raw":{"at":"2024-03-20T04:30:00Z"},"text":"2024-03-20T04:30:00Z","title":"midnight 2024-03-20T00:00:00Z"},` +
+			`{"expires_at":"1403-01-01T08:00:00+03:30","none":null}]`},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("location", tehran)
+		c.Set("calendar", tt.calendar)
+		got, err := json.Marshal(renderDates(c, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.calendar, got, tt.want)
+		}
+	}
+}
+
+func TestFormatIn(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	// Midnight UTC is an instant like any other.
+	midnight := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	if got, want := formatIn(midnight, tehran, false), "2024-03-20T03:30:00+03:30"; got != want {
+		t.Errorf("formatIn = %q, want %q", got, want)
+	}
+	if got, want := formatIn(midnight.Add(-time.Hour), tehran, true), "1403-01-01T02:30:00+03:30"; got != want {
+		t.Errorf("formatIn Jalali = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DelegationHandler struct {
+	delegationService *service.DelegationService
+}
+
+func NewDelegationHandler(delegationService *service.DelegationService) *DelegationHandler {
+	return &DelegationHandler{delegationService: delegationService}
+}
+
+// Delegate the current manager's review authority
+func (h *DelegationHandler) CreateDelegation(c *gin.Context) {
+	var input CreateDelegationInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
+
+	delegation, err := h.delegationService.Delegate(c.Request.Context(), managerID, input.DelegateID, input.StartsAt, input.EndsAt, input.TeamIDs)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+
+	SendSuccessResponse(c, http.StatusCreated, delegation)
+}
+
+// List the current manager's delegations
+func (h *DelegationHandler) GetMyDelegations(c *gin.Context) {
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
+
+	delegations, err := h.delegationService.GetMyDelegations(c.Request.Context(), managerID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if delegations == nil {
+		delegations = make([]models.Delegation, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, delegations)
+}
+
+// Revoke a delegation
+func (h *DelegationHandler) RevokeDelegation(c *gin.Context) {
+	delegationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid delegation ID format", "INVALID_INPUT")
+		return
+	}
+
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
+
+	if err := h.delegationService.Revoke(c.Request.Context(), delegationID, managerID); err != nil {
+		SendError(c, err)
+		return
+	}
+
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Delegation revoked successfully",
+	})
+}
@@ -9,6 +9,29 @@ type RegisterInput struct {
 	FullName      string `json:"full_name" binding:"required"`
 	Password      string `json:"password" binding:"required"`
 	TeamID        int64  `json:"team_id" binding:"required"`
+	Email         string `json:"email" binding:"omitempty,email"`
+}
+
+type ForgotPasswordInput struct {
+	PersonnelCode string `json:"personnel_code" binding:"required"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type UpdateNotificationPreferencesInput struct {
+	Email               *string `json:"email"`
+	Locale              *string `json:"locale"`
+	Calendar            *string `json:"calendar"`
+	Timezone            *string `json:"timezone"` // IANA name, empty to follow the team
+	EmailEnabled        *bool   `json:"email_enabled"`
+	EmailRequestDecided *bool   `json:"email_request_decided"`
+	EmailSlotPublished  *bool   `json:"email_slot_published"`
+	EmailReminders      *bool   `json:"email_reminders"`
+	EmailReviewPending  *bool   `json:"email_review_pending"`
+	ChatEnabled         *bool   `json:"chat_enabled"`
 }
 
 type LoginInput struct {
@@ -16,11 +39,30 @@ type LoginInput struct {
 	Password      string `json:"password" binding:"required"`
 }
 
+// CreateOvertimeInput takes times as RFC 3339 or Jalali, see DateTime. Its
+// time rules are in validate.
 type CreateOvertimeInput struct {
-	Title     string    `json:"title" binding:"required"`
-	StartTime time.Time `json:"start_time" binding:"required"`
-	EndTime   time.Time `json:"end_time" binding:"required"`
-	Capacity  int       `json:"capacity" binding:"required"`
+	Title     string   `json:"title" binding:"required"`
+	StartTime DateTime `json:"start_time"`
+	EndTime   DateTime `json:"end_time"`
+	Capacity  int      `json:"capacity" binding:"min=1"`
+	IsHoliday bool     `json:"is_holiday"`
+
+	ApplicationOpensAt  *DateTime `json:"application_opens_at"`
+	ApplicationClosesAt *DateTime `json:"application_closes_at"`
+	CancellationCutoff  *DateTime `json:"cancellation_cutoff"`
+
+	AllocationStrategy string `json:"allocation_strategy" binding:"omitempty,oneof=manual fcfs lottery fewest_hours rotation"`
+	AllocationSeed     *int64 `json:"allocation_seed"`
+	WaitlistSize       int    `json:"waitlist_size" binding:"min=0"`
+}
+
+type AllocateSlotInput struct {
+	Strategy string `json:"strategy" binding:"omitempty,oneof=fcfs lottery fewest_hours rotation"`
+}
+
+type CancelSlotInput struct {
+	Reason string `json:"reason" binding:"max=500"`
 }
 
 type CreateRequestInput struct {
@@ -28,7 +70,84 @@ type CreateRequestInput struct {
 }
 
 type UpdateRequestStatusInput struct {
-	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Status  string `json:"status" binding:"required,oneof=approved rejected"`
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+type RecordAttendanceInput struct {
+	Attendance string `json:"attendance" binding:"required,oneof=present no_show"`
+}
+
+type BulkReviewInput struct {
+	Status     string  `json:"status" binding:"omitempty,oneof=approved rejected"`
+	RequestIDs []int64 `json:"request_ids" binding:"max=100"`
+
+	// Slot mode: approve the first ApproveFirst pending requests of SlotID
+	// by request time and reject the rest.
+	SlotID       int64 `json:"slot_id"`
+	ApproveFirst *int  `json:"approve_first"`
+
+	Reason       string `json:"reason"`
+	RejectReason string `json:"reject_reason"` // slot mode only, defaults to Reason
+	Comment      string `json:"comment"`
+}
+
+type BulkReviewItem struct {
+	RequestID int64  `json:"request_id"`
+	Decision  string `json:"decision"`
+	Status    string `json:"status,omitempty"` // of the request after the decision
+	Success   bool   `json:"success"`
+	Message   string `json:"message,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type BulkReviewResponse struct {
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkReviewItem `json:"results"`
+}
+
+type CreateWebhookInput struct {
+	URL        string   `json:"url" binding:"required,url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type UpdateWebhookInput struct {
+	Active     *bool    `json:"active"`
+	EventTypes []string `json:"event_types"`
+}
+
+type ReplayEventInput struct {
+	SubscriptionID int64 `json:"subscription_id"`
+}
+
+type CreateCommentInput struct {
+	Body     string `json:"body" binding:"required"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type CreateDelegationInput struct {
+	DelegateID int64     `json:"delegate_id" binding:"required"`
+	StartsAt   time.Time `json:"starts_at" binding:"required"`
+	EndsAt     time.Time `json:"ends_at" binding:"required"`
+	TeamIDs    []int64   `json:"team_ids"`
+}
+
+type ApprovalStepInput struct {
+	Name              string `json:"name"`
+	ApproverRole      string `json:"approver_role"`
+	ApproverUserID    *int64 `json:"approver_user_id"`
+	RequiredApprovals int    `json:"required_approvals"`
+}
+
+type CreateApprovalChainInput struct {
+	Name        string              `json:"name" binding:"required"`
+	MinHours    float64             `json:"min_hours"`
+	HolidayOnly bool                `json:"holiday_only"`
+	Priority    int                 `json:"priority"`
+	Steps       []ApprovalStepInput `json:"steps" binding:"required,min=1"`
 }
 
 
@@ -39,9 +158,46 @@ type SlotResponse struct {
 	EndTime   time.Time `json:"end_time"`
 	Capacity  int64     `json:"capacity"`
 	Status    string    `json:"status"`
-	Creator   string    `json:"creator"` 
+	IsHoliday bool      `json:"is_holiday"`
+	Creator   string    `json:"creator"`
+
+	ApplicationOpensAt  *time.Time `json:"application_opens_at,omitempty"`
+	ApplicationClosesAt time.Time  `json:"application_closes_at"`
+	CancellationCutoff  time.Time  `json:"cancellation_cutoff"`
+
+	AllocationStrategy string `json:"allocation_strategy"`
+	WaitlistSize       int    `json:"waitlist_size"`
+}
+
+
+
+
+
+type CreateHolidayCalendarInput struct {
+	Name      string   `json:"name" binding:"required"`
+	Timezone  string   `json:"timezone"`
+	Weekend   []string `json:"weekend"` // the configured weekend when omitted
+	IsDefault bool     `json:"is_default"`
 }
 
+type UpdateHolidayCalendarInput struct {
+	Name      *string   `json:"name"`
+	Timezone  *string   `json:"timezone"`
+	Weekend   *[]string `json:"weekend"`
+	IsDefault *bool     `json:"is_default"`
+}
 
+type AddHolidayInput struct {
+	Name    string `json:"name" binding:"required"`
+	Date    string `json:"date" binding:"required"` // YYYY-MM-DD, Gregorian or Jalali
+	EndDate string `json:"end_date"`                // last day, inclusive; Date when empty
+	Closure bool   `json:"closure"`
+}
 
+type AssignTeamCalendarInput struct {
+	CalendarID *int64 `json:"calendar_id"` // null for the default calendar
+}
 
+type SetTeamTimezoneInput struct {
+	Timezone string `json:"timezone"` // IANA name, empty for the organization's zone
+}
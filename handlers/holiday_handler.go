@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"shiftdony/config"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const dateLayout = "2006-01-02"
+
+type HolidayHandler struct {
+	holidayService *service.HolidayService
+}
+
+func NewHolidayHandler(holidayService *service.HolidayService) *HolidayHandler {
+	return &HolidayHandler{holidayService: holidayService}
+}
+
+// Create a holiday calendar
+func (h *HolidayHandler) CreateCalendar(c *gin.Context) {
+	var input CreateHolidayCalendarInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	calendar, err := h.holidayService.CreateCalendar(c.Request.Context(), &models.HolidayCalendar{
+		Name:      input.Name,
+		Timezone:  input.Timezone,
+		Weekend:   input.Weekend,
+		IsDefault: input.IsDefault,
+	})
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusCreated, calendar)
+}
+
+// List holiday calendars
+func (h *HolidayHandler) GetCalendars(c *gin.Context) {
+	calendars, err := h.holidayService.GetCalendars(c.Request.Context())
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if calendars == nil {
+		calendars = make([]models.HolidayCalendar, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, calendars)
+}
+
+// Rename a holiday calendar or change its time zone, weekend or default flag
+func (h *HolidayHandler) UpdateCalendar(c *gin.Context) {
+	calendarID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var input UpdateHolidayCalendarInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	calendar, err := h.holidayService.UpdateCalendar(c.Request.Context(), calendarID, service.HolidayCalendarUpdate{
+		Name:      input.Name,
+		Timezone:  input.Timezone,
+		Weekend:   input.Weekend,
+		IsDefault: input.IsDefault,
+	})
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, calendar)
+}
+
+// List a calendar's holidays, this year unless from and to are given
+func (h *HolidayHandler) GetHolidays(c *gin.Context) {
+	calendarID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	year := time.Now().Year()
+	from, err := dateQuery(c, "from", time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Dates must be YYYY-MM-DD, Gregorian or Jalali", "INVALID_INPUT")
+		return
+	}
+	to, err := dateQuery(c, "to", time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Dates must be YYYY-MM-DD, Gregorian or Jalali", "INVALID_INPUT")
+		return
+	}
+
+	holidays, err := h.holidayService.GetHolidays(c.Request.Context(), calendarID, from, to)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if holidays == nil {
+		holidays = make([]models.Holiday, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, holidays)
+}
+
+// Enter a holiday, or a run of holidays, by hand
+func (h *HolidayHandler) AddHoliday(c *gin.Context) {
+	calendarID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var input AddHolidayInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	first, err := parseDate(input.Date)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Dates must be YYYY-MM-DD, Gregorian or Jalali", "INVALID_INPUT")
+		return
+	}
+	last := first
+	if input.EndDate != "" {
+		if last, err = parseDate(input.EndDate); err != nil {
+			SendErrorResponse(c, http.StatusBadRequest, "Dates must be YYYY-MM-DD, Gregorian or Jalali", "INVALID_INPUT")
+			return
+		}
+	}
+
+	holidays, err := h.holidayService.AddHolidays(c.Request.Context(), calendarID, input.Name, first, last, input.Closure)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusCreated, holidays)
+}
+
+// Import holidays from an ICS file, sent as the "file" form field or as the
+// request body
+func (h *HolidayHandler) ImportICS(c *gin.Context) {
+	calendarID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.C.Holidays.MaxImportSize)
+
+	var body io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			SendErrorResponse(c, http.StatusBadRequest, "Could not read the uploaded file", "INVALID_INPUT")
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	closure := c.Query("closure") == "true"
+
+	imported, err := h.holidayService.ImportICS(c.Request.Context(), calendarID, body, closure)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"imported": imported,
+	})
+}
+
+// Delete a holiday from a calendar
+func (h *HolidayHandler) DeleteHoliday(c *gin.Context) {
+	calendarID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	holidayID, ok := idParam(c, "holidayID")
+	if !ok {
+		return
+	}
+	if err := h.holidayService.DeleteHoliday(c.Request.Context(), calendarID, holidayID); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Holiday deleted",
+	})
+}
+
+// Assign a holiday calendar to a team
+func (h *HolidayHandler) AssignTeamCalendar(c *gin.Context) {
+	teamID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var input AssignTeamCalendarInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := h.holidayService.AssignTeamCalendar(c.Request.Context(), teamID, input.CalendarID); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Team calendar updated",
+	})
+}
+
+// Set the time zone a team's members see times in
+func (h *HolidayHandler) SetTeamTimezone(c *gin.Context) {
+	teamID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var input SetTeamTimezoneInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := h.holidayService.SetTeamTimezone(c.Request.Context(), teamID, input.Timezone); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Team time zone updated",
+	})
+}
+
+// Tell the caller whether a date, today by default, is a working day for them
+func (h *HolidayHandler) CheckDay(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	t := time.Now()
+	if date := c.Query("date"); date != "" {
+		// Noon keeps the date the same in every time zone in practice.
+		d, err := parseDate(date)
+		if err != nil {
+			SendErrorResponse(c, http.StatusBadRequest, "Dates must be YYYY-MM-DD, Gregorian or Jalali", "INVALID_INPUT")
+			return
+		}
+		t = d.Add(12 * time.Hour)
+	}
+
+	day, err := h.holidayService.CheckDay(c.Request.Context(), userID, t)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"day":  day,
+		"kind": day.Kind(),
+	})
+}
+
+// idParam parses a numeric path parameter, answering 400 when it is not one.
+func idParam(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid ID format", "INVALID_INPUT")
+		return 0, false
+	}
+	return id, true
+}
+
+func dateQuery(c *gin.Context, name string, fallback time.Time) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return fallback, nil
+	}
+	return parseDate(v)
+}
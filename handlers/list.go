@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"shiftdony/models"
+	"strings"
+	"time"
+)
+
+// defaultPageSize is the page size of lists called without a limit.
+const defaultPageSize = 50
+
+// RequestListQuery filters, sorts and pages lists of overtime requests.
+// Dates are inclusive days in the organization time zone, Gregorian or
+// Jalali; status takes a comma separated list.
+type RequestListQuery struct {
+	Status string `form:"status"`
+	TeamID int64  `form:"team_id" binding:"omitempty,min=1"`
+	UserID int64  `form:"user_id" binding:"omitempty,min=1"`
+	SlotID int64  `form:"slot_id" binding:"omitempty,min=1"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Q      string `form:"q" binding:"max=100"`
+
+	Sort   string `form:"sort" binding:"omitempty,oneof=request_time slot_start status id"`
+	Order  string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=500"`
+	Cursor string `form:"cursor"`
+
+	list listQuery
+}
+
+// SlotListQuery filters, sorts and pages lists of overtime slots, like
+// RequestListQuery.
+type SlotListQuery struct {
+	Status    string `form:"status"`
+	CreatedBy int64  `form:"created_by" binding:"omitempty,min=1"`
+	From      string `form:"from"`
+	To        string `form:"to"`
+	Q         string `form:"q" binding:"max=100"`
+
+	Sort   string `form:"sort" binding:"omitempty,oneof=start_time title status id"`
+	Order  string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=500"`
+	Cursor string `form:"cursor"`
+
+	list listQuery
+}
+
+// listQuery is what validate parsed from the parameters every list
+// shares.
+type listQuery struct {
+	statuses []string
+	from, to time.Time
+	opts     models.ListOptions
+}
+
+func (q *RequestListQuery) validate(v *validation) {
+	q.list.parse(v, q.Status, []string{
+		models.RequestStatusPending,
+		models.RequestStatusApproved,
+		models.RequestStatusRejected,
+		models.RequestStatusWaitlisted,
+		models.RequestStatusWithdrawn,
+		models.RequestStatusExpired,
+		models.RequestStatusCancelled,
+	}, q.From, q.To)
+	q.list.page(v, q.Sort, "request_time", q.Order, q.Limit, q.Cursor)
+}
+
+func (q *SlotListQuery) validate(v *validation) {
+	q.list.parse(v, q.Status, []string{
+		models.SlotStatusScheduled,
+		models.SlotStatusOpen,
+		models.SlotStatusFull,
+		models.SlotStatusClosed,
+		models.SlotStatusInProgress,
+		models.SlotStatusCompleted,
+		models.SlotStatusCancelled,
+	}, q.From, q.To)
+	q.list.page(v, q.Sort, "start_time", q.Order, q.Limit, q.Cursor)
+}
+
+// filter returns the filter the query selects.
+func (q *RequestListQuery) filter() models.RequestFilter {
+	return models.RequestFilter{
+		Statuses: q.list.statuses,
+		TeamID:   q.TeamID,
+		UserID:   q.UserID,
+		SlotID:   q.SlotID,
+		From:     q.list.from,
+		To:       q.list.to,
+		Search:   strings.TrimSpace(q.Q),
+	}
+}
+
+func (q *SlotListQuery) filter() models.SlotFilter {
+	return models.SlotFilter{
+		Statuses:  q.list.statuses,
+		CreatedBy: q.CreatedBy,
+		From:      q.list.from,
+		To:        q.list.to,
+		Search:    strings.TrimSpace(q.Q),
+	}
+}
+
+func (l *listQuery) parse(v *validation, status string, statuses []string, from, to string) {
+	for _, s := range strings.Split(status, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if !contains(statuses, s) {
+			v.fail("status", "oneof", strings.Join(statuses, " "))
+			break
+		}
+		l.statuses = append(l.statuses, s)
+	}
+	if from != "" {
+		d, err := parseDate(from)
+		if err != nil {
+			v.fail("from", "date", "")
+		} else {
+			l.from = inOrgZone(d)
+		}
+	}
+	if to != "" {
+		d, err := parseDate(to)
+		if err != nil {
+			v.fail("to", "date", "")
+		} else {
+			// to is the last day listed.
+			l.to = inOrgZone(d).AddDate(0, 0, 1)
+		}
+	}
+	if !l.from.IsZero() && !l.to.IsZero() && !l.to.After(l.from) {
+		v.fail("to", "not_before", "from")
+	}
+}
+
+// page reads the sort, order, limit and cursor parameters. Time and ID
+// orders default to newest first, the others to ascending.
+func (l *listQuery) page(v *validation, sort, defaultSort, order string, limit int, cursor string) {
+	if sort == "" {
+		sort = defaultSort
+	}
+	desc := order == "desc"
+	if order == "" {
+		desc = sort != "title" && sort != "status"
+	}
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	l.opts = models.ListOptions{Sort: sort, Desc: desc, Limit: limit}
+	if cursor != "" {
+		after, err := models.DecodeCursor(cursor)
+		if err != nil || after.Sort != sort || after.Desc != desc {
+			v.fail("cursor", "cursor", "")
+			return
+		}
+		l.opts.After = after
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandler struct {
+	notificationService *service.NotificationService
+}
+
+func NewNotificationHandler(notificationService *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService: notificationService}
+}
+
+// Get the caller's notification preferences
+func (h *NotificationHandler) GetPreferences(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	settings, err := h.notificationService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, settings)
+}
+
+// Change the caller's notification preferences
+func (h *NotificationHandler) UpdatePreferences(c *gin.Context) {
+	var input UpdateNotificationPreferencesInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	settings, err := h.notificationService.UpdatePreferences(c.Request.Context(), userID, service.PreferencesUpdate{
+		Email:               input.Email,
+		Locale:              input.Locale,
+		Calendar:            input.Calendar,
+		Timezone:            input.Timezone,
+		EmailEnabled:        input.EmailEnabled,
+		EmailRequestDecided: input.EmailRequestDecided,
+		EmailSlotPublished:  input.EmailSlotPublished,
+		EmailReminders:      input.EmailReminders,
+		EmailReviewPending:  input.EmailReviewPending,
+		ChatEnabled:         input.ChatEnabled,
+	})
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, settings)
+}
+
+// List the caller's in-app notifications, newest first
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	var beforeID int64
+	if before := c.Query("before"); before != "" {
+		var err error
+		if beforeID, err = strconv.ParseInt(before, 10, 64); err != nil {
+			SendErrorResponse(c, http.StatusBadRequest, "Invalid before ID format", "INVALID_INPUT")
+			return
+		}
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	inbox, err := h.notificationService.GetInbox(c.Request.Context(), userID, unreadOnly, beforeID, queryLimit(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, inbox)
+}
+
+// Mark one notification read
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	notificationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid notification ID format", "INVALID_INPUT")
+		return
+	}
+	h.markRead(c, []int64{notificationID})
+}
+
+// Mark every notification read
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	h.markRead(c, nil)
+}
+
+func (h *NotificationHandler) markRead(c *gin.Context, ids []int64) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	unread, err := h.notificationService.MarkRead(c.Request.Context(), userID, ids)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"unread_count": unread,
+	})
+}
+
+// Unsubscribe from emails through the link in a notification
+func (h *NotificationHandler) Unsubscribe(c *gin.Context) {
+	err := h.notificationService.Unsubscribe(c.Request.Context(), c.Query("token"), c.Query("kind"))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "You have been unsubscribed",
+	})
+}
@@ -2,13 +2,12 @@ package handlers
 
 import (
 	"encoding/csv"
-	"fmt"
 	"net/http"
+	"shiftdony/i18n"
 	log "shiftdony/logs"
 	"shiftdony/models"
 	"shiftdony/service"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -16,34 +15,41 @@ import (
 
 type OvertimeHandler struct {
 	overtimeService *service.OvertimeService
+	holidayService  *service.HolidayService
 }
 
-func NewOvertimeHandler(overtimeService *service.OvertimeService) *OvertimeHandler {
-	return &OvertimeHandler{overtimeService: overtimeService}
+func NewOvertimeHandler(overtimeService *service.OvertimeService, holidayService *service.HolidayService) *OvertimeHandler {
+	return &OvertimeHandler{overtimeService: overtimeService, holidayService: holidayService}
 }
 
 func (h *OvertimeHandler) CreateOvertimeSlot(c *gin.Context) {
 	var input CreateOvertimeInput
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		SendErrorResponse(c, http.StatusBadRequest, "Invalid input data", "INVALID_INPUT")
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	creatorIDVal, _ := c.Get("userID")
 	creatorID := int64(creatorIDVal.(float64))
 
-	newSlot, err := h.overtimeService.CreateSlot(
-		c.Request.Context(),
-		input.Title,
-		input.StartTime,
-		input.EndTime,
-		input.Capacity,
-		creatorID,
-	)
+	newSlot, err := h.overtimeService.CreateSlot(c.Request.Context(), &models.OvertimeSlot{
+		Title:              input.Title,
+		StartTime:          input.StartTime.Time,
+		EndTime:            input.EndTime.Time,
+		Capacity:           int64(input.Capacity),
+		IsHoliday:          input.IsHoliday,
+		AllocationStrategy: input.AllocationStrategy,
+		AllocationSeed:     input.AllocationSeed,
+		WaitlistSize:       input.WaitlistSize,
+		CreatedBy:          creatorID,
+
+		ApplicationOpensAt:  timePtr(input.ApplicationOpensAt),
+		ApplicationClosesAt: timePtr(input.ApplicationClosesAt),
+		CancellationCutoff:  timePtr(input.CancellationCutoff),
+	})
 
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to create overtime slot", "SERVER_ERROR")
+		SendError(c, err)
 		return
 	}
 
@@ -51,10 +57,15 @@ func (h *OvertimeHandler) CreateOvertimeSlot(c *gin.Context) {
 }
 
 func (h *OvertimeHandler) GetOvertimeSlots(c *gin.Context) {
-	slots, err := h.overtimeService.GetOvertimeSlots(c.Request.Context())
+	var query SlotListQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	slots, page, err := h.overtimeService.ListSlots(c.Request.Context(), query.filter(), query.list.opts)
 
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch overtime slots", "SERVER_ERROR")
+		SendError(c, err)
 		return
 	}
 
@@ -76,11 +87,19 @@ func (h *OvertimeHandler) GetOvertimeSlots(c *gin.Context) {
 			EndTime:   slot.EndTime,
 			Capacity:  slot.Capacity,
 			Status:    slot.Status,
+			IsHoliday: slot.IsHoliday,
 			Creator:   creatorName,
+
+			ApplicationOpensAt:  slot.ApplicationOpensAt,
+			ApplicationClosesAt: slot.ClosesAt(),
+			CancellationCutoff:  slot.CutoffAt(),
+
+			AllocationStrategy: slot.AllocationStrategy,
+			WaitlistSize:       slot.WaitlistSize,
 		})
 	}
 
-	SendSuccessResponse(c, http.StatusOK, responseSlots)
+	SendPageResponse(c, http.StatusOK, responseSlots, page)
 }
 
 // Get Available OvertimeSlots
@@ -89,13 +108,15 @@ func (h *OvertimeHandler) GetAvailableOvertimeSlots(c *gin.Context) {
 	slots, err := h.overtimeService.GetAvailableSlots(c.Request.Context())
 
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch available slots", "SERVER_ERROR")
-		log.Gl.Error("Failed to fetch available slots", zap.Error(err))
+		SendError(c, err)
 		return
 	}
 	if slots == nil {
 		slots = make([]models.OvertimeSlot, 0)
 	}
+	for i := range slots {
+		hideAllocationSeed(c, &slots[i])
+	}
 
 	SendSuccessResponse(c, http.StatusOK, slots)
 
@@ -103,8 +124,7 @@ func (h *OvertimeHandler) GetAvailableOvertimeSlots(c *gin.Context) {
 
 func (h *OvertimeHandler) CreateOvertimeRequest(c *gin.Context) {
 	var input CreateRequestInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		SendErrorResponse(c, http.StatusBadRequest, "Invalid inpud data", "INVALID_INPUT")
+	if !bindJSON(c, &input) {
 		return
 	}
 	userIDVal, _ := c.Get("userID")
@@ -113,59 +133,90 @@ func (h *OvertimeHandler) CreateOvertimeRequest(c *gin.Context) {
 	newRequest, err := h.overtimeService.CreateRequest(c.Request.Context(), userID, input.SlotID)
 
 	if err != nil {
-		switch err {
-		case service.ErrSlotNotFound:
-			SendErrorResponse(c, http.StatusNotFound, "Slot not found or is not open for requests", "SLOT_NOT_FOUND")
-		case service.ErrAlreadyApplied:
-			SendErrorResponse(c, http.StatusConflict, "You have already applied for this slot", "ALREADY_APPLIED")
-		case service.ErrSlotIsFull:
-			SendErrorResponse(c, http.StatusConflict, "This overtime slot is already full", "SLOT_FULL")
-		default:
-			SendErrorResponse(c, http.StatusInternalServerError, "Failed to create request", "SERVER_ERROR")
-			log.Gl.Error("Failed to create request", zap.Error(err))
-		}
+		SendError(c, err)
 		return
 	}
 
 	SendSuccessResponse(c, http.StatusOK, newRequest)
 }
 
+// Withdraw one of my overtime requests
+func (h *OvertimeHandler) WithdrawOvertimeRequest(c *gin.Context) {
+	requestID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid request ID format", "INVALID_INPUT")
+		return
+	}
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	if err := h.overtimeService.WithdrawRequest(c.Request.Context(), requestID, userID); err != nil {
+		SendError(c, err)
+		return
+	}
+
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Request withdrawn successfully",
+	})
+}
+
 // Get My ocertime requests
 func (h *OvertimeHandler) GetMyOvertimeRequests(c *gin.Context) {
+	var query RequestListQuery
+	if !bindQuery(c, &query) {
+		return
+	}
 	userIDVal, _ := c.Get("userID")
-	userID := int64(userIDVal.(float64))
+	filter := query.filter()
+	filter.UserID = int64(userIDVal.(float64))
 
-	requests, err := h.overtimeService.GetMyRequests(c.Request.Context(), userID)
+	requests, page, err := h.overtimeService.ListRequests(c.Request.Context(), filter, query.list.opts)
 
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch your requests", "SERVER_ERROR")
-		log.Gl.Error("Failed to fetch user requests", zap.Error(err))
+		SendError(c, err)
 		return
 	}
 
 	if requests == nil {
 		requests = make([]models.OvertimeRequest, 0)
 	}
+	for i := range requests {
+		hideAllocationSeed(c, requests[i].Slot)
+	}
 
-	SendSuccessResponse(c, http.StatusOK, requests)
+	SendPageResponse(c, http.StatusOK, requests, page)
 }
 
 // Get All overtime Req for Admins
 func (h *OvertimeHandler) GetAllOvertimeRequests(c *gin.Context) {
+	var query RequestListQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+	filter := query.filter()
+	filter.WithApprovals = true
+	reviewerIDVal, _ := c.Get("userID")
+	reviewerID := int64(reviewerIDVal.(float64))
 
-	requests, err := h.overtimeService.GetAllRequests(c.Request.Context())
+	requests, page, err := h.overtimeService.ListReviewRequests(c.Request.Context(), reviewerID, filter, query.list.opts)
 
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch all requests", "SERVER_ERROR")
-		log.Gl.Error("Failed to fetch all requests", zap.Error(err))
+		SendError(c, err)
+		return
+	}
+	if err := h.overtimeService.AnnotateRecentHours(c.Request.Context(), requests); err != nil {
+		SendError(c, err)
 		return
 	}
 
 	if requests == nil {
 		requests = make([]models.OvertimeRequest, 0)
 	}
+	for i := range requests {
+		hideAllocationSeed(c, requests[i].Slot)
+	}
 
-	SendSuccessResponse(c, http.StatusOK, requests)
+	SendPageResponse(c, http.StatusOK, requests, page)
 }
 
 // Update Request Status
@@ -177,22 +228,17 @@ func (h *OvertimeHandler) UpdateOvertimeReqStatus(c *gin.Context) {
 		return
 	}
 	var input UpdateRequestStatusInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		SendErrorResponse(c, http.StatusBadRequest, "Invalid input data for status", "INVALID_INPUT")
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	managerIDVal, _ := c.Get("userID")
 	managerID := int64(managerIDVal.(float64))
 
-	err = h.overtimeService.UpdateRequestStatus(c.Request.Context(), requestID, managerID, input.Status)
+	err = h.overtimeService.UpdateRequestStatus(c.Request.Context(), requestID, managerID, input.Status, input.Reason, input.Comment)
 
 	if err != nil {
-		if err == service.ErrRequestNotFound {
-			SendErrorResponse(c, http.StatusNotFound, "The requested overtime request was not found", "NOT_FOUND")
-		} else {
-			SendErrorResponse(c, http.StatusInternalServerError, "Failed to update request status", "SERVER_ERROR")
-		}
+		SendError(c, err)
 		return
 	}
 
@@ -201,40 +247,244 @@ func (h *OvertimeHandler) UpdateOvertimeReqStatus(c *gin.Context) {
 	})
 }
 
-// Export Approved Requests As CSV
-func (h *OvertimeHandler) ExportApprovedRequestsAsCSV(c *gin.Context) {
-	approvedRequests, err := h.overtimeService.GetApprovedRequests(c.Request.Context())
+// Allocate a slot's pending requests with its allocation strategy
+func (h *OvertimeHandler) AllocateSlot(c *gin.Context) {
+	slotID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		SendErrorResponse(c, http.StatusInternalServerError, "Failed to fetch approved requests", "SERVER_ERROR")
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid slot ID format", "INVALID_INPUT")
 		return
 	}
+	var input AllocateSlotInput
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
 
-	c.Header("Content-Type", "text/csv")
-	c.Header("Content-Disposition", `attachment; filename="approved_requests_report.csv"`)
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
 
-	writer := csv.NewWriter(c.Writer)
+	allocations, err := h.overtimeService.AllocateSlot(c.Request.Context(), slotID, input.Strategy, &managerID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if allocations == nil {
+		allocations = make([]service.Allocation, 0)
+	}
 
-	header := []string{"RequestID", "PersonnelCode", "FullName", "TeamID", "SlotTitle", "StartTime", "EndTime", "ReviewedByManagerID"}
-	writer.Write(header)
+	SendSuccessResponse(c, http.StatusOK, allocations)
+}
 
-	for _, req := range approvedRequests {
-		var managerIDStr string
-		if req.ReviewedBy != nil {
-			managerIDStr = fmt.Sprintf("%d", *req.ReviewedBy)
+func (h *OvertimeHandler) CancelSlot(c *gin.Context) {
+	slotID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid slot ID format", "INVALID_INPUT")
+		return
+	}
+	var input CancelSlotInput
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
 		}
+	}
+
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
+
+	if err := h.overtimeService.CancelSlot(c.Request.Context(), slotID, input.Reason, &managerID); err != nil {
+		SendError(c, err)
+		return
+	}
 
-		row := []string{
-			fmt.Sprintf("%d", req.ID),
-			req.User.PersonnelCode,
-			req.User.FullName,
-			fmt.Sprintf("%d", req.User.TeamID),
-			req.Slot.Title,
-			req.Slot.StartTime.Format(time.RFC3339),
-			req.Slot.EndTime.Format(time.RFC3339),
-			managerIDStr,
+	SendSuccessResponse(c, http.StatusOK, gin.H{"message": "Slot cancelled"})
+}
+
+// Record whether the applicant of an approved request turned up
+func (h *OvertimeHandler) RecordAttendance(c *gin.Context) {
+	requestID, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var input RecordAttendanceInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	request, err := h.overtimeService.RecordAttendance(c.Request.Context(), requestID, input.Attendance)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, request)
+}
+
+// Bulk review: decide a list of requests, or approve the first N of a slot
+// and reject the rest
+func (h *OvertimeHandler) BulkUpdateOvertimeReqStatus(c *gin.Context) {
+	var input BulkReviewInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	managerIDVal, _ := c.Get("userID")
+	managerID := int64(managerIDVal.(float64))
+
+	var results []service.BulkResult
+	var err error
+	switch {
+	case input.SlotID != 0 && input.ApproveFirst != nil && *input.ApproveFirst >= 0:
+		rejectReason := input.RejectReason
+		if rejectReason == "" {
+			rejectReason = input.Reason
 		}
-		writer.Write(row)
+		results, err = h.overtimeService.ApproveFirstForSlot(c.Request.Context(), input.SlotID, *input.ApproveFirst, managerID, input.Reason, rejectReason, input.Comment)
+	case input.Status != "" && len(input.RequestIDs) > 0:
+		results, err = h.overtimeService.BulkUpdateRequestStatus(c.Request.Context(), input.RequestIDs, managerID, input.Status, input.Reason, input.Comment)
+	default:
+		SendErrorResponse(c, http.StatusBadRequest, "Provide status and request_ids, or slot_id and approve_first", "INVALID_INPUT")
+		return
+	}
+	if err != nil {
+		SendError(c, err)
+		return
 	}
 
-	writer.Flush()
+	response := BulkReviewResponse{Results: make([]BulkReviewItem, 0, len(results))}
+	for _, result := range results {
+		item := BulkReviewItem{RequestID: result.RequestID, Decision: result.Decision, Status: result.Status, Success: result.Err == nil}
+		if result.Err != nil {
+			e := service.AsError(result.Err)
+			item.Message = i18n.Message(c.GetString("locale"), e.Code, sentence(e.Message))
+			item.Reason = e.Code
+			if e.Status >= http.StatusInternalServerError {
+				log.Gl.Error("Bulk review item failed", zap.String("correlation_id", c.GetString("requestID")),
+					zap.Int64("request_id", result.RequestID), zap.NamedError("cause", e.Cause))
+			}
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+		response.Results = append(response.Results, item)
+	}
+
+	SendSuccessResponse(c, http.StatusOK, response)
+}
+
+// Export requests as CSV, XLSX or PDF, narrowed by the request list
+// filters and approved ones only unless a status is given. Rows are
+// streamed in slot start order unless another sort is given; cursor and
+// limit are ignored.
+func (h *OvertimeHandler) ExportRequests(c *gin.Context) {
+	var query RequestListQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+	var report ReportQuery
+	if !bindQuery(c, &report) {
+		return
+	}
+
+	filter := query.filter()
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []string{models.RequestStatusApproved}
+	}
+	opts := query.list.opts
+	if query.Sort == "" {
+		opts.Sort, opts.Desc = "slot_start", query.Order == "desc"
+	}
+	opts.After, opts.Limit = nil, 0
+
+	var err error
+	switch report.Format {
+	case "xlsx":
+		err = h.exportXLSX(c, &report, filter, opts)
+	case "pdf":
+		err = h.exportPDF(c, &query, filter, opts)
+	default:
+		csvReport := newCSVReport(c, &report, "overtime_requests_report.csv")
+		err = h.overtimeService.EachReportRow(c.Request.Context(), filter, opts, csvReport.write)
+		if err == nil {
+			err = csvReport.finish()
+		} else {
+			csvReport.abort()
+		}
+	}
+	if err != nil {
+		// Once rows were sent this only logs the error.
+		SendError(c, err)
+	}
+}
+
+// MonthlyReportQuery selects the slots of a monthly report by their start,
+// in inclusive days of the organization time zone, Gregorian or Jalali.
+type MonthlyReportQuery struct {
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Format string `form:"format" binding:"omitempty,oneof=json csv"`
+
+	list listQuery
+}
+
+func (q *MonthlyReportQuery) validate(v *validation) {
+	q.list.parse(v, "", nil, q.From, q.To)
+}
+
+// Sum approved overtime per user and month, in Jalali months when Jalali
+// dates are requested. format=csv returns a CSV file.
+func (h *OvertimeHandler) GetMonthlyReport(c *gin.Context) {
+	var query MonthlyReportQuery
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	calendar := models.CalendarGregorian
+	if wantsJalali(c) {
+		calendar = models.CalendarJalali
+	}
+	totals, err := h.overtimeService.MonthlyTotals(c.Request.Context(), calendar, query.list.from, query.list.to)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+
+	if query.Format != "csv" {
+		SendSuccessResponse(c, http.StatusOK, totals)
+		return
+	}
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="monthly_overtime_report.csv"`)
+	writer := csv.NewWriter(c.Writer)
+	err = writer.Write([]string{"Period", "PersonnelCode", "FullName", "TeamID", "Requests", "Hours", "HolidayHours"})
+	for i := 0; err == nil && i < len(totals); i++ {
+		t := &totals[i]
+		err = writer.Write([]string{
+			t.Period,
+			csvText(t.PersonnelCode),
+			csvText(t.FullName),
+			strconv.FormatInt(t.TeamID, 10),
+			strconv.Itoa(t.Requests),
+			strconv.FormatFloat(t.Hours, 'f', 2, 64),
+			strconv.FormatFloat(t.HolidayHours, 'f', 2, 64),
+		})
+	}
+	if err == nil {
+		writer.Flush()
+		err = writer.Error()
+	}
+	if err != nil {
+		// The headers are sent, so this only logs the error.
+		SendError(c, err)
+	}
+}
+
+// hideAllocationSeed clears the lottery seed of a slot that has not been
+// allocated yet unless a manager asks, so applicants cannot work out the
+// draw in advance.
+func hideAllocationSeed(c *gin.Context, slot *models.OvertimeSlot) {
+	if role, _ := c.Get("userRole"); role == models.RoleManager {
+		return
+	}
+	if slot != nil && slot.AllocatedAt == nil {
+		slot.AllocationSeed = nil
+	}
 }
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"shiftdony/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportQuery selects the format and layout of a report; RequestListQuery
+// selects its rows. Columns takes a comma separated list of column keys in
+// the order wanted, for CSV and XLSX reports; PDF reports are printable
+// sheets of fixed columns. Delimiter, BOM and Totals apply to CSV, the
+// other formats always end with totals.
+type ReportQuery struct {
+	Format    string `form:"format" binding:"omitempty,oneof=csv xlsx pdf"`
+	Columns   string `form:"columns"`
+	Delimiter string `form:"delimiter" binding:"omitempty,oneof=comma semicolon tab"`
+	BOM       bool   `form:"bom"`    // start with a UTF-8 byte order mark, for Excel
+	Totals    bool   `form:"totals"` // end with a row counting requests and summing hours
+
+	columns []reportColumn
+}
+
+// reportColumn is a column a report may include. value returns a string,
+// an int64, hours as a float64, a time.Time or nil for an empty cell.
+type reportColumn struct {
+	key    string
+	header string
+	width  float64 // in characters, for spreadsheets
+	value  func(row *service.ReportRow) interface{}
+}
+
+// reportColumns are the columns of reports, by key. Applicant and slot
+// columns are empty for requests whose user or slot was deleted.
+var reportColumns = []reportColumn{
+	{"request_id", "RequestID", 10, func(row *service.ReportRow) interface{} {
+		return row.Request.ID
+	}},
+	{"personnel_code", "PersonnelCode", 14, func(row *service.ReportRow) interface{} {
+		if row.Request.User == nil {
+			return nil
+		}
+		return row.Request.User.PersonnelCode
+	}},
+	{"full_name", "FullName", 28, func(row *service.ReportRow) interface{} {
+		if row.Request.User == nil {
+			return nil
+		}
+		return row.Request.User.FullName
+	}},
+	{"team_id", "TeamID", 8, func(row *service.ReportRow) interface{} {
+		if row.Request.User == nil {
+			return nil
+		}
+		return row.Request.User.TeamID
+	}},
+	{"slot_title", "SlotTitle", 28, func(row *service.ReportRow) interface{} {
+		if row.Request.Slot == nil {
+			return nil
+		}
+		return row.Request.Slot.Title
+	}},
+	{"start_time", "StartTime", 18, func(row *service.ReportRow) interface{} {
+		if row.Request.Slot == nil {
+			return nil
+		}
+		return row.Request.Slot.StartTime
+	}},
+	{"end_time", "EndTime", 18, func(row *service.ReportRow) interface{} {
+		if row.Request.Slot == nil {
+			return nil
+		}
+		return row.Request.Slot.EndTime
+	}},
+	{"hours", "Hours", 8, func(row *service.ReportRow) interface{} {
+		if row.Request.Slot == nil {
+			return nil
+		}
+		return row.Hours
+	}},
+	{"status", "Status", 12, func(row *service.ReportRow) interface{} {
+		return row.Request.Status
+	}},
+	{"request_time", "RequestTime", 18, func(row *service.ReportRow) interface{} {
+		return row.Request.RequestTime
+	}},
+	{"reviewed_by", "ReviewedByManagerID", 12, func(row *service.ReportRow) interface{} {
+		if row.Request.ReviewedBy == nil {
+			return nil
+		}
+		return *row.Request.ReviewedBy
+	}},
+	{"decision_reason", "DecisionReason", 28, func(row *service.ReportRow) interface{} {
+		return row.Request.DecisionReason
+	}},
+	{"day_type", "DayType", 10, func(row *service.ReportRow) interface{} {
+		return row.DayKind
+	}},
+}
+
+// text returns the value of the column as CSV text.
+func (col *reportColumn) text(c *gin.Context, row *service.ReportRow) string {
+	switch v := col.value(row).(type) {
+	case string:
+		return csvText(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatHours(v)
+	case time.Time:
+		return formatTime(c, v)
+	}
+	return ""
+}
+
+// csvText keeps user text from being read as a formula by spreadsheets:
+// text starting with a formula character gets a leading apostrophe.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// defaultReportColumns are the columns of reports that do not pick any.
+const defaultReportColumns = "request_id,personnel_code,full_name,team_id,slot_title,start_time,end_time,hours,reviewed_by,day_type"
+
+func (q *ReportQuery) validate(v *validation) {
+	columns := q.Columns
+	if strings.TrimSpace(columns) == "" {
+		columns = defaultReportColumns
+	}
+	keys := make([]string, len(reportColumns))
+	for i, column := range reportColumns {
+		keys[i] = column.key
+	}
+	for _, key := range strings.Split(columns, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		i := indexOf(keys, key)
+		if i < 0 {
+			v.fail("columns", "oneof", strings.Join(keys, " "))
+			return
+		}
+		q.columns = append(q.columns, reportColumns[i])
+	}
+	if len(q.columns) == 0 {
+		v.fail("columns", "required", "")
+	}
+}
+
+// comma returns the field delimiter the query selects.
+func (q *ReportQuery) comma() rune {
+	switch q.Delimiter {
+	case "semicolon":
+		return ';'
+	case "tab":
+		return '\t'
+	}
+	return ','
+}
+
+// totalLabel labels the totals row of a report of n requests.
+func totalLabel(n int) string {
+	return "Total (" + strconv.Itoa(n) + ")"
+}
+
+// csvReport writes a CSV report to the response. Nothing is sent before
+// the first row, so errors of the query itself still get an error
+// response.
+type csvReport struct {
+	c        *gin.Context
+	query    *ReportQuery
+	filename string
+	writer   *csv.Writer
+	rows     int
+	hours    float64
+}
+
+// reportFlushRows is how many rows a CSV report buffers before sending
+// them, so long reports reach the client while they are written.
+const reportFlushRows = 500
+
+func newCSVReport(c *gin.Context, query *ReportQuery, filename string) *csvReport {
+	return &csvReport{c: c, query: query, filename: filename}
+}
+
+// start sends the headers, the byte order mark if asked and the header
+// row.
+func (r *csvReport) start() error {
+	r.c.Header("Content-Type", "text/csv; charset=utf-8")
+	r.c.Header("Content-Disposition", `attachment; filename="`+r.filename+`"`)
+	if r.query.BOM {
+		if _, err := r.c.Writer.WriteString("\xEF\xBB\xBF"); err != nil {
+			return err
+		}
+	}
+	r.writer = csv.NewWriter(r.c.Writer)
+	r.writer.Comma = r.query.comma()
+	header := make([]string, len(r.query.columns))
+	for i, column := range r.query.columns {
+		header[i] = column.header
+	}
+	return r.writer.Write(header)
+}
+
+// write adds a row, flushing every reportFlushRows rows.
+func (r *csvReport) write(row *service.ReportRow) error {
+	if r.writer == nil {
+		if err := r.start(); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(r.query.columns))
+	for i, column := range r.query.columns {
+		record[i] = column.text(r.c, row)
+	}
+	if err := r.writer.Write(record); err != nil {
+		return err
+	}
+	r.rows++
+	r.hours += row.Hours
+	if r.rows%reportFlushRows == 0 {
+		return r.flush()
+	}
+	return nil
+}
+
+// finish writes the totals row if asked and sends what is left. The
+// totals row counts the requests in the first column other than hours,
+// and sums the hours column.
+func (r *csvReport) finish() error {
+	if r.writer == nil {
+		if err := r.start(); err != nil {
+			return err
+		}
+	}
+	if r.query.Totals {
+		record := make([]string, len(r.query.columns))
+		label := true
+		for i, column := range r.query.columns {
+			switch {
+			case column.key == "hours":
+				record[i] = formatHours(r.hours)
+			case label:
+				record[i] = totalLabel(r.rows)
+				label = false
+			}
+		}
+		if err := r.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return r.flush()
+}
+
+// reportErrorMarker starts the last row of a CSV report that failed after
+// rows were sent, as the status code can no longer tell.
+const reportErrorMarker = "#ERROR: the report is incomplete"
+
+// abort ends a report that failed. Before the first row nothing was sent,
+// so the error response still goes out; after it the report ends with an
+// error marker row instead of looking complete.
+func (r *csvReport) abort() {
+	if r.writer == nil {
+		return
+	}
+	record := make([]string, len(r.query.columns))
+	record[0] = reportErrorMarker
+	if err := r.writer.Write(record); err == nil {
+		r.flush()
+	}
+}
+
+func (r *csvReport) flush() error {
+	r.writer.Flush()
+	if err := r.writer.Error(); err != nil {
+		return err
+	}
+	r.c.Writer.Flush()
+	return nil
+}
+
+func formatHours(h float64) string {
+	return strconv.FormatFloat(h, 'f', 2, 64)
+}
+
+func indexOf(values []string, v string) int {
+	for i, value := range values {
+		if value == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"shiftdony/i18n"
+	"shiftdony/models"
+	"shiftdony/pdf"
+	"shiftdony/pdf/fonts"
+	"shiftdony/service"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportFont is parsed once, on the first PDF report.
+var reportFont = sync.OnceValues(func() (*pdf.Font, error) {
+	return pdf.ParseFont(fonts.DejaVuSans)
+})
+
+// Layout of printed sheets, in points.
+const (
+	sheetMargin    = 40.0
+	sheetFooter    = 30.0 // space kept for the page number
+	sheetRowHeight = 15.0
+	sheetTextSize  = 8.5
+	sheetSignature = 95.0 // height of the signature block
+)
+
+// sheetColumn is a column of printed sheets.
+type sheetColumn struct {
+	label string
+	width float64
+	value func(c *gin.Context, n int, row *service.ReportRow) string
+}
+
+var sheetColumns = []sheetColumn{
+	{"#", 24, func(c *gin.Context, n int, row *service.ReportRow) string {
+		return strconv.Itoa(n)
+	}},
+	{"Personnel code", 64, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.User == nil {
+			return ""
+		}
+		return row.Request.User.PersonnelCode
+	}},
+	{"Name", 110, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.User == nil {
+			return ""
+		}
+		return row.Request.User.FullName
+	}},
+	{"Slot", 110, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.Slot == nil {
+			return ""
+		}
+		return row.Request.Slot.Title
+	}},
+	{"Start", 76, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.Slot == nil {
+			return ""
+		}
+		return formatShort(c, row.Request.Slot.StartTime)
+	}},
+	{"End", 76, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.Slot == nil {
+			return ""
+		}
+		return formatShort(c, row.Request.Slot.EndTime)
+	}},
+	{"Hours", 40, func(c *gin.Context, n int, row *service.ReportRow) string {
+		if row.Request.Slot == nil {
+			return ""
+		}
+		return formatHours(row.Hours)
+	}},
+}
+
+// signatures label the signature lines at the end of each sheet.
+var signatures = []string{"Prepared by", "Team manager", "Finance"}
+
+// exportPDF prints an overtime sheet per team that has requests in the
+// report, each ending with its total and signature lines. Labels follow
+// the request's locale, and pages run right to left for Persian.
+func (h *OvertimeHandler) exportPDF(c *gin.Context, query *RequestListQuery, filter models.RequestFilter, opts models.ListOptions) error {
+	ctx := c.Request.Context()
+	font, err := reportFont()
+	if err != nil {
+		return service.ErrInternalServer.Wrap(err)
+	}
+	teams, err := h.overtimeService.ReportTeams(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", `attachment; filename="overtime_requests_report.pdf"`)
+	s := &overtimeSheet{
+		c:      c,
+		doc:    pdf.New(c.Writer, font, pdf.A4Width, pdf.A4Height),
+		locale: c.GetString("locale"),
+		period: reportPeriod(c, query),
+	}
+	s.rtl = i18n.RTL(s.locale)
+	for _, team := range teams {
+		filter.TeamID = team.ID
+		s.team, s.rows, s.hours = teamName(&team), 0, 0
+		err := h.overtimeService.EachReportRow(ctx, filter, opts, func(row *service.ReportRow) error {
+			if s.rows == 0 {
+				s.newPage()
+			}
+			s.row(row)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if s.rows > 0 {
+			s.finish()
+		}
+	}
+	if s.pages == 0 {
+		s.team = ""
+		s.newPage()
+		s.text(sheetMargin, s.y+sheetRowHeight, 10, s.label("No requests match the report"), s.doc.Width()-2*sheetMargin)
+	}
+	return s.doc.Close()
+}
+
+// reportPeriod describes the dates a report covers.
+func reportPeriod(c *gin.Context, query *RequestListQuery) string {
+	from, to := query.list.from, query.list.to
+	switch {
+	case from.IsZero() && to.IsZero():
+		return ""
+	case to.IsZero():
+		return formatDay(c, from) + " –"
+	}
+	// to is the day after the last one listed.
+	last := formatDay(c, to.AddDate(0, 0, -1))
+	if from.IsZero() {
+		return "– " + last
+	}
+	return formatDay(c, from) + " – " + last
+}
+
+// overtimeSheet prints the overtime sheets of a PDF report.
+type overtimeSheet struct {
+	c      *gin.Context
+	doc    *pdf.Document
+	locale string
+	rtl    bool
+	period string
+
+	team  string
+	rows  int
+	hours float64
+	pages int
+	y     float64 // top of the next row
+}
+
+func (s *overtimeSheet) label(text string) string {
+	return i18n.Message(s.locale, "", text)
+}
+
+// newPage starts a page with the title of the team's sheet and the table
+// header.
+func (s *overtimeSheet) newPage() {
+	s.doc.AddPage()
+	s.pages++
+	width := s.doc.Width() - 2*sheetMargin
+	s.text(sheetMargin, sheetMargin+14, 14, s.label("Overtime sheet"), width)
+	y := sheetMargin + 34
+	if s.team != "" {
+		s.text(sheetMargin, y, 10, s.label("Team")+": "+s.team, width)
+		y += 15
+	}
+	if s.period != "" {
+		s.text(sheetMargin, y, 10, s.label("Period")+": "+s.period, width)
+		y += 15
+	}
+	page := s.label("Page") + " " + strconv.Itoa(s.pages)
+	s.text(sheetMargin, s.doc.Height()-sheetFooter+10, 8, page, width)
+
+	y += 5
+	s.doc.FillRect(sheetMargin, y, width, sheetRowHeight, 0.88)
+	x := 0.0
+	for _, column := range sheetColumns {
+		s.cell(x, y, column.width, s.label(column.label))
+		x += column.width
+	}
+	s.y = y + sheetRowHeight
+}
+
+// row prints a request, breaking the page when it is full.
+func (s *overtimeSheet) row(row *service.ReportRow) {
+	if s.y+sheetRowHeight > s.doc.Height()-sheetMargin-sheetFooter {
+		s.newPage()
+	}
+	s.rows++
+	s.hours += row.Hours
+	x := 0.0
+	for _, column := range sheetColumns {
+		s.cell(x, s.y, column.width, column.value(s.c, s.rows, row))
+		x += column.width
+	}
+	s.doc.Line(sheetMargin, s.y+sheetRowHeight, s.doc.Width()-sheetMargin, s.y+sheetRowHeight, 0.25)
+	s.y += sheetRowHeight
+}
+
+// finish prints the total hours and the signature lines of the sheet.
+func (s *overtimeSheet) finish() {
+	if s.y+sheetRowHeight+sheetSignature > s.doc.Height()-sheetMargin-sheetFooter {
+		s.newPage()
+	}
+	width := s.doc.Width() - 2*sheetMargin
+	s.doc.Line(sheetMargin, s.y, s.doc.Width()-sheetMargin, s.y, 0.75)
+	last := sheetColumns[len(sheetColumns)-1]
+	s.cell(0, s.y, width-last.width, s.label("Total")+" ("+strconv.Itoa(s.rows)+")")
+	s.cell(width-last.width, s.y, last.width, formatHours(s.hours))
+	s.y += sheetRowHeight
+
+	// Each signature gets a third of the width: its label, room to sign
+	// and a line.
+	box := width / float64(len(signatures))
+	top := s.y + 25
+	for i, signature := range signatures {
+		x := sheetMargin + float64(i)*box
+		if s.rtl {
+			x = s.doc.Width() - sheetMargin - float64(i+1)*box
+		}
+		s.text(x+10, top, 9, s.label(signature), box-20)
+		s.doc.Line(x+10, top+45, x+box-10, top+45, 0.5)
+		s.text(x+10, top+57, 7.5, s.label("Signature and date"), box-20)
+	}
+	s.y = top + sheetSignature
+}
+
+// cell prints text in a table cell starting x points after the start of
+// the line, at the left in left-to-right pages and at the right in
+// right-to-left ones.
+func (s *overtimeSheet) cell(x, y, width float64, text string) {
+	left := sheetMargin + x
+	if s.rtl {
+		left = s.doc.Width() - sheetMargin - x - width
+	}
+	s.text(left+3, y+sheetRowHeight-4.5, sheetTextSize, text, width-6)
+}
+
+// text prints a line in a box of the given width, aligned to the start of
+// the page and shortened with an ellipsis if it does not fit.
+func (s *overtimeSheet) text(left, baseline, size float64, text string, width float64) {
+	text = fit(s.doc, text, size, width)
+	x := left
+	if s.rtl {
+		x = left + width - s.doc.TextWidth(text, size)
+	}
+	s.doc.Text(x, baseline, size, text, pdf.IsRTL(text))
+}
+
+// fit shortens text with an ellipsis until it fits in width.
+func fit(doc *pdf.Document, text string, size, width float64) string {
+	if doc.TextWidth(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if short := string(runes) + "…"; doc.TextWidth(short, size) <= width {
+			return short
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Night shift", "Night shift"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+98 912", "'+98 912"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=b", "a=b"},
+		{"علی", "علی"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.in); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCSVReportAbort(t *testing.T) {
+	query := &ReportQuery{columns: reportColumns[:3]}
+	row := &service.ReportRow{Request: &models.OvertimeRequest{
+		ID:   1,
+		User: &models.User{PersonnelCode: "-7", FullName: "=cmd|' /C calc'!A0"},
+	}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	report := newCSVReport(c, query, "r.csv")
+	if err := report.write(row); err != nil {
+		t.Fatal(err)
+	}
+	report.abort()
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"RequestID", "PersonnelCode", "FullName"},
+		{"1", "'-7", "'=cmd|' /C calc'!A0"},
+		{reportErrorMarker, "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records %q, want %q", records, want)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+
+	// Before the first row nothing is written, so an error response can
+	// still be sent.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	newCSVReport(c, query, "r.csv").abort()
+	if w.Body.Len() != 0 || c.Writer.Written() {
+		t.Errorf("aborted empty report wrote %q", w.Body.String())
+	}
+}
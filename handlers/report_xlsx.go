@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"shiftdony/i18n"
+	"shiftdony/models"
+	"shiftdony/service"
+	"shiftdony/xlsx"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// teamTotal sums the requests of one team in a report.
+type teamTotal struct {
+	team       models.Team
+	requests   int
+	applicants map[int64]bool
+	hours      float64
+}
+
+// exportXLSX writes a workbook with a sheet per team that has requests in
+// the report, then a summary sheet placed first. Sheets are streamed team
+// by team.
+func (h *OvertimeHandler) exportXLSX(c *gin.Context, report *ReportQuery, filter models.RequestFilter, opts models.ListOptions) error {
+	ctx := c.Request.Context()
+	teams, err := h.overtimeService.ReportTeams(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", xlsxContentType)
+	c.Header("Content-Disposition", `attachment; filename="overtime_requests_report.xlsx"`)
+	book := xlsx.NewWriter(c.Writer)
+	book.RightToLeft = i18n.RTL(c.GetString("locale"))
+
+	widths := make([]float64, len(report.columns))
+	header := make([]xlsx.Cell, len(report.columns))
+	for i, column := range report.columns {
+		widths[i] = column.width
+		header[i] = xlsx.String(column.header)
+	}
+	var totals []*teamTotal
+	for _, team := range teams {
+		filter.TeamID = team.ID
+		total := &teamTotal{team: team, applicants: make(map[int64]bool)}
+		err := h.overtimeService.EachReportRow(ctx, filter, opts, func(row *service.ReportRow) error {
+			if total.requests == 0 {
+				if err := book.AddSheet(teamName(&team), widths...); err != nil {
+					return err
+				}
+				if err := book.WriteRow(header...); err != nil {
+					return err
+				}
+			}
+			cells := make([]xlsx.Cell, len(report.columns))
+			for i := range report.columns {
+				cells[i] = xlsxCell(c, report.columns[i].value(row))
+			}
+			total.requests++
+			total.applicants[row.Request.UserID] = true
+			total.hours += row.Hours
+			return book.WriteRow(cells...)
+		})
+		if err != nil {
+			return err
+		}
+		if total.requests == 0 {
+			continue
+		}
+		if err := book.WriteRow(xlsxTotals(report.columns, total.requests, total.hours)...); err != nil {
+			return err
+		}
+		totals = append(totals, total)
+	}
+
+	if err := book.InsertSheet(0, "Summary", 28, 8, 10, 12, 10); err != nil {
+		return err
+	}
+	rows := [][]xlsx.Cell{{
+		xlsx.String("Team"), xlsx.String("TeamID"), xlsx.String("Requests"), xlsx.String("Applicants"), xlsx.String("Hours"),
+	}}
+	var requests, applicants int
+	var hours float64
+	for _, total := range totals {
+		rows = append(rows, []xlsx.Cell{
+			xlsx.String(teamName(&total.team)),
+			xlsx.Int(total.team.ID),
+			xlsx.Int(int64(total.requests)),
+			xlsx.Int(int64(len(total.applicants))),
+			xlsx.Number(total.hours),
+		})
+		requests += total.requests
+		applicants += len(total.applicants)
+		hours += total.hours
+	}
+	rows = append(rows, []xlsx.Cell{
+		xlsx.String("Total").Bold(), {}, xlsx.Int(int64(requests)).Bold(), xlsx.Int(int64(applicants)).Bold(), xlsx.Number(hours).Bold(),
+	})
+	for _, row := range rows {
+		if err := book.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	return book.Close()
+}
+
+// xlsxCell types a column value. Times are shown in the request's zone,
+// and in the Jalali calendar when asked.
+func xlsxCell(c *gin.Context, value interface{}) xlsx.Cell {
+	switch v := value.(type) {
+	case string:
+		return xlsx.String(v)
+	case int64:
+		return xlsx.Int(v)
+	case float64:
+		return xlsx.Number(v)
+	case time.Time:
+		if wantsJalali(c) {
+			return xlsx.PersianTime(v.In(viewerLocation(c)))
+		}
+		return xlsx.Time(v.In(viewerLocation(c)))
+	}
+	return xlsx.Cell{}
+}
+
+// xlsxTotals returns the totals row of a team sheet: the request count in
+// the first column other than hours and the sum of the hours column.
+func xlsxTotals(columns []reportColumn, n int, hours float64) []xlsx.Cell {
+	cells := make([]xlsx.Cell, len(columns))
+	label := true
+	for i, column := range columns {
+		switch {
+		case column.key == "hours":
+			cells[i] = xlsx.Number(hours).Bold()
+		case label:
+			cells[i] = xlsx.String(totalLabel(n)).Bold()
+			label = false
+		}
+	}
+	return cells
+}
+
+// teamName returns the name of a team, or its ID if it has none.
+func teamName(team *models.Team) string {
+	if team.Name != "" {
+		return team.Name
+	}
+	return "Team " + strconv.FormatInt(team.ID, 10)
+}
@@ -1,29 +1,132 @@
 package handlers
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"shiftdony/i18n"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error as RFC 7807 problem details, the default error
+// format. Code, RequestID, Retryable and Errors are extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Retryable bool         `json:"retryable"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// ErrorResponse is the error format of clients that accept
+// application/json but not application/problem+json.
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Reason  string `json:"reason,omitempty"` //if it's empty, don't include it in JSON
+	Success   bool         `json:"success"`
+	Message   string       `json:"message"`
+	Reason    string       `json:"reason,omitempty"` //if it's empty, don't include it in JSON
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
 }
 
 type SuccessResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data"`
+	Success bool             `json:"success"`
+	Data    interface{}      `json:"data"`
+	Page    *models.PageInfo `json:"page,omitempty"` // set on lists
+}
+
+// SendError aborts the request with err for the error middleware to
+// write. A *service.Error is reported as it is; any other error is an
+// internal one whose text is logged but not shown.
+func SendError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// SendErrorResponse aborts the request with an error the handler made up
+// itself. message is English and is translated to the request's locale,
+// see i18n.Message.
+func SendErrorResponse(c *gin.Context, statusCode int, message, reason string) {
+	SendError(c, &service.Error{Code: reason, Status: statusCode, Message: message})
 }
 
-func SendErrorResponse(c *gin.Context, statusCode int, message, reason string){
-	c.JSON(statusCode, ErrorResponse{
-		Success: false,
-		Message: message,
-		Reason: reason,
+// WriteError writes err as problem details, or as an ErrorResponse when
+// the client prefers application/json. It is the writer of
+// middleware.ErrorMiddleware.
+func WriteError(c *gin.Context, err *gin.Error) {
+	e := service.AsError(err.Err)
+	fields, _ := err.Meta.([]FieldError)
+	locale := c.GetString("locale")
+	if locale == "" {
+		// Errors raised before ViewerMiddleware ran.
+		locale = i18n.Match(c.GetHeader("Accept-Language"))
+	}
+	message := i18n.Message(locale, e.Code, sentence(e.Message))
+	requestID := c.GetString("requestID")
+	if e.Retryable {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+
+	// Downloads may fail after setting their own headers.
+	c.Writer.Header().Del("Content-Disposition")
+	if c.NegotiateFormat(ProblemContentType, gin.MIMEJSON) == gin.MIMEJSON {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(e.Status, ErrorResponse{
+			Success:   false,
+			Message:   message,
+			Reason:    e.Code,
+			RequestID: requestID,
+			Errors:    fields,
+		})
+		return
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(e.Status, Problem{
+		Type:      "urn:shiftdony:problem:" + strings.ToLower(strings.ReplaceAll(e.Code, "_", "-")),
+		Title:     i18n.Message(locale, e.Code, http.StatusText(e.Status)),
+		Status:    e.Status,
+		Detail:    message,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: requestID,
+		Retryable: e.Retryable,
+		Errors:    fields,
 	})
 }
 
-func SendSuccessResponse(c *gin.Context, statusCode int, data interface{}){
+// retryAfterSeconds is the Retry-After sent with retryable errors.
+const retryAfterSeconds = 5
+
+// sentence capitalizes the service's lower-case messages.
+func sentence(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func SendSuccessResponse(c *gin.Context, statusCode int, data interface{}) {
+	SendPageResponse(c, statusCode, data, nil)
+}
+
+// SendPageResponse answers with one page of a list.
+func SendPageResponse(c *gin.Context, statusCode int, data interface{}, page *models.PageInfo) {
+	data = renderDates(c, data)
 	c.JSON(statusCode, SuccessResponse{
 		Success: true,
-		Data: data,
+		Data:    data,
+		Page:    page,
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"shiftdony/config"
+	log "shiftdony/logs"
+	"shiftdony/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type StreamHandler struct {
+	stream *service.EventStream
+}
+
+func NewStreamHandler(stream *service.EventStream) *StreamHandler {
+	return &StreamHandler{stream: stream}
+}
+
+// Stream live slot, request and review updates as Server-Sent Events
+func (h *StreamHandler) Stream(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	var lastEventID int64
+	if lastID != "" {
+		var err error
+		if lastEventID, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			SendErrorResponse(c, http.StatusBadRequest, "Invalid Last-Event-ID", "INVALID_INPUT")
+			return
+		}
+	}
+
+	sub, backlog, err := h.stream.Subscribe(c.Request.Context(), userID, lastEventID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	// Live events already sent with the backlog are skipped. Events commit
+	// out of ID order, so this goes by what was sent, not the highest ID.
+	sent := make(map[streamEventKey]bool, len(backlog))
+	for _, ev := range backlog {
+		if !writeStreamEvent(c, ev) {
+			return
+		}
+		sent[streamEventKey{ev.ID, ev.Name}] = true
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(config.C.Stream.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if key := (streamEventKey{ev.ID, ev.Name}); sent[key] {
+				delete(sent, key)
+				continue
+			}
+			if !writeStreamEvent(c, ev) {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// Create a short-lived ticket for opening the event stream
+func (h *StreamHandler) CreateTicket(c *gin.Context) {
+	userIDVal, _ := c.Get("userID")
+	userRole, _ := c.Get("userRole")
+	role, _ := userRole.(string)
+
+	ticket, expiresAt, err := h.stream.IssueTicket(int64(userIDVal.(float64)), role)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
+
+// streamEventKey identifies a stream event; one outbox event can yield
+// several stream events with the same ID.
+type streamEventKey struct {
+	id   int64
+	name string
+}
+
+func writeStreamEvent(c *gin.Context, ev service.StreamEvent) bool {
+	data, err := json.Marshal(renderDates(c, ev.Data))
+	if err != nil {
+		log.Gl.Error("Could not encode stream event", zap.Int64("event_id", ev.ID), zap.Error(err))
+		return true
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Name, data)
+	return err == nil
+}
@@ -22,8 +22,7 @@ func (h *UserHandler) RegisterUser(c *gin.Context) {
 	var input RegisterInput
 
 	//Read inputs
-	if err := c.ShouldBindJSON(&input); err != nil {
-		SendErrorResponse(c, http.StatusBadRequest, "Invalid input data", "INVALID_INPUT")
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -33,17 +32,11 @@ func (h *UserHandler) RegisterUser(c *gin.Context) {
 		input.PersonnelCode,
 		input.FullName,
 		input.Password,
+		input.Email,
 		input.TeamID,
 	)
 	if err != nil {
-		if err == service.ErrPersonnelCodeExists {
-			SendErrorResponse(c, http.StatusConflict, "A user with this personnel code already exists", "ALREADY_EXISTS")
-			log.Gl.Info("A user with this personnel code already exists", zap.String("Personnel Code", input.PersonnelCode))
-
-		} else {
-			SendErrorResponse(c, http.StatusInternalServerError, "Failed to register user", "SERVER_ERROR")
-			log.Gl.Error("Failed to register user", zap.Error(err))
-		}
+		SendError(c, err)
 		return
 	}
 
@@ -57,8 +50,7 @@ func (h *UserHandler) RegisterUser(c *gin.Context) {
 func (h *UserHandler) Login(c *gin.Context) {
 	var input LoginInput
 	//Read inputs
-	if err := c.ShouldBindJSON(&input); err != nil {
-		SendErrorResponse(c, http.StatusBadRequest, "Invalid input data", "INVALID_INPUT")
+	if !bindJSON(c, &input) {
 		log.Gl.Info("Invalid input data for login", zap.String("Personnel Code", input.PersonnelCode))
 		return
 	}
@@ -67,13 +59,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 	token, err := h.userService.Login(c.Request.Context(), input.PersonnelCode, input.Password)
 
 	if err != nil {
-		if err == service.ErrInvalidCredentials {
-			SendErrorResponse(c, http.StatusUnauthorized, "Invalid personnel code or password", "INVALID_CREDENTIALS")
-			log.Gl.Info("Invalid personnel code or password", zap.String("Personnel Code", input.PersonnelCode))
-		} else {
-			SendErrorResponse(c, http.StatusInternalServerError, "Could not process login", "SERVER_ERROR")
-			log.Gl.Error("Could not process login", zap.String("Personnel Code", input.PersonnelCode), zap.Error(err))
-		}
+		SendError(c, err)
 		return
 	}
 
@@ -94,22 +80,52 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 
 	userID, ok := userIDVal.(float64)
 	if !ok {
-		SendErrorResponse(c, http.StatusInternalServerError, "Invalid user ID format in token", "SERVER_ERROR")
+		SendError(c, service.ErrUnauthorized)
 		return
 	}
 
 	userProfile, err := h.userService.GetProfile(c.Request.Context(), int64(userID))
 	if err != nil {
-		if err == service.ErrUserNotFound {
-			SendErrorResponse(c, http.StatusNotFound, "User profile not found", "NOT_FOUND")
-			log.Gl.Info("User profile not found", zap.Error(err))
-		} else {
-			SendErrorResponse(c, http.StatusInternalServerError, "Could not retrieve profile", "SERVER_ERROR")
-			log.Gl.Error("Could not retrieve profile", zap.Error(err))
-		}
+		SendError(c, err)
 		return
 
 	}
 
 	SendSuccessResponse(c, http.StatusOK, userProfile)
 }
+
+// Request a password reset email
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var input ForgotPasswordInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if err := h.userService.ForgotPassword(c.Request.Context(), input.PersonnelCode); err != nil {
+		SendError(c, err)
+		return
+	}
+
+	// Same answer whether or not the account exists.
+	SendSuccessResponse(c, http.StatusAccepted, gin.H{
+		"message": "If the account has an email address, a reset link was sent to it",
+	})
+}
+
+// Set a new password with a reset token
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	err := h.userService.ResetPassword(c.Request.Context(), input.Token, input.Password)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+	})
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"shiftdony/config"
+	"shiftdony/i18n"
+	"shiftdony/service"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`           // JSON path, e.g. "steps[1].approver_role"
+	Rule    string `json:"rule"`            // failed rule, e.g. "required" or "after"
+	Param   string `json:"param,omitempty"` // rule parameter, e.g. the other field of "after"
+	Message string `json:"message"`
+
+	key string // catalog entry of the message when it is not Rule
+}
+
+// validatable is implemented by inputs with rules that binding tags
+// cannot express, such as one field having to follow another. bindJSON
+// calls validate once the tags passed.
+type validatable interface {
+	validate(v *validation)
+}
+
+// validation collects the semantic errors of one input.
+type validation struct {
+	c      *gin.Context
+	now    time.Time
+	errors []FieldError
+}
+
+// fail records that field broke rule.
+func (v *validation) fail(field, rule, param string) {
+	v.errors = append(v.errors, FieldError{Field: field, Rule: rule, Param: param})
+}
+
+// resolve places a time given without an offset in the viewer's zone, see
+// resolveTimes, and records wall clocks a daylight saving change skips or
+// repeats. It reports whether d is usable; nil and zero times are.
+func (v *validation) resolve(field string, d *DateTime) bool {
+	switch err := resolveTimes(v.c, d); err {
+	case nil:
+		return true
+	case service.ErrNonexistentTime:
+		v.fail(field, "nonexistent_time", viewerLocation(v.c).String())
+	default:
+		v.fail(field, "ambiguous_time", viewerLocation(v.c).String())
+	}
+	return false
+}
+
+func init() {
+	// Report fields by their JSON names rather than Go names.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+	}
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		// Query inputs only name their parameters.
+		name, _, _ = strings.Cut(f.Tag.Get("form"), ",")
+	}
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// bindJSON binds the request body into obj, validates it and answers 400
+// with the invalid fields when either fails. Semantic rules are checked
+// even when binding tags failed, so every invalid field is reported.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	return checkBinding(c, obj, c.ShouldBindJSON(obj), decodeErrors)
+}
+
+// bindQuery is bindJSON for the query string.
+func bindQuery(c *gin.Context, obj interface{}) bool {
+	return checkBinding(c, obj, c.ShouldBindQuery(obj), func(c *gin.Context, err error) []FieldError {
+		return []FieldError{{
+			Rule:    "query",
+			Message: i18n.Rule(c.GetString("locale"), "query", "", ""),
+		}}
+	})
+}
+
+// checkBinding validates obj once bound with err, describing errors other
+// than failed binding tags with undecodable.
+func checkBinding(c *gin.Context, obj interface{}, err error, undecodable func(*gin.Context, error) []FieldError) bool {
+	var invalid validator.ValidationErrors
+	if err != nil && !errors.As(err, &invalid) {
+		sendFieldErrors(c, undecodable(c, err))
+		return false
+	}
+
+	v := &validation{c: c, now: time.Now()}
+	for _, fe := range invalid {
+		v.errors = append(v.errors, FieldError{
+			Field: fieldPath(fe.Namespace()),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+			key:   ruleKey(fe),
+		})
+	}
+	if in, ok := obj.(validatable); ok {
+		in.validate(v)
+	}
+	if len(v.errors) == 0 {
+		return true
+	}
+	locale := c.GetString("locale")
+	for i := range v.errors {
+		fe := &v.errors[i]
+		key := fe.key
+		if key == "" {
+			key = fe.Rule
+		}
+		fe.Message = i18n.Rule(locale, key, fe.Field, fe.Param)
+	}
+	sendFieldErrors(c, v.errors)
+	return false
+}
+
+// decodeErrors describes a body that could not be decoded at all.
+func decodeErrors(c *gin.Context, err error) []FieldError {
+	locale := c.GetString("locale")
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		kind := jsonKind(typeErr.Type)
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   kind,
+			Message: i18n.Rule(locale, "type", typeErr.Field, kind),
+		}}
+	case errors.Is(err, errInvalidTime):
+		return []FieldError{{
+			Rule:    "datetime",
+			Message: i18n.Rule(locale, "datetime", "", ""),
+		}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return []FieldError{{
+			Rule:    "json",
+			Message: i18n.Rule(locale, "json", "", ""),
+		}}
+	}
+	return nil
+}
+
+// ruleKey picks the catalog entry of a failed tag: length rules read
+// differently for text and lists than for numbers.
+func ruleKey(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "min", "max", "len":
+		switch fe.Kind() {
+		case reflect.String:
+			return fe.Tag() + "_chars"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fe.Tag() + "_items"
+		}
+	}
+	return fe.Tag()
+}
+
+// fieldPath turns a validator namespace such as
+// "CreateApprovalChainInput.steps[0].name" into the JSON path of the
+// field by dropping the type name.
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
+
+// jsonKind names the JSON type a Go type is decoded from.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Ptr:
+		return jsonKind(t.Elem())
+	}
+	return "object"
+}
+
+// sendFieldErrors answers 400 INVALID_INPUT with the invalid fields.
+func sendFieldErrors(c *gin.Context, fields []FieldError) {
+	_ = c.Error(service.ErrInvalidInput).SetMeta(fields)
+	c.Abort()
+}
+
+// The rules of inputs that need more than binding tags.
+
+func (in *CreateOvertimeInput) validate(v *validation) {
+	start := v.resolve("start_time", &in.StartTime)
+	end := v.resolve("end_time", &in.EndTime)
+	opens := v.resolve("application_opens_at", in.ApplicationOpensAt)
+	closes := v.resolve("application_closes_at", in.ApplicationClosesAt)
+	cutoff := v.resolve("cancellation_cutoff", in.CancellationCutoff)
+	if start && in.StartTime.IsZero() {
+		v.fail("start_time", "required", "")
+		start = false
+	}
+	if end && in.EndTime.IsZero() {
+		v.fail("end_time", "required", "")
+		end = false
+	}
+	if !start || !end {
+		return
+	}
+
+	if !in.EndTime.After(in.StartTime.Time) {
+		v.fail("end_time", "after", "start_time")
+	} else if max := config.C.Slots.MaxDuration; max > 0 && in.EndTime.Sub(in.StartTime.Time) > max {
+		v.fail("end_time", "max_duration", formatDuration(max))
+	}
+	if in.StartTime.Before(v.now) {
+		v.fail("start_time", "future", "")
+	}
+	if t := timePtr(in.ApplicationClosesAt); closes && t != nil {
+		if t.After(in.StartTime.Time) {
+			v.fail("application_closes_at", "before", "start_time")
+		}
+		if o := timePtr(in.ApplicationOpensAt); opens && o != nil && !t.After(*o) {
+			v.fail("application_closes_at", "after", "application_opens_at")
+		}
+	} else if o := timePtr(in.ApplicationOpensAt); opens && o != nil && !o.Before(in.StartTime.Time) {
+		v.fail("application_opens_at", "before", "start_time")
+	}
+	if t := timePtr(in.CancellationCutoff); cutoff && t != nil && t.After(in.StartTime.Time) {
+		v.fail("cancellation_cutoff", "before", "start_time")
+	}
+}
+
+func (in *CreateDelegationInput) validate(v *validation) {
+	if !in.EndsAt.After(in.StartsAt) {
+		v.fail("ends_at", "after", "starts_at")
+	}
+}
+
+func (in *CreateApprovalChainInput) validate(v *validation) {
+	for i, step := range in.Steps {
+		if step.ApproverRole == "" && step.ApproverUserID == nil {
+			v.fail(fmt.Sprintf("steps[%d].approver_role", i), "required_without", "approver_user_id")
+		}
+		if step.RequiredApprovals < 0 {
+			v.fail(fmt.Sprintf("steps[%d].required_approvals", i), "min", "0")
+		}
+	}
+}
+
+func (in *AddHolidayInput) validate(v *validation) {
+	first, err := parseDate(in.Date)
+	if err != nil {
+		v.fail("date", "date", "")
+		return
+	}
+	if in.EndDate == "" {
+		return
+	}
+	if last, err := parseDate(in.EndDate); err != nil {
+		v.fail("end_date", "date", "")
+	} else if last.Before(first) {
+		v.fail("end_date", "not_before", "date")
+	}
+}
+
+// formatDuration drops the zero minutes and seconds time.Duration prints,
+// so 24h reads "24h" rather than "24h0m0s".
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
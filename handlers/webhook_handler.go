@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"shiftdony/models"
+	"shiftdony/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// Register a webhook subscription
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var input CreateWebhookInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	userIDVal, _ := c.Get("userID")
+	userID := int64(userIDVal.(float64))
+
+	sub, secret, err := h.webhookService.Subscribe(c.Request.Context(), input.URL, input.Secret, input.EventTypes, userID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+
+	// The secret is only ever shown here.
+	SendSuccessResponse(c, http.StatusCreated, gin.H{
+		"subscription": sub,
+		"secret":       secret,
+	})
+}
+
+// List webhook subscriptions
+func (h *WebhookHandler) GetSubscriptions(c *gin.Context) {
+	subs, err := h.webhookService.GetSubscriptions(c.Request.Context())
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if subs == nil {
+		subs = make([]models.WebhookSubscription, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, subs)
+}
+
+// Enable, disable or refilter a webhook subscription
+func (h *WebhookHandler) UpdateSubscription(c *gin.Context) {
+	subID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid subscription ID format", "INVALID_INPUT")
+		return
+	}
+	var input UpdateWebhookInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	sub, err := h.webhookService.UpdateSubscription(c.Request.Context(), subID, input.Active, input.EventTypes)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, sub)
+}
+
+// Delete a webhook subscription
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	subID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid subscription ID format", "INVALID_INPUT")
+		return
+	}
+	if err := h.webhookService.DeleteSubscription(c.Request.Context(), subID); err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusOK, gin.H{
+		"message": "Subscription deleted successfully",
+	})
+}
+
+// List outbox events, newest first
+func (h *WebhookHandler) GetEvents(c *gin.Context) {
+	beforeID, _ := strconv.ParseInt(c.Query("before_id"), 10, 64)
+	events, err := h.webhookService.GetEvents(c.Request.Context(), c.Query("type"), beforeID, queryLimit(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if events == nil {
+		events = make([]models.OutboxEvent, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, events)
+}
+
+// Replay an event to one or all interested subscriptions
+func (h *WebhookHandler) ReplayEvent(c *gin.Context) {
+	eventID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid event ID format", "INVALID_INPUT")
+		return
+	}
+	var input ReplayEventInput
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &input) {
+			return
+		}
+	}
+
+	deliveries, err := h.webhookService.ReplayEvent(c.Request.Context(), eventID, input.SubscriptionID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusAccepted, deliveries)
+}
+
+// List deliveries; status=dead gives the dead-letter view
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	deliveries, err := h.webhookService.GetDeliveries(c.Request.Context(), c.Query("status"), queryLimit(c))
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = make([]models.WebhookDelivery, 0)
+	}
+	SendSuccessResponse(c, http.StatusOK, deliveries)
+}
+
+// Retry a dead delivery
+func (h *WebhookHandler) RetryDelivery(c *gin.Context) {
+	deliveryID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		SendErrorResponse(c, http.StatusBadRequest, "Invalid delivery ID format", "INVALID_INPUT")
+		return
+	}
+	delivery, err := h.webhookService.RetryDelivery(c.Request.Context(), deliveryID)
+	if err != nil {
+		SendError(c, err)
+		return
+	}
+	SendSuccessResponse(c, http.StatusAccepted, delivery)
+}
+
+// queryLimit reads the limit query parameter, defaulting to 50 and capped
+// at 500.
+func queryLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return 50
+	}
+	if limit > 500 {
+		return 500
+	}
+	return limit
+}
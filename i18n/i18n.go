@@ -0,0 +1,172 @@
+// Package i18n translates API messages. Catalogs live in locales/*.json
+// and have three sections: reasons, keyed by the reason codes of error
+// responses; messages, keyed by the English text they translate (case is
+// ignored); and rules, the messages of failed validation rules.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the locale handlers write their messages in.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+type catalog struct {
+	Reasons  map[string]string `json:"reasons"`
+	Messages map[string]string `json:"messages"`
+	Rules    map[string]string `json:"rules"`
+}
+
+var catalogs = loadCatalogs()
+
+// Locales lists the locales with a catalog, DefaultLocale first.
+var Locales = catalogLocales()
+
+func loadCatalogs() map[string]*catalog {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]*catalog, len(files))
+	for _, f := range files {
+		raw, err := localeFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(raw, &c); err != nil {
+			panic("i18n: " + f.Name() + ": " + err.Error())
+		}
+		messages := make(map[string]string, len(c.Messages))
+		for k, v := range c.Messages {
+			messages[strings.ToLower(k)] = v
+		}
+		c.Messages = messages
+		out[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = &c
+	}
+	return out
+}
+
+func catalogLocales() []string {
+	out := []string{DefaultLocale}
+	for locale := range catalogs {
+		if locale != DefaultLocale {
+			out = append(out, locale)
+		}
+	}
+	sort.Strings(out[1:])
+	return out
+}
+
+// Supported reports whether locale has a catalog.
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Match returns the supported locale an Accept-Language header prefers
+// most, or "" if it names none. Regional tags match their language, so
+// "fa-IR" picks "fa".
+func Match(header string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if base, _, _ := strings.Cut(tag, "-"); q > 0 && Supported(base) {
+			choices = append(choices, choice{locale: base, q: q})
+		}
+	}
+	// Stable, so equal weights keep the client's order.
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	if len(choices) == 0 {
+		return ""
+	}
+	return choices[0].locale
+}
+
+// Message translates an error message. The text itself is looked up
+// first, then the reason code; fallback is returned when neither is in
+// the locale's catalog.
+func Message(locale, reason, fallback string) string {
+	c, ok := catalogs[locale]
+	if !ok {
+		return fallback
+	}
+	if text, ok := c.Messages[strings.ToLower(fallback)]; ok {
+		return text
+	}
+	if text, ok := c.Reasons[reason]; ok {
+		return text
+	}
+	return fallback
+}
+
+// Rule returns the message of a failed validation rule. {field} and
+// {param} in the catalog text are replaced with field and param, isolated
+// in right-to-left locales. Unknown rules use the "invalid" entry, and
+// unknown locales DefaultLocale.
+func Rule(locale, rule, field, param string) string {
+	c, ok := catalogs[locale]
+	if !ok {
+		c = catalogs[DefaultLocale]
+	}
+	if RTL(locale) {
+		field, param = Isolate(field), Isolate(param)
+	}
+	text, ok := c.Rules[rule]
+	if !ok {
+		if text, ok = c.Rules["invalid"]; !ok {
+			text = catalogs[DefaultLocale].Rules["invalid"]
+		}
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(text)
+}
+
+// RTL reports whether locale is written right to left.
+func RTL(locale string) bool {
+	return locale == "fa"
+}
+
+// PluralOne reports whether n takes the singular form in locale. Persian
+// counts with the singular after numbers, so every n does there.
+func PluralOne(locale string, n int64) bool {
+	if locale == "fa" {
+		return true
+	}
+	return n == 1
+}
+
+// Isolate wraps text of unknown direction, such as names and titles, in
+// Unicode first-strong isolates so it cannot reorder the text around it.
+func Isolate(s string) string {
+	return "\u2068" + s + "\u2069"
+}
+
+// LTR wraps left-to-right text such as dates, numbers with units and
+// codes in a left-to-right isolate, for use inside right-to-left text.
+func LTR(s string) string {
+	return "\u2066" + s + "\u2069"
+}
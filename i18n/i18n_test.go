@@ -0,0 +1,89 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// errorMessages returns the messages the tree passes as literals to
+// newError and SendErrorResponse, by position.
+func errorMessages(t *testing.T, root string) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 3 {
+				return true
+			}
+			var name string
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				name = fun.Name
+			case *ast.SelectorExpr:
+				name = fun.Sel.Name
+			}
+			if name != "newError" && name != "SendErrorResponse" {
+				return true
+			}
+			// newError(status, code, message), SendErrorResponse(c, status, message, code)
+			arg := call.Args[2]
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			message, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Errorf("%s: %v", fset.Position(lit.Pos()), err)
+				return true
+			}
+			out[fset.Position(lit.Pos()).String()] = message
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestCatalogsTranslateErrorMessages(t *testing.T) {
+	messages := errorMessages(t, "..")
+	if len(messages) == 0 {
+		t.Fatal("found no error messages")
+	}
+	for _, locale := range Locales {
+		if locale == DefaultLocale {
+			continue
+		}
+		for pos, message := range messages {
+			if _, ok := catalogs[locale].Messages[strings.ToLower(message)]; !ok {
+				t.Errorf("%s: %s catalog lacks %q", pos, locale, message)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package ical writes iCalendar (RFC 5545) feeds.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+	// maxLineOctets is the longest content line allowed before folding.
+	maxLineOctets = 75
+)
+
+// Event is one VEVENT. UID must stay the same for the life of the event and
+// Sequence must grow whenever its time or status changes, so subscribed
+// calendars replace their copy instead of adding another.
+type Event struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	URL         string
+	Cancelled   bool
+	// AllDay events cover whole dates; End is exclusive.
+	AllDay bool
+}
+
+// Calendar is a published feed of events.
+type Calendar struct {
+	Name string
+	// Timezone is the IANA zone clients should show the feed in. Event
+	// times are always written in UTC, so it only affects display.
+	Timezone string
+	// RefreshInterval is how often clients are asked to poll the feed.
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// WriteTo writes the calendar as an iCalendar object.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &contentWriter{w: bufio.NewWriter(w)}
+	stamp := time.Now()
+
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", "-//shiftdoni//overtime//EN")
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.Timezone != "" {
+		cw.line("X-WR-TIMEZONE", escape(c.Timezone))
+	}
+	if c.RefreshInterval > 0 {
+		interval := "PT" + strconv.Itoa(int(c.RefreshInterval/time.Minute)) + "M"
+		cw.line("REFRESH-INTERVAL;VALUE=DURATION", interval)
+		cw.line("X-PUBLISHED-TTL", interval)
+	}
+	for i := range c.Events {
+		e := &c.Events[i]
+		cw.line("BEGIN", "VEVENT")
+		cw.line("UID", escape(e.UID))
+		cw.line("DTSTAMP", formatTime(stamp))
+		cw.line("SEQUENCE", strconv.Itoa(e.Sequence))
+		if e.AllDay {
+			cw.line("DTSTART;VALUE=DATE", e.Start.Format(dateFormat))
+			cw.line("DTEND;VALUE=DATE", e.End.Format(dateFormat))
+		} else {
+			cw.line("DTSTART", formatTime(e.Start))
+			cw.line("DTEND", formatTime(e.End))
+		}
+		cw.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			cw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			cw.line("URL", e.URL)
+		}
+		if e.Cancelled {
+			cw.line("STATUS", "CANCELLED")
+		} else {
+			cw.line("STATUS", "CONFIRMED")
+		}
+		cw.line("TRANSP", "OPAQUE")
+		cw.line("END", "VEVENT")
+	}
+	cw.line("END", "VCALENDAR")
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// contentWriter writes folded CRLF content lines and keeps the first error.
+type contentWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *contentWriter) line(name, value string) {
+	cw.write(fold(name + ":" + value))
+}
+
+func (cw *contentWriter) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// fold splits a content line into lines of at most 75 octets, continuing
+// each with a leading space and never splitting a UTF-8 sequence.
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the next line.
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
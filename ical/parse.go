@@ -0,0 +1,187 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned for input that is not an iCalendar object.
+var ErrInvalid = errors.New("ical: invalid calendar")
+
+// maxParseLine bounds a single unfolded content line.
+const maxParseLine = 64 * 1024
+
+// Parse reads the VEVENTs of an iCalendar object. Date-time values with a
+// TZID are read in that zone and floating ones in loc. Recurring events are
+// rejected with ErrInvalid, as their occurrences are not expanded.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events  []Event
+		current *Event
+		seen    bool
+		hasEnd  bool
+		// nested counts open components inside the event, such as VALARM,
+		// whose properties are not the event's.
+		nested int
+	)
+	for n, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d is not a content line", ErrInvalid, n+1)
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			seen = true
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			current, hasEnd, nested = &Event{}, false, 0
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("%w: unexpected END:VEVENT on line %d", ErrInvalid, n+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("%w: event ending on line %d has no DTSTART", ErrInvalid, n+1)
+			}
+			if !hasEnd {
+				current.End = current.Start
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			// Calendar properties and other components are ignored.
+		case name == "BEGIN":
+			nested++
+		case name == "END":
+			nested--
+		case nested > 0:
+		case name == "UID":
+			current.UID = unescape(value)
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "DESCRIPTION":
+			current.Description = unescape(value)
+		case name == "URL":
+			current.URL = value
+		case name == "SEQUENCE":
+			fmt.Sscanf(value, "%d", &current.Sequence)
+		case name == "STATUS":
+			current.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			t, allDay, err := parseTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalid, n+1, err)
+			}
+			current.Start, current.AllDay = t, allDay
+		case name == "DTEND":
+			t, _, err := parseTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalid, n+1, err)
+			}
+			current.End, hasEnd = t, true
+		case name == "RRULE", name == "RDATE":
+			return nil, fmt.Errorf("%w: line %d: recurring events are not supported", ErrInvalid, n+1)
+		}
+	}
+	if !seen {
+		return nil, fmt.Errorf("%w: no VCALENDAR", ErrInvalid)
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%w: unterminated VEVENT", ErrInvalid)
+	}
+	return events, nil
+}
+
+// unfold joins folded lines.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxParseLine)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine splits "NAME;PARAM=x:value" into its parts. Names and parameter
+// names are upper-cased.
+func splitLine(line string) (string, map[string]string, string, bool) {
+	// The value starts at the first colon outside a quoted parameter.
+	colon, quoted := -1, false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+func parseTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateFormat) {
+		t, err := time.Parse(dateFormat, value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(timeFormat, value)
+		return t, false, err
+	}
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation(strings.TrimSuffix(timeFormat, "Z"), value, loc)
+	return t, false, err
+}
+
+// unescape reverses the TEXT escaping.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
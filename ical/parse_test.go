@@ -0,0 +1,173 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Night shift"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"one over", "SUMMARY:" + strings.Repeat("a", 68)},
+		{"several lines", "DESCRIPTION:" + strings.Repeat("abcdefghij", 30)},
+		// Two-byte runes must not be split across lines.
+		{"persian", "SUMMARY:" + strings.Repeat("تعطیل ", 40)},
+	}
+	for _, tt := range tests {
+		folded := fold(tt.line)
+		if !strings.HasSuffix(folded, "\r\n") {
+			t.Errorf("%s: %q does not end with CRLF", tt.name, folded)
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n")
+		for i, part := range parts {
+			if len(part) > maxLineOctets {
+				t.Errorf("%s: line %d has %d octets", tt.name, i, len(part))
+			}
+			if i > 0 && part[0] != ' ' {
+				t.Errorf("%s: continuation line %d does not start with a space", tt.name, i)
+			}
+			if !utf8.ValidString(part) {
+				t.Errorf("%s: line %d splits a UTF-8 sequence", tt.name, i)
+			}
+		}
+		lines, err := unfold(strings.NewReader(folded))
+		if err != nil {
+			t.Errorf("%s: unfold: %v", tt.name, err)
+			continue
+		}
+		if len(lines) != 1 || lines[0] != tt.line {
+			t.Errorf("%s: unfolded to %q, want %q", tt.name, lines, tt.line)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	wrap := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+	}
+
+	tests := []struct {
+		name string
+		ics  string
+		want []Event
+	}{
+		{
+			"all-day event",
+			wrap("BEGIN:VEVENT", "UID:nowruz", "DTSTART;VALUE=DATE:20240320", "DTEND;VALUE=DATE:20240324", "SUMMARY:Nowruz", "END:VEVENT"),
+			[]Event{{UID: "nowruz", Summary: "Nowruz", AllDay: true,
+				Start: time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 24, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			"date without DTEND lasts a day",
+			wrap("BEGIN:VEVENT", "DTSTART:20240401", "SUMMARY:Nature day", "END:VEVENT"),
+			[]Event{{Summary: "Nature day", AllDay: true,
+				Start: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			"UTC, TZID and floating times",
+			wrap("BEGIN:VEVENT", "DTSTART:20240320T083000Z", "DTEND;TZID=Asia/Tehran:20240320T170000", "END:VEVENT",
+				"BEGIN:VEVENT", "DTSTART:20240321T090000", "END:VEVENT"),
+			[]Event{
+				{Start: time.Date(2024, 3, 20, 8, 30, 0, 0, time.UTC), End: time.Date(2024, 3, 20, 17, 0, 0, 0, tehran)},
+				{Start: time.Date(2024, 3, 21, 9, 0, 0, 0, tehran), End: time.Date(2024, 3, 21, 9, 0, 0, 0, tehran)},
+			},
+		},
+		{
+			"folded and escaped text",
+			wrap("BEGIN:VEVENT", "DTSTART;VALUE=DATE:20240320", "SUMMARY:Spring\\, new\\; year", "DESCRIPTION:first line\\n",
+				" second\\\\line", "\tcontinued", "END:VEVENT"),
+			[]Event{{Summary: "Spring, new; year", Description: "first line\nsecond\\linecontinued", AllDay: true,
+				Start: time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			"alarm properties are not the event's",
+			wrap("BEGIN:VEVENT", "DTSTART;VALUE=DATE:20240320", "SUMMARY:Holiday", "BEGIN:VALARM", "SUMMARY:Reminder",
+				"DESCRIPTION:ring", "END:VALARM", "STATUS:CANCELLED", "SEQUENCE:3", "END:VEVENT"),
+			[]Event{{Summary: "Holiday", Cancelled: true, Sequence: 3, AllDay: true,
+				Start: time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			"other components are ignored",
+			wrap("X-WR-CALNAME:Holidays", "BEGIN:VTODO", "DTSTART:bogus", "END:VTODO"),
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(strings.NewReader(tt.ics), tehran)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d events, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			g, w := got[i], tt.want[i]
+			if !g.Start.Equal(w.Start) || !g.End.Equal(w.End) {
+				t.Errorf("%s: event %d runs %v-%v, want %v-%v", tt.name, i, g.Start, g.End, w.Start, w.End)
+			}
+			g.Start, g.End, w.Start, w.End = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("%s: event %d = %+v, want %+v", tt.name, i, g, w)
+			}
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+	}{
+		{"empty", ""},
+		{"not a calendar", "BEGIN:VCARD\r\nEND:VCARD\r\n"},
+		{"not a content line", "BEGIN:VCALENDAR\r\nnonsense\r\nEND:VCALENDAR\r\n"},
+		{"no DTSTART", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"bad DTSTART", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:2024-03-20\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"unterminated event", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20240320\r\n"},
+		{"stray END:VEVENT", "BEGIN:VCALENDAR\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"recurring event", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240320\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"extra dates", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20240320\r\nRDATE;VALUE=DATE:20250320\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(strings.NewReader(tt.ics), time.UTC); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Parse = %v, want ErrInvalid", tt.name, err)
+		}
+	}
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	start := time.Date(2024, 3, 20, 16, 0, 0, 0, time.UTC)
+	cal := Calendar{Name: "Shifts", Timezone: "Asia/Tehran", Events: []Event{
+		{UID: "slot-1", Sequence: 2, Start: start, End: start.Add(4 * time.Hour),
+			Summary: "Night shift; ward 3, " + strings.Repeat("طولانی ", 20), Description: "bring\nbadge", URL: "https://example.com/slots/1"},
+		{UID: "slot-2", Start: time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 22, 0, 0, 0, 0, time.UTC),
+			Summary: "Holiday", AllDay: true, Cancelled: true},
+	}}
+	var buf bytes.Buffer
+	if _, err := cal.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&buf, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cal.Events) {
+		t.Errorf("round trip = %+v, want %+v", got, cal.Events)
+	}
+}
@@ -0,0 +1,227 @@
+// Package jalali converts between the Gregorian and the Solar Hijri
+// (Jalali) calendars, and formats and parses Jalali dates.
+//
+// Conversion uses the 33-year arithmetic cycle, which matches the
+// astronomical calendar for years 1178 to 1633 AP.
+package jalali
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned for strings that are not Jalali dates.
+var ErrInvalid = errors.New("jalali: invalid date")
+
+// MonthNames are the Persian month names, Farvardin first.
+var MonthNames = [12]string{
+	"فروردین", "اردیبهشت", "خرداد", "تیر", "مرداد", "شهریور",
+	"مهر", "آبان", "آذر", "دی", "بهمن", "اسفند",
+}
+
+// LatinMonthNames are the month names in Latin script.
+var LatinMonthNames = [12]string{
+	"Farvardin", "Ordibehesht", "Khordad", "Tir", "Mordad", "Shahrivar",
+	"Mehr", "Aban", "Azar", "Dey", "Bahman", "Esfand",
+}
+
+// Date is a day of the Jalali calendar.
+type Date struct {
+	Year  int
+	Month int // 1 to 12
+	Day   int
+}
+
+// String returns the date as YYYY-MM-DD.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// gregorianMonthStart holds the days before each month of a common year.
+var gregorianMonthStart = [12]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+
+// FromGregorian converts a Gregorian date.
+func FromGregorian(gy, gm, gd int) Date {
+	gy2 := gy
+	if gm > 2 {
+		gy2 = gy + 1
+	}
+	days := 355666 + 365*gy + (gy2+3)/4 - (gy2+99)/100 + (gy2+399)/400 + gd + gregorianMonthStart[gm-1]
+	jy := -1595 + 33*(days/12053)
+	days %= 12053
+	jy += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		jy += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	if days < 186 {
+		return Date{Year: jy, Month: 1 + days/31, Day: 1 + days%31}
+	}
+	return Date{Year: jy, Month: 7 + (days-186)/30, Day: 1 + (days-186)%30}
+}
+
+// Gregorian converts the date to the Gregorian calendar.
+func (d Date) Gregorian() (year int, month time.Month, day int) {
+	jy := d.Year + 1595
+	days := -355668 + 365*jy + (jy/33)*8 + ((jy%33)+3)/4 + d.Day
+	if d.Month < 7 {
+		days += (d.Month - 1) * 31
+	} else {
+		days += (d.Month-7)*30 + 186
+	}
+	gy := 400 * (days / 146097)
+	days %= 146097
+	if days > 36524 {
+		days--
+		gy += 100 * (days / 36524)
+		days %= 36524
+		if days >= 365 {
+			days++
+		}
+	}
+	gy += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		gy += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	// days is now the zero-based day of the year gy; let time split it.
+	return time.Date(gy, time.January, days+1, 0, 0, 0, 0, time.UTC).Date()
+}
+
+// FromTime returns the Jalali date of t in t's location.
+func FromTime(t time.Time) Date {
+	y, m, d := t.Date()
+	return FromGregorian(y, int(m), d)
+}
+
+// Time returns the instant at the given Jalali date and clock time in loc.
+func (d Date) Time(hour, min, sec, nsec int, loc *time.Location) time.Time {
+	y, m, day := d.Gregorian()
+	return time.Date(y, m, day, hour, min, sec, nsec, loc)
+}
+
+// IsLeap reports whether the Jalali year has 366 days.
+func IsLeap(year int) bool {
+	y1, m1, d1 := Date{Year: year, Month: 12, Day: 1}.Gregorian()
+	y2, m2, d2 := Date{Year: year + 1, Month: 1, Day: 1}.Gregorian()
+	start := time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC)
+	return end.Sub(start) == 30*24*time.Hour
+}
+
+// DaysIn returns the number of days in a month of a Jalali year.
+func DaysIn(year, month int) int {
+	switch {
+	case month <= 6:
+		return 31
+	case month <= 11:
+		return 30
+	case IsLeap(year):
+		return 30
+	default:
+		return 29
+	}
+}
+
+// Valid reports whether d is a real Jalali date.
+func (d Date) Valid() bool {
+	return d.Month >= 1 && d.Month <= 12 && d.Day >= 1 && d.Day <= DaysIn(d.Year, d.Month)
+}
+
+// Format returns t in its location as a Jalali ISO 8601 style string,
+// e.g. "1404-01-15T08:30:00+03:30".
+func Format(t time.Time) string {
+	return FromTime(t).String() + t.Format("T15:04:05Z07:00")
+}
+
+// FormatDate returns the Jalali date of t in its location as YYYY-MM-DD.
+func FormatDate(t time.Time) string {
+	return FromTime(t).String()
+}
+
+// Parse parses a Jalali date with an optional time of day and offset:
+// "1404-01-15", "1404/01/15 08:30", "1404-01-15T08:30:00+03:30". Persian
+// and Arabic digits are accepted. Times without an offset are read in loc.
+func Parse(s string, loc *time.Location) (time.Time, error) {
+	t, _, err := parse(s, loc)
+	return t, err
+}
+
+// ParseWall is Parse for callers that place times without an offset
+// themselves: such times come back as their wall clock in UTC with zoned
+// false.
+func ParseWall(s string) (t time.Time, zoned bool, err error) {
+	return parse(s, time.UTC)
+}
+
+func parse(s string, loc *time.Location) (time.Time, bool, error) {
+	s = strings.TrimSpace(NormalizeDigits(s))
+	datePart, rest := s, ""
+	if i := strings.IndexAny(s, "T "); i >= 0 {
+		datePart, rest = s[:i], strings.TrimSpace(s[i+1:])
+	}
+
+	fields := strings.FieldsFunc(datePart, func(r rune) bool { return r == '-' || r == '/' })
+	if len(fields) != 3 {
+		return time.Time{}, false, ErrInvalid
+	}
+	var nums [3]int
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return time.Time{}, false, ErrInvalid
+		}
+		nums[i] = n
+	}
+	d := Date{Year: nums[0], Month: nums[1], Day: nums[2]}
+	if !d.Valid() {
+		return time.Time{}, false, ErrInvalid
+	}
+	if rest == "" {
+		return d.Time(0, 0, 0, 0, loc), false, nil
+	}
+
+	// The clock and zone are Gregorian-neutral, so time can parse them.
+	for _, layout := range []string{"15:04:05.999999999Z07:00", "15:04Z07:00", "15:04:05.999999999", "15:04"} {
+		clock, err := time.Parse(layout, rest)
+		if err != nil {
+			continue
+		}
+		zoned := strings.Contains(layout, "Z07:00")
+		if zoned {
+			loc = clock.Location()
+		}
+		return d.Time(clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), loc), zoned, nil
+	}
+	return time.Time{}, false, ErrInvalid
+}
+
+// LooksJalali reports whether s starts with a year that can only be a
+// Jalali one in practice (before 1700). It tells Jalali input apart from
+// Gregorian input without being told which calendar a client uses.
+func LooksJalali(s string) bool {
+	s = strings.TrimSpace(NormalizeDigits(s))
+	if len(s) < 4 {
+		return false
+	}
+	year, err := strconv.Atoi(s[:4])
+	return err == nil && year < 1700
+}
+
+// NormalizeDigits replaces Persian and Arabic-Indic digits with ASCII ones.
+func NormalizeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '۰' && r <= '۹':
+			return '0' + (r - '۰')
+		case r >= '٠' && r <= '٩':
+			return '0' + (r - '٠')
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,164 @@
+package jalali
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFromGregorian(t *testing.T) {
+	tests := []struct {
+		gy, gm, gd int
+		want       Date
+	}{
+		{1979, 2, 11, Date{1357, 11, 22}},
+		{2000, 1, 1, Date{1378, 10, 11}},
+		{2021, 3, 20, Date{1399, 12, 30}}, // last day of a leap year
+		{2021, 3, 21, Date{1400, 1, 1}},
+		{2023, 3, 21, Date{1402, 1, 1}},
+		{2024, 1, 1, Date{1402, 10, 11}},
+		{2024, 2, 29, Date{1402, 12, 10}},
+		{2024, 3, 20, Date{1403, 1, 1}},
+		{2024, 9, 21, Date{1403, 6, 31}},
+		{2024, 9, 22, Date{1403, 7, 1}},
+		{2025, 3, 20, Date{1403, 12, 30}},
+		{2025, 3, 21, Date{1404, 1, 1}},
+	}
+	for _, tt := range tests {
+		if got := FromGregorian(tt.gy, tt.gm, tt.gd); got != tt.want {
+			t.Errorf("FromGregorian(%d, %d, %d) = %v, want %v", tt.gy, tt.gm, tt.gd, got, tt.want)
+		}
+		y, m, d := tt.want.Gregorian()
+		if y != tt.gy || int(m) != tt.gm || d != tt.gd {
+			t.Errorf("%v.Gregorian() = %d-%02d-%02d, want %d-%02d-%02d", tt.want, y, m, d, tt.gy, tt.gm, tt.gd)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Every day must convert back to itself and follow the day before it.
+	day := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := FromTime(day.AddDate(0, 0, -1))
+	for ; day.Year() < 2060; day = day.AddDate(0, 0, 1) {
+		d := FromTime(day)
+		if !d.Valid() {
+			t.Fatalf("%s converts to invalid %v", day.Format("2006-01-02"), d)
+		}
+		if got := d.Time(0, 0, 0, 0, time.UTC); !got.Equal(day) {
+			t.Fatalf("%s converts to %v and back to %s", day.Format("2006-01-02"), d, got.Format("2006-01-02"))
+		}
+		next := Date{prev.Year, prev.Month, prev.Day + 1}
+		if !next.Valid() {
+			next = Date{prev.Year, prev.Month + 1, 1}
+			if next.Month > 12 {
+				next = Date{prev.Year + 1, 1, 1}
+			}
+		}
+		if d != next {
+			t.Fatalf("%s is %v, want %v after %v", day.Format("2006-01-02"), d, next, prev)
+		}
+		prev = d
+	}
+}
+
+func TestDaysIn(t *testing.T) {
+	tests := []struct {
+		year, month, want int
+	}{
+		{1403, 1, 31},
+		{1403, 6, 31},
+		{1403, 7, 30},
+		{1403, 11, 30},
+		{1403, 12, 30}, // leap
+		{1402, 12, 29},
+		{1404, 12, 29},
+		{1399, 12, 30}, // leap
+	}
+	for _, tt := range tests {
+		if got := DaysIn(tt.year, tt.month); got != tt.want {
+			t.Errorf("DaysIn(%d, %d) = %d, want %d", tt.year, tt.month, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"1403-01-01", time.Date(2024, 3, 20, 0, 0, 0, 0, tehran)},
+		{"1403/01/01", time.Date(2024, 3, 20, 0, 0, 0, 0, tehran)},
+		{"۱۴۰۳/۰۱/۰۱", time.Date(2024, 3, 20, 0, 0, 0, 0, tehran)},
+		{"١٤٠٣-٠١-٠١", time.Date(2024, 3, 20, 0, 0, 0, 0, tehran)},
+		{" 1403-12-30 ", time.Date(2025, 3, 20, 0, 0, 0, 0, tehran)},
+		{"1403-07-01 08:30", time.Date(2024, 9, 22, 8, 30, 0, 0, tehran)},
+		{"1403-07-01T08:30:15", time.Date(2024, 9, 22, 8, 30, 15, 0, tehran)},
+		{"1403-07-01T08:30:00Z", time.Date(2024, 9, 22, 8, 30, 0, 0, time.UTC)},
+		{"1403-07-01T08:30:00+03:30", time.Date(2024, 9, 22, 5, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tehran)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "1403-01", "1403-13-01", "1402-12-30", "1403-07-31", "1403-01-01 25:00", "abc-01-01"} {
+		if _, err := Parse(in, tehran); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %v, want ErrInvalid", in, err)
+		}
+	}
+}
+
+func TestParseWall(t *testing.T) {
+	got, zoned, err := ParseWall("1403-01-01 09:00")
+	if err != nil || zoned || !got.Equal(time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseWall without offset = %v, %v, %v", got, zoned, err)
+	}
+	got, zoned, err = ParseWall("1403-01-01T09:00:00+03:30")
+	if err != nil || !zoned || !got.Equal(time.Date(2024, 3, 20, 5, 30, 0, 0, time.UTC)) {
+		t.Errorf("ParseWall with offset = %v, %v, %v", got, zoned, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	// 22:00 UTC on 19 March is already Nowruz in Tehran.
+	at := time.Date(2024, 3, 19, 22, 0, 0, 0, time.UTC)
+	if got, want := Format(at.In(tehran)), "1403-01-01T01:30:00+03:30"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	if got, want := FormatDate(at), "1402-12-29"; got != want {
+		t.Errorf("FormatDate = %q, want %q", got, want)
+	}
+}
+
+func TestLooksJalali(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"1403-01-01", true},
+		{"۱۴۰۳-۰۱-۰۱", true},
+		{"2024-03-20", false},
+		{"140", false},
+		{"", false},
+		{"abcd", false},
+	}
+	for _, tt := range tests {
+		if got := LooksJalali(tt.in); got != tt.want {
+			t.Errorf("LooksJalali(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
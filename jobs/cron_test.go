@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleNext(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", at("2024-03-10 10:15:30"), at("2024-03-10 10:16:00")},
+		{"*/10 * * * *", at("2024-03-10 10:15:00"), at("2024-03-10 10:20:00")},
+		{"5/15 * * * *", at("2024-03-10 10:51:00"), at("2024-03-10 11:05:00")},
+		{"0 9-17 * * *", at("2024-03-10 17:30:00"), at("2024-03-11 09:00:00")},
+		{"30 8 * * mon", at("2024-03-10 12:00:00"), at("2024-03-11 08:30:00")},
+		{"0 0 * * 7", at("2024-03-10 00:00:00"), at("2024-03-17 00:00:00")},
+		{"0 0 31 * *", at("2024-04-01 00:00:00"), at("2024-05-31 00:00:00")},
+		{"0 0 29 feb *", at("2024-03-01 00:00:00"), at("2028-02-29 00:00:00")},
+		// Restricted day of month and day of week match either.
+		{"0 0 13 * fri", at("2024-09-01 00:00:00"), at("2024-09-06 00:00:00")},
+		{"@hourly", at("2024-03-10 10:00:00"), at("2024-03-10 11:00:00")},
+		{"@daily", at("2024-12-31 23:59:00"), at("2025-01-01 00:00:00")},
+		{"@monthly", at("2024-01-31 12:00:00"), at("2024-02-01 00:00:00")},
+		{"@yearly", at("2024-06-01 00:00:00"), at("2025-01-01 00:00:00")},
+		{"@every 5s", at("2024-03-10 10:15:07"), at("2024-03-10 10:15:10")},
+		{"@every 1m", at("2024-03-10 10:15:00"), at("2024-03-10 10:16:00")},
+		// Cron fields follow the wall clock of the time passed in.
+		{"0 9 * * *", at("2024-03-10 06:00:00").In(tehran), time.Date(2024, 3, 11, 9, 0, 0, 0, tehran)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"10-5 * * * *",
+		"*/0 * * * *",
+		"x * * * *",
+		"@every",
+		"@every 500ms",
+		"@every soon",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package jobs runs periodic background work. Every replica runs the same
+// scheduler; a Postgres advisory lock per job and a unique run per scheduled
+// activation make sure only one replica executes each activation.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	pg "shiftdony/database"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownJob     = errors.New("unknown job")
+	ErrAlreadyRunning = errors.New("job is already running on another replica")
+)
+
+// Job is a unit of periodic work.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string
+	Run         func(ctx context.Context) error
+
+	// MaxAttempts is how often a failing run is tried, 1 when zero. Retries
+	// wait Backoff, doubling after every attempt.
+	MaxAttempts int
+	Backoff     time.Duration
+
+	schedule Schedule
+}
+
+type Scheduler struct {
+	repo pg.JobRepository
+	node string
+	tick time.Duration
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]bool
+}
+
+func NewScheduler(repo pg.JobRepository) *Scheduler {
+	node, _ := os.Hostname()
+	return &Scheduler{
+		repo:    repo,
+		node:    fmt.Sprintf("%s/%d", node, os.Getpid()),
+		tick:    time.Second,
+		jobs:    make(map[string]*Job),
+		running: make(map[string]bool),
+	}
+}
+
+// Register adds job to the scheduler. It fails on an invalid schedule or a
+// duplicate name.
+func (s *Scheduler) Register(job Job) error {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = 1
+	}
+	job.schedule = schedule
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s registered twice", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Jobs returns the registered jobs ordered by name.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// NextRun returns the next activation of job after t.
+func (j Job) NextRun(t time.Time) time.Time {
+	return j.schedule.Next(t)
+}
+
+// LatestRuns returns the most recent run of every job that has run.
+func (s *Scheduler) LatestRuns(ctx context.Context) (map[string]models.JobRun, error) {
+	return s.repo.GetLatestJobRuns(ctx)
+}
+
+// PruneRuns deletes the finished runs older than retention, keeping the
+// latest run of every job for the jobs list.
+func (s *Scheduler) PruneRuns(ctx context.Context, retention time.Duration) (int, error) {
+	deleted, err := s.repo.DeleteJobRuns(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		log.Gl.Info("Pruned job runs", zap.Int("count", deleted))
+	}
+	return deleted, nil
+}
+
+// Start runs the scheduling loop until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	next := make(map[string]time.Time)
+	for _, job := range s.Jobs() {
+		next[job.Name] = job.NextRun(time.Now())
+	}
+
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, job := range s.Jobs() {
+				due := next[job.Name]
+				if now.Before(due) {
+					continue
+				}
+				next[job.Name] = job.NextRun(now)
+				go s.runScheduled(ctx, job, due)
+			}
+		}
+	}
+}
+
+// RunNow runs the named job immediately, outside its schedule.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrUnknownJob
+	}
+	return s.execute(ctx, *job, nil)
+}
+
+func (s *Scheduler) runScheduled(ctx context.Context, job Job, due time.Time) {
+	const op = "jobs.runScheduled"
+	if err := s.execute(ctx, job, &due); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+		log.Error(op, "background job failed", err, zap.String("job", job.Name))
+	}
+}
+
+// execute runs job under its advisory lock and records the run. scheduledFor
+// is nil for manual runs.
+func (s *Scheduler) execute(ctx context.Context, job Job, scheduledFor *time.Time) error {
+	// Skip when this process is still busy with the previous activation.
+	s.mu.Lock()
+	if s.running[job.Name] {
+		s.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	s.running[job.Name] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.Name)
+		s.mu.Unlock()
+	}()
+
+	release, ok, err := s.repo.TryAdvisoryLock(ctx, lockKey(job.Name))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAlreadyRunning
+	}
+	defer release()
+
+	trigger := "manual"
+	if scheduledFor != nil {
+		trigger = "schedule"
+	}
+	run := &models.JobRun{
+		JobName:      job.Name,
+		ScheduledFor: scheduledFor,
+		Trigger:      trigger,
+		Node:         s.node,
+		Status:       models.JobRunRunning,
+		StartedAt:    time.Now(),
+	}
+	created, err := s.repo.CreateJobRun(ctx, run)
+	if err != nil {
+		return err
+	}
+	if !created {
+		// Another replica already took this activation.
+		return nil
+	}
+
+	backoff := job.Backoff
+	for attempt := 1; ; attempt++ {
+		run.Attempts = attempt
+		err = job.Run(ctx)
+		if err == nil || attempt >= job.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+		log.Gl.Warn("Background job attempt failed, retrying",
+			zap.String("job", job.Name), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = models.JobRunSucceeded
+	if err != nil {
+		run.Status = models.JobRunFailed
+		run.Error = err.Error()
+	}
+	// The run context may be cancelled on shutdown; still record the outcome.
+	if uerr := s.repo.UpdateJobRun(context.Background(), run); uerr != nil {
+		log.Error("jobs.execute", "cannot record job run", uerr, zap.String("job", job.Name))
+	}
+	return err
+}
+
+// lockKey maps a job name to its advisory lock key.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("shiftdoni:job:" + name))
+	return int64(h.Sum64())
+}
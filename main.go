@@ -16,6 +16,8 @@ func main() {
 	}
 
 	root.AddCommand(cmd.Start())
+	root.AddCommand(cmd.Jobs())
+	root.AddCommand(cmd.Chat())
 
 	if err := root.Execute(); err != nil {
 		log.Gl.Fatal(err.Error())
@@ -1,9 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 	"shiftdony/config"
+	"shiftdony/service"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -15,14 +16,14 @@ func AuthMiddleware() gin.HandlerFunc {
 		//Read Authorization from header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			abort(c, service.ErrUnauthorized)
 			return
 		}
 
 		//Check Header Format
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			abort(c, service.ErrUnauthorized)
 			return
 		}
 
@@ -35,7 +36,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		})
 
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			abort(c, service.ErrUnauthorized.Wrap(err))
+			return
 		}
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 			userID := claims["sub"]
@@ -44,25 +46,90 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Set("userRole", userRole)
 			c.Next()
 		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			abort(c, service.ErrUnauthorized)
 		}
 
 	}
 }
 
 
+// TicketVerifier checks stream tickets.
+type TicketVerifier interface {
+	VerifyTicket(ticket string) (int64, string, error)
+}
+
+// StreamAuthMiddleware authenticates the event stream. Clients that cannot
+// set headers, such as the browser EventSource, pass a short-lived stream
+// ticket in the ticket query parameter; others use the bearer token.
+func StreamAuthMiddleware(tickets TicketVerifier) gin.HandlerFunc {
+	bearer := AuthMiddleware()
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			bearer(c)
+			return
+		}
+		userID, role, err := tickets.VerifyTicket(ticket)
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		// Same types as the claims AuthMiddleware sets.
+		c.Set("userID", float64(userID))
+		c.Set("userRole", role)
+		c.Next()
+	}
+}
+
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		//Must be run after AuthMiddleware 
 		userRole, exists := c.Get("userRole")
 		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
+			abort(c, service.ErrUnauthorized)
 			return
 		}
 		if userRole.(string) != "manager" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Access denied: requires admin role"})
+			abort(c, service.ErrRoleRequired)
+			return
+		}
+		c.Next()
+	}
+}
+
+// DelegationChecker reports whether a user currently holds review authority
+// delegated by a manager.
+type DelegationChecker interface {
+	HasActiveDelegation(ctx context.Context, userID int64) (bool, error)
+}
+
+// ReviewerMiddleware lets managers, department heads, who sign off the later
+// steps of approval chains, and users holding an active delegation through
+// to the review endpoints.
+func ReviewerMiddleware(delegations DelegationChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//Must be run after AuthMiddleware
+		userRole, exists := c.Get("userRole")
+		if !exists {
+			abort(c, service.ErrUnauthorized)
+			return
+		}
+		if role := userRole.(string); role == "manager" || role == "department_head" {
+			c.Next()
+			return
+		}
+
+		userIDVal, _ := c.Get("userID")
+		userID, _ := userIDVal.(float64)
+		delegated, err := delegations.HasActiveDelegation(c.Request.Context(), int64(userID))
+		if err != nil {
+			abort(c, service.ErrInternalServer.Wrap(err))
+			return
+		}
+		if !delegated {
+			abort(c, service.ErrRoleRequired)
 			return
 		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	log "shiftdony/logs"
+	"shiftdony/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the correlation ID of a request in both
+// directions.
+const RequestIDHeader = "X-Request-ID"
+
+// ErrorWriter writes the response for an error a handler attached with
+// c.Error.
+type ErrorWriter func(c *gin.Context, err *gin.Error)
+
+// ErrorMiddleware gives every request a correlation ID, stored as
+// "requestID" in the context and echoed in the X-Request-ID header; a
+// well-formed ID sent by the client is kept. When the handlers return
+// with errors attached and nothing written, the last error is logged with
+// its cause and written by write. Panics are recovered into internal
+// errors. Register it before every other middleware.
+func ErrorMiddleware(write ErrorWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				_ = c.Error(service.ErrInternalServer.Wrap(fmt.Errorf("panic: %v", r)))
+				c.Abort()
+			}
+			last := c.Errors.Last()
+			if last == nil {
+				return
+			}
+			logError(c, requestID, last.Err)
+			if !c.Writer.Written() {
+				write(c, last)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// logError logs server-side failures with their causes; client errors
+// only at debug level.
+func logError(c *gin.Context, requestID string, err error) {
+	e := service.AsError(err)
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("method", c.Request.Method),
+		zap.String("path", c.FullPath()),
+		zap.String("code", e.Code),
+		zap.Int("status", e.Status),
+	}
+	if e.Cause != nil {
+		fields = append(fields, zap.NamedError("cause", e.Cause))
+	}
+	if e.Status >= http.StatusInternalServerError {
+		log.Gl.Error("Request failed", fields...)
+	} else {
+		log.Gl.Debug("Request rejected", fields...)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// abort stops the handler chain with err, which ErrorMiddleware writes.
+func abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
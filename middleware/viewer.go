@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"shiftdony/config"
+	"shiftdony/i18n"
+	"shiftdony/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Viewers looks up the settings a user reads the API in.
+type Viewers interface {
+	Viewer(ctx context.Context, userID int64) (*models.NotificationPreference, *time.Location, error)
+}
+
+// ViewerMiddleware picks how messages and dates are shown and stores the
+// locale as "locale", the calendar as "calendar" and the *time.Location as
+// "location" in the context. The Accept-Language header, the calendar
+// query parameter or X-Calendar header and the tz query parameter or
+// X-Timezone header come first, then the user's settings, then the
+// configured defaults. Unsupported locales and unknown zones are ignored.
+// Run it after AuthMiddleware for the user's settings to apply; viewers
+// may be nil on public routes.
+func ViewerMiddleware(viewers Viewers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale := i18n.Match(c.GetHeader("Accept-Language"))
+		calendar := strings.ToLower(c.Query("calendar"))
+		if calendar == "" {
+			calendar = strings.ToLower(c.GetHeader("X-Calendar"))
+		}
+		zone := c.Query("tz")
+		if zone == "" {
+			zone = c.GetHeader("X-Timezone")
+		}
+		var loc *time.Location
+		if zone != "" && zone != "Local" {
+			loc, _ = time.LoadLocation(zone)
+		}
+
+		if (locale == "" || calendar == "" || loc == nil) && viewers != nil {
+			if userIDVal, ok := c.Get("userID"); ok {
+				userID, _ := userIDVal.(float64)
+				// A failed lookup only costs the user their settings.
+				pref, userLoc, err := viewers.Viewer(c.Request.Context(), int64(userID))
+				if err == nil {
+					if locale == "" && i18n.Supported(pref.Locale) {
+						locale = pref.Locale
+					}
+					if calendar == "" {
+						calendar = pref.Calendar
+					}
+					if loc == nil {
+						loc = userLoc
+					}
+				}
+			}
+		}
+		if locale == "" {
+			locale = config.C.Notify.DefaultLocale
+		}
+		if calendar == "" {
+			calendar = config.C.Dates.DefaultCalendar
+		}
+		if loc == nil {
+			var err error
+			if loc, err = time.LoadLocation(config.C.Dates.Timezone); err != nil {
+				loc = time.UTC
+			}
+		}
+		c.Set("locale", locale)
+		c.Set("calendar", calendar)
+		c.Set("location", loc)
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package models
+
+import "time"
+
+// DailyHoursView is the materialized view of approved overtime per user and
+// day, read by analytics when materialized views are enabled.
+const DailyHoursView = "analytics_daily_hours"
+
+// AnalyticsFilter narrows the requests and slots analytics aggregate. Zero
+// fields match everything.
+type AnalyticsFilter struct {
+	TeamID int64 // team of the applicant; slots are not filtered by team
+	// From and To bound the slot start to [From, To).
+	From time.Time
+	To   time.Time
+	// Zone is the IANA time zone days are counted in.
+	Zone string
+}
+
+// Analytics groupings of overtime hours.
+const (
+	GroupByUser  = "user"
+	GroupByTeam  = "team"
+	GroupByTotal = "total"
+)
+
+// DailyTotal sums approved overtime of one user or team, or of everyone
+// when Key is 0, on slots starting on Day.
+type DailyTotal struct {
+	Day      string  `bun:"day"` // YYYY-MM-DD
+	Key      int64   `bun:"key"`
+	Requests int     `bun:"requests"`
+	Hours    float64 `bun:"hours"`
+}
+
+// DayPartHours sums a user's approved overtime on slots starting on Day
+// that falls on the date of the user's holiday calendar starting at
+// PartStart. Slots running past midnight there add a row per date.
+type DayPartHours struct {
+	UserID        int64     `bun:"user_id"`
+	PersonnelCode string    `bun:"personnel_code"`
+	FullName      string    `bun:"full_name"`
+	TeamID        int64     `bun:"team_id"`
+	Day           string    `bun:"day"`         // YYYY-MM-DD of the slot start in the organization time zone
+	CalendarID    int64     `bun:"calendar_id"` // the team's holiday calendar, 0 for the default one
+	PartStart     time.Time `bun:"part_start"`  // the later of the slot start and the date's midnight
+	Requests      int       `bun:"requests"`    // requests whose slot starts in this part
+	Hours         float64   `bun:"hours"`
+}
+
+// UserTotal sums a user's approved overtime.
+type UserTotal struct {
+	UserID   int64   `bun:"user_id"`
+	Requests int     `bun:"requests"`
+	Hours    float64 `bun:"hours"`
+}
+
+// SlotFillDay sums the slots starting on Day, cancelled ones aside.
+type SlotFillDay struct {
+	Day       string `bun:"day"`
+	Slots     int    `bun:"slots"`
+	Capacity  int64  `bun:"capacity"`
+	Filled    int64  `bun:"filled"`     // approved places, at most the capacity
+	FullSlots int    `bun:"full_slots"` // slots with every place approved
+	// TimedSlots are the full slots whose last place has a decision time;
+	// FillSeconds sums the time from their opening to it.
+	TimedSlots  int     `bun:"timed_slots"`
+	FillSeconds float64 `bun:"fill_seconds"`
+}
+
+// ReviewerTotal sums the decisions one reviewer took on approval steps.
+type ReviewerTotal struct {
+	ReviewerID int64 `bun:"reviewer_id"`
+	Approved   int   `bun:"approved"`
+	Rejected   int   `bun:"rejected"`
+	// TimedDecisions are the decisions with a decision time; ReviewSeconds
+	// sums the time to them from the application, or from the decision of
+	// the step before.
+	TimedDecisions int     `bun:"timed_decisions"`
+	ReviewSeconds  float64 `bun:"review_seconds"`
+}
+
+// AttendanceDay sums the approved requests on slots starting on Day that
+// have ended.
+type AttendanceDay struct {
+	Day      string `bun:"day"`
+	Approved int    `bun:"approved"`
+	Present  int    `bun:"present"`
+	NoShows  int    `bun:"no_shows"`
+}
+
+// MemberTotal sums the overtime one team member applied for and was
+// approved for.
+type MemberTotal struct {
+	UserID        int64   `bun:"user_id"`
+	PersonnelCode string  `bun:"personnel_code"`
+	FullName      string  `bun:"full_name"`
+	Applied       int     `bun:"applied"` // requests in any status
+	AppliedHours  float64 `bun:"applied_hours"`
+	Approved      int     `bun:"approved"`
+	ApprovedHours float64 `bun:"approved_hours"`
+}
+
+// SlotSupply sums the overtime offered: slots open to applications, the
+// cancelled ones aside.
+type SlotSupply struct {
+	Slots int     `bun:"slots"`
+	Hours float64 `bun:"hours"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	RoleUser           = "user"
+	RoleManager        = "manager"
+	RoleDepartmentHead = "department_head"
+)
+
+// ApprovalChain is an ordered list of steps a request has to pass before it
+// is approved. The chain with the highest priority whose rules match the slot
+// is used for a new request.
+type ApprovalChain struct {
+	bun.BaseModel `bun:"table:approval_chains,alias:ac"`
+
+	ID          int64   `bun:"id,pk,autoincrement"`
+	Name        string  `bun:"name,notnull"`
+	MinHours    float64 `bun:"min_hours,notnull,default:0"`        // applies to slots at least this long
+	HolidayOnly bool    `bun:"holiday_only,notnull,default:false"` // applies to holiday slots only
+	Priority    int     `bun:"priority,notnull,default:0"`
+
+	Steps []ApprovalStep `bun:"rel:has-many,join:id=chain_id"`
+}
+
+// ApprovalStep is one level of an approval chain. Approvers are matched by
+// role or by user. With RequiredApprovals above one the step is approved in
+// parallel: that many distinct approvers must sign off.
+type ApprovalStep struct {
+	bun.BaseModel `bun:"table:approval_steps,alias:ast"`
+
+	ID                int64  `bun:"id,pk,autoincrement"`
+	ChainID           int64  `bun:"chain_id,notnull"`
+	Position          int    `bun:"position,notnull"`
+	Name              string `bun:"name"`
+	ApproverRole      string `bun:"approver_role"`
+	ApproverUserID    *int64 `bun:"approver_user_id"`
+	RequiredApprovals int    `bun:"required_approvals,notnull,default:1"`
+}
+
+// RequestApproval records a single decision taken on a step of a request.
+type RequestApproval struct {
+	bun.BaseModel `bun:"table:request_approvals,alias:ra"`
+
+	ID           int64     `bun:"id,pk,autoincrement"`
+	RequestID    int64     `bun:"request_id,notnull"`
+	StepPosition int       `bun:"step_position,notnull"`
+	ApproverID   int64     `bun:"approver_id,notnull"`
+	OnBehalfOf   *int64    `bun:"on_behalf_of"`     // set when ApproverID acted as a delegate
+	Decision     string    `bun:"decision,notnull"` // 'approved', 'rejected'
+	Reason       string    `bun:"reason"`
+	Comment      string    `bun:"comment"`
+	DecidedAt    time.Time `bun:"decided_at,notnull"`
+
+	Approver  *User `bun:"rel:belongs-to,join:approver_id=id" json:",omitempty"`
+	Delegator *User `bun:"rel:belongs-to,join:on_behalf_of=id" json:",omitempty"`
+}
+
+// ActingFor returns the user whose authority the decision was taken under.
+func (a *RequestApproval) ActingFor() int64 {
+	if a.OnBehalfOf != nil {
+		return *a.OnBehalfOf
+	}
+	return a.ApproverID
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// CalendarToken is the secret in a user's calendar feed URLs. Only its hash
+// is stored; the URLs are shown once when the token is created.
+type CalendarToken struct {
+	bun.BaseModel `bun:"table:calendar_tokens,alias:ct"`
+
+	UserID    int64     `bun:"user_id,pk"`
+	TokenHash string    `bun:"token_hash,notnull,unique"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
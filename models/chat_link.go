@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ChatLink ties a user to their chat on a chat platform.
+type ChatLink struct {
+	bun.BaseModel `bun:"table:chat_links,alias:cl"`
+
+	ID       int64  `bun:"id,pk,autoincrement" json:"id"`
+	UserID   int64  `bun:"user_id,notnull" json:"user_id"`
+	Provider string `bun:"provider,notnull" json:"provider"`
+	ChatID   int64  `bun:"chat_id,notnull" json:"-"`
+	// SenderID is the platform's ID of the user who linked the chat; only
+	// they can act through it.
+	SenderID int64     `bun:"sender_id,notnull,default:0" json:"-"`
+	Username string    `bun:"username" json:"username"`
+	LinkedAt time.Time `bun:"linked_at,notnull,default:current_timestamp" json:"linked_at"`
+}
+
+// ChatLinkCode is a one-time code a user sends to the bot to link their
+// chat. Only its hash is stored.
+type ChatLinkCode struct {
+	bun.BaseModel `bun:"table:chat_link_codes,alias:clc"`
+
+	CodeHash  string     `bun:"code_hash,pk"`
+	UserID    int64      `bun:"user_id,notnull"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull"`
+	UsedAt    *time.Time `bun:"used_at"`
+}
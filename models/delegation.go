@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Delegation hands a manager's review authority to another user for a date
+// range, optionally limited to some teams. An empty TeamIDs covers every team.
+type Delegation struct {
+	bun.BaseModel `bun:"table:delegations,alias:dl"`
+
+	ID         int64      `bun:"id,pk,autoincrement"`
+	ManagerID  int64      `bun:"manager_id,notnull"`
+	DelegateID int64      `bun:"delegate_id,notnull"`
+	StartsAt   time.Time  `bun:"starts_at,notnull"`
+	EndsAt     time.Time  `bun:"ends_at,notnull"`
+	TeamIDs    []int64    `bun:"team_ids,array"`
+	CreatedAt  time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	RevokedAt  *time.Time `bun:"revoked_at"`
+
+	Manager  *User `bun:"rel:belongs-to,join:manager_id=id" json:",omitempty"`
+	Delegate *User `bun:"rel:belongs-to,join:delegate_id=id" json:",omitempty"`
+}
+
+// Covers reports whether the delegation applies to a request from teamID.
+func (d *Delegation) Covers(teamID int64) bool {
+	if len(d.TeamIDs) == 0 {
+		return true
+	}
+	for _, id := range d.TeamIDs {
+		if id == teamID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	DayWorkday = "workday"
+	DayWeekend = "weekend"
+	DayHoliday = "holiday"
+)
+
+const (
+	HolidaySourceManual = "manual"
+	HolidaySourceICS    = "ics"
+)
+
+// HolidayCalendar is a set of public holidays and a weekly weekend, for
+// example one per office. Teams are assigned a calendar; teams without one
+// use the default calendar.
+type HolidayCalendar struct {
+	bun.BaseModel `bun:"table:holiday_calendars,alias:hc"`
+
+	ID       int64  `bun:"id,pk,autoincrement" json:"id"`
+	Name     string `bun:"name,notnull,unique" json:"name"`
+	Timezone string `bun:"timezone,notnull" json:"timezone"` // IANA name; dates are local to it
+	// Weekend lists the weekly days off as lower-case English day names,
+	// e.g. ["thursday", "friday"].
+	Weekend   []string  `bun:"weekend,array" json:"weekend"`
+	IsDefault bool      `bun:"is_default,notnull,default:false" json:"is_default"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Location returns the calendar's time zone, UTC when it is unknown.
+func (c *HolidayCalendar) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsWeekend reports whether d is a weekly day off.
+func (c *HolidayCalendar) IsWeekend(d time.Weekday) bool {
+	for _, name := range c.Weekend {
+		if wd, ok := ParseWeekday(name); ok && wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWeekday parses an English day name such as "friday".
+func ParseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == name {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// Holiday is a day off on a calendar. On a closure day the office is shut
+// and no slots may be created. (calendar_id, date) is unique.
+type Holiday struct {
+	bun.BaseModel `bun:"table:holidays,alias:h"`
+
+	ID         int64     `bun:"id,pk,autoincrement" json:"id"`
+	CalendarID int64     `bun:"calendar_id,notnull" json:"calendar_id"`
+	Date       time.Time `bun:"date,type:date,notnull" json:"date" format:"date"` // midnight UTC of the date
+	Name       string    `bun:"name,notnull" json:"name"`
+	Closure    bool      `bun:"closure,notnull,default:false" json:"closure"`
+	Source     string    `bun:"source,notnull,default:'manual'" json:"source"` // 'manual' or 'ics'
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
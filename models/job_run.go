@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// JobRun is one execution of a background job. Scheduled runs carry the
+// activation they belong to, which is unique per job so replicas never run
+// the same activation twice.
+type JobRun struct {
+	bun.BaseModel `bun:"table:job_runs,alias:jr"`
+
+	ID           int64      `bun:"id,pk,autoincrement"`
+	JobName      string     `bun:"job_name,notnull"`
+	ScheduledFor *time.Time `bun:"scheduled_for"`   // nil for manual runs
+	Trigger      string     `bun:"trigger,notnull"` // 'schedule', 'manual'
+	Node         string     `bun:"node"`
+	Status       string     `bun:"status,notnull"`
+	Attempts     int        `bun:"attempts,notnull,default:0"`
+	Error        string     `bun:"error"`
+	StartedAt    time.Time  `bun:"started_at,notnull"`
+	FinishedAt   *time.Time `bun:"finished_at"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RequestFilter narrows a list of overtime requests. Zero fields match
+// every request.
+type RequestFilter struct {
+	Statuses []string
+	TeamID   int64 // team of the applicant
+	// TeamIDs limits the applicant to these teams when it is not nil; an
+	// empty, non-nil TeamIDs matches no request.
+	TeamIDs []int64
+	UserID  int64
+	SlotID  int64
+	// From and To bound the slot start to [From, To).
+	From time.Time
+	To   time.Time
+	// Search matches the slot title or the applicant's name, ignoring case.
+	Search string
+
+	// WithApprovals loads the approval decisions of each request as well.
+	WithApprovals bool
+}
+
+// SlotFilter narrows a list of overtime slots. Zero fields match every
+// slot.
+type SlotFilter struct {
+	Statuses  []string
+	CreatedBy int64
+	// From and To bound the slot start to [From, To).
+	From time.Time
+	To   time.Time
+	// Search matches the slot title, ignoring case.
+	Search string
+}
+
+// ListOptions selects one page of a list ordered by Sort, an allow-listed
+// key of the list, with the row ID breaking ties.
+type ListOptions struct {
+	Sort  string
+	Desc  bool
+	After *Cursor // continue after this row; nil for the first page
+	Limit int     // 0 lists every row
+}
+
+// Cursor marks where a page ended: the sort value and ID of its last row.
+// Clients pass it back opaque, see Encode.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"i"`
+}
+
+// ErrInvalidCursor is returned by DecodeCursor for tokens it did not make.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c *Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a token made by Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort == "" || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// PageInfo describes a page of a list.
+type PageInfo struct {
+	Sort       string `json:"sort"`
+	Order      string `json:"order"` // "asc" or "desc"
+	Limit      int    `json:"limit,omitempty"`
+	Count      int    `json:"count"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []Cursor{
+		{Sort: "id", ID: 1},
+		{Sort: "request_time", Desc: true, Value: "2024-03-20T04:30:00.123456Z", ID: 42},
+		{Sort: "title", Value: "شیفت شب, ward 3 \"A\"", ID: 7},
+		{Sort: "status", Value: "a/b+c=d?", ID: 1 << 62},
+	}
+	for _, want := range tests {
+		token := want.Encode()
+		if strings.ContainsAny(token, "+/=") {
+			t.Errorf("%+v: token %q is not URL-safe", want, token)
+		}
+		got, err := DecodeCursor(token)
+		if err != nil {
+			t.Errorf("%+v: DecodeCursor: %v", want, err)
+			continue
+		}
+		if *got != want {
+			t.Errorf("DecodeCursor(Encode(%+v)) = %+v", want, *got)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id","i":1}`))},
+		{"not JSON", encode("id:1")},
+		{"no sort", encode(`{"i":1}`)},
+		{"no ID", encode(`{"s":"id"}`)},
+		{"negative ID", encode(`{"s":"id","i":-5}`)},
+		{"wrong types", encode(`{"s":1,"i":"1"}`)},
+	}
+	for _, tt := range tests {
+		if c, err := DecodeCursor(tt.token); err != ErrInvalidCursor {
+			t.Errorf("%s: DecodeCursor = %+v, %v, want ErrInvalidCursor", tt.name, c, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Notification is an entry in a user's in-app inbox.
+type Notification struct {
+	bun.BaseModel `bun:"table:notifications,alias:n"`
+
+	ID     int64  `bun:"id,pk,autoincrement" json:"id"`
+	UserID int64  `bun:"user_id,notnull" json:"-"`
+	Kind   string `bun:"kind,notnull" json:"kind"`
+	Title  string `bun:"title,notnull" json:"title"`
+	Body   string `bun:"body,notnull" json:"body"`
+	// Data links the entry to what it is about, e.g. request_id or slot_id.
+	Data      map[string]interface{} `bun:"data,type:jsonb" json:"data,omitempty"`
+	ReadAt    *time.Time             `bun:"read_at" json:"read_at"`
+	CreatedAt time.Time              `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
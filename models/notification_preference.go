@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Notification kinds, shared by every channel.
+const (
+	NotifyRequestDecided = "request_decided"
+	NotifySlotPublished  = "slot_published"
+	NotifyReminder       = "reminder"
+	NotifyPasswordReset  = "password_reset"
+	NotifyReviewPending  = "review_pending"
+)
+
+// Calendars dates can be shown in.
+const (
+	CalendarGregorian = "gregorian"
+	CalendarJalali    = "jalali"
+)
+
+// NotificationPreference holds a user's notification settings. Users
+// without a row get DefaultNotificationPreference.
+type NotificationPreference struct {
+	bun.BaseModel `bun:"table:notification_preferences,alias:np"`
+
+	UserID int64  `bun:"user_id,pk"`
+	Locale string `bun:"locale,notnull,default:'en'"`
+	// Calendar is how API responses and exports show dates to the user:
+	// 'gregorian' or 'jalali'.
+	Calendar string `bun:"calendar,notnull,default:'gregorian'"`
+	// Timezone is the IANA zone times are shown to the user in. Empty
+	// means their team's zone, or else the organization's.
+	Timezone string `bun:"timezone,notnull,default:''"`
+
+	EmailEnabled        bool `bun:"email_enabled,notnull,default:true"`
+	EmailRequestDecided bool `bun:"email_request_decided,notnull,default:true"`
+	EmailSlotPublished  bool `bun:"email_slot_published,notnull,default:true"`
+	EmailReminders      bool `bun:"email_reminders,notnull,default:true"`
+	EmailReviewPending  bool `bun:"email_review_pending,notnull,default:true"`
+
+	// ChatEnabled turns notifications to a linked chat on or off.
+	ChatEnabled bool `bun:"chat_enabled,notnull,default:true"`
+
+	// UnsubscribeToken identifies the user in unsubscribe links.
+	UnsubscribeToken string    `bun:"unsubscribe_token,unique,notnull" json:"-"`
+	UpdatedAt        time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// DefaultNotificationPreference returns the settings of a user who never
+// changed them.
+func DefaultNotificationPreference(userID int64) NotificationPreference {
+	return NotificationPreference{
+		UserID:              userID,
+		Locale:              "en",
+		Calendar:            CalendarGregorian,
+		EmailEnabled:        true,
+		EmailRequestDecided: true,
+		EmailSlotPublished:  true,
+		EmailReminders:      true,
+		EmailReviewPending:  true,
+		ChatEnabled:         true,
+	}
+}
+
+// EmailAllows reports whether the user wants emails of kind.
+func (p *NotificationPreference) EmailAllows(kind string) bool {
+	if !p.EmailEnabled {
+		return kind == NotifyPasswordReset
+	}
+	switch kind {
+	case NotifyRequestDecided:
+		return p.EmailRequestDecided
+	case NotifySlotPublished:
+		return p.EmailSlotPublished
+	case NotifyReminder:
+		return p.EmailReminders
+	case NotifyReviewPending:
+		return p.EmailReviewPending
+	}
+	return true
+}
+
+// PasswordReset is a single use password reset token. Only its hash is
+// stored.
+type PasswordReset struct {
+	bun.BaseModel `bun:"table:password_resets,alias:pr"`
+
+	ID        int64      `bun:"id,pk,autoincrement"`
+	UserID    int64      `bun:"user_id,notnull"`
+	TokenHash string     `bun:"token_hash,unique,notnull"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull"`
+	UsedAt    *time.Time `bun:"used_at"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+}
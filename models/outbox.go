@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Domain event types written to the outbox.
+const (
+	EventSlotCreated       = "slot.created"
+	EventSlotStatusChanged = "slot.status_changed"
+	EventSlotAllocated     = "slot.allocated"
+
+	EventRequestCreated      = "request.created"
+	EventRequestStepApproved = "request.step_approved"
+	EventRequestApproved     = "request.approved"
+	EventRequestRejected     = "request.rejected"
+	EventRequestWaitlisted   = "request.waitlisted"
+	EventRequestPromoted     = "request.promoted" // back in review from the waitlist
+	EventRequestWithdrawn    = "request.withdrawn"
+	EventRequestExpired      = "request.expired"
+	EventRequestCancelled    = "request.cancelled" // its slot was cancelled
+	EventRequestEscalated    = "request.escalated"
+	EventRequestCommented    = "request.commented"
+	EventRequestReminded     = "request.reminded"
+
+	EventUserRegistered         = "user.registered"
+	EventPasswordResetRequested = "user.password_reset_requested"
+	EventDelegationCreated      = "delegation.created"
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the state
+// change it describes. Consumers pick events up from the table afterwards.
+type OutboxEvent struct {
+	bun.BaseModel `bun:"table:outbox_events,alias:oe"`
+
+	ID            int64           `bun:"id,pk,autoincrement"`
+	Type          string          `bun:"type,notnull"`
+	AggregateType string          `bun:"aggregate_type,notnull"`
+	AggregateID   int64           `bun:"aggregate_id,notnull"`
+	Payload       json.RawMessage `bun:"payload,type:jsonb,notnull"`
+	CreatedAt     time.Time       `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// OutboxConsumer is a named reader of the outbox. It sees every event
+// created from StartedAt on, its first read, however long it was down.
+type OutboxConsumer struct {
+	bun.BaseModel `bun:"table:outbox_consumers,alias:ocr"`
+
+	Name      string    `bun:"name,pk"`
+	StartedAt time.Time `bun:"started_at,notnull"`
+}
+
+// OutboxConsumption marks an event as handled by one consumer.
+type OutboxConsumption struct {
+	bun.BaseModel `bun:"table:outbox_consumptions,alias:oc"`
+
+	Consumer   string    `bun:"consumer,pk"`
+	EventID    int64     `bun:"event_id,pk"`
+	ConsumedAt time.Time `bun:"consumed_at,notnull,default:current_timestamp"`
+}
@@ -8,21 +8,60 @@ import (
 	"github.com/uptrace/bun"
 )
 
+const (
+	RequestStatusPending    = "pending"
+	RequestStatusApproved   = "approved"
+	RequestStatusRejected   = "rejected"
+	RequestStatusWaitlisted = "waitlisted"
+	RequestStatusWithdrawn  = "withdrawn"
+	RequestStatusExpired    = "expired"
+	// RequestStatusCancelled is an approved request whose slot was
+	// cancelled.
+	RequestStatusCancelled = "cancelled"
+)
+
+// Attendance of an approved request, recorded by a manager once the slot
+// has started.
+const (
+	AttendancePresent = "present"
+	AttendanceNoShow  = "no_show"
+)
+
 type OvertimeRequest struct {
 	bun.BaseModel `bun:"table:overtime_requests,alias:or"`
 
-	ID           int64     `bun:"id,pk,autoincrement"`
-	Status       string    `bun:"status,notnull,default:'pending'"` // 'pending', 'approved', 'rejected'
-	RequestTime  time.Time `bun:"request_time,notnull"`
-
+	ID          int64     `bun:"id,pk,autoincrement"`
+	Status      string    `bun:"status,notnull,default:'pending'"` // 'pending', 'approved', 'rejected', 'waitlisted', 'withdrawn', 'expired', 'cancelled'
+	RequestTime time.Time `bun:"request_time,notnull"`
 
 	UserID int64 `bun:"user_id,notnull"`
 	SlotID int64 `bun:"slot_id,notnull"`
 
+	ReviewedBy     *int64 `bun:"reviewed_by"`
+	DecisionReason string `bun:"decision_reason"` // reason given with the latest decision
+	// DecidedAt is when the request was finally approved or rejected; nil
+	// while undecided and for requests decided before it was recorded.
+	DecidedAt *time.Time `bun:"decided_at"`
+
+	// ChainID is the approval chain picked when the request was created. A nil
+	// chain means the default single manager step.
+	ChainID     *int64 `bun:"chain_id"`
+	CurrentStep int    `bun:"current_step,notnull,default:0"`
+
+	WaitlistPosition int `bun:"waitlist_position,notnull,default:0"` // 1-based, 0 when not waitlisted
+
+	Attendance string `bun:"attendance,notnull,default:''"` // 'present', 'no_show', empty until recorded
 
-	ReviewedBy *int64 `bun:"reviewed_by"`
+	// Requests pending past the review SLA are escalated one manager up per
+	// SLA period.
+	EscalatedTo     *int64     `bun:"escalated_to"`
+	EscalatedAt     *time.Time `bun:"escalated_at"`
+	EscalationLevel int        `bun:"escalation_level,notnull,default:0"`
 
+	// Sequence counts the updates of the request, for calendar clients.
+	Sequence int `bun:"sequence,notnull,default:0"`
 
-	User *User         `bun:"rel:belongs-to,join:user_id=id"`
-	Slot *OvertimeSlot `bun:"rel:belongs-to,join:slot_id=id"`
-}
\ No newline at end of file
+	User      *User             `bun:"rel:belongs-to,join:user_id=id"`
+	Slot      *OvertimeSlot     `bun:"rel:belongs-to,join:slot_id=id"`
+	Approvals []RequestApproval `bun:"rel:has-many,join:id=request_id" json:",omitempty"`
+}
@@ -8,6 +8,24 @@ import (
 	"github.com/uptrace/bun"
 )
 
+const (
+	SlotStatusScheduled  = "scheduled"
+	SlotStatusOpen       = "open"
+	SlotStatusFull       = "full"
+	SlotStatusClosed     = "closed"
+	SlotStatusInProgress = "in_progress"
+	SlotStatusCompleted  = "completed"
+	SlotStatusCancelled  = "cancelled"
+)
+
+const (
+	AllocationManual      = "manual"
+	AllocationFCFS        = "fcfs"
+	AllocationLottery     = "lottery"
+	AllocationFewestHours = "fewest_hours"
+	AllocationRotation    = "rotation"
+)
+
 type OvertimeSlot struct {
 	bun.BaseModel `bun:"table:overtime_slots,alias:os"`
 
@@ -17,7 +35,57 @@ type OvertimeSlot struct {
 	EndTime   time.Time `bun:"end_time,notnull"`
 	Capacity  int64     `bun:"capacity,notnull"`
 	Status    string    `bun:"status,notnull,default:'open'"`
+	IsHoliday bool      `bun:"is_holiday,notnull,default:false"`
+
+	// AllocationStrategy decides who gets the slot when it is oversubscribed:
+	// 'manual', 'fcfs', 'lottery', 'fewest_hours' or 'rotation'.
+	AllocationStrategy string     `bun:"allocation_strategy,notnull,default:'manual'"`
+	AllocationSeed     *int64     `bun:"allocation_seed"` // lottery seed, drawn at random on allocation when nil
+	WaitlistSize       int        `bun:"waitlist_size,notnull,default:0"`
+	AllocatedAt        *time.Time `bun:"allocated_at"`
+
+	// Application window. Nil values fall back to the slot creation (opens)
+	// and the slot start (closes, cancellation cutoff).
+	ApplicationOpensAt  *time.Time `bun:"application_opens_at"`
+	ApplicationClosesAt *time.Time `bun:"application_closes_at"`
+	CancellationCutoff  *time.Time `bun:"cancellation_cutoff"`
+
+	// Sequence counts the updates of the slot, for calendar clients.
+	Sequence int `bun:"sequence,notnull,default:0"`
 
 	CreatedBy int64 `bun:"created_by,notnull"`
 	Creator   *User `bun:"rel:belongs-to,join:created_by=id"`
 }
+
+// Hours returns the time elapsed between start and end in hours, so a
+// slot spanning a DST change counts the hour gained or lost.
+func (s *OvertimeSlot) Hours() float64 {
+	return s.EndTime.Sub(s.StartTime).Hours()
+}
+
+// ClosesAt returns when applications for the slot close.
+func (s *OvertimeSlot) ClosesAt() time.Time {
+	if s.ApplicationClosesAt != nil {
+		return *s.ApplicationClosesAt
+	}
+	return s.StartTime
+}
+
+// CutoffAt returns the last moment a request on the slot can be withdrawn.
+func (s *OvertimeSlot) CutoffAt() time.Time {
+	if s.CancellationCutoff != nil {
+		return *s.CancellationCutoff
+	}
+	return s.StartTime
+}
+
+// AcceptsApplicationsAt reports whether t falls inside the application window.
+func (s *OvertimeSlot) AcceptsApplicationsAt(t time.Time) bool {
+	if s.Status == SlotStatusCancelled {
+		return false
+	}
+	if s.ApplicationOpensAt != nil && t.Before(*s.ApplicationOpensAt) {
+		return false
+	}
+	return t.Before(s.ClosesAt())
+}
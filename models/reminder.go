@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ReminderScheduled = "scheduled"
+	ReminderSending   = "sending" // claimed by a sender
+	ReminderSent      = "sent"
+	ReminderFailed    = "failed" // given up after the last attempt
+	ReminderCancelled = "cancelled"
+)
+
+// Reminder is a notification due some time before an approved request's
+// slot starts. (request_id, offset_minutes) is unique, so each reminder is
+// scheduled once; it is claimed atomically before sending, so concurrent
+// senders never send it twice. Failed deliveries are retried on the
+// channels that have not received it yet.
+type Reminder struct {
+	bun.BaseModel `bun:"table:reminders,alias:rm"`
+
+	ID            int64      `bun:"id,pk,autoincrement" json:"id"`
+	RequestID     int64      `bun:"request_id,notnull" json:"request_id"`
+	SlotID        int64      `bun:"slot_id,notnull" json:"slot_id"`
+	UserID        int64      `bun:"user_id,notnull" json:"user_id"`
+	OffsetMinutes int        `bun:"offset_minutes,notnull" json:"offset_minutes"`
+	DueAt         time.Time  `bun:"due_at,notnull" json:"due_at"`
+	Status        string     `bun:"status,notnull" json:"status"`
+	SentAt        *time.Time `bun:"sent_at" json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+
+	// Attempts counts the claims; RetryAt is when a failed reminder is
+	// tried again, and ClaimedAt when the current claim was taken.
+	Attempts  int        `bun:"attempts,notnull,default:0" json:"attempts"`
+	RetryAt   *time.Time `bun:"retry_at" json:"retry_at,omitempty"`
+	ClaimedAt *time.Time `bun:"claimed_at" json:"-"`
+	// Delivered lists the channels that have the reminder.
+	Delivered []string `bun:"delivered,array" json:"delivered,omitempty"`
+	LastError string   `bun:"last_error,notnull,default:''" json:"last_error,omitempty"`
+}
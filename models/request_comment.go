@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// RequestComment is a message in the discussion thread of an overtime
+// request. Replies point at the comment they answer through ParentID.
+type RequestComment struct {
+	bun.BaseModel `bun:"table:request_comments,alias:rc"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	RequestID int64     `bun:"request_id,notnull"`
+	AuthorID  int64     `bun:"author_id,notnull"`
+	ParentID  *int64    `bun:"parent_id"`
+	Body      string    `bun:"body,notnull"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+
+	Author *User `bun:"rel:belongs-to,join:author_id=id" json:",omitempty"`
+}
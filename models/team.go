@@ -8,4 +8,10 @@ type Team struct {
 	ID        int64  `bun:"id,pk,autoincrement"`
 	Name      string `bun:"name,notnull"`
 	ManagerID int64  `bun:"manager_id"`
+	ParentID  *int64 `bun:"parent_id"` // team one level up, used for escalation
+
+	CalendarID *int64 `bun:"calendar_id"` // holiday calendar, the default one when nil
+	// Timezone is the IANA zone members see times in unless they picked
+	// their own; empty means the organization's zone.
+	Timezone string `bun:"timezone,notnull,default:''"`
 }
@@ -7,10 +7,15 @@ type User struct {
 	ID            int64  `bun:"id,pk,autoincrement"`
 	PersonnelCode string `bun:"personnel_code,unique,notnull"`
 	FullName      string `bun:"full_name,notnull"`
-	PasswordHash  string `bun:"password_hash,notnull"`
+	PasswordHash  string `bun:"password_hash,notnull" json:"-"`
 	Role          string `bun:"role,notnull"`
 	WorkHours     string `bun:"work_hours"`
+	Email         string `bun:"email"`
 
 	TeamID int64 `bun:"team_id,notnull"`
 	Team   *Team `bun:"rel:belongs-to,join:team_id=id"`
+
+	// RecentOvertimeHours are the approved overtime hours of the fairness
+	// window, set on applicants in review lists.
+	RecentOvertimeHours *float64 `bun:"-" json:",omitempty"`
 }
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookSubscription is an endpoint that receives outbox events. An empty
+// EventTypes subscribes to every event.
+type WebhookSubscription struct {
+	bun.BaseModel `bun:"table:webhook_subscriptions,alias:ws"`
+
+	ID         int64     `bun:"id,pk,autoincrement"`
+	URL        string    `bun:"url,notnull"`
+	Secret     string    `bun:"secret,notnull" json:"-"`
+	EventTypes []string  `bun:"event_types,array"`
+	Active     bool      `bun:"active,notnull,default:true"`
+	CreatedBy  int64     `bun:"created_by,notnull"`
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// Wants reports whether the subscription receives events of type eventType.
+func (w *WebhookSubscription) Wants(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one attempt chain of sending an event to a
+// subscription. Deliveries that exhaust their attempts end up dead.
+type WebhookDelivery struct {
+	bun.BaseModel `bun:"table:webhook_deliveries,alias:wd"`
+
+	ID             int64      `bun:"id,pk,autoincrement"`
+	SubscriptionID int64      `bun:"subscription_id,notnull"`
+	EventID        int64      `bun:"event_id,notnull"`
+	Status         string     `bun:"status,notnull,default:'pending'"`
+	Attempts       int        `bun:"attempts,notnull,default:0"`
+	NextAttemptAt  time.Time  `bun:"next_attempt_at,notnull"`
+	LastStatusCode int        `bun:"last_status_code"`
+	LastError      string     `bun:"last_error"`
+	DeliveredAt    *time.Time `bun:"delivered_at"`
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+
+	Subscription *WebhookSubscription `bun:"rel:belongs-to,join:subscription_id=id" json:",omitempty"`
+	Event        *OutboxEvent         `bun:"rel:belongs-to,join:event_id=id" json:",omitempty"`
+}
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"shiftdony/config"
+	"strings"
+	"time"
+)
+
+// EmailChannel sends notifications through an SMTP server.
+type EmailChannel struct {
+	cfg     config.SMTP
+	baseURL string
+	from    *mail.Address
+}
+
+func NewEmailChannel(cfg config.SMTP, baseURL string) (*EmailChannel, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address: %w", err)
+	}
+	return &EmailChannel{cfg: cfg, baseURL: strings.TrimRight(baseURL, "/"), from: from}, nil
+}
+
+func (c *EmailChannel) Name() string { return "email" }
+
+func (c *EmailChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Email == "" || !to.Prefs.EmailAllows(msg.Kind) {
+		return ErrSkipped
+	}
+
+	data := map[string]interface{}{}
+	for k, v := range msg.Data {
+		data[k] = v
+	}
+	data["Name"] = to.FullName
+	data["BaseURL"] = c.baseURL
+	unsubscribe := ""
+	if to.Prefs.UnsubscribeToken != "" {
+		unsubscribe = c.baseURL + "/api/notifications/unsubscribe?token=" + to.Prefs.UnsubscribeToken + "&kind=" + msg.Kind
+	}
+	data["UnsubscribeURL"] = unsubscribe
+
+	rendered, err := Render(to.Prefs.Locale, msg.Kind, data)
+	if err != nil {
+		return err
+	}
+	body, err := c.compose(to, rendered, unsubscribe)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, to.Email, body)
+}
+
+// compose builds a multipart/alternative message with a plain text and, when
+// present, an HTML part.
+func (c *EmailChannel) compose(to Recipient, r *Rendered, unsubscribe string) ([]byte, error) {
+	var buf bytes.Buffer
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := mail.Address{Name: to.FullName, Address: to.Email}
+	fmt.Fprintf(&buf, "From: %s\r\n", c.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", r.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", boundary, c.from.Address[strings.LastIndex(c.from.Address, "@")+1:])
+	if unsubscribe != "" {
+		fmt.Fprintf(&buf, "List-Unsubscribe: <%s>\r\n", unsubscribe)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if r.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, r.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", r.Text},
+		{"text/html", r.HTML},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func (c *EmailChannel) send(ctx context.Context, to string, body []byte) error {
+	addr := net.JoinHostPort(c.cfg.Host, c.cfg.Port)
+	dialer := net.Dialer{Timeout: c.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if c.cfg.Username != "" {
+		auth := smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, s string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
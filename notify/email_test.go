@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"shiftdony/config"
+	"shiftdony/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a MailHog-style SMTP server that accepts every message
+// and hands the raw message to the test.
+type smtpStandIn struct {
+	ln   net.Listener
+	rcpt chan string
+	data chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	s := &smtpStandIn{ln: ln, rcpt: make(chan string, 1), data: make(chan string, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 stand-in ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 stand-in")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.rcpt <- strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data <- msg.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) channel(t *testing.T) *EmailChannel {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	ch, err := NewEmailChannel(config.SMTP{
+		Host:    host,
+		Port:    port,
+		From:    "Shiftdoni <no-reply@shiftdoni.local>",
+		Timeout: 5 * time.Second,
+	}, "https://shiftdoni.example/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestEmailChannelSend(t *testing.T) {
+	server := newSMTPStandIn(t)
+	ch := server.channel(t)
+	start := time.Date(2024, 3, 20, 16, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"RequestID":     int64(7),
+		"SlotID":        int64(3),
+		"Status":        models.RequestStatusApproved,
+		"Reason":        "covered",
+		"SlotTitle":     "Night shift",
+		"StartTime":     start,
+		"EndTime":       start.Add(4 * time.Hour),
+		"Capacity":      int64(2),
+		"RequesterName": "Sara",
+		"Token":         "reset-token",
+		"ExpiresAt":     start.Add(time.Hour),
+	}
+
+	tests := []struct {
+		locale, kind string
+		textOnly     bool
+	}{
+		{"en", models.NotifyRequestDecided, false},
+		{"en", models.NotifySlotPublished, false},
+		{"en", models.NotifyReminder, false},
+		{"en", models.NotifyReviewPending, false},
+		{"en", models.NotifyPasswordReset, false},
+		{"fa", models.NotifyRequestDecided, false},
+		{"fa", models.NotifyPasswordReset, false},
+		// Unknown locales fall back to the default templates.
+		{"de", models.NotifySlotPublished, false},
+		// Templates without an HTML part send a plain text message.
+		{"en", models.NotifyPasswordReset, true},
+	}
+	defer func(saved fs.FS) { templateFS = saved }(templateFS)
+	for _, tt := range tests {
+		templateFS = embeddedTemplates
+		if tt.textOnly {
+			templateFS = textOnly{embeddedTemplates}
+		}
+		prefs := models.DefaultNotificationPreference(1)
+		prefs.Locale = tt.locale
+		prefs.UnsubscribeToken = "unsub"
+		to := Recipient{UserID: 1, FullName: "Ali Rezaei", Email: "ali@example.com", Prefs: prefs}
+
+		if err := ch.Send(context.Background(), to, Message{Kind: tt.kind, Data: data}); err != nil {
+			t.Errorf("%s/%s: Send: %v", tt.locale, tt.kind, err)
+			continue
+		}
+		if rcpt := <-server.rcpt; rcpt != to.Email {
+			t.Errorf("%s/%s: RCPT %q, want %q", tt.locale, tt.kind, rcpt, to.Email)
+		}
+		msg, err := mail.ReadMessage(strings.NewReader(<-server.data))
+		if err != nil {
+			t.Errorf("%s/%s: unreadable message: %v", tt.locale, tt.kind, err)
+			continue
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil || subject == "" {
+			t.Errorf("%s/%s: subject %q, %v", tt.locale, tt.kind, subject, err)
+		}
+		want := "<https://shiftdoni.example/api/notifications/unsubscribe?token=unsub&kind=" + tt.kind + ">"
+		if got := msg.Header.Get("List-Unsubscribe"); got != want {
+			t.Errorf("%s/%s: List-Unsubscribe %q, want %q", tt.locale, tt.kind, got, want)
+		}
+
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if err != nil {
+			t.Errorf("%s/%s: Content-Type: %v", tt.locale, tt.kind, err)
+			continue
+		}
+		if tt.textOnly {
+			body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+			if mediaType != "text/plain" || err != nil || !strings.Contains(string(body), "reset-token") {
+				t.Errorf("%s/%s: text only message %s %q, %v", tt.locale, tt.kind, mediaType, body, err)
+			}
+			continue
+		}
+		parts := multipart.NewReader(msg.Body, params["boundary"])
+		var types []string
+		for {
+			part, err := parts.NextPart()
+			if err != nil {
+				break
+			}
+			types = append(types, part.Header.Get("Content-Type"))
+			body, err := io.ReadAll(quotedprintable.NewReader(part))
+			if err != nil || len(body) == 0 {
+				t.Errorf("%s/%s: empty %s part: %v", tt.locale, tt.kind, part.Header.Get("Content-Type"), err)
+			}
+			if tt.kind == models.NotifyPasswordReset && !strings.Contains(string(body), "reset-token") {
+				t.Errorf("%s/%s: %s part lacks the token", tt.locale, tt.kind, part.Header.Get("Content-Type"))
+			}
+		}
+		if len(types) != 2 {
+			t.Errorf("%s/%s: parts %v, want text and HTML", tt.locale, tt.kind, types)
+		}
+	}
+}
+
+// textOnly hides the HTML templates of the files it wraps.
+type textOnly struct{ fs.FS }
+
+func (f textOnly) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, ".html.tmpl") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.FS.Open(name)
+}
+
+func TestEmailChannelSkips(t *testing.T) {
+	server := newSMTPStandIn(t)
+	ch := server.channel(t)
+	optedOut := models.DefaultNotificationPreference(1)
+	optedOut.EmailEnabled = false
+	noReminders := models.DefaultNotificationPreference(1)
+	noReminders.EmailReminders = false
+
+	tests := []struct {
+		name string
+		to   Recipient
+		kind string
+		skip bool
+	}{
+		{"no address", Recipient{Prefs: models.DefaultNotificationPreference(1)}, models.NotifyRequestDecided, true},
+		{"emails off", Recipient{Email: "a@example.com", Prefs: optedOut}, models.NotifySlotPublished, true},
+		{"kind off", Recipient{Email: "a@example.com", Prefs: noReminders}, models.NotifyReminder, true},
+		// Password resets are sent even to users who turned emails off.
+		{"reset with emails off", Recipient{Email: "a@example.com", Prefs: optedOut}, models.NotifyPasswordReset, false},
+	}
+	for _, tt := range tests {
+		msg := Message{Kind: tt.kind, Data: map[string]interface{}{
+			"Token":     "t",
+			"ExpiresAt": time.Now(),
+			"StartTime": time.Now(),
+			"EndTime":   time.Now(),
+			"Capacity":  int64(1),
+		}}
+		err := ch.Send(context.Background(), tt.to, msg)
+		if skipped := errors.Is(err, ErrSkipped); skipped != tt.skip {
+			t.Errorf("%s: Send = %v, want skipped %v", tt.name, err, tt.skip)
+		}
+		if err == nil {
+			<-server.rcpt
+			<-server.data
+		}
+	}
+}
+
+func TestMessageIn(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	at := time.Date(2024, 3, 20, 16, 0, 0, 0, time.UTC)
+	msg := Message{Kind: "k", Data: map[string]interface{}{"At": at, "Ptr": &at, "Nil": (*time.Time)(nil), "N": 1}}
+
+	local := msg.In(tehran)
+	if got := local.Data["At"].(time.Time); got.Location() != tehran || !got.Equal(at) {
+		t.Errorf("At = %v, want %v in Asia/Tehran", got, at)
+	}
+	if got := local.Data["Ptr"].(*time.Time); got.Location() != tehran || !got.Equal(at) {
+		t.Errorf("Ptr = %v, want %v in Asia/Tehran", got, at)
+	}
+	if local.Data["Nil"].(*time.Time) != nil || local.Data["N"] != 1 {
+		t.Errorf("other values changed: %v", local.Data)
+	}
+	if msg.Data["At"].(time.Time).Location() != time.UTC {
+		t.Error("In changed the original message")
+	}
+}
@@ -0,0 +1,54 @@
+// Package notify delivers user notifications over pluggable channels.
+package notify
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+)
+
+// Recipient is the user a notification is addressed to, with the settings
+// channels need to reach them.
+type Recipient struct {
+	UserID   int64
+	FullName string
+	Email    string
+	Prefs    models.NotificationPreference
+	// Location is the zone times are shown to the recipient in.
+	Location *time.Location
+}
+
+// Message is a notification of one kind. Data is passed to the templates.
+type Message struct {
+	Kind string
+	Data map[string]interface{}
+}
+
+// In returns a copy of m with the times in Data moved to loc, so they are
+// rendered in the recipient's zone. A nil loc returns m unchanged.
+func (m Message) In(loc *time.Location) Message {
+	if loc == nil {
+		return m
+	}
+	data := make(map[string]interface{}, len(m.Data))
+	for k, v := range m.Data {
+		switch t := v.(type) {
+		case time.Time:
+			v = t.In(loc)
+		case *time.Time:
+			if t != nil {
+				local := t.In(loc)
+				v = &local
+			}
+		}
+		data[k] = v
+	}
+	return Message{Kind: m.Kind, Data: data}
+}
+
+// Channel sends messages to recipients. Send returns ErrSkipped when the
+// recipient cannot or does not want to be reached on the channel.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
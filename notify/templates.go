@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"shiftdony/i18n"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// DefaultLocale is used when a template is missing for the user's locale.
+const DefaultLocale = "en"
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// templateFS holds the templates by locale; tests swap it to render
+// templates the tree does not ship.
+var templateFS fs.FS = embeddedTemplates
+
+// ErrSkipped is returned by channels that did not send a message because the
+// recipient opted out or has no address on the channel.
+var ErrSkipped = errors.New("notification skipped")
+
+var funcs = map[string]interface{}{
+	"datetime": func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+	"date":     func(t time.Time) string { return t.Format("2006-01-02") },
+	// plural picks the English singular or plural form for n.
+	"plural": func(n int64, one, other string) string {
+		if i18n.PluralOne("en", n) {
+			return one
+		}
+		return other
+	},
+	// isolate and ltr keep names, titles and dates from reordering the
+	// right-to-left text around them.
+	"isolate": i18n.Isolate,
+	"ltr":     i18n.LTR,
+}
+
+// Rendered is a message rendered for one locale.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Render renders the subject, plain text and HTML templates of kind in
+// locale, falling back to DefaultLocale. The HTML part is optional.
+func Render(locale, kind string, data interface{}) (*Rendered, error) {
+	locale = templateLocale(locale, kind, "txt")
+
+	var out Rendered
+	subject, err := RenderText(locale, kind, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	out.Subject = strings.TrimSpace(subject)
+	if out.Text, err = RenderText(locale, kind, "txt", data); err != nil {
+		return nil, err
+	}
+
+	path := templatePath(locale, kind, "html")
+	if _, err := fs.Stat(templateFS, path); err == nil {
+		tmpl, err := htmltemplate.New(kind).Funcs(funcs).ParseFS(templateFS, path)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, pathBase(path), data); err != nil {
+			return nil, err
+		}
+		out.HTML = buf.String()
+	}
+	return &out, nil
+}
+
+// RenderText renders one plain text part of kind, e.g. "subject" or the
+// one-line "short" summary used by in-app and chat channels.
+func RenderText(locale, kind, part string, data interface{}) (string, error) {
+	path := templatePath(templateLocale(locale, kind, part), kind, part)
+	tmpl, err := texttemplate.New(pathBase(path)).Funcs(funcs).ParseFS(templateFS, path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, pathBase(path), data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateLocale returns locale if it has the template, DefaultLocale
+// otherwise.
+func templateLocale(locale, kind, part string) string {
+	if _, err := fs.Stat(templateFS, templatePath(locale, kind, part)); err != nil {
+		return DefaultLocale
+	}
+	return locale
+}
+
+func templatePath(locale, kind, part string) string {
+	return "templates/" + locale + "/" + kind + "." + part + ".tmpl"
+}
+
+func pathBase(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,424 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"unicode/utf16"
+)
+
+// ErrInvalidFont is returned by ParseFont for data that is not a TrueType
+// font it can embed.
+var ErrInvalidFont = errors.New("pdf: invalid or unsupported TrueType font")
+
+// Font is a TrueType font, embedded in documents as a subset of the
+// glyphs they use.
+type Font struct {
+	tables map[string][]byte
+
+	name       string // PostScript name
+	unitsPerEm int
+	bbox       [4]int
+	ascent     int
+	descent    int
+	capHeight  int
+	longLoca   bool
+	numGlyphs  int
+	advances   []int // by glyph, in font units
+	cmap       map[rune]uint16
+}
+
+// ParseFont reads a TrueType (glyf outline) font.
+func ParseFont(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, ErrInvalidFont
+	}
+	if v := binary.BigEndian.Uint32(data); v != 0x00010000 && v != 0x74727565 { // 1.0 or 'true'
+		return nil, ErrInvalidFont
+	}
+	f := &Font{tables: make(map[string][]byte)}
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*n {
+		return nil, ErrInvalidFont
+	}
+	for i := 0; i < n; i++ {
+		rec := data[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, ErrInvalidFont
+		}
+		f.tables[string(rec[:4])] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+		if f.tables[tag] == nil {
+			return nil, ErrInvalidFont
+		}
+	}
+	if err := f.parseMetrics(); err != nil {
+		return nil, err
+	}
+	if err := f.parseCmap(); err != nil {
+		return nil, err
+	}
+	f.name = f.postScriptName()
+	return f, nil
+}
+
+func (f *Font) parseMetrics() error {
+	head, hhea, maxp, hmtx := f.tables["head"], f.tables["hhea"], f.tables["maxp"], f.tables["hmtx"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return ErrInvalidFont
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return ErrInvalidFont
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.capHeight = f.ascent
+	if os2 := f.tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		f.capHeight = int(int16(binary.BigEndian.Uint16(os2[88:])))
+	}
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if metrics == 0 || metrics > f.numGlyphs || len(hmtx) < 4*metrics {
+		return ErrInvalidFont
+	}
+	f.advances = make([]int, f.numGlyphs)
+	for gid := range f.advances {
+		// Glyphs past the last metric repeat its advance.
+		f.advances[gid] = int(binary.BigEndian.Uint16(hmtx[4*min(gid, metrics-1):]))
+	}
+	return nil
+}
+
+// parseCmap reads the Unicode mapping of the font, format 4 for the Basic
+// Multilingual Plane or format 12 for all of Unicode.
+func (f *Font) parseCmap() error {
+	cmap := f.tables["cmap"]
+	if len(cmap) < 4 {
+		return ErrInvalidFont
+	}
+	var sub []byte
+	best := -1
+	for i, n := 0, int(binary.BigEndian.Uint16(cmap[2:])); i < n && 4+8*i+8 <= len(cmap); i++ {
+		rec := cmap[4+8*i:]
+		platform, encoding := binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[2:])
+		offset := binary.BigEndian.Uint32(rec[4:])
+		if int(offset)+4 > len(cmap) {
+			continue
+		}
+		rank := -1
+		switch {
+		case platform == 3 && encoding == 10, platform == 0 && encoding >= 4:
+			rank = 2
+		case platform == 3 && encoding == 1, platform == 0:
+			rank = 1
+		}
+		if rank > best {
+			best, sub = rank, cmap[offset:]
+		}
+	}
+	if sub == nil {
+		return ErrInvalidFont
+	}
+	f.cmap = make(map[rune]uint16)
+	switch binary.BigEndian.Uint16(sub) {
+	case 4:
+		return f.parseCmap4(sub)
+	case 12:
+		return f.parseCmap12(sub)
+	}
+	return ErrInvalidFont
+}
+
+func (f *Font) parseCmap4(sub []byte) error {
+	if len(sub) < 14 {
+		return ErrInvalidFont
+	}
+	segs := int(binary.BigEndian.Uint16(sub[6:])) / 2
+	if len(sub) < 16+8*segs {
+		return ErrInvalidFont
+	}
+	ends, starts := sub[14:], sub[16+2*segs:]
+	deltas, ranges := sub[16+4*segs:], sub[16+6*segs:]
+	for i := 0; i < segs; i++ {
+		end := rune(binary.BigEndian.Uint16(ends[2*i:]))
+		start := rune(binary.BigEndian.Uint16(starts[2*i:]))
+		delta := binary.BigEndian.Uint16(deltas[2*i:])
+		rangeOffset := int(binary.BigEndian.Uint16(ranges[2*i:]))
+		for r := start; r <= end && r != 0xFFFF; r++ {
+			gid := uint16(r) + delta
+			if rangeOffset != 0 {
+				at := 16 + 6*segs + 2*i + rangeOffset + 2*int(r-start)
+				if at+2 > len(sub) {
+					return ErrInvalidFont
+				}
+				if gid = binary.BigEndian.Uint16(sub[at:]); gid != 0 {
+					gid += delta
+				}
+			}
+			if gid != 0 && int(gid) < f.numGlyphs {
+				f.cmap[r] = gid
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Font) parseCmap12(sub []byte) error {
+	if len(sub) < 16 {
+		return ErrInvalidFont
+	}
+	groups := int(binary.BigEndian.Uint32(sub[12:]))
+	if len(sub) < 16+12*groups {
+		return ErrInvalidFont
+	}
+	for i := 0; i < groups; i++ {
+		g := sub[16+12*i:]
+		start, end := rune(binary.BigEndian.Uint32(g)), rune(binary.BigEndian.Uint32(g[4:]))
+		gid := binary.BigEndian.Uint32(g[8:])
+		for r := start; r <= end && r <= 0x10FFFF; r++ {
+			if id := gid + uint32(r-start); id != 0 && int(id) < f.numGlyphs {
+				f.cmap[r] = uint16(id)
+			}
+		}
+	}
+	return nil
+}
+
+// postScriptName returns name ID 6 of the name table, or "Embedded" when
+// the font has none.
+func (f *Font) postScriptName() string {
+	name := f.tables["name"]
+	if len(name) < 6 {
+		return "Embedded"
+	}
+	count, strings := int(binary.BigEndian.Uint16(name[2:])), int(binary.BigEndian.Uint16(name[4:]))
+	for i := 0; i < count && 6+12*i+12 <= len(name); i++ {
+		rec := name[6+12*i:]
+		platform, id := binary.BigEndian.Uint16(rec), binary.BigEndian.Uint16(rec[6:])
+		length, offset := int(binary.BigEndian.Uint16(rec[8:])), int(binary.BigEndian.Uint16(rec[10:]))
+		if id != 6 || strings+offset+length > len(name) {
+			continue
+		}
+		raw := name[strings+offset : strings+offset+length]
+		var s []rune
+		if platform == 1 {
+			for _, b := range raw {
+				s = append(s, rune(b))
+			}
+		} else {
+			units := make([]uint16, len(raw)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(raw[2*j:])
+			}
+			s = utf16.Decode(units)
+		}
+		clean := make([]rune, 0, len(s))
+		for _, r := range s {
+			// PDF names take printable ASCII without delimiters.
+			if r > ' ' && r < 0x7F && r != '/' && r != '[' && r != ']' && r != '(' && r != ')' && r != '<' && r != '>' && r != '{' && r != '}' && r != '%' {
+				clean = append(clean, r)
+			}
+		}
+		if len(clean) > 0 {
+			return string(clean)
+		}
+	}
+	return "Embedded"
+}
+
+// glyph returns the glyph of r, 0 (.notdef) when the font lacks it.
+func (f *Font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// has reports whether the font has a glyph for r.
+func (f *Font) has(r rune) bool {
+	_, ok := f.cmap[r]
+	return ok
+}
+
+// advance returns the advance of a glyph in 1/1000 of the font size.
+func (f *Font) advance(gid uint16) float64 {
+	return float64(f.advances[gid]) * 1000 / float64(f.unitsPerEm)
+}
+
+func (f *Font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+func (f *Font) glyphData(gid int) []byte {
+	loca, glyf := f.tables["loca"], f.tables["glyf"]
+	var start, end int
+	if f.longLoca {
+		if 4*gid+8 > len(loca) {
+			return nil
+		}
+		start, end = int(binary.BigEndian.Uint32(loca[4*gid:])), int(binary.BigEndian.Uint32(loca[4*gid+4:]))
+	} else {
+		if 2*gid+4 > len(loca) {
+			return nil
+		}
+		start, end = 2*int(binary.BigEndian.Uint16(loca[2*gid:])), 2*int(binary.BigEndian.Uint16(loca[2*gid+2:]))
+	}
+	if start > end || end > len(glyf) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// Composite glyph flags.
+const (
+	argsAreWords   = 0x0001
+	haveScale      = 0x0008
+	moreComponents = 0x0020
+	haveXYScale    = 0x0040
+	haveTwoByTwo   = 0x0080
+)
+
+// components returns the glyphs a composite glyph is built from.
+func components(glyph []byte) []uint16 {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+	var out []uint16
+	for p := 10; p+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[p:])
+		out = append(out, binary.BigEndian.Uint16(glyph[p+2:]))
+		p += 4
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return out
+}
+
+// subset returns a font program keeping only the outlines of the given
+// glyphs and the glyphs they are composed of. Glyph IDs do not change, so
+// unused glyphs are left empty rather than removed.
+func (f *Font) subset(used map[uint16]bool) []byte {
+	keep := make(map[uint16]bool, len(used)+1)
+	queue := []uint16{0}
+	for gid := range used {
+		queue = append(queue, gid)
+	}
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if keep[gid] || int(gid) >= f.numGlyphs {
+			continue
+		}
+		keep[gid] = true
+		queue = append(queue, components(f.glyphData(int(gid)))...)
+	}
+
+	var glyf []byte
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for gid := 0; gid < f.numGlyphs; gid++ {
+		binary.BigEndian.PutUint32(loca[4*gid:], uint32(len(glyf)))
+		if keep[uint16(gid)] {
+			glyf = append(glyf, f.glyphData(gid)...)
+			for len(glyf)%4 != 0 {
+				glyf = append(glyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(len(glyf)))
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment, set below
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"maxp": f.tables["maxp"],
+		"hmtx": f.tables["hmtx"],
+		"loca": loca,
+		"glyf": glyf,
+	}
+	// Hinting programs, which the glyphs may call.
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if t := f.tables[tag]; t != nil {
+			tables[tag] = t
+		}
+	}
+	out := writeSFNT(tables)
+	adjust := 0xB1B0AFBA - checksum(out)
+	binary.BigEndian.PutUint32(out[headOffset(out)+8:], adjust)
+	return out
+}
+
+// writeSFNT lays out a TrueType file with the given tables.
+func writeSFNT(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	n := len(tags)
+	searchRange, selector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		selector++
+	}
+	out := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(out, 0x00010000)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(out[8:], uint16(selector))
+	binary.BigEndian.PutUint16(out[10:], uint16(n*16-searchRange*16))
+	for i, tag := range tags {
+		t := tables[tag]
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], checksum(t))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t)))
+		out = append(out, t...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func headOffset(sfnt []byte) int {
+	n := int(binary.BigEndian.Uint16(sfnt[4:]))
+	for i := 0; i < n; i++ {
+		rec := sfnt[12+16*i:]
+		if string(rec[:4]) == "head" {
+			return int(binary.BigEndian.Uint32(rec[8:]))
+		}
+	}
+	return 0
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
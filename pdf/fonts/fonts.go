@@ -0,0 +1,11 @@
+// Package fonts bundles the fonts documents are drawn in, so they render
+// the same everywhere without depending on fonts installed on the server.
+package fonts
+
+import _ "embed"
+
+// DejaVuSans is DejaVu Sans, which covers Latin, Arabic and the Persian
+// letters and their presentation forms. See LICENSE.
+//
+//go:embed DejaVuSans.ttf
+var DejaVuSans []byte
@@ -0,0 +1,313 @@
+// Package pdf writes simple PDF documents: pages of text, lines and shaded
+// boxes in one embedded TrueType font. Pages are written as they are
+// finished, so long documents do not build up in memory; the font is
+// written last, subset to the glyphs used.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page sizes in points, portrait.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Object numbers fixed up front, so pages can refer to them before they
+// are written.
+const (
+	objCatalog = iota + 1
+	objPages
+	objFont
+	objCIDFont
+	objDescriptor
+	objFontFile
+	objToUnicode
+	objFree // first object number left for pages
+)
+
+// Document is a PDF being written to w. Coordinates are in points from
+// the top left corner of the page.
+type Document struct {
+	w       *bufio.Writer
+	written int64
+	err     error
+
+	font   *Font
+	width  float64
+	height float64
+
+	offsets []int64 // by object number; 0 is unused
+	pages   []int   // object numbers of the pages
+	content bytes.Buffer
+	open    bool
+	used    map[uint16]rune // glyphs drawn and the character of each
+}
+
+// New starts a document of pages of the given size drawn in font.
+func New(w io.Writer, font *Font, width, height float64) *Document {
+	d := &Document{
+		w:       bufio.NewWriter(w),
+		font:    font,
+		width:   width,
+		height:  height,
+		offsets: make([]int64, objFree),
+		used:    make(map[uint16]rune),
+	}
+	// The binary comment tells transfer programs the file is not text.
+	d.printf("%%PDF-1.7\n%%\xE2\xE3\xCF\xD3\n")
+	return d
+}
+
+// Width and Height return the page size.
+func (d *Document) Width() float64  { return d.width }
+func (d *Document) Height() float64 { return d.height }
+
+// AddPage finishes the current page, if any, and starts a new one.
+func (d *Document) AddPage() {
+	d.endPage()
+	d.open = true
+	d.content.Reset()
+}
+
+// Text draws a line of text with its left end at x and its baseline at y.
+// Right-to-left text is shaped and reordered; rtl is the direction of the
+// line, which places neutral characters between runs of both directions.
+func (d *Document) Text(x, y, size float64, text string, rtl bool) {
+	glyphs := d.layout(text, rtl)
+	if len(glyphs) == 0 {
+		return
+	}
+	var hex strings.Builder
+	for _, g := range glyphs {
+		fmt.Fprintf(&hex, "%04X", g)
+	}
+	fmt.Fprintf(&d.content, "BT /F1 %s Tf %s %s Td <%s> Tj ET\n", num(size), num(x), num(d.height-y), hex.String())
+}
+
+// TextWidth returns the width of text drawn at size.
+func (d *Document) TextWidth(text string, size float64) float64 {
+	var w float64
+	for _, g := range d.layout(text, false) {
+		w += d.font.advance(g)
+	}
+	return w * size / 1000
+}
+
+// Line draws a straight line of the given width.
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&d.content, "%s w %s %s m %s %s l S\n", num(width), num(x1), num(d.height-y1), num(x2), num(d.height-y2))
+}
+
+// FillRect fills a rectangle with a gray level, 0 black to 1 white.
+func (d *Document) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&d.content, "%s g %s %s %s %s re f 0 g\n", num(gray), num(x), num(d.height-y-h), num(w), num(h))
+}
+
+// layout returns the glyphs of text in drawing order, noting them for the
+// font subset.
+func (d *Document) layout(text string, rtl bool) []uint16 {
+	runes := reorder(d.font.shape([]rune(text)), rtl)
+	glyphs := make([]uint16, len(runes))
+	for i, r := range runes {
+		g := d.font.glyph(r)
+		glyphs[i] = g
+		if _, ok := d.used[g]; !ok && g != 0 {
+			d.used[g] = r
+		}
+	}
+	return glyphs
+}
+
+func (d *Document) endPage() {
+	if !d.open {
+		return
+	}
+	d.open = false
+	content := d.stream(d.content.Bytes())
+	contentObj := d.newObject()
+	d.printf("<< /Length %d /Filter /FlateDecode >>\nstream\n", len(content))
+	d.write(content)
+	d.printf("\nendstream\nendobj\n")
+
+	pageObj := d.newObject()
+	d.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		objPages, num(d.width), num(d.height), objFont, contentObj)
+	d.pages = append(d.pages, pageObj)
+}
+
+// Close finishes the last page and writes the font and the document
+// structure. A document needs at least one page; an empty page is added
+// otherwise.
+func (d *Document) Close() error {
+	if len(d.pages) == 0 && !d.open {
+		d.AddPage()
+	}
+	d.endPage()
+	d.writeFont()
+
+	d.beginObject(objPages)
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = strconv.Itoa(p) + " 0 R"
+	}
+	d.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(d.pages))
+	d.beginObject(objCatalog)
+	d.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", objPages)
+
+	xref := d.written
+	d.printf("xref\n0 %d\n0000000000 65535 f \n", len(d.offsets))
+	for _, offset := range d.offsets[1:] {
+		d.printf("%010d 00000 n \n", offset)
+	}
+	d.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.offsets), objCatalog, xref)
+	if d.err != nil {
+		return d.err
+	}
+	return d.w.Flush()
+}
+
+func (d *Document) writeFont() {
+	f := d.font
+	gids := make([]uint16, 0, len(d.used))
+	for g := range d.used {
+		gids = append(gids, g)
+	}
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+	used := make(map[uint16]bool, len(gids))
+	for _, g := range gids {
+		used[g] = true
+	}
+	name := subsetTag(gids) + "+" + f.name
+
+	d.beginObject(objFont)
+	d.printf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>\nendobj\n",
+		name, objCIDFont, objToUnicode)
+
+	var widths strings.Builder
+	for _, g := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", g, int(f.advance(g)+0.5))
+	}
+	d.beginObject(objCIDFont)
+	d.printf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW %d /W [%s] /CIDToGIDMap /Identity >>\nendobj\n",
+		name, objDescriptor, int(f.advance(0)+0.5), widths.String())
+
+	d.beginObject(objDescriptor)
+	d.printf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>\nendobj\n",
+		name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.capHeight), objFontFile)
+
+	program := f.subset(used)
+	file := d.stream(program)
+	d.beginObject(objFontFile)
+	d.printf("<< /Length %d /Length1 %d /Filter /FlateDecode >>\nstream\n", len(file), len(program))
+	d.write(file)
+	d.printf("\nendstream\nendobj\n")
+
+	cmap := d.stream(toUnicode(gids, d.used))
+	d.beginObject(objToUnicode)
+	d.printf("<< /Length %d /Filter /FlateDecode >>\nstream\n", len(cmap))
+	d.write(cmap)
+	d.printf("\nendstream\nendobj\n")
+}
+
+// toUnicode maps glyphs back to text, so it can be searched and copied.
+func toUnicode(gids []uint16, chars map[uint16]rune) []byte {
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(&b, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&b, "<%04X> <", g)
+			for _, u := range utf16Units(chars[g]) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
+
+func utf16Units(r rune) []uint16 {
+	if r < 0x10000 {
+		return []uint16{uint16(r)}
+	}
+	r -= 0x10000
+	return []uint16{uint16(0xD800 + r>>10), uint16(0xDC00 + r&0x3FF)}
+}
+
+// subsetTag names a subset with six capital letters derived from its
+// glyphs, as subset font names must start with.
+func subsetTag(gids []uint16) string {
+	h := sha1.New()
+	for _, g := range gids {
+		h.Write([]byte{byte(g >> 8), byte(g)})
+	}
+	sum := h.Sum(nil)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	return string(tag)
+}
+
+// stream compresses the data of a stream object.
+func (d *Document) stream(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+func (d *Document) newObject() int {
+	d.offsets = append(d.offsets, 0)
+	n := len(d.offsets) - 1
+	d.beginObject(n)
+	return n
+}
+
+func (d *Document) beginObject(n int) {
+	d.offsets[n] = d.written
+	d.printf("%d 0 obj\n", n)
+}
+
+func (d *Document) printf(format string, args ...interface{}) {
+	d.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (d *Document) write(b []byte) {
+	if d.err != nil {
+		return
+	}
+	n, err := d.w.Write(b)
+	d.written += int64(n)
+	d.err = err
+}
+
+// num formats a coordinate with at most two decimals.
+func num(v float64) string {
+	return strconv.FormatFloat(float64(int64(v*100+0.5*sign(v)))/100, 'f', -1, 64)
+}
+
+func sign(v float64) float64 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
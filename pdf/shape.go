@@ -0,0 +1,358 @@
+package pdf
+
+import "strings"
+
+// PDF text is drawn glyph by glyph from left to right, so right-to-left
+// text is shaped and reordered before it is drawn. Shaping maps Arabic and
+// Persian letters to their contextual presentation forms; reordering is a
+// simplified Unicode bidirectional algorithm, enough for single lines of
+// names, titles, numbers and dates.
+
+// joining is how an Arabic letter connects to its neighbours.
+type joining int
+
+const (
+	joinNone        joining = iota // does not join
+	joinRight                      // joins the letter before it only
+	joinDual                       // joins on both sides
+	joinCausing                    // tatweel and ZWJ: joins both sides, has no forms
+	joinTransparent                // marks, skipped when joining
+)
+
+// forms are the isolated, final, initial and medial presentation forms of
+// a letter; zero where the letter has none.
+type forms [4]rune
+
+const (
+	formIsolated = iota
+	formFinal
+	formInitial
+	formMedial
+)
+
+// arabicForms are the presentation forms of the Arabic letters Persian
+// uses.
+var arabicForms = map[rune]forms{
+	0x0621: {0xFE80, 0, 0, 0},
+	0x0622: {0xFE81, 0xFE82, 0, 0},
+	0x0623: {0xFE83, 0xFE84, 0, 0},
+	0x0624: {0xFE85, 0xFE86, 0, 0},
+	0x0625: {0xFE87, 0xFE88, 0, 0},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94, 0, 0},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE, 0, 0},
+	0x0649: {0xFEEF, 0xFEF0, 0xFBE8, 0xFBE9},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59}, // peh
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, // tcheh
+	0x0698: {0xFB8A, 0xFB8B, 0, 0},           // jeh
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, // keheh
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95}, // gaf
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF}, // farsi yeh
+}
+
+// lamAlef are the isolated and final ligatures of lam with each alef.
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const (
+	lam  = 0x0644
+	zwnj = 0x200C
+	zwj  = 0x200D
+)
+
+func joiningOf(r rune) joining {
+	switch {
+	case r == 0x0640 || r == zwj:
+		return joinCausing
+	case r >= 0x064B && r <= 0x065F, r == 0x0670:
+		return joinTransparent
+	}
+	f, ok := arabicForms[r]
+	switch {
+	case !ok:
+		return joinNone
+	case f[formInitial] != 0:
+		return joinDual
+	case f[formFinal] != 0:
+		return joinRight
+	}
+	return joinNone
+}
+
+// shape replaces Arabic letters with their contextual forms, in logical
+// order. Forms the font lacks are left as the base letter. Zero width
+// joiners and non-joiners are dropped once they have had their effect, and
+// bidirectional formatting characters too.
+func (f *Font) shape(text []rune) []rune {
+	out := make([]rune, 0, len(text))
+	// joinsNext reports whether the letter at i connects to the one after.
+	joinsNext := func(i int) bool {
+		for i++; i < len(text); i++ {
+			switch j := joiningOf(text[i]); j {
+			case joinTransparent:
+				continue
+			case joinRight, joinDual, joinCausing:
+				return true
+			default:
+				return false
+			}
+		}
+		return false
+	}
+	prevJoins := false // the letter before connects to this one
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		j := joiningOf(r)
+		if j == joinTransparent {
+			out = append(out, r)
+			continue
+		}
+		if r == zwnj || r == zwj {
+			prevJoins = r == zwj
+			continue
+		}
+		if bidiControl(r) {
+			continue
+		}
+		if r == lam {
+			if k := nextLetter(text, i); k >= 0 {
+				if lig, ok := lamAlef[text[k]]; ok && f.has(lig[0]) && f.has(lig[1]) {
+					if prevJoins {
+						out = append(out, lig[1])
+					} else {
+						out = append(out, lig[0])
+					}
+					out = append(out, text[i+1:k]...) // marks on the lam
+					i = k
+					prevJoins = false
+					continue
+				}
+			}
+		}
+		form := -1
+		switch j {
+		case joinDual:
+			next := joinsNext(i)
+			switch {
+			case prevJoins && next:
+				form = formMedial
+			case prevJoins:
+				form = formFinal
+			case next:
+				form = formInitial
+			default:
+				form = formIsolated
+			}
+		case joinRight:
+			form = formIsolated
+			if prevJoins {
+				form = formFinal
+			}
+		}
+		if form >= 0 {
+			if shaped := arabicForms[r][form]; shaped != 0 && f.has(shaped) {
+				r = shaped
+			}
+		}
+		out = append(out, r)
+		prevJoins = j == joinDual || j == joinCausing
+	}
+	return out
+}
+
+// bidiControl reports whether r is an invisible bidirectional formatting
+// character. Lines are reordered as a whole, so they are dropped.
+func bidiControl(r rune) bool {
+	return r == 0x200E || r == 0x200F || r == 0x061C || r >= 0x202A && r <= 0x202E || r >= 0x2066 && r <= 0x2069
+}
+
+// nextLetter returns the index of the first non-mark after i, or -1.
+func nextLetter(text []rune, i int) int {
+	for i++; i < len(text); i++ {
+		if joiningOf(text[i]) != joinTransparent {
+			return i
+		}
+	}
+	return -1
+}
+
+// direction is the bidirectional class of a character, reduced to what
+// reorder needs.
+type direction int
+
+const (
+	dirNeutral direction = iota
+	dirLTR
+	dirRTL
+	dirNumber // digits, drawn left to right but placed like the text around them
+)
+
+func directionOf(r rune) direction {
+	switch {
+	case r >= '0' && r <= '9', r >= 0x0660 && r <= 0x0669, r >= 0x06F0 && r <= 0x06F9:
+		return dirNumber
+	case r >= 0x0590 && r <= 0x08FF, r >= 0xFB1D && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFF:
+		if joiningOf(r) == joinTransparent {
+			return dirNeutral
+		}
+		return dirRTL
+	case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		return dirLTR
+	case r >= 0x00C0 && r < 0x0590, r >= 0x1E00 && r < 0x2000:
+		return dirLTR
+	}
+	return dirNeutral
+}
+
+// IsRTL reports whether text starts, ignoring neutral characters, with a
+// right-to-left letter.
+func IsRTL(text string) bool {
+	for _, r := range text {
+		if d := directionOf(r); d != dirNeutral {
+			return d == dirRTL
+		}
+	}
+	return false
+}
+
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{',
+	'<': '>', '>': '<', '«': '»', '»': '«',
+}
+
+// reorder turns a line in logical order into the left to right order it
+// is drawn in. Numbers take the direction of the letters before them, and
+// separators inside a number, as in 12.5 or 1403/01/05, belong to it.
+// Other neutral characters between two runs of the same direction take
+// it; the rest take the direction of the line, rtl or not.
+func reorder(text []rune, rtl bool) []rune {
+	if len(text) == 0 {
+		return text
+	}
+	base := dirLTR
+	if rtl {
+		base = dirRTL
+	}
+	dirs := make([]direction, len(text))
+	for i, r := range text {
+		dirs[i] = directionOf(r)
+	}
+	for i := 1; i+1 < len(text); i++ {
+		if dirs[i] == dirNeutral && dirs[i-1] == dirNumber && dirs[i+1] == dirNumber && strings.ContainsRune("./,:-+", text[i]) {
+			dirs[i] = dirNumber
+		}
+	}
+	// strong is the direction neutral characters see: that of the letters
+	// before numbers.
+	strong := make([]direction, len(text))
+	last := base
+	for i, d := range dirs {
+		switch d {
+		case dirLTR, dirRTL:
+			last = d
+			strong[i] = d
+		case dirNumber:
+			strong[i] = last
+		}
+	}
+	for i := 0; i < len(dirs); {
+		if dirs[i] != dirNeutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(dirs) && dirs[j] == dirNeutral {
+			j++
+		}
+		before, after := base, base
+		if i > 0 {
+			before = strong[i-1]
+		}
+		if j < len(dirs) {
+			after = strong[j]
+		}
+		d := base
+		if before == after {
+			d = before
+		}
+		for k := i; k < j; k++ {
+			dirs[k] = d
+		}
+		i = j
+	}
+	for i, d := range dirs {
+		if d == dirNumber {
+			dirs[i] = dirLTR
+		}
+	}
+
+	type run struct{ start, end int }
+	var runs []run
+	for i := 0; i < len(text); {
+		j := i + 1
+		for j < len(text) && dirs[j] == dirs[i] {
+			j++
+		}
+		runs = append(runs, run{i, j})
+		i = j
+	}
+	if rtl {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+	out := make([]rune, 0, len(text))
+	for _, r := range runs {
+		if dirs[r.start] != dirRTL {
+			out = append(out, text[r.start:r.end]...)
+			continue
+		}
+		// Marks stay after the letter they sit on, which they are drawn
+		// over.
+		for k := r.end - 1; k >= r.start; k-- {
+			s := k
+			for s > r.start && joiningOf(text[s]) == joinTransparent {
+				s--
+			}
+			c := text[s]
+			if m, ok := mirrored[c]; ok {
+				c = m
+			}
+			out = append(out, c)
+			out = append(out, text[s+1:k+1]...)
+			k = s
+		}
+	}
+	return out
+}
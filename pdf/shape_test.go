@@ -0,0 +1,138 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"shiftdony/pdf/fonts"
+	"strings"
+	"testing"
+)
+
+func loadFont(t *testing.T) *Font {
+	t.Helper()
+	font, err := ParseFont(fonts.DejaVuSans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+func hexRunes(rs []rune) string {
+	parts := make([]string, len(rs))
+	for i, r := range rs {
+		parts[i] = fmt.Sprintf("%04X", r)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestShape(t *testing.T) {
+	font := loadFont(t)
+	tests := []struct {
+		name string
+		text string
+		want []rune
+	}{
+		{"initial, medial and final", "علی", []rune{0xFECB, 0xFEE0, 0xFBFD}},
+		{"initial and final", "من", []rune{0xFEE3, 0xFEE6}},
+		{"isolated letter", "و", []rune{0xFEED}},
+		// Letters joining only the letter before break the word.
+		{"right-joining letters", "دارد", []rune{0xFEA9, 0xFE8D, 0xFEAD, 0xFEA9}},
+		{"Persian letters", "پچژکگ", []rune{0xFB58, 0xFB7D, 0xFB8B, 0xFB90, 0xFB93}},
+		{"lam alef after a joining letter", "سلام", []rune{0xFEB3, 0xFEFC, 0xFEE1}},
+		{"lam alef alone", "لا", []rune{0xFEFB}},
+		{"lam alef madda", "لآ", []rune{0xFEF5}},
+		// The zero width non-joiner keeps the prefix apart and is dropped.
+		{"zero width non-joiner", "می‌روم", []rune{0xFEE3, 0xFBFD, 0xFEAD, 0xFEED, 0xFEE1}},
+		{"zero width joiner", "ه‍", []rune{0xFEEB}},
+		{"tatweel joins", "بـ", []rune{0xFE91, 0x0640}},
+		{"marks are skipped when joining", "بَب", []rune{0xFE91, 0x064E, 0xFE90}},
+		{"bidi controls are dropped", "‏ب‪", []rune{0xFE8F}},
+		{"words join separately", "به به", []rune{0xFE91, 0xFEEA, ' ', 0xFE91, 0xFEEA}},
+		{"Latin is untouched", "Ali 12", []rune("Ali 12")},
+		{"Persian digits are untouched", "۱۴۰۳", []rune("۱۴۰۳")},
+	}
+	for _, tt := range tests {
+		if got := font.shape([]rune(tt.text)); hexRunes(got) != hexRunes(tt.want) {
+			t.Errorf("%s: shape(%q) = %s, want %s", tt.name, tt.text, hexRunes(got), hexRunes(tt.want))
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		rtl  bool
+		want string
+	}{
+		{"left to right", "Night shift", false, "Night shift"},
+		{"right to left", "علی", true, "یلع"},
+		{"number after Persian", "ساعت 12.5", true, "12.5 تعاس"},
+		{"Jalali date", "تاریخ 1403/01/05", true, "1403/01/05 خیرات"},
+		{"Persian digits", "شیفت ۱۲", true, "۱۲ تفیش"},
+		{"Latin name in a Persian line", "نام John Smith", true, "John Smith مان"},
+		{"Persian name in a Latin line", "Name: علی رضایی", false, "Name: ییاضر یلع"},
+		{"mirrored brackets", "(علی)", true, "(یلع)"},
+		{"neutral between directions takes the line's", "علی - Ali", true, "Ali - یلع"},
+		{"marks stay after their letter", "\u0628\u064E\u0627", true, "\u0627\u0628\u064E"},
+		{"empty", "", true, ""},
+	}
+	for _, tt := range tests {
+		if got := string(reorder([]rune(tt.text), tt.rtl)); got != tt.want {
+			t.Errorf("%s: reorder(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestIsRTL(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"علی رضایی", true},
+		{"  «شیفت»", true},
+		// Digits are not neutral.
+		{"123 شیفت", false},
+		{"Ali رضایی", false},
+		{"12:30", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsRTL(tt.text); got != tt.want {
+			t.Errorf("IsRTL(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentShapesText(t *testing.T) {
+	font := loadFont(t)
+	var buf bytes.Buffer
+	doc := New(&buf, font, A4Width, A4Height)
+	doc.AddPage()
+	doc.Text(50, 50, 12, "سلام 1403", true)
+	if err := doc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The line is drawn left to right as "1403 " and the shaped word
+	// reversed.
+	want := []rune("1403 ")
+	want = append(want, 0xFEE1, 0xFEFC, 0xFEB3)
+	glyphs := doc.layout("سلام 1403", true)
+	if len(glyphs) != len(want) {
+		t.Fatalf("layout has %d glyphs, want %d", len(glyphs), len(want))
+	}
+	for i, r := range want {
+		if g := font.glyph(r); g == 0 || glyphs[i] != g {
+			t.Errorf("glyph %d is %d, want %d for %04X", i, glyphs[i], g, r)
+		}
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Errorf("not a PDF file: %.20q...%q", out, out[len(out)-10:])
+	}
+	// Copied text maps the presentation forms back to characters.
+	if !strings.Contains(out, "/ToUnicode") {
+		t.Error("font has no ToUnicode map")
+	}
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type analyticsRepository struct {
+	db *bun.DB
+}
+
+func NewAnalyticsRepository(db *bun.DB) *analyticsRepository {
+	return &analyticsRepository{db: db}
+}
+
+// approvedHours selects approved overtime per day and user of filter, the
+// rows of the daily hours view, aggregated from the requests themselves.
+func (r *analyticsRepository) approvedHours(ctx context.Context, filter models.AnalyticsFilter) *bun.SelectQuery {
+	q := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("(slot.start_time AT TIME ZONE ?)::date AS day", filter.Zone).
+		ColumnExpr("?TableAlias.user_id, u.team_id").
+		ColumnExpr("COUNT(*) AS requests").
+		ColumnExpr("SUM(EXTRACT(EPOCH FROM (slot.end_time - slot.start_time)) / 3600) AS hours").
+		Join("JOIN overtime_slots AS slot ON slot.id = ?TableAlias.slot_id").
+		Join("JOIN users AS u ON u.id = ?TableAlias.user_id").
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		GroupExpr("1, 2, 3")
+	if filter.TeamID != 0 {
+		q = q.Where("u.team_id = ?", filter.TeamID)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("slot.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("slot.start_time < ?", filter.To)
+	}
+	return q
+}
+
+// dailyHours selects the rows of the daily hours view matching filter, from
+// the view itself when fromView is set.
+func (r *analyticsRepository) dailyHours(ctx context.Context, filter models.AnalyticsFilter, fromView bool) *bun.SelectQuery {
+	if !fromView {
+		return conn(ctx, r.db).NewSelect().TableExpr("(?) AS h", r.approvedHours(ctx, filter))
+	}
+	q := conn(ctx, r.db).NewSelect().TableExpr("? AS h", bun.Ident(models.DailyHoursView))
+	if filter.TeamID != 0 {
+		q = q.Where("h.team_id = ?", filter.TeamID)
+	}
+	// The bounds are midnights in the zone the view counts days in.
+	if !filter.From.IsZero() {
+		q = q.Where("h.day >= (? AT TIME ZONE ?)::date", filter.From, filter.Zone)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("h.day < (? AT TIME ZONE ?)::date", filter.To, filter.Zone)
+	}
+	return q
+}
+
+// GetDailyHours sums approved overtime per day and per user, team or
+// nothing, as group asks, by day.
+func (r *analyticsRepository) GetDailyHours(ctx context.Context, filter models.AnalyticsFilter, group string, fromView bool) ([]models.DailyTotal, error) {
+	key := "0"
+	switch group {
+	case models.GroupByUser:
+		key = "h.user_id"
+	case models.GroupByTeam:
+		key = "h.team_id"
+	}
+	var totals []models.DailyTotal
+	err := r.dailyHours(ctx, filter, fromView).
+		ColumnExpr("h.day::text AS day").
+		ColumnExpr(key+" AS key").
+		ColumnExpr("SUM(h.requests) AS requests").
+		ColumnExpr("SUM(h.hours) AS hours").
+		GroupExpr("1, 2").
+		OrderExpr("1, 2").
+		Scan(ctx, &totals)
+	return totals, err
+}
+
+// GetTopEarners returns the limit users with the most approved overtime
+// hours, most first.
+func (r *analyticsRepository) GetTopEarners(ctx context.Context, filter models.AnalyticsFilter, limit int, fromView bool) ([]models.UserTotal, error) {
+	var totals []models.UserTotal
+	err := r.dailyHours(ctx, filter, fromView).
+		ColumnExpr("h.user_id").
+		ColumnExpr("SUM(h.requests) AS requests").
+		ColumnExpr("SUM(h.hours) AS hours").
+		GroupExpr("h.user_id").
+		OrderExpr("hours DESC, h.user_id").
+		Limit(limit).
+		Scan(ctx, &totals)
+	return totals, err
+}
+
+// GetDailySlotFill sums capacity and approved places of the slots of filter
+// per day of their start. A slot fills when its last place is approved; the
+// approvals are ordered by decision time to find it.
+func (r *analyticsRepository) GetDailySlotFill(ctx context.Context, filter models.AnalyticsFilter) ([]models.SlotFillDay, error) {
+	slots := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeSlot)(nil)).
+		ColumnExpr("(?TableAlias.start_time AT TIME ZONE ?)::date AS day", filter.Zone).
+		ColumnExpr("?TableAlias.capacity").
+		ColumnExpr("COALESCE(?TableAlias.application_opens_at, a.first_request) AS opened_at").
+		ColumnExpr("COALESCE(a.approved, 0) AS approved").
+		ColumnExpr("a.filled_at").
+		Join(`LEFT JOIN LATERAL (
+			SELECT MIN(r.request_time) AS first_request,
+				COUNT(*) FILTER (WHERE r.status = ?0) AS approved,
+				(array_agg(r.decided_at ORDER BY r.decided_at) FILTER (WHERE r.status = ?0))[?TableAlias.capacity::int] AS filled_at
+			FROM overtime_requests AS r
+			WHERE r.slot_id = ?TableAlias.id
+		) AS a ON true`, models.RequestStatusApproved).
+		Where("?TableAlias.status <> ?", models.SlotStatusCancelled)
+	if !filter.From.IsZero() {
+		slots = slots.Where("?TableAlias.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		slots = slots.Where("?TableAlias.start_time < ?", filter.To)
+	}
+
+	var days []models.SlotFillDay
+	err := conn(ctx, r.db).NewSelect().
+		TableExpr("(?) AS s", slots).
+		ColumnExpr("s.day::text AS day").
+		ColumnExpr("COUNT(*) AS slots").
+		ColumnExpr("SUM(s.capacity) AS capacity").
+		ColumnExpr("SUM(LEAST(s.approved, s.capacity)) AS filled").
+		ColumnExpr("COUNT(*) FILTER (WHERE s.approved >= s.capacity) AS full_slots").
+		ColumnExpr("COUNT(s.filled_at) AS timed_slots").
+		ColumnExpr("COALESCE(SUM(GREATEST(EXTRACT(EPOCH FROM (s.filled_at - s.opened_at)), 0)), 0) AS fill_seconds").
+		GroupExpr("s.day").
+		OrderExpr("s.day").
+		Scan(ctx, &days)
+	return days, err
+}
+
+// GetReviewerTotals sums the decisions each reviewer took on the approval
+// steps of the requests of filter, counting every step rather than only the
+// last one. Review time runs from the application, or from the decision of
+// the step before.
+func (r *analyticsRepository) GetReviewerTotals(ctx context.Context, filter models.AnalyticsFilter) ([]models.ReviewerTotal, error) {
+	var totals []models.ReviewerTotal
+	q := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("a.approver_id AS reviewer_id").
+		ColumnExpr("COUNT(*) FILTER (WHERE a.decision = ?) AS approved", models.RequestStatusApproved).
+		ColumnExpr("COUNT(*) FILTER (WHERE a.decision = ?) AS rejected", models.RequestStatusRejected).
+		ColumnExpr("COUNT(*) AS timed_decisions").
+		ColumnExpr("COALESCE(SUM(EXTRACT(EPOCH FROM (a.decided_at - COALESCE(prev.decided_at, ?TableAlias.request_time)))), 0) AS review_seconds").
+		Join("JOIN request_approvals AS a ON a.request_id = ?TableAlias.id").
+		Join(`LEFT JOIN LATERAL (
+			SELECT MAX(p.decided_at) AS decided_at
+			FROM request_approvals AS p
+			WHERE p.request_id = a.request_id AND p.step_position < a.step_position
+		) AS prev ON true`).
+		Where("a.decision IN (?)", bun.In([]string{models.RequestStatusApproved, models.RequestStatusRejected})).
+		GroupExpr("a.approver_id").
+		OrderExpr("a.approver_id")
+	q = r.filterRequests(q, filter)
+	err := q.Scan(ctx, &totals)
+	return totals, err
+}
+
+// GetDailyAttendance sums the attendance of approved requests of filter on
+// slots that ended before now, per day of the slot start.
+func (r *analyticsRepository) GetDailyAttendance(ctx context.Context, filter models.AnalyticsFilter, now time.Time) ([]models.AttendanceDay, error) {
+	var days []models.AttendanceDay
+	q := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("(slot.start_time AT TIME ZONE ?)::date::text AS day", filter.Zone).
+		ColumnExpr("COUNT(*) AS approved").
+		ColumnExpr("COUNT(*) FILTER (WHERE ?TableAlias.attendance = ?) AS present", models.AttendancePresent).
+		ColumnExpr("COUNT(*) FILTER (WHERE ?TableAlias.attendance = ?) AS no_shows", models.AttendanceNoShow).
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		Where("slot.end_time <= ?", now).
+		GroupExpr("1").
+		OrderExpr("1")
+	q = r.filterRequests(q, filter)
+	err := q.Scan(ctx, &days)
+	return days, err
+}
+
+// filterRequests joins the slot, and the applicant when filtering by team,
+// to a query on requests and applies filter.
+func (r *analyticsRepository) filterRequests(q *bun.SelectQuery, filter models.AnalyticsFilter) *bun.SelectQuery {
+	q = q.Join("JOIN overtime_slots AS slot ON slot.id = ?TableAlias.slot_id")
+	if filter.TeamID != 0 {
+		q = q.Join("JOIN users AS u ON u.id = ?TableAlias.user_id").Where("u.team_id = ?", filter.TeamID)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("slot.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("slot.start_time < ?", filter.To)
+	}
+	return q
+}
+
+// GetMemberTotals sums what every member of the team applied for and was
+// approved for on slots starting in [from, to), by personnel code.
+func (r *analyticsRepository) GetMemberTotals(ctx context.Context, teamID int64, from, to time.Time) ([]models.MemberTotal, error) {
+	var totals []models.MemberTotal
+	err := conn(ctx, r.db).NewSelect().
+		Model((*models.User)(nil)).
+		ColumnExpr("?TableAlias.id AS user_id, ?TableAlias.personnel_code, ?TableAlias.full_name").
+		ColumnExpr("COUNT(r.id) AS applied").
+		ColumnExpr("COALESCE(SUM(r.hours), 0) AS applied_hours").
+		ColumnExpr("COUNT(r.id) FILTER (WHERE r.status = ?) AS approved", models.RequestStatusApproved).
+		ColumnExpr("COALESCE(SUM(r.hours) FILTER (WHERE r.status = ?), 0) AS approved_hours", models.RequestStatusApproved).
+		Join(`LEFT JOIN (
+			SELECT req.id, req.user_id, req.status,
+				EXTRACT(EPOCH FROM (slot.end_time - slot.start_time)) / 3600 AS hours
+			FROM overtime_requests AS req
+			JOIN overtime_slots AS slot ON slot.id = req.slot_id
+			WHERE slot.start_time >= ? AND slot.start_time < ?
+		) AS r ON r.user_id = ?TableAlias.id`, from, to).
+		Where("?TableAlias.team_id = ?", teamID).
+		GroupExpr("?TableAlias.id").
+		OrderExpr("?TableAlias.personnel_code").
+		Scan(ctx, &totals)
+	return totals, err
+}
+
+// GetSlotSupply sums the slots starting in [from, to) that were not
+// cancelled.
+func (r *analyticsRepository) GetSlotSupply(ctx context.Context, from, to time.Time) (*models.SlotSupply, error) {
+	var supply models.SlotSupply
+	err := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeSlot)(nil)).
+		ColumnExpr("COUNT(*) AS slots").
+		ColumnExpr("COALESCE(SUM(EXTRACT(EPOCH FROM (?TableAlias.end_time - ?TableAlias.start_time)) / 3600), 0) AS hours").
+		Where("?TableAlias.status <> ?", models.SlotStatusCancelled).
+		Where("?TableAlias.start_time >= ? AND ?TableAlias.start_time < ?", from, to).
+		Scan(ctx, &supply)
+	return &supply, err
+}
+
+// RefreshDailyHours recomputes the daily hours view without blocking
+// readers.
+func (r *analyticsRepository) RefreshDailyHours(ctx context.Context) error {
+	_, err := conn(ctx, r.db).NewRaw("REFRESH MATERIALIZED VIEW CONCURRENTLY ?", bun.Ident(models.DailyHoursView)).Exec(ctx)
+	return err
+}
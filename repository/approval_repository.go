@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type approvalRepository struct {
+	db *bun.DB
+}
+
+func NewApprovalRepository(db *bun.DB) *approvalRepository {
+	return &approvalRepository{db: db}
+}
+
+func (r *approvalRepository) CreateApprovalChain(ctx context.Context, chain *models.ApprovalChain) error {
+	return NewTransactor(r.db).RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).NewInsert().Model(chain).Exec(ctx); err != nil {
+			return err
+		}
+		if len(chain.Steps) == 0 {
+			return nil
+		}
+		for i := range chain.Steps {
+			chain.Steps[i].ChainID = chain.ID
+		}
+		_, err := conn(ctx, r.db).NewInsert().Model(&chain.Steps).Exec(ctx)
+		return err
+	})
+}
+
+func (r *approvalRepository) GetApprovalChains(ctx context.Context) ([]models.ApprovalChain, error) {
+	var chains []models.ApprovalChain
+	err := conn(ctx, r.db).NewSelect().
+		Model(&chains).
+		Relation("Steps", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("position ASC")
+		}).
+		Order("priority DESC", "min_hours DESC").
+		Scan(ctx)
+	return chains, err
+}
+
+func (r *approvalRepository) GetApprovalChainByID(ctx context.Context, chainID int64) (*models.ApprovalChain, error) {
+	var chain models.ApprovalChain
+	err := conn(ctx, r.db).NewSelect().
+		Model(&chain).
+		Relation("Steps", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("position ASC")
+		}).
+		Where("ac.id = ?", chainID).
+		Scan(ctx)
+	return &chain, err
+}
+
+func (r *approvalRepository) CreateRequestApproval(ctx context.Context, approval *models.RequestApproval) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(approval).Exec(ctx)
+	return err
+}
+
+func (r *approvalRepository) GetRequestApprovals(ctx context.Context, requestID int64) ([]models.RequestApproval, error) {
+	var approvals []models.RequestApproval
+	err := conn(ctx, r.db).NewSelect().
+		Model(&approvals).
+		Relation("Approver", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("full_name", "role")
+		}).
+		Relation("Delegator", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("full_name")
+		}).
+		Where("ra.request_id = ?", requestID).
+		Order("ra.decided_at ASC").
+		Scan(ctx)
+	return approvals, err
+}
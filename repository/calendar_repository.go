@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type calendarRepository struct {
+	db *bun.DB
+}
+
+func NewCalendarRepository(db *bun.DB) *calendarRepository {
+	return &calendarRepository{db: db}
+}
+
+func (r *calendarRepository) SaveCalendarToken(ctx context.Context, token *models.CalendarToken) error {
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(token).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("token_hash = EXCLUDED.token_hash").
+		Set("created_at = EXCLUDED.created_at").
+		Exec(ctx)
+	return err
+}
+
+func (r *calendarRepository) GetCalendarTokenByHash(ctx context.Context, tokenHash string) (*models.CalendarToken, error) {
+	token := new(models.CalendarToken)
+	err := conn(ctx, r.db).NewSelect().
+		Model(token).
+		Where("token_hash = ?", tokenHash).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *calendarRepository) DeleteCalendarToken(ctx context.Context, userID int64) (bool, error) {
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.CalendarToken)(nil)).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type chatRepository struct {
+	db *bun.DB
+}
+
+func NewChatRepository(db *bun.DB) *chatRepository {
+	return &chatRepository{db: db}
+}
+
+func (r *chatRepository) CreateLinkCode(ctx context.Context, code *models.ChatLinkCode) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(code).Exec(ctx)
+	return err
+}
+
+func (r *chatRepository) GetLinkCode(ctx context.Context, codeHash string) (*models.ChatLinkCode, error) {
+	var code models.ChatLinkCode
+	err := conn(ctx, r.db).NewSelect().
+		Model(&code).
+		Where("code_hash = ?", codeHash).
+		For("UPDATE").
+		Scan(ctx)
+	return &code, err
+}
+
+func (r *chatRepository) UpdateLinkCode(ctx context.Context, code *models.ChatLinkCode) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(code).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *chatRepository) SaveChatLink(ctx context.Context, link *models.ChatLink) error {
+	db := conn(ctx, r.db)
+	_, err := db.NewDelete().
+		Model((*models.ChatLink)(nil)).
+		Where("provider = ?", link.Provider).
+		WhereGroup(" AND ", func(q *bun.DeleteQuery) *bun.DeleteQuery {
+			return q.Where("user_id = ?", link.UserID).WhereOr("chat_id = ?", link.ChatID)
+		}).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.NewInsert().Model(link).Exec(ctx)
+	return err
+}
+
+func (r *chatRepository) DeleteChatLink(ctx context.Context, provider string, userID int64) (bool, error) {
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.ChatLink)(nil)).
+		Where("provider = ?", provider).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *chatRepository) GetChatLinkByChatID(ctx context.Context, provider string, chatID int64) (*models.ChatLink, error) {
+	var link models.ChatLink
+	err := conn(ctx, r.db).NewSelect().
+		Model(&link).
+		Where("provider = ?", provider).
+		Where("chat_id = ?", chatID).
+		Scan(ctx)
+	return &link, err
+}
+
+func (r *chatRepository) GetChatLinkByUserID(ctx context.Context, provider string, userID int64) (*models.ChatLink, error) {
+	var link models.ChatLink
+	err := conn(ctx, r.db).NewSelect().
+		Model(&link).
+		Where("provider = ?", provider).
+		Where("user_id = ?", userID).
+		Scan(ctx)
+	return &link, err
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type commentRepository struct {
+	db *bun.DB
+}
+
+func NewCommentRepository(db *bun.DB) *commentRepository {
+	return &commentRepository{db: db}
+}
+
+func (r *commentRepository) CreateRequestComment(ctx context.Context, comment *models.RequestComment) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(comment).Exec(ctx)
+	return err
+}
+
+func (r *commentRepository) GetRequestComments(ctx context.Context, requestID int64) ([]models.RequestComment, error) {
+	var comments []models.RequestComment
+	err := conn(ctx, r.db).NewSelect().
+		Model(&comments).
+		Relation("Author", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("full_name", "role")
+		}).
+		Where("rc.request_id = ?", requestID).
+		Order("rc.created_at ASC", "rc.id ASC").
+		Scan(ctx)
+	return comments, err
+}
+
+func (r *commentRepository) GetRequestCommentByID(ctx context.Context, commentID int64) (*models.RequestComment, error) {
+	var comment models.RequestComment
+	err := conn(ctx, r.db).NewSelect().
+		Model(&comment).
+		Where("id = ?", commentID).
+		Scan(ctx)
+	return &comment, err
+}
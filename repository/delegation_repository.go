@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type delegationRepository struct {
+	db *bun.DB
+}
+
+func NewDelegationRepository(db *bun.DB) *delegationRepository {
+	return &delegationRepository{db: db}
+}
+
+func (r *delegationRepository) CreateDelegation(ctx context.Context, delegation *models.Delegation) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(delegation).Exec(ctx)
+	return err
+}
+
+func (r *delegationRepository) GetDelegationsByManager(ctx context.Context, managerID int64) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := conn(ctx, r.db).NewSelect().
+		Model(&delegations).
+		Relation("Delegate", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("full_name")
+		}).
+		Where("dl.manager_id = ?", managerID).
+		Order("dl.starts_at DESC").
+		Scan(ctx)
+	return delegations, err
+}
+
+func (r *delegationRepository) GetActiveDelegationsForDelegate(ctx context.Context, delegateID int64, at time.Time) ([]models.Delegation, error) {
+	var delegations []models.Delegation
+	err := conn(ctx, r.db).NewSelect().
+		Model(&delegations).
+		Relation("Manager", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("full_name", "role")
+		}).
+		Where("dl.delegate_id = ?", delegateID).
+		Where("dl.revoked_at IS NULL").
+		Where("dl.starts_at <= ? AND dl.ends_at > ?", at, at).
+		Scan(ctx)
+	return delegations, err
+}
+
+func (r *delegationRepository) RevokeDelegation(ctx context.Context, delegationID, managerID int64, at time.Time) (bool, error) {
+	res, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.Delegation)(nil)).
+		Set("revoked_at = ?", at).
+		Where("id = ? AND manager_id = ? AND revoked_at IS NULL", delegationID, managerID).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
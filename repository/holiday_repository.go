@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type holidayRepository struct {
+	db *bun.DB
+}
+
+func NewHolidayRepository(db *bun.DB) *holidayRepository {
+	return &holidayRepository{db: db}
+}
+
+func (r *holidayRepository) CreateHolidayCalendar(ctx context.Context, calendar *models.HolidayCalendar) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(calendar).Exec(ctx)
+	return err
+}
+
+func (r *holidayRepository) GetHolidayCalendars(ctx context.Context) ([]models.HolidayCalendar, error) {
+	var calendars []models.HolidayCalendar
+	err := conn(ctx, r.db).NewSelect().
+		Model(&calendars).
+		Order("name ASC").
+		Scan(ctx)
+	return calendars, err
+}
+
+func (r *holidayRepository) GetHolidayCalendarByID(ctx context.Context, calendarID int64) (*models.HolidayCalendar, error) {
+	calendar := new(models.HolidayCalendar)
+	err := conn(ctx, r.db).NewSelect().
+		Model(calendar).
+		Where("id = ?", calendarID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return calendar, nil
+}
+
+func (r *holidayRepository) GetDefaultHolidayCalendar(ctx context.Context) (*models.HolidayCalendar, error) {
+	calendar := new(models.HolidayCalendar)
+	err := conn(ctx, r.db).NewSelect().
+		Model(calendar).
+		Where("is_default").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return calendar, nil
+}
+
+func (r *holidayRepository) UpdateHolidayCalendar(ctx context.Context, calendar *models.HolidayCalendar) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(calendar).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *holidayRepository) ClearDefaultHolidayCalendar(ctx context.Context) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.HolidayCalendar)(nil)).
+		Set("is_default = false").
+		Where("is_default").
+		Exec(ctx)
+	return err
+}
+
+func (r *holidayRepository) UpsertHolidays(ctx context.Context, holidays []models.Holiday) error {
+	if len(holidays) == 0 {
+		return nil
+	}
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(&holidays).
+		On("CONFLICT (calendar_id, date) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Set("closure = EXCLUDED.closure").
+		Set("source = EXCLUDED.source").
+		Exec(ctx)
+	return err
+}
+
+func (r *holidayRepository) GetHolidays(ctx context.Context, calendarID int64, from, to string) ([]models.Holiday, error) {
+	var holidays []models.Holiday
+	err := conn(ctx, r.db).NewSelect().
+		Model(&holidays).
+		Where("calendar_id = ?", calendarID).
+		Where("date BETWEEN ?::date AND ?::date", from, to).
+		Order("date ASC").
+		Scan(ctx)
+	return holidays, err
+}
+
+func (r *holidayRepository) DeleteHoliday(ctx context.Context, calendarID, holidayID int64) (bool, error) {
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.Holiday)(nil)).
+		Where("id = ?", holidayID).
+		Where("calendar_id = ?", calendarID).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
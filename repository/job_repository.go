@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type jobRepository struct {
+	db *bun.DB
+}
+
+func NewJobRepository(db *bun.DB) *jobRepository {
+	return &jobRepository{db: db}
+}
+
+func (r *jobRepository) CreateJobRun(ctx context.Context, run *models.JobRun) (bool, error) {
+	res, err := conn(ctx, r.db).NewInsert().
+		Model(run).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *jobRepository) UpdateJobRun(ctx context.Context, run *models.JobRun) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(run).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *jobRepository) GetLatestJobRuns(ctx context.Context) (map[string]models.JobRun, error) {
+	var runs []models.JobRun
+	err := conn(ctx, r.db).NewSelect().
+		Model(&runs).
+		DistinctOn("job_name").
+		Order("job_name ASC", "started_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]models.JobRun, len(runs))
+	for _, run := range runs {
+		latest[run.JobName] = run
+	}
+	return latest, nil
+}
+
+func (r *jobRepository) DeleteJobRuns(ctx context.Context, before time.Time) (int, error) {
+	latest := conn(ctx, r.db).NewSelect().
+		Model((*models.JobRun)(nil)).
+		Column("id").
+		DistinctOn("job_name").
+		Order("job_name ASC", "started_at DESC")
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.JobRun)(nil)).
+		Where("started_at < ?", before).
+		Where("status <> ?", models.JobRunRunning).
+		Where("id NOT IN (?)", latest).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// TryAdvisoryLock pins a connection for the lifetime of the lock, since
+// advisory locks belong to the session that took them.
+func (r *jobRepository) TryAdvisoryLock(ctx context.Context, key int64) (func(), bool, error) {
+	c, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var ok bool
+	if err := c.NewRaw("SELECT pg_try_advisory_lock(?)", key).Scan(ctx, &ok); err != nil {
+		c.Close()
+		return nil, false, err
+	}
+	if !ok {
+		c.Close()
+		return nil, false, nil
+	}
+	release := func() {
+		c.ExecContext(context.Background(), "SELECT pg_advisory_unlock(?)", key)
+		c.Close()
+	}
+	return release, true, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+	"shiftdony/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// sortKey is a column a list may be ordered by.
+type sortKey[T any] struct {
+	column string          // SQL expression, may use ?TableAlias
+	cast   string          // type the cursor value is cast to
+	value  func(*T) string // the row's value, for cursors; nil for the ID
+}
+
+// paginate orders q by the sort key of opts, resumes after opts.After and
+// fetches one row more than the limit, which page then trims. Unknown sort
+// keys are rejected; handlers allow-list them first.
+func paginate[T any](q *bun.SelectQuery, keys map[string]sortKey[T], opts models.ListOptions) (*bun.SelectQuery, error) {
+	key, ok := keys[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", opts.Sort)
+	}
+	dir, op := "ASC", ">"
+	if opts.Desc {
+		dir, op = "DESC", "<"
+	}
+	if after := opts.After; after != nil {
+		if key.value == nil {
+			q = q.Where("?TableAlias.id "+op+" ?", after.ID)
+		} else {
+			q = q.Where("("+key.column+", ?TableAlias.id) "+op+" (?::"+key.cast+", ?)", after.Value, after.ID)
+		}
+	}
+	if key.value == nil {
+		q = q.OrderExpr("?TableAlias.id " + dir)
+	} else {
+		q = q.OrderExpr(key.column + " " + dir + ", ?TableAlias.id " + dir)
+	}
+	if opts.Limit > 0 {
+		q = q.Limit(opts.Limit + 1)
+	}
+	return q, nil
+}
+
+// page trims the extra row paginate fetched and describes the page.
+func page[T any](rows []T, keys map[string]sortKey[T], opts models.ListOptions, id func(*T) int64) ([]T, *models.PageInfo) {
+	info := &models.PageInfo{Sort: opts.Sort, Order: "asc", Limit: opts.Limit}
+	if opts.Desc {
+		info.Order = "desc"
+	}
+	if opts.Limit > 0 && len(rows) > opts.Limit {
+		rows = rows[:opts.Limit]
+		last := &rows[len(rows)-1]
+		cursor := &models.Cursor{Sort: opts.Sort, Desc: opts.Desc, ID: id(last)}
+		if value := keys[opts.Sort].value; value != nil {
+			cursor.Value = value(last)
+		}
+		info.HasMore = true
+		info.NextCursor = cursor.Encode()
+	}
+	info.Count = len(rows)
+	return rows, info
+}
+
+// containsPattern returns an ILIKE pattern matching s anywhere.
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+func cursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"shiftdony/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestPageCursor(t *testing.T) {
+	start := time.Date(2024, 3, 20, 8, 30, 0, 123456789, time.FixedZone("IRST", 3*3600+1800))
+	slots := []models.OvertimeSlot{
+		{ID: 9, Title: "a", StartTime: start},
+		{ID: 5, Title: "b", StartTime: start.Add(time.Hour)},
+		{ID: 3, Title: "c", StartTime: start.Add(2 * time.Hour)},
+	}
+	id := func(s *models.OvertimeSlot) int64 { return s.ID }
+
+	tests := []struct {
+		name string
+		opts models.ListOptions
+		rows int
+		want *models.Cursor // nil when there is no next page
+	}{
+		{"every row", models.ListOptions{Sort: "id"}, 3, nil},
+		{"last page", models.ListOptions{Sort: "id", Limit: 3}, 3, nil},
+		{"by ID", models.ListOptions{Sort: "id", Desc: true, Limit: 1}, 1, &models.Cursor{Sort: "id", Desc: true, ID: 9}},
+		{"by title", models.ListOptions{Sort: "title", Limit: 2}, 2, &models.Cursor{Sort: "title", Value: "b", ID: 5}},
+		// Times are kept to the nanosecond, in UTC.
+		{"by time", models.ListOptions{Sort: "start_time", Limit: 1}, 1,
+			&models.Cursor{Sort: "start_time", Value: "2024-03-20T05:00:00.123456789Z", ID: 9}},
+	}
+	for _, tt := range tests {
+		rows, info := page(append([]models.OvertimeSlot(nil), slots...), slotSorts, tt.opts, id)
+		if len(rows) != tt.rows || info.Count != tt.rows {
+			t.Errorf("%s: %d rows, count %d, want %d", tt.name, len(rows), info.Count, tt.rows)
+		}
+		if info.HasMore != (tt.want != nil) {
+			t.Errorf("%s: has more %v", tt.name, info.HasMore)
+		}
+		if tt.want == nil {
+			if info.NextCursor != "" {
+				t.Errorf("%s: unexpected cursor %q", tt.name, info.NextCursor)
+			}
+			continue
+		}
+		got, err := models.DecodeCursor(info.NextCursor)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("%s: cursor %+v, want %+v", tt.name, *got, *tt.want)
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, got.Value); tt.opts.Sort == "start_time" && (err != nil || !parsed.Equal(rows[len(rows)-1].StartTime)) {
+			t.Errorf("%s: cursor time %q does not match the last row", tt.name, got.Value)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+	tests := []struct {
+		name string
+		opts models.ListOptions
+		want []string
+	}{
+		{"first page", models.ListOptions{Sort: "start_time", Limit: 10},
+			[]string{`ORDER BY "os".start_time ASC, "os".id ASC`, "LIMIT 11"}},
+		{"after a time", models.ListOptions{Sort: "start_time", Desc: true, Limit: 10,
+			After: &models.Cursor{Sort: "start_time", Desc: true, Value: "2024-03-20T05:00:00Z", ID: 4}},
+			[]string{`("os".start_time, "os".id) < ('2024-03-20T05:00:00Z'::timestamptz, 4)`, `ORDER BY "os".start_time DESC, "os".id DESC`}},
+		{"after a quoted title", models.ListOptions{Sort: "title", Limit: 5,
+			After: &models.Cursor{Sort: "title", Value: "it's", ID: 2}},
+			[]string{`("os".title, "os".id) > ('it''s'::text, 2)`}},
+		{"after an ID", models.ListOptions{Sort: "id", After: &models.Cursor{Sort: "id", ID: 8}},
+			[]string{`"os".id > 8`, `ORDER BY "os".id ASC`}},
+	}
+	for _, tt := range tests {
+		q, err := paginate(db.NewSelect().Model((*models.OvertimeSlot)(nil)), slotSorts, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		query := q.String()
+		for _, part := range tt.want {
+			if !strings.Contains(query, part) {
+				t.Errorf("%s: %s\nlacks %s", tt.name, query, part)
+			}
+		}
+		if tt.opts.Limit == 0 && strings.Contains(query, "LIMIT") {
+			t.Errorf("%s: unlimited list has a limit: %s", tt.name, query)
+		}
+	}
+
+	if _, err := paginate(db.NewSelect().Model((*models.OvertimeSlot)(nil)), slotSorts, models.ListOptions{Sort: "capacity"}); err == nil {
+		t.Error("unknown sort key accepted")
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type notificationRepository struct {
+	db *bun.DB
+}
+
+func NewNotificationRepository(db *bun.DB) *notificationRepository {
+	return &notificationRepository{db: db}
+}
+
+func (r *notificationRepository) GetPreferences(ctx context.Context, userIDs []int64) (map[int64]models.NotificationPreference, error) {
+	prefs := make(map[int64]models.NotificationPreference, len(userIDs))
+	if len(userIDs) == 0 {
+		return prefs, nil
+	}
+	var rows []models.NotificationPreference
+	err := conn(ctx, r.db).NewSelect().
+		Model(&rows).
+		Where("user_id IN (?)", bun.In(userIDs)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		prefs[row.UserID] = row
+	}
+	return prefs, nil
+}
+
+func (r *notificationRepository) CreateMissingPreferences(ctx context.Context, prefs []models.NotificationPreference) error {
+	if len(prefs) == 0 {
+		return nil
+	}
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(&prefs).
+		On("CONFLICT (user_id) DO NOTHING").
+		Exec(ctx)
+	return err
+}
+
+func (r *notificationRepository) GetPreferencesByToken(ctx context.Context, token string) (*models.NotificationPreference, error) {
+	var pref models.NotificationPreference
+	err := conn(ctx, r.db).NewSelect().
+		Model(&pref).
+		Where("unsubscribe_token = ?", token).
+		Scan(ctx)
+	return &pref, err
+}
+
+func (r *notificationRepository) UpsertPreferences(ctx context.Context, pref *models.NotificationPreference) error {
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(pref).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("locale = EXCLUDED.locale").
+		Set("calendar = EXCLUDED.calendar").
+		Set("timezone = EXCLUDED.timezone").
+		Set("email_enabled = EXCLUDED.email_enabled").
+		Set("email_request_decided = EXCLUDED.email_request_decided").
+		Set("email_slot_published = EXCLUDED.email_slot_published").
+		Set("email_reminders = EXCLUDED.email_reminders").
+		Set("email_review_pending = EXCLUDED.email_review_pending").
+		Set("chat_enabled = EXCLUDED.chat_enabled").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	return err
+}
+
+func (r *notificationRepository) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(reset).Exec(ctx)
+	return err
+}
+
+func (r *notificationRepository) GetPasswordResetByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := conn(ctx, r.db).NewSelect().
+		Model(&reset).
+		Where("token_hash = ?", tokenHash).
+		For("UPDATE").
+		Scan(ctx)
+	return &reset, err
+}
+
+func (r *notificationRepository) UpdatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(reset).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *notificationRepository) CreateNotification(ctx context.Context, n *models.Notification) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(n).Exec(ctx)
+	return err
+}
+
+func (r *notificationRepository) GetNotifications(ctx context.Context, userID int64, unreadOnly bool, beforeID int64, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	q := conn(ctx, r.db).NewSelect().
+		Model(&notifications).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit)
+	if unreadOnly {
+		q = q.Where("read_at IS NULL")
+	}
+	if beforeID > 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	err := q.Scan(ctx)
+	return notifications, err
+}
+
+func (r *notificationRepository) CountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
+	return conn(ctx, r.db).NewSelect().
+		Model((*models.Notification)(nil)).
+		Where("user_id = ?", userID).
+		Where("read_at IS NULL").
+		Count(ctx)
+}
+
+func (r *notificationRepository) MarkNotificationsRead(ctx context.Context, userID int64, ids []int64, at time.Time) (int, error) {
+	q := conn(ctx, r.db).NewUpdate().
+		Model((*models.Notification)(nil)).
+		Set("read_at = ?", at).
+		Where("user_id = ?", userID).
+		Where("read_at IS NULL")
+	if len(ids) > 0 {
+		q = q.Where("id IN (?)", bun.In(ids))
+	}
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *notificationRepository) DeleteNotifications(ctx context.Context, readBefore, before time.Time) (int, error) {
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.Notification)(nil)).
+		WhereGroup(" AND ", func(q *bun.DeleteQuery) *bun.DeleteQuery {
+			return q.Where("read_at IS NOT NULL AND created_at < ?", readBefore).
+				WhereOr("created_at < ?", before)
+		}).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// outboxChannel is the LISTEN/NOTIFY channel announcing new outbox events.
+const outboxChannel = "outbox_events"
+
+type outboxRepository struct {
+	db *bun.DB
+}
+
+func NewOutboxRepository(db *bun.DB) *outboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// CreateOutboxEvent stores the event and announces it on outboxChannel.
+// Inside a transaction the notification is only delivered on commit.
+func (r *outboxRepository) CreateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	db := conn(ctx, r.db)
+	if _, err := db.NewInsert().Model(event).Exec(ctx); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "SELECT pg_notify(?, ?)", outboxChannel, strconv.FormatInt(event.ID, 10))
+	return err
+}
+
+func (r *outboxRepository) GetOutboxEventByID(ctx context.Context, eventID int64) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	err := conn(ctx, r.db).NewSelect().
+		Model(&event).
+		Where("id = ?", eventID).
+		Scan(ctx)
+	return &event, err
+}
+
+func (r *outboxRepository) GetOutboxEvents(ctx context.Context, eventType string, beforeID int64, limit int) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	q := conn(ctx, r.db).NewSelect().
+		Model(&events).
+		Order("id DESC").
+		Limit(limit)
+	if eventType != "" {
+		q = q.Where("type = ?", eventType)
+	}
+	if beforeID > 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	err := q.Scan(ctx)
+	return events, err
+}
+
+func (r *outboxRepository) GetUnconsumedEvents(ctx context.Context, consumer string, limit int) ([]models.OutboxEvent, error) {
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(&models.OutboxConsumer{Name: consumer, StartedAt: time.Now()}).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.OutboxEvent
+	err = conn(ctx, r.db).NewSelect().
+		Model(&events).
+		Where("oe.created_at >= (SELECT started_at FROM outbox_consumers WHERE name = ?)", consumer).
+		Where("NOT EXISTS (SELECT 1 FROM outbox_consumptions AS oc WHERE oc.consumer = ? AND oc.event_id = oe.id)", consumer).
+		Order("id ASC").
+		Limit(limit).
+		Scan(ctx)
+	return events, err
+}
+
+func (r *outboxRepository) MarkEventsConsumed(ctx context.Context, consumer string, eventIDs []int64) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+	marks := make([]models.OutboxConsumption, len(eventIDs))
+	for i, id := range eventIDs {
+		marks[i] = models.OutboxConsumption{Consumer: consumer, EventID: id}
+	}
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(&marks).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	return err
+}
+
+func (r *outboxRepository) GetOutboxEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := conn(ctx, r.db).NewSelect().
+		Model(&events).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Scan(ctx)
+	return events, err
+}
+
+func (r *outboxRepository) ListenOutboxEvents(ctx context.Context, handle func(eventID int64)) error {
+	ln := pgdriver.NewListener(r.db)
+	defer ln.Close()
+	if err := ln.Listen(ctx, outboxChannel); err != nil {
+		return err
+	}
+
+	// The channel reconnects and listens again on connection loss.
+	notifications := ln.CreateChannel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			if id, err := strconv.ParseInt(n.Payload, 10, 64); err == nil {
+				handle(id)
+			}
+		}
+	}
+}
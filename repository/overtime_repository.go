@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"shiftdony/models"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -16,25 +19,55 @@ func NewOvertimeRepository(db *bun.DB) *overtimeRepository {
 }
 
 func (r *overtimeRepository) CreateOvertimeSlot(ctx context.Context, slot *models.OvertimeSlot) error {
-	_, err := r.db.NewInsert().Model(slot).Exec(ctx)
+	_, err := conn(ctx, r.db).NewInsert().Model(slot).Exec(ctx)
 	return err
 }
 
-func (r *overtimeRepository) GetOvertimeSlots(ctx context.Context) ([]models.OvertimeSlot, error) {
+var slotSorts = map[string]sortKey[models.OvertimeSlot]{
+	"start_time": {column: "?TableAlias.start_time", cast: "timestamptz", value: func(s *models.OvertimeSlot) string { return cursorTime(s.StartTime) }},
+	"title":      {column: "?TableAlias.title", cast: "text", value: func(s *models.OvertimeSlot) string { return s.Title }},
+	"status":     {column: "?TableAlias.status", cast: "text", value: func(s *models.OvertimeSlot) string { return s.Status }},
+	"id":         {},
+}
+
+// ListOvertimeSlots returns a page of the slots matching filter, with the
+// creator's name.
+func (r *overtimeRepository) ListOvertimeSlots(ctx context.Context, filter models.SlotFilter, opts models.ListOptions) ([]models.OvertimeSlot, *models.PageInfo, error) {
 	var slots []models.OvertimeSlot
-	err := r.db.NewSelect().
+	q := conn(ctx, r.db).NewSelect().
 		Model(&slots).
 		Relation("Creator", func(sq *bun.SelectQuery) *bun.SelectQuery {
 			return sq.Column("full_name")
-		}).
-		Order("start_time DESC").
-		Scan(ctx)
-	return slots, err
+		})
+	if len(filter.Statuses) > 0 {
+		q = q.Where("?TableAlias.status IN (?)", bun.In(filter.Statuses))
+	}
+	if filter.CreatedBy != 0 {
+		q = q.Where("?TableAlias.created_by = ?", filter.CreatedBy)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("?TableAlias.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("?TableAlias.start_time < ?", filter.To)
+	}
+	if filter.Search != "" {
+		q = q.Where("?TableAlias.title ILIKE ?", containsPattern(filter.Search))
+	}
+	q, err := paginate(q, slotSorts, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, nil, err
+	}
+	slots, info := page(slots, slotSorts, opts, func(s *models.OvertimeSlot) int64 { return s.ID })
+	return slots, info, nil
 }
 
 func (r *overtimeRepository) GetAvailableOvertimeSlots(ctx context.Context) ([]models.OvertimeSlot, error) {
 	var slots []models.OvertimeSlot
-	err := r.db.NewSelect().
+	err := conn(ctx, r.db).NewSelect().
 		Model(&slots).
 		Relation("Creator", func(q *bun.SelectQuery) *bun.SelectQuery {
 			return q.Column("full_name")
@@ -48,62 +81,190 @@ func (r *overtimeRepository) GetAvailableOvertimeSlots(ctx context.Context) ([]m
 
 func (r *overtimeRepository) GetOvertimeSlotByID(ctx context.Context, slotID int64) (*models.OvertimeSlot, error) {
 	var slot models.OvertimeSlot
-	err := r.db.NewSelect().
+	err := conn(ctx, r.db).NewSelect().
 		Model(&slot).
 		Where("id = ? AND status = ?", slotID, "open").
 		Scan(ctx)
 	return &slot, err
 }
 
+func (r *overtimeRepository) GetSlotByID(ctx context.Context, slotID int64) (*models.OvertimeSlot, error) {
+	var slot models.OvertimeSlot
+	err := conn(ctx, r.db).NewSelect().
+		Model(&slot).
+		Where("id = ?", slotID).
+		Scan(ctx)
+	return &slot, err
+}
+
+// LockOvertimeSlot loads a slot and locks its row until the surrounding
+// transaction ends, so concurrent approvals cannot overfill it.
+func (r *overtimeRepository) LockOvertimeSlot(ctx context.Context, slotID int64) (*models.OvertimeSlot, error) {
+	var slot models.OvertimeSlot
+	err := conn(ctx, r.db).NewSelect().
+		Model(&slot).
+		Where("id = ?", slotID).
+		For("UPDATE").
+		Scan(ctx)
+	return &slot, err
+}
+
+// UserHasPendingRequestForSlot reports whether the user has a request for
+// the slot that is still live. Withdrawn and rejected requests do not
+// count, so the user may apply again.
 func (r *overtimeRepository) UserHasPendingRequestForSlot(ctx context.Context, userID, slotID int64) (bool, error) {
-	return r.db.NewSelect().
+	return conn(ctx, r.db).NewSelect().
 		Model((*models.OvertimeRequest)(nil)).
 		Where("user_id = ? AND slot_id = ?", userID, slotID).
+		Where("status NOT IN (?)", bun.In([]string{models.RequestStatusWithdrawn, models.RequestStatusRejected, models.RequestStatusCancelled})).
 		Exists(ctx)
 }
 
 func (r *overtimeRepository) CountApprovedRequestsForSlot(ctx context.Context, slotID int64) (int, error) {
-	return r.db.NewSelect().
+	return conn(ctx, r.db).NewSelect().
 		Model((*models.OvertimeRequest)(nil)).
 		Where("slot_id = ? AND status = ?", slotID, "approved").
 		Count(ctx)
 }
 
 func (r *overtimeRepository) CreateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) error {
-	_, err := r.db.NewInsert().Model(req).Exec(ctx)
+	_, err := conn(ctx, r.db).NewInsert().Model(req).Exec(ctx)
 	return err
 }
 
 func (r *overtimeRepository) UpdateOvertimeSlot(ctx context.Context, slot *models.OvertimeSlot) error {
-	_, err := r.db.NewUpdate().Model(slot).WherePK().Exec(ctx)
+	slot.Sequence++
+	_, err := conn(ctx, r.db).NewUpdate().Model(slot).WherePK().Exec(ctx)
 	return err
 }
 
-func (r *overtimeRepository) GetMyOvertimeRequests(ctx context.Context, userID int64) ([]models.OvertimeRequest, error) {
+var requestSorts = map[string]sortKey[models.OvertimeRequest]{
+	"request_time": {column: "?TableAlias.request_time", cast: "timestamptz", value: func(r *models.OvertimeRequest) string { return cursorTime(r.RequestTime) }},
+	"slot_start":   {column: "slot.start_time", cast: "timestamptz", value: func(r *models.OvertimeRequest) string { return cursorTime(r.Slot.StartTime) }},
+	"status":       {column: "?TableAlias.status", cast: "text", value: func(r *models.OvertimeRequest) string { return r.Status }},
+	"id":           {},
+}
+
+// ListOvertimeRequests returns a page of the requests matching filter,
+// with their slots and applicants.
+func (r *overtimeRepository) ListOvertimeRequests(ctx context.Context, filter models.RequestFilter, opts models.ListOptions) ([]models.OvertimeRequest, *models.PageInfo, error) {
 	var requests []models.OvertimeRequest
-	err := r.db.NewSelect().
+	q := conn(ctx, r.db).NewSelect().
 		Model(&requests).
-		Where("user_id = ?", userID).
-		Relation("Slot").
-		Order("request_time DESC").
-		Scan(ctx)
-	return requests, err
+		Relation("User", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.ExcludeColumn("password_hash")
+		}).
+		Relation("Slot")
+	if filter.WithApprovals {
+		q = q.Relation("Approvals")
+	}
+	q = filterRequests(q, filter)
+	q, err := paginate(q, requestSorts, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, nil, err
+	}
+	requests, info := page(requests, requestSorts, opts, func(r *models.OvertimeRequest) int64 { return r.ID })
+	return requests, info, nil
 }
 
-func (r *overtimeRepository) GetAllOvertimeRequests(ctx context.Context) ([]models.OvertimeRequest, error) {
-	var requsets []models.OvertimeRequest
-	err := r.db.NewSelect().
-		Model(&requsets).
-		Relation("User").
-		Relation("Slot").
-		Order("request_time DESC").
-		Scan(ctx)
-	return requsets, err
+// EachOvertimeRequest calls fn with every request matching filter, with
+// its slot and applicant, in the order of opts. Rows are read one at a
+// time from an open result set, so exports of any size run in constant
+// memory. The request passed to fn is reused for the next row. An error
+// from fn stops the iteration and is returned as it is.
+func (r *overtimeRepository) EachOvertimeRequest(ctx context.Context, filter models.RequestFilter, opts models.ListOptions, fn func(*models.OvertimeRequest) error) error {
+	// The joined models are bound to these on the first row, so they are
+	// reset rather than replaced between rows.
+	var user models.User
+	var slot models.OvertimeSlot
+	request := models.OvertimeRequest{User: &user, Slot: &slot}
+	q := conn(ctx, r.db).NewSelect().
+		Model(&request).
+		Relation("User", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.ExcludeColumn("password_hash")
+		}).
+		Relation("Slot")
+	q = filterRequests(q, filter)
+	q, err := paginate(q, requestSorts, opts)
+	if err != nil {
+		return err
+	}
+	rows, err := q.Rows(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	scanner, ok := q.GetModel().(interface {
+		ScanRow(ctx context.Context, rows *sql.Rows) error
+	})
+	if !ok {
+		return fmt.Errorf("cannot scan %T row by row", q.GetModel())
+	}
+	for rows.Next() {
+		request = models.OvertimeRequest{User: &user, Slot: &slot}
+		user, slot = models.User{}, models.OvertimeSlot{}
+		if err := scanner.ScanRow(ctx, rows); err != nil {
+			return err
+		}
+		row := request
+		if user.ID == 0 {
+			row.User = nil
+		}
+		if slot.ID == 0 {
+			row.Slot = nil
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// filterRequests applies filter to a query of requests joined with their
+// User and Slot relations.
+func filterRequests(q *bun.SelectQuery, filter models.RequestFilter) *bun.SelectQuery {
+	if len(filter.Statuses) > 0 {
+		q = q.Where("?TableAlias.status IN (?)", bun.In(filter.Statuses))
+	}
+	if filter.TeamID != 0 {
+		q = q.Where("\"user\".team_id = ?", filter.TeamID)
+	}
+	if filter.TeamIDs != nil {
+		if len(filter.TeamIDs) == 0 {
+			q = q.Where("FALSE")
+		} else {
+			q = q.Where("\"user\".team_id IN (?)", bun.In(filter.TeamIDs))
+		}
+	}
+	if filter.UserID != 0 {
+		q = q.Where("?TableAlias.user_id = ?", filter.UserID)
+	}
+	if filter.SlotID != 0 {
+		q = q.Where("?TableAlias.slot_id = ?", filter.SlotID)
+	}
+	if !filter.From.IsZero() {
+		q = q.Where("slot.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q = q.Where("slot.start_time < ?", filter.To)
+	}
+	if filter.Search != "" {
+		pattern := containsPattern(filter.Search)
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("slot.title ILIKE ?", pattern).
+				WhereOr("\"user\".full_name ILIKE ?", pattern)
+		})
+	}
+	return q
 }
 
 func (r *overtimeRepository) GetOvertimeRequestByID(ctx context.Context, requestID int64) (*models.OvertimeRequest, error) {
 	var request models.OvertimeRequest
-	err := r.db.NewSelect().
+	err := conn(ctx, r.db).NewSelect().
 		Model(&request).
 		Where("id = ?", requestID).
 		For("UPDATE").
@@ -111,17 +272,300 @@ func (r *overtimeRepository) GetOvertimeRequestByID(ctx context.Context, request
 	return &request, err
 }
 
+func (r *overtimeRepository) GetRequestByID(ctx context.Context, requestID int64) (*models.OvertimeRequest, error) {
+	var request models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&request).
+		Where("id = ?", requestID).
+		Scan(ctx)
+	return &request, err
+}
+
 func (r *overtimeRepository) UpdateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) error {
-	_, err := r.db.NewUpdate().Model(req).WherePK().Exec(ctx)
+	req.Sequence++
+	_, err := conn(ctx, r.db).NewUpdate().Model(req).WherePK().Exec(ctx)
+	return err
+}
+
+// EscalateOvertimeRequest saves the escalation fields of req if it is still
+// pending, and reports whether it was.
+func (r *overtimeRepository) EscalateOvertimeRequest(ctx context.Context, req *models.OvertimeRequest) (bool, error) {
+	res, err := conn(ctx, r.db).NewUpdate().
+		Model(req).
+		Column("escalated_at", "escalated_to", "escalation_level").
+		Where("id = ? AND status = ?", req.ID, models.RequestStatusPending).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetStalePendingRequests returns pending requests that have not been
+// escalated since before, together with the applicant.
+func (r *overtimeRepository) GetStalePendingRequests(ctx context.Context, before time.Time) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Relation("User").
+		Where("?TableAlias.status = ?", models.RequestStatusPending).
+		Where("COALESCE(?TableAlias.escalated_at, ?TableAlias.request_time) < ?", before).
+		Order("request_time ASC").
+		Scan(ctx)
+	return requests, err
+}
+
+func (r *overtimeRepository) GetPendingRequestsForApprover(ctx context.Context, approverID int64, role, defaultRole string, limit int) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Relation("User").
+		Join("LEFT JOIN approval_steps AS ast ON ast.chain_id = ?TableAlias.chain_id AND ast.position = ?TableAlias.current_step").
+		Where("?TableAlias.status = ?", models.RequestStatusPending).
+		Where("?TableAlias.user_id <> ?", approverID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("?TableAlias.escalated_to = ?", approverID).
+				WhereOr("?TableAlias.escalated_to IS NULL AND ast.approver_user_id = ?", approverID).
+				WhereOr("?TableAlias.escalated_to IS NULL AND ast.approver_user_id IS NULL AND ast.approver_role = ?", role).
+				// Requests without a chain, or whose chain is gone or empty,
+				// follow the default chain's single step.
+				WhereOr(`?TableAlias.escalated_to IS NULL AND ?TableAlias.current_step = 0 AND ? = ?
+					AND NOT EXISTS (SELECT 1 FROM approval_steps AS s WHERE s.chain_id = ?TableAlias.chain_id)`, role, defaultRole)
+		}).
+		Where(`NOT EXISTS (SELECT 1 FROM request_approvals AS ra
+			WHERE ra.request_id = ?TableAlias.id AND ra.step_position = ?TableAlias.current_step AND ra.approver_id = ?)`, approverID).
+		OrderExpr("?TableAlias.request_time ASC, ?TableAlias.id ASC").
+		Limit(limit).
+		Scan(ctx)
+	return requests, err
+}
+
+func (r *overtimeRepository) GetPendingRequestsForSlot(ctx context.Context, slotID int64) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Where("slot_id = ? AND status = ?", slotID, models.RequestStatusPending).
+		Order("request_time ASC", "id ASC").
+		Scan(ctx)
+	return requests, err
+}
+
+func (r *overtimeRepository) GetRequestsForSlot(ctx context.Context, slotID int64, statuses ...string) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Where("slot_id = ?", slotID).
+		Where("status IN (?)", bun.In(statuses)).
+		Order("request_time ASC", "id ASC").
+		Scan(ctx)
+	return requests, err
+}
+
+// GetApprovedHoursByUser sums the approved overtime hours of each user on
+// slots starting in [from, to).
+func (r *overtimeRepository) GetApprovedHoursByUser(ctx context.Context, userIDs []int64, from, to time.Time) (map[int64]float64, error) {
+	hours := make(map[int64]float64, len(userIDs))
+	if len(userIDs) == 0 {
+		return hours, nil
+	}
+	var rows []struct {
+		UserID int64   `bun:"user_id"`
+		Hours  float64 `bun:"hours"`
+	}
+	err := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("?TableAlias.user_id").
+		ColumnExpr("COALESCE(SUM(EXTRACT(EPOCH FROM (slot.end_time - slot.start_time)) / 3600), 0) AS hours").
+		Join("JOIN overtime_slots AS slot ON slot.id = ?TableAlias.slot_id").
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		Where("?TableAlias.user_id IN (?)", bun.In(userIDs)).
+		Where("slot.start_time >= ? AND slot.start_time < ?", from, to).
+		Group("?TableAlias.user_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		hours[row.UserID] = row.Hours
+	}
+	return hours, nil
+}
+
+// GetApprovedDayParts splits every approved slot at the midnights of its
+// applicant's holiday calendar and sums the parts per user, day of the
+// slot start and calendar date. Hours are elapsed time, so a part spanning
+// a DST change counts the hours actually worked.
+func (r *overtimeRepository) GetApprovedDayParts(ctx context.Context, from, to time.Time, zone, defaultZone string) ([]models.DayPartHours, error) {
+	var parts []models.DayPartHours
+	q := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("?TableAlias.user_id, u.personnel_code, u.full_name, u.team_id").
+		ColumnExpr("(slot.start_time AT TIME ZONE ?)::date::text AS day", zone).
+		ColumnExpr("COALESCE(hc.id, 0) AS calendar_id").
+		ColumnExpr("part.start AS part_start").
+		ColumnExpr("COUNT(*) FILTER (WHERE part.start = slot.start_time) AS requests").
+		ColumnExpr("SUM(EXTRACT(EPOCH FROM (LEAST(part.next, slot.end_time) - part.start)) / 3600) AS hours").
+		Join("JOIN overtime_slots AS slot ON slot.id = ?TableAlias.slot_id").
+		Join("JOIN users AS u ON u.id = ?TableAlias.user_id").
+		Join("LEFT JOIN teams AS t ON t.id = u.team_id").
+		Join("LEFT JOIN holiday_calendars AS hc ON hc.id = t.calendar_id").
+		// The local midnights from the slot's first date on, as long as
+		// they fall before its end.
+		Join(`CROSS JOIN LATERAL (
+			SELECT GREATEST(d.midnight AT TIME ZONE z.name, slot.start_time) AS start,
+				(d.midnight + interval '1 day') AT TIME ZONE z.name AS next
+			FROM (SELECT COALESCE(hc.timezone, ?) AS name) AS z,
+				generate_series(date_trunc('day', slot.start_time AT TIME ZONE z.name),
+					slot.end_time AT TIME ZONE z.name, interval '1 day') AS d(midnight)
+			WHERE d.midnight AT TIME ZONE z.name < slot.end_time
+		) AS part`, defaultZone).
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		GroupExpr("1, 2, 3, 4, 5, 6, 7").
+		OrderExpr("5, 1, 7")
+	if !from.IsZero() {
+		q = q.Where("slot.start_time >= ?", from)
+	}
+	if !to.IsZero() {
+		q = q.Where("slot.start_time < ?", to)
+	}
+	err := q.Scan(ctx, &parts)
+	return parts, err
+}
+
+// GetLastApprovedSlotStart returns, for each user, the start of the latest
+// approved slot that began before before. Users without one are absent.
+func (r *overtimeRepository) GetLastApprovedSlotStart(ctx context.Context, userIDs []int64, before time.Time) (map[int64]time.Time, error) {
+	last := make(map[int64]time.Time, len(userIDs))
+	if len(userIDs) == 0 {
+		return last, nil
+	}
+	var rows []struct {
+		UserID int64     `bun:"user_id"`
+		Last   time.Time `bun:"last_start"`
+	}
+	err := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		ColumnExpr("?TableAlias.user_id").
+		ColumnExpr("MAX(slot.start_time) AS last_start").
+		Join("JOIN overtime_slots AS slot ON slot.id = ?TableAlias.slot_id").
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		Where("?TableAlias.user_id IN (?)", bun.In(userIDs)).
+		Where("slot.start_time < ?", before).
+		Group("?TableAlias.user_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		last[row.UserID] = row.Last
+	}
+	return last, nil
+}
+
+// ExpirePendingRequests expires the requests still pending on slots that
+// started before slotStartedBefore and returns them.
+func (r *overtimeRepository) ExpirePendingRequests(ctx context.Context, slotStartedBefore time.Time, reason string) ([]models.OvertimeRequest, error) {
+	var expired []models.OvertimeRequest
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.OvertimeRequest)(nil)).
+		Set("status = ?", models.RequestStatusExpired).
+		Set("decision_reason = ?", reason).
+		Where("status IN (?)", bun.In([]string{models.RequestStatusPending, models.RequestStatusWaitlisted})).
+		Where("slot_id IN (?)", conn(ctx, r.db).NewSelect().
+			Model((*models.OvertimeSlot)(nil)).
+			Column("id").
+			Where("start_time < ?", slotStartedBefore)).
+		Returning("*").
+		Exec(ctx, &expired)
+	return expired, err
+}
+
+// GetActiveSlots returns the slots that have not completed yet.
+func (r *overtimeRepository) GetActiveSlots(ctx context.Context) ([]models.OvertimeSlot, error) {
+	var slots []models.OvertimeSlot
+	err := conn(ctx, r.db).NewSelect().
+		Model(&slots).
+		Where("status IN (?)", bun.In([]string{
+			models.SlotStatusScheduled,
+			models.SlotStatusOpen,
+			models.SlotStatusFull,
+			models.SlotStatusClosed,
+			models.SlotStatusInProgress,
+		})).
+		Order("start_time ASC").
+		Scan(ctx)
+	return slots, err
+}
+
+func (r *overtimeRepository) UpdateSlotStatus(ctx context.Context, slotID int64, status string) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.OvertimeSlot)(nil)).
+		Set("status = ?", status).
+		Set("sequence = sequence + 1").
+		Where("id = ?", slotID).
+		Exec(ctx)
 	return err
 }
 
-func (r *overtimeRepository) GetApprovedRequests(ctx context.Context) ([]models.OvertimeRequest, error) {
-	var approvedRequests []models.OvertimeRequest
-	err := r.db.NewSelect().
-		Model(&approvedRequests).
-		Relation("User").Relation("Slot").
-		Where("?TableAlias.status = ?", "approved").
-		Order("slot.start_time ASC").Scan(ctx)
-	return approvedRequests, err
+func (r *overtimeRepository) GetFirstWaitlistedRequest(ctx context.Context, slotID int64) (*models.OvertimeRequest, error) {
+	var request models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&request).
+		Where("slot_id = ? AND status = ?", slotID, models.RequestStatusWaitlisted).
+		Order("waitlist_position ASC", "request_time ASC").
+		Limit(1).
+		For("UPDATE").
+		Scan(ctx)
+	return &request, err
+}
+
+func (r *overtimeRepository) GetSlotsEndingAfter(ctx context.Context, t time.Time, statuses ...string) ([]models.OvertimeSlot, error) {
+	var slots []models.OvertimeSlot
+	err := conn(ctx, r.db).NewSelect().
+		Model(&slots).
+		Where("end_time > ?", t).
+		Where("status IN (?)", bun.In(statuses)).
+		Order("start_time ASC", "id ASC").
+		Scan(ctx)
+	return slots, err
+}
+
+func (r *overtimeRepository) GetUserRequestsEndingAfter(ctx context.Context, userID int64, t time.Time, statuses ...string) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Relation("Slot").
+		Where("?TableAlias.user_id = ?", userID).
+		Where("?TableAlias.status IN (?)", bun.In(statuses)).
+		Where("slot.end_time > ?", t).
+		OrderExpr("slot.start_time ASC, ?TableAlias.id ASC").
+		Scan(ctx)
+	return requests, err
+}
+
+func (r *overtimeRepository) CountApprovedRequestsBySlot(ctx context.Context, slotIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int, len(slotIDs))
+	if len(slotIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		SlotID int64 `bun:"slot_id"`
+		Count  int   `bun:"count"`
+	}
+	err := conn(ctx, r.db).NewSelect().
+		Model((*models.OvertimeRequest)(nil)).
+		Column("slot_id").
+		ColumnExpr("count(*) AS count").
+		Where("slot_id IN (?)", bun.In(slotIDs)).
+		Where("status = ?", models.RequestStatusApproved).
+		Group("slot_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.SlotID] = row.Count
+	}
+	return counts, nil
 }
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type reminderRepository struct {
+	db *bun.DB
+}
+
+func NewReminderRepository(db *bun.DB) *reminderRepository {
+	return &reminderRepository{db: db}
+}
+
+func (r *reminderRepository) ScheduleReminders(ctx context.Context, reminders []models.Reminder) error {
+	if len(reminders) == 0 {
+		return nil
+	}
+	_, err := conn(ctx, r.db).NewInsert().
+		Model(&reminders).
+		On("CONFLICT (request_id, offset_minutes) DO UPDATE").
+		Set("status = EXCLUDED.status").
+		Set("due_at = EXCLUDED.due_at").
+		Where("rm.status = ?", models.ReminderCancelled).
+		Returning("NULL").
+		Exec(ctx)
+	return err
+}
+
+func (r *reminderRepository) CancelRequestReminders(ctx context.Context, requestID int64) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.Reminder)(nil)).
+		Set("status = ?", models.ReminderCancelled).
+		Where("request_id = ?", requestID).
+		Where("status = ?", models.ReminderScheduled).
+		Exec(ctx)
+	return err
+}
+
+func (r *reminderRepository) CancelSlotReminders(ctx context.Context, slotID int64) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.Reminder)(nil)).
+		Set("status = ?", models.ReminderCancelled).
+		Where("slot_id = ?", slotID).
+		Where("status = ?", models.ReminderScheduled).
+		Exec(ctx)
+	return err
+}
+
+func (r *reminderRepository) ClaimDueReminders(ctx context.Context, now, staleBefore time.Time, limit int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	due := conn(ctx, r.db).NewSelect().
+		Model((*models.Reminder)(nil)).
+		Column("id").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("status = ? AND COALESCE(retry_at, due_at) <= ?", models.ReminderScheduled, now).
+				WhereOr("status = ? AND claimed_at < ?", models.ReminderSending, staleBefore)
+		}).
+		OrderExpr("COALESCE(retry_at, due_at) ASC").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model(&reminders).
+		Set("status = ?", models.ReminderSending).
+		Set("claimed_at = ?", now).
+		Set("attempts = attempts + 1").
+		Where("id IN (?)", due).
+		Returning("*").
+		Exec(ctx, &reminders)
+	return reminders, err
+}
+
+func (r *reminderRepository) UpdateReminder(ctx context.Context, reminder *models.Reminder) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(reminder).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *reminderRepository) GetUnremindedRequests(ctx context.Context, t time.Time) ([]models.OvertimeRequest, error) {
+	var requests []models.OvertimeRequest
+	err := conn(ctx, r.db).NewSelect().
+		Model(&requests).
+		Relation("Slot").
+		Where("?TableAlias.status = ?", models.RequestStatusApproved).
+		Where("slot.start_time > ?", t).
+		Where("slot.status <> ?", models.SlotStatusCancelled).
+		Where("NOT EXISTS (SELECT 1 FROM reminders AS rm WHERE rm.request_id = ?TableAlias.id)").
+		OrderExpr("?TableAlias.id ASC").
+		Scan(ctx)
+	return requests, err
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+
+	"github.com/uptrace/bun"
+)
+
+type teamRepository struct {
+	db *bun.DB
+}
+
+func NewTeamRepository(db *bun.DB) *teamRepository {
+	return &teamRepository{db: db}
+}
+
+func (r *teamRepository) GetTeamByID(ctx context.Context, teamID int64) (*models.Team, error) {
+	var team models.Team
+	err := conn(ctx, r.db).NewSelect().
+		Model(&team).
+		Where("id = ?", teamID).
+		Scan(ctx)
+	return &team, err
+}
+
+// GetTeams returns the teams, by name.
+func (r *teamRepository) GetTeams(ctx context.Context) ([]models.Team, error) {
+	var teams []models.Team
+	err := conn(ctx, r.db).NewSelect().Model(&teams).Order("name ASC", "id ASC").Scan(ctx)
+	return teams, err
+}
+
+func (r *teamRepository) UpdateTeamCalendar(ctx context.Context, teamID int64, calendarID *int64) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("calendar_id = ?", calendarID).
+		Where("id = ?", teamID).
+		Exec(ctx)
+	return err
+}
+
+func (r *teamRepository) UpdateTeamTimezone(ctx context.Context, teamID int64, timezone string) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("timezone = ?", timezone).
+		Where("id = ?", teamID).
+		Exec(ctx)
+	return err
+}
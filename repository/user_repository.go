@@ -16,22 +16,60 @@ func NewUserRepository(db *bun.DB) *userRepository {
 }
 
 func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
-	_, err := r.db.NewInsert().Model(user).Exec(ctx)
+	_, err := conn(ctx, r.db).NewInsert().Model(user).Exec(ctx)
 	return err
 }
 
 func (r *userRepository) GetUserByPersonnelCode(ctx context.Context, code string) (*models.User, error) {
 	var user models.User
-	err := r.db.NewSelect().
+	err := conn(ctx, r.db).NewSelect().
 		Model(&user).
 		Where("personnel_code = ?", code).
 		Scan(ctx)
 	return &user, err
 }
 
+func (r *userRepository) GetUsersByIDs(ctx context.Context, userIDs []int64) ([]models.User, error) {
+	var users []models.User
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	err := conn(ctx, r.db).NewSelect().
+		Model(&users).
+		Relation("Team", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.ExcludeColumn("manager_id")
+		}).
+		Where("u.id IN (?)", bun.In(userIDs)).
+		Scan(ctx)
+	return users, err
+}
+
+func (r *userRepository) GetUsersByRole(ctx context.Context, roles ...string) ([]models.User, error) {
+	var users []models.User
+	err := conn(ctx, r.db).NewSelect().
+		Model(&users).
+		Where("role IN (?)", bun.In(roles)).
+		Order("id ASC").
+		Scan(ctx)
+	return users, err
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(user).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *userRepository) EmailInUse(ctx context.Context, email string, exceptUserID int64) (bool, error) {
+	return conn(ctx, r.db).NewSelect().
+		Model((*models.User)(nil)).
+		Where("lower(email) = lower(?)", email).
+		Where("id <> ?", exceptUserID).
+		Exists(ctx)
+}
+
 func (r *userRepository) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
 	var user models.User
-	err := r.db.NewSelect().
+	err := conn(ctx, r.db).NewSelect().
 		Model(&user).
 		Relation("Team", func(q *bun.SelectQuery) *bun.SelectQuery {
 			return q.ExcludeColumn("manager_id")
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"shiftdony/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type webhookRepository struct {
+	db *bun.DB
+}
+
+func NewWebhookRepository(db *bun.DB) *webhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	_, err := conn(ctx, r.db).NewInsert().Model(sub).Exec(ctx)
+	return err
+}
+
+func (r *webhookRepository) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subs []models.WebhookSubscription
+	err := conn(ctx, r.db).NewSelect().
+		Model(&subs).
+		Order("id ASC").
+		Scan(ctx)
+	return subs, err
+}
+
+func (r *webhookRepository) GetSubscriptionByID(ctx context.Context, subID int64) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := conn(ctx, r.db).NewSelect().
+		Model(&sub).
+		Where("id = ?", subID).
+		Scan(ctx)
+	return &sub, err
+}
+
+func (r *webhookRepository) UpdateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	_, err := conn(ctx, r.db).NewUpdate().Model(sub).WherePK().Exec(ctx)
+	return err
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, subID int64) (bool, error) {
+	res, err := conn(ctx, r.db).NewDelete().
+		Model((*models.WebhookSubscription)(nil)).
+		Where("id = ?", subID).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *webhookRepository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	_, err := conn(ctx, r.db).NewInsert().Model(&deliveries).Exec(ctx)
+	return err
+}
+
+func (r *webhookRepository) GetDueDeliveries(ctx context.Context, at time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := conn(ctx, r.db).NewSelect().
+		Model(&deliveries).
+		Relation("Subscription").
+		Relation("Event").
+		Where("wd.status = ? AND wd.next_attempt_at <= ?", models.DeliveryPending, at).
+		Order("wd.next_attempt_at ASC").
+		Limit(limit).
+		Scan(ctx)
+	return deliveries, err
+}
+
+func (r *webhookRepository) GetDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	q := conn(ctx, r.db).NewSelect().
+		Model(&deliveries).
+		Relation("Event").
+		Order("wd.id DESC").
+		Limit(limit)
+	if status != "" {
+		q = q.Where("wd.status = ?", status)
+	}
+	err := q.Scan(ctx)
+	return deliveries, err
+}
+
+func (r *webhookRepository) GetDeliveryByID(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := conn(ctx, r.db).NewSelect().
+		Model(&delivery).
+		Where("id = ?", deliveryID).
+		Scan(ctx)
+	return &delivery, err
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := conn(ctx, r.db).NewUpdate().
+		Model(delivery).
+		ExcludeColumn("created_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
@@ -1,43 +1,89 @@
 package routes
 
 import (
+	"shiftdony/config"
 	"shiftdony/handlers"
 	"shiftdony/middleware"
-	"shiftdony/repository"
-	"shiftdony/service"
 
 	"github.com/gin-gonic/gin"
-	"github.com/uptrace/bun"
 )
 
-func SetupRouter(db *bun.DB) *gin.Engine {
+func SetupRouter(svc *Services) *gin.Engine {
 	router := gin.Default()
+	router.Use(middleware.ErrorMiddleware(handlers.WriteError))
 
-	userRepo := repository.NewUserRepository(db)
-	overtimeRepo := repository.NewOvertimeRepository(db)
-
-	userService := service.NewUserService(userRepo)
-	overtimeService := service.NewOvertimeService(overtimeRepo)
-
-	userHandler := handlers.NewUserHandler(userService)
-	overtimeHandler := handlers.NewOvertimeHandler(overtimeService)
+	userHandler := handlers.NewUserHandler(svc.User)
+	overtimeHandler := handlers.NewOvertimeHandler(svc.Overtime, svc.Holiday)
+	approvalHandler := handlers.NewApprovalHandler(svc.Approval)
+	delegationHandler := handlers.NewDelegationHandler(svc.Delegation)
+	commentHandler := handlers.NewCommentHandler(svc.Comment)
+	webhookHandler := handlers.NewWebhookHandler(svc.Webhook)
+	notificationHandler := handlers.NewNotificationHandler(svc.Notification)
+	streamHandler := handlers.NewStreamHandler(svc.Stream)
+	chatHandler := handlers.NewChatHandler(svc.ChatBot)
+	calendarHandler := handlers.NewCalendarHandler(svc.Calendar)
+	holidayHandler := handlers.NewHolidayHandler(svc.Holiday)
+	analyticsHandler := handlers.NewAnalyticsHandler(svc.Analytics)
 	
 	//Public Routes
 	// Public Routes
 	api := router.Group("/api")
+	api.Use(middleware.ViewerMiddleware(nil))
 	{
 		api.POST("/register", userHandler.RegisterUser)
 		api.POST("/login", userHandler.Login)
+		api.POST("/password/forgot", userHandler.ForgotPassword)
+		api.POST("/password/reset", userHandler.ResetPassword)
+		// POST supports one-click unsubscribe from mail clients.
+		api.GET("/notifications/unsubscribe", notificationHandler.Unsubscribe)
+		api.POST("/notifications/unsubscribe", notificationHandler.Unsubscribe)
+		// Calendar clients cannot authenticate; the token in the path does.
+		api.GET("/calendar/:token/personal.ics", calendarHandler.PersonalFeed)
+		api.GET("/calendar/:token/slots.ics", calendarHandler.SlotsFeed)
 	}
 
+	// Telegram only calls the webhook in webhook mode; polling replicas do
+	// not expose it.
+	if cfg := config.C.Chat; cfg.Enabled && cfg.Mode == "webhook" {
+		api.POST("/chat/telegram/webhook", chatHandler.TelegramWebhook)
+	}
+
+	// Event stream; EventSource cannot send headers, so it may connect with
+	// a stream ticket in the query string instead.
+	router.GET("/api/stream", middleware.StreamAuthMiddleware(svc.Stream), middleware.ViewerMiddleware(svc.Notification), streamHandler.Stream)
+
 	// Protected Routes
 	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(), middleware.ViewerMiddleware(svc.Notification))
 	{
 		protected.GET("/profile", userHandler.GetProfile)
+		protected.POST("/stream/ticket", streamHandler.CreateTicket)
+		protected.GET("/notifications/preferences", notificationHandler.GetPreferences)
+		protected.PATCH("/notifications/preferences", notificationHandler.UpdatePreferences)
+		protected.GET("/notifications", notificationHandler.GetNotifications)
+		protected.POST("/notifications/:id/read", notificationHandler.MarkNotificationRead)
+		protected.POST("/notifications/read-all", notificationHandler.MarkAllNotificationsRead)
+		protected.POST("/chat/link-code", chatHandler.CreateLinkCode)
+		protected.DELETE("/chat/link", chatHandler.Unlink)
+		protected.POST("/calendar/feed-token", calendarHandler.CreateFeedToken)
+		protected.DELETE("/calendar/feed-token", calendarHandler.RevokeFeedToken)
+		protected.GET("/holidays/day", holidayHandler.CheckDay)
 		protected.GET("/overtime/available", overtimeHandler.GetAvailableOvertimeSlots)
 		protected.POST("/requests/append", overtimeHandler.CreateOvertimeRequest)
 		protected.GET("/my-requests", overtimeHandler.GetMyOvertimeRequests)
+		protected.POST("/requests/:id/withdraw", overtimeHandler.WithdrawOvertimeRequest)
+		protected.GET("/requests/:id/comments", commentHandler.GetRequestComments)
+		protected.POST("/requests/:id/comments", commentHandler.CreateRequestComment)
+
+		// Review Routes, open to managers and their delegates
+		reviewRoutes := protected.Group("/admin")
+		reviewRoutes.Use(middleware.ReviewerMiddleware(svc.Delegation))
+		{
+			reviewRoutes.GET("/requests", overtimeHandler.GetAllOvertimeRequests)
+			reviewRoutes.PATCH("/requests/:id", overtimeHandler.UpdateOvertimeReqStatus)
+			reviewRoutes.POST("/requests/bulk", overtimeHandler.BulkUpdateOvertimeReqStatus)
+			reviewRoutes.GET("/requests/:id/approvals", approvalHandler.GetRequestApprovals)
+		}
 
 		// Admins Routes
 		adminRoutes := protected.Group("/admin")
@@ -45,9 +91,42 @@ func SetupRouter(db *bun.DB) *gin.Engine {
 		{
 			adminRoutes.POST("/overtime", overtimeHandler.CreateOvertimeSlot)
 			adminRoutes.GET("/overtime", overtimeHandler.GetOvertimeSlots)
-			adminRoutes.GET("/requests", overtimeHandler.GetAllOvertimeRequests)
-			adminRoutes.PATCH("/requests/:id", overtimeHandler.UpdateOvertimeReqStatus)
-			adminRoutes.GET("/reports/csv", overtimeHandler.ExportApprovedRequestsAsCSV)
+			adminRoutes.POST("/overtime/:id/allocate", overtimeHandler.AllocateSlot)
+			adminRoutes.POST("/overtime/:id/cancel", overtimeHandler.CancelSlot)
+			adminRoutes.PUT("/requests/:id/attendance", overtimeHandler.RecordAttendance)
+			adminRoutes.GET("/reports", overtimeHandler.ExportRequests)
+			adminRoutes.GET("/reports/csv", overtimeHandler.ExportRequests)
+			adminRoutes.GET("/reports/monthly", overtimeHandler.GetMonthlyReport)
+			adminRoutes.GET("/reports/fairness", analyticsHandler.GetFairnessReport)
+			adminRoutes.GET("/analytics/dashboard", analyticsHandler.GetDashboard)
+			adminRoutes.GET("/analytics/hours", analyticsHandler.GetHours)
+			adminRoutes.GET("/analytics/slots", analyticsHandler.GetSlots)
+			adminRoutes.GET("/analytics/reviewers", analyticsHandler.GetReviewers)
+			adminRoutes.GET("/analytics/attendance", analyticsHandler.GetAttendance)
+			adminRoutes.GET("/analytics/top-earners", analyticsHandler.GetTopEarners)
+			adminRoutes.POST("/holiday-calendars", holidayHandler.CreateCalendar)
+			adminRoutes.GET("/holiday-calendars", holidayHandler.GetCalendars)
+			adminRoutes.PATCH("/holiday-calendars/:id", holidayHandler.UpdateCalendar)
+			adminRoutes.GET("/holiday-calendars/:id/holidays", holidayHandler.GetHolidays)
+			adminRoutes.POST("/holiday-calendars/:id/holidays", holidayHandler.AddHoliday)
+			adminRoutes.POST("/holiday-calendars/:id/import", holidayHandler.ImportICS)
+			adminRoutes.DELETE("/holiday-calendars/:id/holidays/:holidayID", holidayHandler.DeleteHoliday)
+			adminRoutes.PUT("/teams/:id/holiday-calendar", holidayHandler.AssignTeamCalendar)
+			adminRoutes.PUT("/teams/:id/timezone", holidayHandler.SetTeamTimezone)
+			adminRoutes.POST("/approval-chains", approvalHandler.CreateApprovalChain)
+			adminRoutes.GET("/approval-chains", approvalHandler.GetApprovalChains)
+			adminRoutes.POST("/delegations", delegationHandler.CreateDelegation)
+			adminRoutes.GET("/delegations", delegationHandler.GetMyDelegations)
+			adminRoutes.DELETE("/delegations/:id", delegationHandler.RevokeDelegation)
+
+			adminRoutes.POST("/webhooks", webhookHandler.CreateSubscription)
+			adminRoutes.GET("/webhooks", webhookHandler.GetSubscriptions)
+			adminRoutes.PATCH("/webhooks/:id", webhookHandler.UpdateSubscription)
+			adminRoutes.DELETE("/webhooks/:id", webhookHandler.DeleteSubscription)
+			adminRoutes.GET("/webhooks/deliveries", webhookHandler.GetDeliveries)
+			adminRoutes.POST("/webhooks/deliveries/:id/retry", webhookHandler.RetryDelivery)
+			adminRoutes.GET("/events", webhookHandler.GetEvents)
+			adminRoutes.POST("/events/:id/replay", webhookHandler.ReplayEvent)
 		}
 	}
 
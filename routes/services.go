@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"errors"
+	"shiftdony/chat"
+	"shiftdony/config"
+	"shiftdony/notify"
+	"shiftdony/repository"
+	"shiftdony/service"
+
+	"github.com/uptrace/bun"
+)
+
+// Services holds the application services shared by the HTTP router and the
+// background workers.
+type Services struct {
+	User       *service.UserService
+	Overtime   *service.OvertimeService
+	Approval   *service.ApprovalService
+	Delegation *service.DelegationService
+	Comment    *service.CommentService
+	Webhook    *service.WebhookService
+
+	Notification *service.NotificationService
+	Stream       *service.EventStream
+	ChatBot      *service.ChatBotService
+	Reminder     *service.ReminderService
+	Calendar     *service.CalendarService
+	Holiday      *service.HolidayService
+	Analytics    *service.AnalyticsService
+}
+
+func NewServices(db *bun.DB) (*Services, error) {
+	userRepo := repository.NewUserRepository(db)
+	teamRepo := repository.NewTeamRepository(db)
+	overtimeRepo := repository.NewOvertimeRepository(db)
+	approvalRepo := repository.NewApprovalRepository(db)
+	delegationRepo := repository.NewDelegationRepository(db)
+	commentRepo := repository.NewCommentRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	chatRepo := repository.NewChatRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	calendarRepo := repository.NewCalendarRepository(db)
+	holidayRepo := repository.NewHolidayRepository(db)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	transactor := repository.NewTransactor(db)
+
+	var channels []notify.Channel
+	if cfg := config.C.Notify; cfg.SMTP.Enabled {
+		email, err := notify.NewEmailChannel(cfg.SMTP, cfg.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, email)
+	}
+	var bot chat.Bot
+	if cfg := config.C.Chat; cfg.Enabled {
+		// The secret is all that tells the provider's calls from anyone's.
+		if cfg.Mode == "webhook" && cfg.WebhookSecret == "" {
+			return nil, errors.New("chat webhook mode requires chat.webhook_secret")
+		}
+		bot = chat.NewTelegramBot(cfg.APIURL, cfg.Token)
+		channels = append(channels, service.NewChatChannel(bot, cfg.Provider, chatRepo))
+	}
+
+	events := service.NewEventPublisher(outboxRepo)
+	approvalService := service.NewApprovalService(approvalRepo)
+	notificationService := service.NewNotificationService(notificationRepo, userRepo, overtimeRepo, outboxRepo, approvalService, transactor, channels...)
+	userService := service.NewUserService(userRepo, notificationRepo, events, transactor)
+	delegationService := service.NewDelegationService(delegationRepo, userRepo, events, transactor)
+	holidayService := service.NewHolidayService(holidayRepo, teamRepo, userRepo, transactor)
+	overtimeService := service.NewOvertimeService(overtimeRepo, userRepo, teamRepo, approvalService, delegationService, holidayService, events, transactor)
+	commentService := service.NewCommentService(commentRepo, overtimeRepo, userRepo, approvalService, delegationService, events, transactor)
+	webhookService := service.NewWebhookService(webhookRepo, outboxRepo, transactor)
+	reminderService, err := service.NewReminderService(reminderRepo, overtimeRepo, outboxRepo, notificationService, events, transactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Services{
+		User:       userService,
+		Overtime:   overtimeService,
+		Approval:   approvalService,
+		Delegation: delegationService,
+		Comment:    commentService,
+		Webhook:    webhookService,
+
+		Notification: notificationService,
+		Stream:       service.NewEventStream(outboxRepo, overtimeRepo, userRepo, approvalService),
+		ChatBot:      service.NewChatBotService(bot, chatRepo, userRepo, notificationRepo, overtimeRepo, jobRepo, overtimeService, approvalService, transactor),
+		Reminder:     reminderService,
+		Calendar:     service.NewCalendarService(calendarRepo, overtimeRepo, userRepo, notificationRepo),
+		Holiday:      holidayService,
+		Analytics:    service.NewAnalyticsService(analyticsRepo, userRepo, teamRepo),
+	}, nil
+}
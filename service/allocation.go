@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	crand "crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"shiftdony/models"
+	"sort"
+	"time"
+)
+
+// rotationWindow is how far back the rotation strategy looks for a user's
+// latest overtime.
+const rotationWindow = 180 * 24 * time.Hour
+
+// Allocation is the decision taken for one request by an allocation run.
+type Allocation struct {
+	RequestID   int64  `json:"request_id"`
+	UserID      int64  `json:"user_id"`
+	Rank        int    `json:"rank"`
+	Status      string `json:"status"`
+	Explanation string `json:"explanation"`
+}
+
+// candidate is a pending request together with what the strategies rank on.
+type candidate struct {
+	request    *models.OvertimeRequest
+	hours      float64   // approved hours in the slot's month
+	lastServed time.Time // zero when never served in the rotation window
+	basis      string
+}
+
+// IsAllocationStrategy reports whether name is a known strategy.
+func IsAllocationStrategy(name string) bool {
+	switch name {
+	case models.AllocationManual, models.AllocationFCFS, models.AllocationLottery,
+		models.AllocationFewestHours, models.AllocationRotation:
+		return true
+	}
+	return false
+}
+
+// AllocateSlot decides every pending request of a slot in one transaction
+// using the slot's allocation strategy, or strategy when it is not empty.
+// The best ranked requests are selected up to the remaining capacity, the
+// next WaitlistSize are waitlisted and the rest are rejected. Selected
+// requests go through their approval chains, see approveChosen, with
+// managerID as approver, or the slot's creator when the run is automatic
+// and managerID is nil. Winners awaiting later steps hold their place until
+// decided; one rejected there hands it to the waitlist.
+func (s *OvertimeService) AllocateSlot(ctx context.Context, slotID int64, strategy string, managerID *int64) ([]Allocation, error) {
+	var allocations []Allocation
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		slot, err := s.overtimeRepo.LockOvertimeSlot(ctx, slotID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSlotNotFound
+			}
+			return ErrInternalServer.Wrap(err)
+		}
+		if strategy == "" {
+			strategy = slot.AllocationStrategy
+		}
+		if strategy == models.AllocationManual || !IsAllocationStrategy(strategy) {
+			return ErrInvalidAllocationStrategy
+		}
+
+		pending, err := s.overtimeRepo.GetPendingRequestsForSlot(ctx, slotID)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		approvedCount, err := s.overtimeRepo.CountApprovedRequestsForSlot(ctx, slotID)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+
+		ranked, err := s.rankCandidates(ctx, slot, strategy, pending)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+
+		free := int(slot.Capacity) - approvedCount
+		if free < 0 {
+			free = 0
+		}
+		approverID := slot.CreatedBy
+		if managerID != nil {
+			approverID = *managerID
+		}
+		decidedAt := time.Now()
+		allocations = make([]Allocation, 0, len(ranked))
+		for i, c := range ranked {
+			rank := i + 1
+			explanation := fmt.Sprintf("%s: ranked %d of %d by %s; ", strategy, rank, len(ranked), c.basis)
+			var step *int
+			switch {
+			case i < free:
+				explanation += fmt.Sprintf("selected within the %d free places", free)
+				step, err = s.approveChosen(ctx, c.request, approverID, explanation)
+				if err != nil {
+					return err
+				}
+				if c.request.Status == models.RequestStatusPending {
+					c.request.DecisionReason += "; awaiting the remaining approval steps"
+				}
+			case i < free+slot.WaitlistSize:
+				explanation += fmt.Sprintf("waitlisted at position %d", i-free+1)
+				c.request.Status = models.RequestStatusWaitlisted
+				c.request.WaitlistPosition = i - free + 1
+				c.request.DecisionReason = explanation
+			default:
+				explanation += fmt.Sprintf("rejected: beyond the %d free places and %d waitlist places", free, slot.WaitlistSize)
+				c.request.Status = models.RequestStatusRejected
+				c.request.WaitlistPosition = 0
+				c.request.DecisionReason = explanation
+				c.request.ReviewedBy = managerID
+				c.request.DecidedAt = &decidedAt
+			}
+
+			if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, c.request); err != nil {
+				return ErrInternalServer.Wrap(err)
+			}
+			if err := s.emitChosen(ctx, c.request, step, managerID); err != nil {
+				return ErrInternalServer.Wrap(err)
+			}
+			allocations = append(allocations, Allocation{
+				RequestID:   c.request.ID,
+				UserID:      c.request.UserID,
+				Rank:        rank,
+				Status:      c.request.Status,
+				Explanation: c.request.DecisionReason,
+			})
+		}
+
+		// Requests reaching their last step closed the slot when it filled
+		// up, see approveFinal; those still awaiting later steps leave it
+		// open, so a rejection there frees the place again.
+		allocated, err := s.overtimeRepo.LockOvertimeSlot(ctx, slotID)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		allocated.AllocatedAt = &decidedAt
+		allocated.AllocationSeed = slot.AllocationSeed
+		if err := s.overtimeRepo.UpdateOvertimeSlot(ctx, allocated); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if err := s.events.emit(ctx, models.EventSlotAllocated, "slot", allocated.ID, slotEvent(allocated)); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// approveChosen moves a request chosen for a place on its slot along its
+// approval chain the way a review does. The choice counts as the approval
+// of approverID for the current step when they may decide it and did not
+// apply themselves; otherwise, and while later steps remain, the request
+// stays pending for the other approvers and holds its place. It returns the
+// step approved, or nil.
+func (s *OvertimeService) approveChosen(ctx context.Context, request *models.OvertimeRequest, approverID int64, reason string) (*int, error) {
+	request.Status = models.RequestStatusPending
+	request.WaitlistPosition = 0
+	request.DecisionReason = reason
+
+	chain, err := s.approvals.chainForRequest(ctx, request)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if request.CurrentStep >= len(chain.Steps) {
+		return nil, ErrInternalServer.Wrap(fmt.Errorf("request %d step %d beyond chain %d", request.ID, request.CurrentStep, chain.ID))
+	}
+	approver, err := s.userRepo.GetUserByID(ctx, approverID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	onBehalfOf, err := s.actingFor(ctx, request, chain.Steps[request.CurrentStep], approver)
+	if err == ErrNotAnApprover || err == ErrSelfReview {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	step := request.CurrentStep
+	err = s.decideStep(ctx, request, chain, approver, onBehalfOf, models.RequestStatusApproved, reason, "")
+	if err == ErrAlreadyReviewed {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+// emitChosen publishes the outcome of approveChosen for request: its new
+// status, or the step approved while later ones remain.
+func (s *OvertimeService) emitChosen(ctx context.Context, request *models.OvertimeRequest, step *int, actorID *int64) error {
+	if request.Status != models.RequestStatusPending {
+		return s.events.emitRequestStatus(ctx, request, actorID)
+	}
+	if step == nil {
+		return nil
+	}
+	event := requestEvent(request, actorID)
+	event.Reason = request.DecisionReason
+	event.Step = step
+	return s.events.emit(ctx, models.EventRequestStepApproved, "request", request.ID, event)
+}
+
+// rankCandidates orders the pending requests of slot best first. The
+// lottery sets the slot's seed when it has none; the caller saves the slot.
+func (s *OvertimeService) rankCandidates(ctx context.Context, slot *models.OvertimeSlot, strategy string, pending []models.OvertimeRequest) ([]*candidate, error) {
+	candidates := make([]*candidate, len(pending))
+	userIDs := make([]int64, len(pending))
+	for i := range pending {
+		candidates[i] = &candidate{request: &pending[i]}
+		userIDs[i] = pending[i].UserID
+	}
+	// Pending requests come ordered by request time, which is also the tie
+	// breaker of every strategy below.
+	byRequestTime := func(i, j int) bool {
+		return candidates[i].request.RequestTime.Before(candidates[j].request.RequestTime)
+	}
+
+	switch strategy {
+	case models.AllocationFCFS:
+		for _, c := range candidates {
+			c.basis = "request time " + c.request.RequestTime.In(OrgLocation()).Format(time.RFC3339)
+		}
+		sort.SliceStable(candidates, byRequestTime)
+
+	case models.AllocationLottery:
+		// A seed anyone can predict lets applicants time their requests for
+		// a winning position, so unless one was set it is drawn now and kept
+		// on the slot for audit.
+		if slot.AllocationSeed == nil {
+			var buf [8]byte
+			if _, err := crand.Read(buf[:]); err != nil {
+				return nil, err
+			}
+			drawn := int64(binary.BigEndian.Uint64(buf[:]) >> 1)
+			slot.AllocationSeed = &drawn
+		}
+		seed := *slot.AllocationSeed
+		// Shuffle from a fixed order so the same seed always gives the same
+		// draw.
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].request.ID < candidates[j].request.ID })
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		for _, c := range candidates {
+			c.basis = fmt.Sprintf("lottery draw with seed %d", seed)
+		}
+
+	case models.AllocationFewestHours:
+		start := slot.StartTime.In(OrgLocation())
+		monthStart := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+		hours, err := s.overtimeRepo.GetApprovedHoursByUser(ctx, userIDs, monthStart, monthStart.AddDate(0, 1, 0))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range candidates {
+			c.hours = hours[c.request.UserID]
+			c.basis = fmt.Sprintf("%.1f approved hours this month", c.hours)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].hours != candidates[j].hours {
+				return candidates[i].hours < candidates[j].hours
+			}
+			return byRequestTime(i, j)
+		})
+
+	case models.AllocationRotation:
+		// Rotation puts whoever has waited longest since their last overtime
+		// first, weighting ties by hours worked in the rotation window.
+		from := slot.StartTime.Add(-rotationWindow)
+		last, err := s.overtimeRepo.GetLastApprovedSlotStart(ctx, userIDs, slot.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		hours, err := s.overtimeRepo.GetApprovedHoursByUser(ctx, userIDs, from, slot.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range candidates {
+			c.hours = hours[c.request.UserID]
+			if t, ok := last[c.request.UserID]; ok && t.After(from) {
+				c.lastServed = t
+				c.basis = fmt.Sprintf("last overtime on %s, %.1f hours in the last %d days", t.In(OrgLocation()).Format("2006-01-02"), c.hours, int(rotationWindow.Hours()/24))
+			} else {
+				c.basis = fmt.Sprintf("no overtime in the last %d days", int(rotationWindow.Hours()/24))
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if !a.lastServed.Equal(b.lastServed) {
+				return a.lastServed.Before(b.lastServed)
+			}
+			if a.hours != b.hours {
+				return a.hours < b.hours
+			}
+			return byRequestTime(i, j)
+		})
+	}
+	return candidates, nil
+}
@@ -0,0 +1,473 @@
+package service
+
+import (
+	"context"
+	"math"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AnalyticsService aggregates overtime for managers' dashboards. The sums
+// are computed in SQL; only the folding of days into the months of the
+// viewer's calendar happens here.
+type AnalyticsService struct {
+	analyticsRepo pg.AnalyticsRepository
+	userRepo      pg.UserRepository
+	teamRepo      pg.TeamRepository
+}
+
+func NewAnalyticsService(analyticsRepo pg.AnalyticsRepository, userRepo pg.UserRepository, teamRepo pg.TeamRepository) *AnalyticsService {
+	return &AnalyticsService{
+		analyticsRepo: analyticsRepo,
+		userRepo:      userRepo,
+		teamRepo:      teamRepo,
+	}
+}
+
+// Chart lays analytics out for charting libraries: one value of every
+// series per label. Keys, when set, are the user IDs of the labels. Totals
+// sum, or average, each series over the whole range.
+type Chart struct {
+	Labels []string           `json:"labels"`
+	Keys   []int64            `json:"keys,omitempty"`
+	Series []Series           `json:"series"`
+	Totals map[string]float64 `json:"totals"`
+}
+
+// Series is one line or set of bars of a chart.
+type Series struct {
+	Key  int64     `json:"key,omitempty"` // user or team ID, when grouped by them
+	Name string    `json:"name"`
+	Data []float64 `json:"data"`
+}
+
+// Dashboard holds the totals of every analytics chart and the top earners.
+type Dashboard struct {
+	Hours      map[string]float64 `json:"hours"`
+	Slots      map[string]float64 `json:"slots"`
+	Reviews    map[string]float64 `json:"reviews"`
+	Attendance map[string]float64 `json:"attendance"`
+	TopEarners *Chart             `json:"top_earners"`
+}
+
+// dashboardEarners is how many top earners the dashboard lists.
+const dashboardEarners = 5
+
+// analyticsFilter counts days in the organization time zone.
+func analyticsFilter(filter models.AnalyticsFilter) models.AnalyticsFilter {
+	filter.Zone = OrgLocation().String()
+	return filter
+}
+
+// Hours charts approved overtime hours per month of calendar, with a
+// series per user or team, or a single one, as group asks.
+func (s *AnalyticsService) Hours(ctx context.Context, filter models.AnalyticsFilter, group, calendar string) (*Chart, error) {
+	filter = analyticsFilter(filter)
+	rows, err := s.analyticsRepo.GetDailyHours(ctx, filter, group, config.C.Analytics.MaterializedViews)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	days := make([]string, len(rows))
+	for i, row := range rows {
+		days[i] = row.Day
+	}
+	axis := newMonthAxis(calendar, filter, days)
+
+	series := make(map[int64]*Series)
+	var order []int64
+	var requests int
+	var hours float64
+	for _, row := range rows {
+		line, ok := series[row.Key]
+		if !ok {
+			line = &Series{Key: row.Key, Data: make([]float64, len(axis.labels))}
+			series[row.Key] = line
+			order = append(order, row.Key)
+		}
+		line.Data[axis.of(row.Day)] += row.Hours
+		requests += row.Requests
+		hours += row.Hours
+	}
+	names, err := s.groupNames(ctx, group, order)
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &Chart{
+		Labels: axis.labels,
+		Series: make([]Series, 0, len(order)),
+		Totals: map[string]float64{"hours": round(hours, 2), "requests": float64(requests)},
+	}
+	for _, key := range order {
+		line := series[key]
+		line.Name = names[key]
+		for i := range line.Data {
+			line.Data[i] = round(line.Data[i], 2)
+		}
+		chart.Series = append(chart.Series, *line)
+	}
+	// The largest series first, as charts stack and legend them.
+	sort.SliceStable(chart.Series, func(i, j int) bool {
+		return sum(chart.Series[i].Data) > sum(chart.Series[j].Data)
+	})
+	return chart, nil
+}
+
+// groupNames names the users or teams of a chart by ID.
+func (s *AnalyticsService) groupNames(ctx context.Context, group string, keys []int64) (map[int64]string, error) {
+	names := make(map[int64]string, len(keys))
+	switch group {
+	case models.GroupByUser:
+		return s.userNames(ctx, keys)
+	case models.GroupByTeam:
+		teams, err := s.teamRepo.GetTeams(ctx)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		for _, team := range teams {
+			names[team.ID] = team.Name
+		}
+		for _, key := range keys {
+			if names[key] == "" {
+				names[key] = "Team " + strconv.FormatInt(key, 10)
+			}
+		}
+	default:
+		names[0] = "Total"
+	}
+	return names, nil
+}
+
+func (s *AnalyticsService) userNames(ctx context.Context, userIDs []int64) (map[int64]string, error) {
+	names := make(map[int64]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return names, nil
+	}
+	users, err := s.userRepo.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	for _, user := range users {
+		names[user.ID] = user.FullName
+	}
+	for _, id := range userIDs {
+		if names[id] == "" {
+			names[id] = "User " + strconv.FormatInt(id, 10)
+		}
+	}
+	return names, nil
+}
+
+// TopEarners charts the limit users with the most approved overtime hours.
+func (s *AnalyticsService) TopEarners(ctx context.Context, filter models.AnalyticsFilter, limit int) (*Chart, error) {
+	filter = analyticsFilter(filter)
+	rows, err := s.analyticsRepo.GetTopEarners(ctx, filter, limit, config.C.Analytics.MaterializedViews)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.UserID
+	}
+	names, err := s.userNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &Chart{
+		Labels: make([]string, len(rows)),
+		Keys:   ids,
+		Series: []Series{
+			{Name: "hours", Data: make([]float64, len(rows))},
+			{Name: "requests", Data: make([]float64, len(rows))},
+		},
+	}
+	var hours float64
+	for i, row := range rows {
+		chart.Labels[i] = names[row.UserID]
+		chart.Series[0].Data[i] = round(row.Hours, 2)
+		chart.Series[1].Data[i] = float64(row.Requests)
+		hours += row.Hours
+	}
+	chart.Totals = map[string]float64{"hours": round(hours, 2)}
+	return chart, nil
+}
+
+// Slots charts, per month of calendar, the slots, their capacity and the
+// places filled, the fill rate and the average hours a full slot took to
+// fill after it opened.
+func (s *AnalyticsService) Slots(ctx context.Context, filter models.AnalyticsFilter, calendar string) (*Chart, error) {
+	filter = analyticsFilter(filter)
+	rows, err := s.analyticsRepo.GetDailySlotFill(ctx, filter)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	days := make([]string, len(rows))
+	for i, row := range rows {
+		days[i] = row.Day
+	}
+	axis := newMonthAxis(calendar, filter, days)
+	months := make([]models.SlotFillDay, len(axis.labels))
+	var total models.SlotFillDay
+	for _, row := range rows {
+		for _, m := range []*models.SlotFillDay{&months[axis.of(row.Day)], &total} {
+			m.Slots += row.Slots
+			m.Capacity += row.Capacity
+			m.Filled += row.Filled
+			m.FullSlots += row.FullSlots
+			m.TimedSlots += row.TimedSlots
+			m.FillSeconds += row.FillSeconds
+		}
+	}
+
+	chart := &Chart{Labels: axis.labels, Series: newSeries(len(months),
+		"slots", "capacity", "filled", "full_slots", "fill_rate", "avg_time_to_fill_hours")}
+	for i, m := range months {
+		for j, v := range slotFillValues(m) {
+			chart.Series[j].Data[i] = v
+		}
+	}
+	chart.Totals = totalsOf(chart.Series, slotFillValues(total))
+	return chart, nil
+}
+
+func slotFillValues(m models.SlotFillDay) []float64 {
+	return []float64{
+		float64(m.Slots),
+		float64(m.Capacity),
+		float64(m.Filled),
+		float64(m.FullSlots),
+		ratio(float64(m.Filled), float64(m.Capacity)),
+		round(ratio(m.FillSeconds, float64(m.TimedSlots))/3600, 2),
+	}
+}
+
+// Reviewers charts the decisions per reviewer on every approval step:
+// approvals, rejections, their rates and the average hours a request
+// waited on the reviewer's step.
+func (s *AnalyticsService) Reviewers(ctx context.Context, filter models.AnalyticsFilter) (*Chart, error) {
+	filter = analyticsFilter(filter)
+	rows, err := s.analyticsRepo.GetReviewerTotals(ctx, filter)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ReviewerID
+	}
+	names, err := s.userNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &Chart{
+		Labels: make([]string, len(rows)),
+		Keys:   ids,
+		Series: newSeries(len(rows), "decisions", "approved", "rejected", "approval_rate", "rejection_rate", "avg_review_hours"),
+	}
+	var total models.ReviewerTotal
+	for i, row := range rows {
+		chart.Labels[i] = names[row.ReviewerID]
+		for j, v := range reviewerValues(row) {
+			chart.Series[j].Data[i] = v
+		}
+		total.Approved += row.Approved
+		total.Rejected += row.Rejected
+		total.TimedDecisions += row.TimedDecisions
+		total.ReviewSeconds += row.ReviewSeconds
+	}
+	chart.Totals = totalsOf(chart.Series, reviewerValues(total))
+	return chart, nil
+}
+
+func reviewerValues(t models.ReviewerTotal) []float64 {
+	decisions := float64(t.Approved + t.Rejected)
+	return []float64{
+		decisions,
+		float64(t.Approved),
+		float64(t.Rejected),
+		ratio(float64(t.Approved), decisions),
+		ratio(float64(t.Rejected), decisions),
+		round(ratio(t.ReviewSeconds, float64(t.TimedDecisions))/3600, 2),
+	}
+}
+
+// Attendance charts, per month of calendar, the approved requests on
+// slots that have ended, how many were marked present or no-show, and the
+// no-show rate among those marked.
+func (s *AnalyticsService) Attendance(ctx context.Context, filter models.AnalyticsFilter, calendar string) (*Chart, error) {
+	filter = analyticsFilter(filter)
+	rows, err := s.analyticsRepo.GetDailyAttendance(ctx, filter, time.Now())
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	days := make([]string, len(rows))
+	for i, row := range rows {
+		days[i] = row.Day
+	}
+	axis := newMonthAxis(calendar, filter, days)
+	months := make([]models.AttendanceDay, len(axis.labels))
+	var total models.AttendanceDay
+	for _, row := range rows {
+		for _, m := range []*models.AttendanceDay{&months[axis.of(row.Day)], &total} {
+			m.Approved += row.Approved
+			m.Present += row.Present
+			m.NoShows += row.NoShows
+		}
+	}
+
+	chart := &Chart{Labels: axis.labels, Series: newSeries(len(months), "approved", "present", "no_shows", "unrecorded", "no_show_rate")}
+	for i, m := range months {
+		for j, v := range attendanceValues(m) {
+			chart.Series[j].Data[i] = v
+		}
+	}
+	chart.Totals = totalsOf(chart.Series, attendanceValues(total))
+	return chart, nil
+}
+
+func attendanceValues(m models.AttendanceDay) []float64 {
+	return []float64{
+		float64(m.Approved),
+		float64(m.Present),
+		float64(m.NoShows),
+		float64(m.Approved - m.Present - m.NoShows),
+		ratio(float64(m.NoShows), float64(m.Present+m.NoShows)),
+	}
+}
+
+// Dashboard returns the totals of every chart over filter, with the top
+// earners.
+func (s *AnalyticsService) Dashboard(ctx context.Context, filter models.AnalyticsFilter, calendar string) (*Dashboard, error) {
+	hours, err := s.Hours(ctx, filter, models.GroupByTotal, calendar)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := s.Slots(ctx, filter, calendar)
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := s.Reviewers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	attendance, err := s.Attendance(ctx, filter, calendar)
+	if err != nil {
+		return nil, err
+	}
+	earners, err := s.TopEarners(ctx, filter, dashboardEarners)
+	if err != nil {
+		return nil, err
+	}
+	return &Dashboard{
+		Hours:      hours.Totals,
+		Slots:      slots.Totals,
+		Reviews:    reviews.Totals,
+		Attendance: attendance.Totals,
+		TopEarners: earners,
+	}, nil
+}
+
+// RefreshViews recomputes the materialized views analytics read, when they
+// are enabled.
+func (s *AnalyticsService) RefreshViews(ctx context.Context) error {
+	if !config.C.Analytics.MaterializedViews {
+		return nil
+	}
+	return s.analyticsRepo.RefreshDailyHours(ctx)
+}
+
+// monthAxis labels the months of a chart: every month of the calendar
+// from the start of the filter, or of the first day with data, to its end,
+// or the last day with data.
+type monthAxis struct {
+	calendar string
+	loc      *time.Location
+	labels   []string
+	index    map[string]int
+}
+
+// newMonthAxis builds the axis of filter and days, YYYY-MM-DD dates in
+// filter.Zone.
+func newMonthAxis(calendar string, filter models.AnalyticsFilter, days []string) *monthAxis {
+	a := &monthAxis{calendar: calendar, loc: OrgLocation(), labels: []string{}, index: make(map[string]int)}
+	first, last := filter.From, time.Time{}
+	if !filter.To.IsZero() {
+		last = filter.To.Add(-time.Nanosecond)
+	}
+	for _, day := range days {
+		t := a.day(day)
+		if filter.From.IsZero() && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+		if filter.To.IsZero() && t.After(last) {
+			last = t
+		}
+	}
+	if first.IsZero() || last.IsZero() || last.Before(first) {
+		return a
+	}
+	_, month := monthOf(calendar, first.In(a.loc))
+	for !month.After(last) {
+		label, _ := monthOf(calendar, month)
+		a.index[label] = len(a.labels)
+		a.labels = append(a.labels, label)
+		// No month is longer than 31 days, so this lands in the next one.
+		_, month = monthOf(calendar, month.AddDate(0, 0, 32))
+	}
+	return a
+}
+
+func (a *monthAxis) day(day string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", day, a.loc)
+	return t
+}
+
+// of returns the index of the month of day.
+func (a *monthAxis) of(day string) int {
+	label, _ := monthOf(a.calendar, a.day(day))
+	return a.index[label]
+}
+
+// newSeries returns named series of n values each.
+func newSeries(n int, names ...string) []Series {
+	series := make([]Series, len(names))
+	for i, name := range names {
+		series[i] = Series{Name: name, Data: make([]float64, n)}
+	}
+	return series
+}
+
+// totalsOf names the values of the totals of a chart after its series.
+func totalsOf(series []Series, values []float64) map[string]float64 {
+	totals := make(map[string]float64, len(series))
+	for i, s := range series {
+		totals[s.Name] = values[i]
+	}
+	return totals
+}
+
+// ratio returns a / b to four decimals, 0 when b is.
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return round(a/b, 4)
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+func sum(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"sort"
+	"time"
+)
+
+type ApprovalService struct {
+	approvalRepo pg.ApprovalRepository
+}
+
+func NewApprovalService(approvalRepo pg.ApprovalRepository) *ApprovalService {
+	return &ApprovalService{approvalRepo: approvalRepo}
+}
+
+// defaultApprovalChain is used when no configured chain matches a slot: a
+// single step any manager can approve.
+var defaultApprovalChain = models.ApprovalChain{
+	Name: "default",
+	Steps: []models.ApprovalStep{
+		{Position: 0, Name: "manager", ApproverRole: models.RoleManager, RequiredApprovals: 1},
+	},
+}
+
+func (s *ApprovalService) CreateChain(ctx context.Context, chain *models.ApprovalChain) error {
+	if len(chain.Steps) == 0 {
+		return ErrInvalidApprovalChain
+	}
+	sort.SliceStable(chain.Steps, func(i, j int) bool { return chain.Steps[i].Position < chain.Steps[j].Position })
+	for i := range chain.Steps {
+		step := &chain.Steps[i]
+		if step.ApproverRole == "" && step.ApproverUserID == nil {
+			return ErrInvalidApprovalChain
+		}
+		if step.RequiredApprovals < 1 {
+			step.RequiredApprovals = 1
+		}
+		if step.ApproverUserID != nil && step.RequiredApprovals > 1 {
+			// A single named user can only sign once.
+			return ErrInvalidApprovalChain
+		}
+		step.Position = i
+	}
+	if err := s.approvalRepo.CreateApprovalChain(ctx, chain); err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+func (s *ApprovalService) GetChains(ctx context.Context) ([]models.ApprovalChain, error) {
+	chains, err := s.approvalRepo.GetApprovalChains(ctx)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return chains, nil
+}
+
+func (s *ApprovalService) GetRequestApprovals(ctx context.Context, requestID int64) ([]models.RequestApproval, error) {
+	approvals, err := s.approvalRepo.GetRequestApprovals(ctx, requestID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return approvals, nil
+}
+
+// chainForSlot picks the configured chain that applies to slot, or nil when
+// the default chain should be used.
+func (s *ApprovalService) chainForSlot(ctx context.Context, slot *models.OvertimeSlot) (*int64, error) {
+	chains, err := s.approvalRepo.GetApprovalChains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Chains come ordered by priority and threshold, so the first match wins.
+	for _, chain := range chains {
+		if chain.HolidayOnly && !slot.IsHoliday {
+			continue
+		}
+		if slot.Hours() < chain.MinHours {
+			continue
+		}
+		id := chain.ID
+		return &id, nil
+	}
+	return nil, nil
+}
+
+// chainForRequest loads the chain a request was created with.
+func (s *ApprovalService) chainForRequest(ctx context.Context, request *models.OvertimeRequest) (*models.ApprovalChain, error) {
+	if request.ChainID == nil {
+		return &defaultApprovalChain, nil
+	}
+	chain, err := s.approvalRepo.GetApprovalChainByID(ctx, *request.ChainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &defaultApprovalChain, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(chain.Steps) == 0 {
+		return &defaultApprovalChain, nil
+	}
+	return chain, nil
+}
+
+// hasDecided reports whether userID took a decision on any step of the
+// request.
+func (s *ApprovalService) hasDecided(ctx context.Context, requestID, userID int64) (bool, error) {
+	approvals, err := s.approvalRepo.GetRequestApprovals(ctx, requestID)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range approvals {
+		if a.ApproverID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// canApprove reports whether reviewer is an approver of step.
+func canApprove(step models.ApprovalStep, reviewer *models.User) bool {
+	if step.ApproverUserID != nil {
+		return *step.ApproverUserID == reviewer.ID
+	}
+	return step.ApproverRole == reviewer.Role
+}
+
+// pendingApprovers returns the users the pending request is waiting on: the
+// escalation target, or the approvers of its current step.
+func pendingApprovers(ctx context.Context, approvals *ApprovalService, userRepo pg.UserRepository, request *models.OvertimeRequest) ([]int64, error) {
+	if request.EscalatedTo != nil {
+		return []int64{*request.EscalatedTo}, nil
+	}
+	chain, err := approvals.chainForRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if request.CurrentStep >= len(chain.Steps) {
+		return nil, nil
+	}
+	step := chain.Steps[request.CurrentStep]
+	if step.ApproverUserID != nil {
+		return []int64{*step.ApproverUserID}, nil
+	}
+	users, err := userRepo.GetUsersByRole(ctx, step.ApproverRole)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, u := range users {
+		if u.ID != request.UserID {
+			ids = append(ids, u.ID)
+		}
+	}
+	return ids, nil
+}
+
+// recordDecision stores reviewer's decision on the current step of request
+// and reports whether the step is now complete. onBehalfOf is the user whose
+// authority reviewer used, or nil when reviewer acted for themselves.
+func (s *ApprovalService) recordDecision(ctx context.Context, request *models.OvertimeRequest, step models.ApprovalStep, reviewer *models.User, onBehalfOf *int64, decision, reason, comment string) (bool, error) {
+	actingFor := reviewer.ID
+	if onBehalfOf != nil {
+		actingFor = *onBehalfOf
+	}
+
+	approvals, err := s.approvalRepo.GetRequestApprovals(ctx, request.ID)
+	if err != nil {
+		return false, err
+	}
+	approved := 0
+	for _, a := range approvals {
+		if a.StepPosition != step.Position {
+			continue
+		}
+		if a.ApproverID == reviewer.ID || a.ActingFor() == actingFor {
+			return false, ErrAlreadyReviewed
+		}
+		if a.Decision == models.RequestStatusApproved {
+			approved++
+		}
+	}
+
+	approval := &models.RequestApproval{
+		RequestID:    request.ID,
+		StepPosition: step.Position,
+		ApproverID:   reviewer.ID,
+		OnBehalfOf:   onBehalfOf,
+		Decision:     decision,
+		Reason:       reason,
+		Comment:      comment,
+		DecidedAt:    time.Now(),
+	}
+	if err := s.approvalRepo.CreateRequestApproval(ctx, approval); err != nil {
+		return false, err
+	}
+	if decision == models.RequestStatusApproved {
+		approved++
+	}
+	return approved >= step.RequiredApprovals, nil
+}
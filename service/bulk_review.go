@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"shiftdony/models"
+	"strings"
+)
+
+// BulkResult is the outcome of one request in a bulk review: the decision
+// taken and the status of the request after it, which stays pending while
+// later approval steps remain.
+type BulkResult struct {
+	RequestID int64  `json:"request_id"`
+	Decision  string `json:"decision"`
+	Status    string `json:"status,omitempty"`
+	Err       error  `json:"-"`
+}
+
+// BulkUpdateRequestStatus applies the same decision to every request in
+// requestIDs. Requests are decided one at a time in the given order, each in
+// its own transaction, so a full slot or an ineligible request only fails
+// that item and capacity is still checked for every approval.
+func (s *OvertimeService) BulkUpdateRequestStatus(ctx context.Context, requestIDs []int64, managerID int64, status, reason, comment string) ([]BulkResult, error) {
+	if strings.TrimSpace(reason) == "" && reasonRequired(status) {
+		return nil, ErrReasonRequired
+	}
+
+	results := make([]BulkResult, 0, len(requestIDs))
+	seen := make(map[int64]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result, err := s.reviewRequest(ctx, id, managerID, status, reason, comment)
+		results = append(results, BulkResult{RequestID: id, Decision: status, Status: result, Err: err})
+	}
+	return results, nil
+}
+
+// ApproveFirstForSlot approves the first n pending requests of a slot by
+// request time and rejects the rest with rejectReason. Approvals that fail,
+// for example because the slot filled up, are reported per item and do not
+// move the remaining requests forward.
+func (s *OvertimeService) ApproveFirstForSlot(ctx context.Context, slotID int64, n int, managerID int64, approveReason, rejectReason, comment string) ([]BulkResult, error) {
+	if strings.TrimSpace(approveReason) == "" && reasonRequired(models.RequestStatusApproved) {
+		return nil, ErrReasonRequired
+	}
+	if strings.TrimSpace(rejectReason) == "" && reasonRequired(models.RequestStatusRejected) {
+		return nil, ErrReasonRequired
+	}
+
+	if _, err := s.overtimeRepo.GetSlotByID(ctx, slotID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSlotNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	pending, err := s.overtimeRepo.GetPendingRequestsForSlot(ctx, slotID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	results := make([]BulkResult, 0, len(pending))
+	for i, request := range pending {
+		status, reason := models.RequestStatusApproved, approveReason
+		if i >= n {
+			status, reason = models.RequestStatusRejected, rejectReason
+		}
+		result, err := s.reviewRequest(ctx, request.ID, managerID, status, reason, comment)
+		results = append(results, BulkResult{RequestID: request.ID, Decision: status, Status: result, Err: err})
+	}
+	return results, nil
+}
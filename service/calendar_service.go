@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	"shiftdony/ical"
+	"shiftdony/models"
+	"time"
+)
+
+// CalendarService publishes overtime as iCalendar feeds behind per-user
+// secret URLs.
+type CalendarService struct {
+	calendarRepo pg.CalendarRepository
+	overtimeRepo pg.OvertimeRepository
+	userRepo     pg.UserRepository
+	notifyRepo   pg.NotificationRepository
+}
+
+func NewCalendarService(calendarRepo pg.CalendarRepository, overtimeRepo pg.OvertimeRepository, userRepo pg.UserRepository, notifyRepo pg.NotificationRepository) *CalendarService {
+	return &CalendarService{
+		calendarRepo: calendarRepo,
+		overtimeRepo: overtimeRepo,
+		userRepo:     userRepo,
+		notifyRepo:   notifyRepo,
+	}
+}
+
+// CreateFeedToken creates a new feed token for the user and returns it. Any
+// earlier token stops working.
+func (s *CalendarService) CreateFeedToken(ctx context.Context, userID int64) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", ErrInternalServer.Wrap(err)
+	}
+	err = s.calendarRepo.SaveCalendarToken(ctx, &models.CalendarToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", ErrInternalServer.Wrap(err)
+	}
+	return token, nil
+}
+
+// RevokeFeedToken disables the user's feed URLs.
+func (s *CalendarService) RevokeFeedToken(ctx context.Context, userID int64) error {
+	found, err := s.calendarRepo.DeleteCalendarToken(ctx, userID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !found {
+		return ErrInvalidCalendarToken
+	}
+	return nil
+}
+
+func (s *CalendarService) userForToken(ctx context.Context, token string) (int64, error) {
+	if token == "" {
+		return 0, ErrInvalidCalendarToken
+	}
+	t, err := s.calendarRepo.GetCalendarTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCalendarToken
+		}
+		return 0, ErrInternalServer.Wrap(err)
+	}
+	return t.UserID, nil
+}
+
+// PersonalFeed returns the approved overtime of the token's owner. Requests
+// withdrawn after approval, and those cancelled with their slot, stay in the
+// feed as cancelled events so clients drop them.
+func (s *CalendarService) PersonalFeed(ctx context.Context, token string) (*ical.Calendar, error) {
+	userID, err := s.userForToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := s.overtimeRepo.GetUserRequestsEndingAfter(ctx, userID, time.Now().Add(-config.C.Calendar.History),
+		models.RequestStatusApproved, models.RequestStatusWithdrawn, models.RequestStatusCancelled)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	loc, err := zoneFor(ctx, s.userRepo, s.notifyRepo, userID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	cal := newCalendar("My overtime", loc)
+	for i := range requests {
+		request := &requests[i]
+		slot := request.Slot
+		cancelled := request.Status != models.RequestStatusApproved || slot.Status == models.SlotStatusCancelled
+		cal.Events = append(cal.Events, ical.Event{
+			UID: eventUID("request", request.ID),
+			// Both counters only grow, so their sum does too.
+			Sequence:    slot.Sequence + request.Sequence,
+			Start:       slot.StartTime,
+			End:         slot.EndTime,
+			Summary:     "Overtime: " + slot.Title,
+			Description: fmt.Sprintf("Approved overtime shift, %s, %.1f hours.", localSpan(slot, loc), slot.Hours()),
+			Cancelled:   cancelled,
+		})
+	}
+	return cal, nil
+}
+
+// publishedSlotStatuses are the statuses of slots that have been open for
+// applications. Cancelled slots are in the feed so clients drop them.
+var publishedSlotStatuses = []string{
+	models.SlotStatusOpen,
+	models.SlotStatusFull,
+	models.SlotStatusClosed,
+	models.SlotStatusInProgress,
+	models.SlotStatusCompleted,
+	models.SlotStatusCancelled,
+}
+
+// SlotsFeed returns every published slot with its remaining capacity.
+func (s *CalendarService) SlotsFeed(ctx context.Context, token string) (*ical.Calendar, error) {
+	userID, err := s.userForToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := zoneFor(ctx, s.userRepo, s.notifyRepo, userID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	now := time.Now()
+	all, err := s.overtimeRepo.GetSlotsEndingAfter(ctx, now.Add(-config.C.Calendar.History), publishedSlotStatuses...)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	// Slots cancelled before their applications opened were never
+	// published.
+	slots := all[:0]
+	for _, slot := range all {
+		if slot.Status == models.SlotStatusCancelled && slot.ApplicationOpensAt != nil && slot.ApplicationOpensAt.After(now) {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	ids := make([]int64, len(slots))
+	for i := range slots {
+		ids[i] = slots[i].ID
+	}
+	approved, err := s.overtimeRepo.CountApprovedRequestsBySlot(ctx, ids)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	cal := newCalendar("Overtime slots", loc)
+	for i := range slots {
+		slot := &slots[i]
+		remaining := slot.Capacity - int64(approved[slot.ID])
+		if remaining < 0 {
+			remaining = 0
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:      eventUID("slot", slot.ID),
+			Sequence: slot.Sequence,
+			Start:    slot.StartTime,
+			End:      slot.EndTime,
+			Summary:  slot.Title,
+			Description: fmt.Sprintf("When: %s\nStatus: %s\nCapacity: %d\nRemaining places: %d",
+				localSpan(slot, loc), slot.Status, slot.Capacity, remaining),
+			Cancelled: slot.Status == models.SlotStatusCancelled,
+		})
+	}
+	return cal, nil
+}
+
+func newCalendar(name string, loc *time.Location) *ical.Calendar {
+	return &ical.Calendar{
+		Name:            name,
+		Timezone:        loc.String(),
+		RefreshInterval: config.C.Calendar.RefreshInterval,
+	}
+}
+
+// localSpan describes when a slot runs on the clocks of loc.
+func localSpan(slot *models.OvertimeSlot, loc *time.Location) string {
+	start, end := slot.StartTime.In(loc), slot.EndTime.In(loc)
+	if start.YearDay() == end.YearDay() && start.Year() == end.Year() {
+		return start.Format("2006-01-02 15:04") + " - " + end.Format("15:04 MST")
+	}
+	return start.Format("2006-01-02 15:04 MST") + " - " + end.Format("2006-01-02 15:04 MST")
+}
+
+// eventUID returns the stable UID of the calendar event for an entity.
+func eventUID(kind string, id int64) string {
+	return fmt.Sprintf("%s-%d@%s", kind, id, config.C.Calendar.UIDDomain)
+}
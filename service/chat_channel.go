@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shiftdony/chat"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"shiftdony/notify"
+	"strings"
+)
+
+// chatChannel sends notifications to the user's linked chat, with buttons
+// to act on them where that makes sense.
+type chatChannel struct {
+	bot      chat.Bot
+	provider string
+	chatRepo pg.ChatRepository
+}
+
+// NewChatChannel returns a notification channel delivering to chats linked
+// on provider.
+func NewChatChannel(bot chat.Bot, provider string, chatRepo pg.ChatRepository) notify.Channel {
+	return &chatChannel{bot: bot, provider: provider, chatRepo: chatRepo}
+}
+
+func (c *chatChannel) Name() string { return c.provider }
+
+func (c *chatChannel) Send(ctx context.Context, to notify.Recipient, msg notify.Message) error {
+	if msg.Kind == models.NotifyPasswordReset || !to.Prefs.ChatEnabled {
+		return notify.ErrSkipped
+	}
+	link, err := c.chatRepo.GetChatLinkByUserID(ctx, c.provider, to.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notify.ErrSkipped
+	}
+	if err != nil {
+		return err
+	}
+
+	title, err := notify.RenderText(to.Prefs.Locale, msg.Kind, "subject", msg.Data)
+	if err != nil {
+		return err
+	}
+	body, err := notify.RenderText(to.Prefs.Locale, msg.Kind, "short", msg.Data)
+	if err != nil {
+		return err
+	}
+	out := chat.Message{
+		ChatID: link.ChatID,
+		Text:   strings.TrimSpace(title) + "\n\n" + strings.TrimSpace(body),
+	}
+	switch msg.Kind {
+	case models.NotifySlotPublished:
+		out.Buttons = [][]chat.Button{{{Text: "Apply", Data: fmt.Sprintf("%s:%v", chatApply, msg.Data["SlotID"])}}}
+	case models.NotifyReviewPending:
+		out.Buttons = reviewButtons(msg.Data["RequestID"])
+	}
+	return c.bot.Send(ctx, out)
+}
+
+func reviewButtons(requestID interface{}) [][]chat.Button {
+	return [][]chat.Button{{
+		{Text: "Approve", Data: fmt.Sprintf("%s:%v", chatApprove, requestID)},
+		{Text: "Reject", Data: fmt.Sprintf("%s:%v", chatReject, requestID)},
+	}}
+}
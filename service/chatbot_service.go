@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shiftdony/chat"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Button actions, carried in callback data as "<action>:<id>".
+const (
+	chatApply   = "apply"
+	chatApprove = "approve"
+	chatReject  = "reject"
+)
+
+// chatPollLockKey is the advisory lock held by the replica that long-polls
+// the chat provider; the provider allows only one poller per bot.
+const chatPollLockKey int64 = 0x63686174706f6c6c // "chatpoll"
+
+// linkCodeAlphabet leaves out characters that are easy to confuse.
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const notLinkedText = "This chat is not linked yet. Get a code in the app and send /link CODE in a private chat with the bot."
+
+const chatHelp = `Commands:
+/link CODE - link this chat to your account (get the code from the app)
+/unlink - unlink this chat
+/slots - list open overtime slots
+/pending - list requests waiting for your review
+/approve ID [reason] - approve a request
+/reject ID reason - reject a request`
+
+// ChatBotService lets users apply for overtime and managers review requests
+// from a chat platform.
+type ChatBotService struct {
+	bot          chat.Bot
+	provider     string
+	chatRepo     pg.ChatRepository
+	userRepo     pg.UserRepository
+	notifyRepo   pg.NotificationRepository
+	overtimeRepo pg.OvertimeRepository
+	jobRepo      pg.JobRepository
+	overtime     *OvertimeService
+	approvals    *ApprovalService
+	tx           pg.Transactor
+}
+
+// NewChatBotService returns the bot service. bot is nil when the chat
+// integration is disabled.
+func NewChatBotService(bot chat.Bot, chatRepo pg.ChatRepository, userRepo pg.UserRepository, notifyRepo pg.NotificationRepository, overtimeRepo pg.OvertimeRepository, jobRepo pg.JobRepository, overtime *OvertimeService, approvals *ApprovalService, tx pg.Transactor) *ChatBotService {
+	return &ChatBotService{
+		bot:          bot,
+		provider:     config.C.Chat.Provider,
+		chatRepo:     chatRepo,
+		userRepo:     userRepo,
+		notifyRepo:   notifyRepo,
+		overtimeRepo: overtimeRepo,
+		jobRepo:      jobRepo,
+		overtime:     overtime,
+		approvals:    approvals,
+		tx:           tx,
+	}
+}
+
+// CreateLinkCode returns a one-time code the user sends to the bot with
+// /link to tie the chat to their account.
+func (s *ChatBotService) CreateLinkCode(ctx context.Context, userID int64) (string, time.Time, error) {
+	if s.bot == nil {
+		return "", time.Time{}, ErrChatDisabled
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, ErrInternalServer.Wrap(err)
+	}
+	for i := range buf {
+		buf[i] = linkCodeAlphabet[int(buf[i])%len(linkCodeAlphabet)]
+	}
+	code := string(buf)
+	expiresAt := time.Now().Add(config.C.Chat.LinkCodeTTL)
+
+	err := s.chatRepo.CreateLinkCode(ctx, &models.ChatLinkCode{
+		CodeHash:  hashToken(code),
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, ErrInternalServer.Wrap(err)
+	}
+	return code, expiresAt, nil
+}
+
+func (s *ChatBotService) Unlink(ctx context.Context, userID int64) error {
+	deleted, err := s.chatRepo.DeleteChatLink(ctx, s.provider, userID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !deleted {
+		return ErrChatNotLinked
+	}
+	return nil
+}
+
+// SetupWebhook registers the configured webhook with the provider.
+func (s *ChatBotService) SetupWebhook(ctx context.Context) error {
+	if s.bot == nil {
+		return ErrChatDisabled
+	}
+	return s.bot.SetWebhook(ctx, config.C.Chat.WebhookURL, config.C.Chat.WebhookSecret)
+}
+
+// Poll long-polls the provider for updates until ctx is done. Only the
+// replica holding chatPollLockKey polls; the others wait to take over.
+func (s *ChatBotService) Poll(ctx context.Context) {
+	const op = "ChatBotService.Poll"
+	for ctx.Err() == nil {
+		release, ok, err := s.jobRepo.TryAdvisoryLock(ctx, chatPollLockKey)
+		if err != nil {
+			log.Error(op, "cannot take the polling lock", err)
+		} else if ok {
+			// Polling is refused while a webhook is set.
+			if err := s.bot.DeleteWebhook(ctx); err != nil {
+				log.Error(op, "cannot remove the webhook", err)
+			} else {
+				s.pollUpdates(ctx)
+			}
+			release()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+// pollUpdates handles updates until polling fails or ctx is done.
+func (s *ChatBotService) pollUpdates(ctx context.Context) {
+	const op = "ChatBotService.pollUpdates"
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := s.bot.GetUpdates(ctx, offset, config.C.Chat.PollTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error(op, "cannot get updates", err)
+			}
+			return
+		}
+		for _, u := range updates {
+			if err := s.HandleUpdate(ctx, u); err != nil {
+				log.Error(op, "cannot handle update", err, zap.Int64("update_id", u.ID))
+			}
+			offset = u.ID + 1
+		}
+	}
+}
+
+// HandleUpdate answers one incoming message or button press. Problems the
+// user can fix are replied in the chat; only delivery failures are
+// returned.
+func (s *ChatBotService) HandleUpdate(ctx context.Context, u chat.Update) error {
+	if s.bot == nil {
+		return ErrChatDisabled
+	}
+	if u.CallbackID != "" {
+		return s.handleButton(ctx, u)
+	}
+
+	fields := strings.Fields(u.Text)
+	if len(fields) == 0 {
+		return nil
+	}
+	command := strings.ToLower(fields[0])
+	// Commands in groups come as /command@botname.
+	if i := strings.Index(command, "@"); i > 0 {
+		command = command[:i]
+	}
+	args := fields[1:]
+
+	switch command {
+	case "/link":
+		if len(args) != 1 {
+			return s.reply(ctx, u.ChatID, "Usage: /link CODE")
+		}
+		return s.link(ctx, u, args[0])
+	case "/start":
+		// Deep links open the chat with /start CODE.
+		if len(args) == 1 {
+			return s.link(ctx, u, args[0])
+		}
+		return s.reply(ctx, u.ChatID, "Welcome to Shiftdoni.\n\n"+chatHelp)
+	case "/help":
+		return s.reply(ctx, u.ChatID, chatHelp)
+	}
+
+	user, err := s.linkedUser(ctx, u)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return s.reply(ctx, u.ChatID, notLinkedText)
+	}
+
+	switch command {
+	case "/unlink":
+		if err := s.Unlink(ctx, user.ID); err != nil {
+			return s.reply(ctx, u.ChatID, chatErrorText(err))
+		}
+		return s.reply(ctx, u.ChatID, "This chat is no longer linked to your account.")
+	case "/slots":
+		return s.sendSlots(ctx, u.ChatID, user)
+	case "/pending":
+		return s.sendPending(ctx, u.ChatID, user)
+	case "/approve", "/reject":
+		if len(args) == 0 {
+			return s.reply(ctx, u.ChatID, "Usage: "+command+" ID [reason]")
+		}
+		requestID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return s.reply(ctx, u.ChatID, "The request ID must be a number.")
+		}
+		status := models.RequestStatusApproved
+		if command == "/reject" {
+			status = models.RequestStatusRejected
+		}
+		return s.review(ctx, u.ChatID, user, requestID, status, strings.Join(args[1:], " "))
+	}
+	return s.reply(ctx, u.ChatID, "Unknown command.\n\n"+chatHelp)
+}
+
+func (s *ChatBotService) handleButton(ctx context.Context, u chat.Update) error {
+	// Stop the client's spinner whatever happens next.
+	if err := s.bot.AnswerCallback(ctx, u.CallbackID, ""); err != nil {
+		return err
+	}
+
+	user, err := s.linkedUser(ctx, u)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return s.reply(ctx, u.ChatID, notLinkedText)
+	}
+
+	action, rawID, _ := strings.Cut(u.CallbackData, ":")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	switch action {
+	case chatApply:
+		request, err := s.overtime.CreateRequest(ctx, user.ID, id)
+		if err != nil {
+			return s.reply(ctx, u.ChatID, "Could not apply: "+chatErrorText(err))
+		}
+		return s.reply(ctx, u.ChatID, fmt.Sprintf("Applied. Your request #%d is %s.", request.ID, request.Status))
+	case chatApprove:
+		return s.review(ctx, u.ChatID, user, id, models.RequestStatusApproved, "")
+	case chatReject:
+		return s.review(ctx, u.ChatID, user, id, models.RequestStatusRejected, "")
+	}
+	return nil
+}
+
+func (s *ChatBotService) link(ctx context.Context, u chat.Update, code string) error {
+	// In a group anyone could act through the link, so only private chats
+	// are linked.
+	if !u.Private || u.FromID == 0 {
+		return s.reply(ctx, u.ChatID, "Chats can only be linked in a private chat with the bot.")
+	}
+	var user *models.User
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		linkCode, err := s.chatRepo.GetLinkCode(ctx, hashToken(strings.ToUpper(code)))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidLinkCode
+			}
+			return err
+		}
+		now := time.Now()
+		if linkCode.UsedAt != nil || now.After(linkCode.ExpiresAt) {
+			return ErrInvalidLinkCode
+		}
+		linkCode.UsedAt = &now
+		if err := s.chatRepo.UpdateLinkCode(ctx, linkCode); err != nil {
+			return err
+		}
+		if user, err = s.userRepo.GetUserByID(ctx, linkCode.UserID); err != nil {
+			return err
+		}
+		return s.chatRepo.SaveChatLink(ctx, &models.ChatLink{
+			UserID:   linkCode.UserID,
+			Provider: s.provider,
+			ChatID:   u.ChatID,
+			SenderID: u.FromID,
+			Username: u.Username,
+			LinkedAt: now,
+		})
+	})
+	if err != nil {
+		if err != ErrInvalidLinkCode {
+			log.Error("ChatBotService.link", "cannot link chat", err)
+			err = ErrInternalServer
+		}
+		return s.reply(ctx, u.ChatID, chatErrorText(err))
+	}
+	return s.reply(ctx, u.ChatID, fmt.Sprintf("Linked to %s. Send /help to see what you can do.", user.FullName))
+}
+
+func (s *ChatBotService) sendSlots(ctx context.Context, chatID int64, user *models.User) error {
+	slots, err := s.overtime.GetAvailableSlots(ctx)
+	if err != nil {
+		return s.reply(ctx, chatID, chatErrorText(ErrInternalServer))
+	}
+	if len(slots) == 0 {
+		return s.reply(ctx, chatID, "There are no open slots right now.")
+	}
+	if len(slots) > 10 {
+		slots = slots[:10]
+	}
+	loc := s.location(ctx, user)
+	var buttons [][]chat.Button
+	var text strings.Builder
+	text.WriteString("Open slots:\n")
+	for _, slot := range slots {
+		fmt.Fprintf(&text, "\n#%d %s, %s - %s", slot.ID, slot.Title,
+			slot.StartTime.In(loc).Format("2006-01-02 15:04"), slot.EndTime.In(loc).Format("15:04 MST"))
+		buttons = append(buttons, []chat.Button{{
+			Text: "Apply: " + slot.Title,
+			Data: fmt.Sprintf("%s:%d", chatApply, slot.ID),
+		}})
+	}
+	return s.bot.Send(ctx, chat.Message{ChatID: chatID, Text: text.String(), Buttons: buttons})
+}
+
+func (s *ChatBotService) sendPending(ctx context.Context, chatID int64, reviewer *models.User) error {
+	requests, err := s.overtimeRepo.GetPendingRequestsForApprover(ctx, reviewer.ID, reviewer.Role, defaultApprovalChain.Steps[0].ApproverRole, 10)
+	if err != nil {
+		return s.reply(ctx, chatID, chatErrorText(ErrInternalServer))
+	}
+	if len(requests) == 0 {
+		return s.reply(ctx, chatID, "Nothing is waiting for your review.")
+	}
+	loc := s.location(ctx, reviewer)
+	for i := range requests {
+		request := &requests[i]
+		slot, err := s.overtimeRepo.GetSlotByID(ctx, request.SlotID)
+		if err != nil {
+			return s.reply(ctx, chatID, chatErrorText(ErrInternalServer))
+		}
+		name := ""
+		if request.User != nil {
+			name = request.User.FullName
+		}
+		text := fmt.Sprintf("Request #%d by %s for %s (%s)", request.ID, name, slot.Title, slot.StartTime.In(loc).Format("2006-01-02 15:04 MST"))
+		if err := s.bot.Send(ctx, chat.Message{ChatID: chatID, Text: text, Buttons: reviewButtons(request.ID)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ChatBotService) review(ctx context.Context, chatID int64, reviewer *models.User, requestID int64, status, reason string) error {
+	if reason == "" && reasonRequired(status) {
+		return s.reply(ctx, chatID, fmt.Sprintf("A reason is required. Send /%s %d <reason>.", chatActionFor(status), requestID))
+	}
+	if err := s.overtime.UpdateRequestStatus(ctx, requestID, reviewer.ID, status, reason, ""); err != nil {
+		return s.reply(ctx, chatID, fmt.Sprintf("Could not update request #%d: %s", requestID, chatErrorText(err)))
+	}
+	return s.reply(ctx, chatID, fmt.Sprintf("Your decision on request #%d was recorded.", requestID))
+}
+
+// linkedUser returns the user linked to the update's chat, or nil. The
+// update must come from the platform user who linked the chat.
+func (s *ChatBotService) linkedUser(ctx context.Context, u chat.Update) (*models.User, error) {
+	link, err := s.chatRepo.GetChatLinkByChatID(ctx, s.provider, u.ChatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.SenderID == 0 || link.SenderID != u.FromID {
+		return nil, nil
+	}
+	return s.userRepo.GetUserByID(ctx, link.UserID)
+}
+
+// location returns the zone times are shown to the chat's user in. A
+// failed lookup falls back to the organization's zone.
+func (s *ChatBotService) location(ctx context.Context, user *models.User) *time.Location {
+	prefs, err := s.notifyRepo.GetPreferences(ctx, []int64{user.ID})
+	if err != nil {
+		return OrgLocation()
+	}
+	if pref, ok := prefs[user.ID]; ok {
+		return userLocation(user, &pref)
+	}
+	return userLocation(user, nil)
+}
+
+func (s *ChatBotService) reply(ctx context.Context, chatID int64, text string) error {
+	return s.bot.Send(ctx, chat.Message{ChatID: chatID, Text: text})
+}
+
+func chatActionFor(status string) string {
+	if status == models.RequestStatusRejected {
+		return chatReject
+	}
+	return chatApprove
+}
+
+func chatErrorText(err error) string {
+	if errors.Is(err, ErrInternalServer) {
+		return "something went wrong, please try again later."
+	}
+	return err.Error()
+}
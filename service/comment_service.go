@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"strings"
+	"time"
+)
+
+type CommentService struct {
+	commentRepo  pg.CommentRepository
+	overtimeRepo pg.OvertimeRepository
+	userRepo     pg.UserRepository
+	approvals    *ApprovalService
+	delegations  *DelegationService
+	events       *EventPublisher
+	tx           pg.Transactor
+}
+
+func NewCommentService(commentRepo pg.CommentRepository, overtimeRepo pg.OvertimeRepository, userRepo pg.UserRepository, approvals *ApprovalService, delegations *DelegationService, events *EventPublisher, tx pg.Transactor) *CommentService {
+	return &CommentService{
+		commentRepo:  commentRepo,
+		overtimeRepo: overtimeRepo,
+		userRepo:     userRepo,
+		approvals:    approvals,
+		delegations:  delegations,
+		events:       events,
+		tx:           tx,
+	}
+}
+
+func (s *CommentService) AddComment(ctx context.Context, requestID, authorID int64, parentID *int64, body string) (*models.RequestComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, ErrInvalidComment
+	}
+	request, err := s.checkAccess(ctx, requestID, authorID)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		parent, err := s.commentRepo.GetRequestCommentByID(ctx, *parentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrCommentNotFound
+			}
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		if parent.RequestID != requestID {
+			return nil, ErrCommentNotFound
+		}
+	}
+
+	comment := &models.RequestComment{
+		RequestID: requestID,
+		AuthorID:  authorID,
+		ParentID:  parentID,
+		Body:      body,
+		CreatedAt: time.Now(),
+	}
+	err = s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := s.commentRepo.CreateRequestComment(ctx, comment); err != nil {
+			return err
+		}
+		event := requestEvent(request, &authorID)
+		event.CommentID = &comment.ID
+		return s.events.emit(ctx, models.EventRequestCommented, "request", requestID, event)
+	})
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return comment, nil
+}
+
+func (s *CommentService) GetComments(ctx context.Context, requestID, userID int64) ([]models.RequestComment, error) {
+	if _, err := s.checkAccess(ctx, requestID, userID); err != nil {
+		return nil, err
+	}
+	comments, err := s.commentRepo.GetRequestComments(ctx, requestID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return comments, nil
+}
+
+// checkAccess allows the applicant, managers, delegates covering the
+// applicant's team and anyone who already took a decision on the request.
+// It returns the request.
+func (s *CommentService) checkAccess(ctx context.Context, requestID, userID int64) (*models.OvertimeRequest, error) {
+	request, err := s.overtimeRepo.GetRequestByID(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if request.UserID == userID {
+		return request, nil
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if user.Role == models.RoleManager || user.Role == models.RoleDepartmentHead {
+		return request, nil
+	}
+
+	applicant, err := s.userRepo.GetUserByID(ctx, request.UserID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	delegated, err := s.delegations.covers(ctx, userID, applicant.TeamID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if delegated {
+		return request, nil
+	}
+
+	decided, err := s.approvals.hasDecided(ctx, requestID, userID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if !decided {
+		return nil, ErrForbidden
+	}
+	return request, nil
+}
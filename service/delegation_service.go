@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"time"
+)
+
+type DelegationService struct {
+	delegationRepo pg.DelegationRepository
+	userRepo       pg.UserRepository
+	events         *EventPublisher
+	tx             pg.Transactor
+}
+
+func NewDelegationService(delegationRepo pg.DelegationRepository, userRepo pg.UserRepository, events *EventPublisher, tx pg.Transactor) *DelegationService {
+	return &DelegationService{delegationRepo: delegationRepo, userRepo: userRepo, events: events, tx: tx}
+}
+
+// Delegate hands managerID's review authority to delegateID between startsAt
+// and endsAt. An empty teamIDs covers every team.
+func (s *DelegationService) Delegate(ctx context.Context, managerID, delegateID int64, startsAt, endsAt time.Time, teamIDs []int64) (*models.Delegation, error) {
+	if managerID == delegateID || !endsAt.After(startsAt) {
+		return nil, ErrInvalidDelegation
+	}
+	if _, err := s.userRepo.GetUserByID(ctx, delegateID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	delegation := &models.Delegation{
+		ManagerID:  managerID,
+		DelegateID: delegateID,
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+		TeamIDs:    teamIDs,
+		CreatedAt:  time.Now(),
+	}
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := s.delegationRepo.CreateDelegation(ctx, delegation); err != nil {
+			return err
+		}
+		return s.events.emit(ctx, models.EventDelegationCreated, "delegation", delegation.ID, delegation)
+	})
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return delegation, nil
+}
+
+func (s *DelegationService) GetMyDelegations(ctx context.Context, managerID int64) ([]models.Delegation, error) {
+	delegations, err := s.delegationRepo.GetDelegationsByManager(ctx, managerID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return delegations, nil
+}
+
+func (s *DelegationService) Revoke(ctx context.Context, delegationID, managerID int64) error {
+	ok, err := s.delegationRepo.RevokeDelegation(ctx, delegationID, managerID, time.Now())
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !ok {
+		return ErrDelegationNotFound
+	}
+	return nil
+}
+
+// HasActiveDelegation reports whether anyone currently delegates review
+// authority to userID.
+func (s *DelegationService) HasActiveDelegation(ctx context.Context, userID int64) (bool, error) {
+	delegations, err := s.delegationRepo.GetActiveDelegationsForDelegate(ctx, userID, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return len(delegations) > 0, nil
+}
+
+// covers reports whether delegateID currently reviews requests from teamID
+// under a delegation.
+func (s *DelegationService) covers(ctx context.Context, delegateID, teamID int64) (bool, error) {
+	delegations, err := s.delegationRepo.GetActiveDelegationsForDelegate(ctx, delegateID, time.Now())
+	if err != nil {
+		return false, err
+	}
+	for _, d := range delegations {
+		if d.Covers(teamID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// coveredTeams returns the teams whose requests delegateID currently
+// reviews under a delegation, or all when a delegation covers every team.
+func (s *DelegationService) coveredTeams(ctx context.Context, delegateID int64) (teamIDs []int64, all bool, err error) {
+	delegations, err := s.delegationRepo.GetActiveDelegationsForDelegate(ctx, delegateID, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+	teamIDs = []int64{}
+	for _, d := range delegations {
+		if len(d.TeamIDs) == 0 {
+			return nil, true, nil
+		}
+		teamIDs = append(teamIDs, d.TeamIDs...)
+	}
+	return teamIDs, false, nil
+}
+
+// delegatorsFor returns the managers whose authority delegateID currently
+// holds for requests from teamID.
+func (s *DelegationService) delegatorsFor(ctx context.Context, delegateID, teamID int64) ([]models.User, error) {
+	delegations, err := s.delegationRepo.GetActiveDelegationsForDelegate(ctx, delegateID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var managers []models.User
+	for _, d := range delegations {
+		if !d.Covers(teamID) {
+			continue
+		}
+		manager, err := s.userRepo.GetUserByID(ctx, d.ManagerID)
+		if err != nil {
+			return nil, err
+		}
+		managers = append(managers, *manager)
+	}
+	return managers, nil
+}
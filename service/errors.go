@@ -1,17 +1,155 @@
 package service
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// Error is an error the API reports to clients. Code is the stable reason
+// clients branch on, Status the HTTP status and Message the English text,
+// translated per locale by the i18n catalogs. Retryable tells clients the
+// same request may succeed later. Cause is the underlying error; it is
+// logged but never shown to clients.
+type Error struct {
+	Code      string
+	Status    int
+	Message   string
+	Retryable bool
+	Cause     error
+
+	base *Error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Cause }
+
+// Is matches a wrapped copy against the error it was made from, so
+// errors.Is(ErrInternalServer.Wrap(err), ErrInternalServer) holds.
+func (e *Error) Is(target error) bool {
+	return e.base != nil && target == error(e.base)
+}
+
+// Wrap returns a copy of e that records cause.
+func (e *Error) Wrap(cause error) error {
+	wrapped := *e
+	wrapped.Cause = cause
+	wrapped.base = e
+	if e.base != nil {
+		wrapped.base = e.base
+	}
+	return &wrapped
+}
+
+func newError(status int, code, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// AsError returns the *Error err is or wraps. Anything else is an internal
+// error, or a retryable unavailable one when the cause is transient, such
+// as a timeout, a lost connection or a serialization failure.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) && !errors.Is(e, ErrInternalServer) {
+		return e
+	}
+	cause := err
+	if e != nil && e.Cause != nil {
+		cause = e.Cause
+	}
+	if transient(cause) {
+		return ErrUnavailable.Wrap(cause).(*Error)
+	}
+	if e != nil {
+		return e
+	}
+	return ErrInternalServer.Wrap(err).(*Error)
+}
+
+func transient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) {
+		switch code := pgErr.Field('C'); {
+		case code == "40001", code == "40P01", code == "55P03", code == "57P01":
+			return true
+		case len(code) == 5 && code[:2] == "08":
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
 
 // Custom errors for business logic
 var (
-	ErrInvalidCredentials  = errors.New("invalid personnel code or password")
-	ErrUserNotFound        = errors.New("user not found")
-	ErrPersonnelCodeExists = errors.New("personnel code already exists")
+	ErrInvalidCredentials  = newError(http.StatusUnauthorized, "INVALID_CREDENTIALS", "invalid personnel code or password")
+	ErrUserNotFound        = newError(http.StatusNotFound, "NOT_FOUND", "user not found")
+	ErrPersonnelCodeExists = newError(http.StatusConflict, "ALREADY_EXISTS", "personnel code already exists")
+	ErrUnauthorized        = newError(http.StatusUnauthorized, "UNAUTHORIZED", "a valid bearer token is required")
+	ErrRoleRequired        = newError(http.StatusForbidden, "FORBIDDEN", "your role does not allow this action")
+
+	ErrSlotNotFound    = newError(http.StatusNotFound, "SLOT_NOT_FOUND", "slot not found or is not open for requests")
+	ErrAlreadyApplied  = newError(http.StatusConflict, "ALREADY_APPLIED", "you have already applied for this slot")
+	ErrSlotIsFull      = newError(http.StatusConflict, "SLOT_FULL", "this overtime slot is already full")
+	ErrRequestNotFound = newError(http.StatusNotFound, "NOT_FOUND", "request not found")
+
+	ErrApplicationWindowClosed   = newError(http.StatusConflict, "APPLICATION_WINDOW_CLOSED", "applications for this slot are not open")
+	ErrCancellationCutoffPassed  = newError(http.StatusConflict, "CANCELLATION_CUTOFF_PASSED", "the cancellation cutoff for this slot has passed")
+	ErrCannotWithdraw            = newError(http.StatusConflict, "CANNOT_WITHDRAW", "this request can no longer be withdrawn")
+	ErrCannotCancelSlot          = newError(http.StatusConflict, "CANNOT_CANCEL_SLOT", "this slot can no longer be cancelled")
+	ErrInvalidSlotWindow         = newError(http.StatusBadRequest, "INVALID_INPUT", "slot must start in the future, end after it starts within the maximum duration, and close applications before it starts")
+	ErrInvalidCapacity           = newError(http.StatusBadRequest, "INVALID_INPUT", "slot capacity must be at least 1")
+	ErrSlotOnClosureDay          = newError(http.StatusConflict, "CLOSURE_DAY", "slots cannot be created on a closure day")
+	ErrInvalidAllocationStrategy = newError(http.StatusBadRequest, "INVALID_STRATEGY", "slot has no automatic allocation strategy")
+	ErrCannotRecordAttendance    = newError(http.StatusConflict, "CANNOT_RECORD_ATTENDANCE", "attendance can only be recorded for approved requests once their slot has started")
+
+	ErrRequestAlreadyDecided = newError(http.StatusConflict, "ALREADY_DECIDED", "request has already been decided")
+	ErrNotAnApprover         = newError(http.StatusForbidden, "NOT_AN_APPROVER", "you are not an approver for the current step of this request")
+	ErrAlreadyReviewed       = newError(http.StatusConflict, "ALREADY_REVIEWED", "you have already reviewed this step of the request")
+	ErrSelfReview            = newError(http.StatusForbidden, "SELF_REVIEW", "you cannot review your own request")
+	ErrReasonRequired        = newError(http.StatusBadRequest, "REASON_REQUIRED", "a reason is required for this decision")
+	ErrInvalidComment        = newError(http.StatusBadRequest, "INVALID_INPUT", "comment body must not be empty")
+	ErrCommentNotFound       = newError(http.StatusNotFound, "NOT_FOUND", "comment not found on this request")
+	ErrForbidden             = newError(http.StatusForbidden, "FORBIDDEN", "you are not allowed to access this request")
+	ErrInvalidDelegation     = newError(http.StatusBadRequest, "INVALID_INPUT", "a delegation needs another user and an end after its start")
+	ErrDelegationNotFound    = newError(http.StatusNotFound, "NOT_FOUND", "delegation not found")
+	ErrInvalidApprovalChain  = newError(http.StatusBadRequest, "INVALID_INPUT", "approval chain must have at least one step and every step needs an approver")
+
+	ErrInvalidWebhookURL = newError(http.StatusBadRequest, "INVALID_INPUT", "webhook URL must be an absolute http or https URL")
+	ErrWebhookNotFound   = newError(http.StatusNotFound, "NOT_FOUND", "webhook subscription or delivery not found")
+	ErrEventNotFound     = newError(http.StatusNotFound, "NOT_FOUND", "event not found")
+
+	ErrInvalidLocale      = newError(http.StatusBadRequest, "INVALID_INPUT", "unsupported locale")
+	ErrInvalidCalendar    = newError(http.StatusBadRequest, "INVALID_INPUT", "calendar must be gregorian or jalali")
+	ErrInvalidTimezone    = newError(http.StatusBadRequest, "INVALID_INPUT", "unknown time zone")
+	ErrNonexistentTime    = newError(http.StatusBadRequest, "INVALID_INPUT", "local time is skipped by a daylight saving change")
+	ErrAmbiguousTime      = newError(http.StatusBadRequest, "INVALID_INPUT", "local time occurs twice because of a daylight saving change")
+	ErrInvalidEmail       = newError(http.StatusBadRequest, "INVALID_INPUT", "invalid email address")
+	ErrEmailExists        = newError(http.StatusConflict, "EMAIL_EXISTS", "another user already has this email address")
+	ErrInvalidUnsubscribe = newError(http.StatusBadRequest, "INVALID_INPUT", "invalid unsubscribe link")
+	ErrInvalidResetToken  = newError(http.StatusBadRequest, "INVALID_TOKEN", "password reset token is invalid or expired")
+
+	ErrChatDisabled    = newError(http.StatusServiceUnavailable, "CHAT_DISABLED", "chat integration is not enabled")
+	ErrInvalidLinkCode = newError(http.StatusBadRequest, "INVALID_TOKEN", "link code is invalid or expired")
+	ErrChatNotLinked   = newError(http.StatusNotFound, "NOT_FOUND", "no chat is linked to this account")
 
-	ErrSlotNotFound   = errors.New("slot not found or is not open for requests")
-	ErrAlreadyApplied = errors.New("you have already applied for this slot")
-	ErrSlotIsFull     = errors.New("this overtime slot is already full")
-	ErrRequestNotFound = errors.New("request not found")
+	ErrInvalidCalendarToken    = newError(http.StatusNotFound, "NOT_FOUND", "invalid calendar feed token")
+	ErrHolidayCalendarNotFound = newError(http.StatusNotFound, "NOT_FOUND", "holiday calendar not found")
+	ErrHolidayNotFound         = newError(http.StatusNotFound, "NOT_FOUND", "holiday not found")
+	ErrInvalidHolidayCalendar  = newError(http.StatusBadRequest, "INVALID_INPUT", "a holiday calendar needs a unique name, a known time zone and valid weekend days")
+	ErrInvalidHoliday          = newError(http.StatusBadRequest, "INVALID_INPUT", "a holiday needs a name and a date range of at most a year")
+	ErrInvalidICS              = newError(http.StatusBadRequest, "INVALID_INPUT", "the file is not a valid iCalendar file")
+	ErrTeamNotFound            = newError(http.StatusNotFound, "NOT_FOUND", "team not found")
 
-	ErrInternalServer = errors.New("internal server error")
-)
\ No newline at end of file
+	ErrInvalidInput   = newError(http.StatusBadRequest, "INVALID_INPUT", "invalid input data")
+	ErrInternalServer = newError(http.StatusInternalServerError, "SERVER_ERROR", "internal server error")
+	ErrUnavailable    = &Error{Code: "SERVICE_UNAVAILABLE", Status: http.StatusServiceUnavailable, Message: "the service is temporarily unavailable, please retry", Retryable: true}
+)
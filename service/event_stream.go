@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// Server-Sent Event names.
+const (
+	StreamSlotUpdated    = "slot.updated"
+	StreamRequestUpdated = "request.updated"
+	StreamReviewPending  = "review.pending"
+	// StreamReset tells the client its backlog was too long to replay;
+	// it should reload its state and carry on from the reset's ID.
+	StreamReset = "stream.reset"
+)
+
+// StreamEvent is one event sent to a live client. ID is the outbox event it
+// was derived from, so clients can resume with Last-Event-ID.
+type StreamEvent struct {
+	ID   int64
+	Name string
+	Data interface{}
+}
+
+// SlotUpdate reports the current fill of a slot.
+type SlotUpdate struct {
+	SlotID    int64  `json:"slot_id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	Capacity  int64  `json:"capacity"`
+	Approved  int    `json:"approved"`
+	Remaining int64  `json:"remaining"`
+	Cause     string `json:"cause"`
+}
+
+// RequestUpdate reports a change of one of the user's requests.
+type RequestUpdate struct {
+	Type string `json:"type"`
+	RequestEvent
+}
+
+// ReviewUpdate tells a reviewer a request is waiting on them.
+type ReviewUpdate struct {
+	Type      string `json:"type"`
+	RequestID int64  `json:"request_id"`
+	SlotID    int64  `json:"slot_id"`
+	UserID    int64  `json:"user_id"`
+}
+
+// ResetNotice is the data of a stream.reset event.
+type ResetNotice struct {
+	Reason string `json:"reason"`
+}
+
+// routedEvent is a stream event with its audience: everyone, or the users
+// in audience.
+type routedEvent struct {
+	event    StreamEvent
+	all      bool
+	audience map[int64]bool
+}
+
+func (r *routedEvent) reaches(userID int64) bool {
+	return r.all || r.audience[userID]
+}
+
+// EventStream fans outbox events out to connected clients. Every replica
+// listens for new events through Postgres LISTEN/NOTIFY, so a client sees
+// changes made on any of them.
+type EventStream struct {
+	outboxRepo   pg.OutboxRepository
+	overtimeRepo pg.OvertimeRepository
+	userRepo     pg.UserRepository
+	approvals    *ApprovalService
+
+	mu   sync.Mutex
+	subs map[*StreamSubscription]struct{}
+}
+
+func NewEventStream(outboxRepo pg.OutboxRepository, overtimeRepo pg.OvertimeRepository, userRepo pg.UserRepository, approvals *ApprovalService) *EventStream {
+	return &EventStream{
+		outboxRepo:   outboxRepo,
+		overtimeRepo: overtimeRepo,
+		userRepo:     userRepo,
+		approvals:    approvals,
+		subs:         make(map[*StreamSubscription]struct{}),
+	}
+}
+
+// StreamSubscription receives the events for one connected client. Events
+// is closed when the subscription ends, including when the client falls
+// too far behind; it should then reconnect with Last-Event-ID.
+type StreamSubscription struct {
+	UserID int64
+	Events chan StreamEvent
+
+	stream *EventStream
+	closed bool
+}
+
+// Close ends the subscription.
+func (sub *StreamSubscription) Close() {
+	sub.stream.mu.Lock()
+	defer sub.stream.mu.Unlock()
+	sub.stream.remove(sub)
+}
+
+// remove must be called with mu held.
+func (s *EventStream) remove(sub *StreamSubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(s.subs, sub)
+	close(sub.Events)
+}
+
+// Subscribe registers a client. With a lastEventID it also returns the
+// events for the user that followed it, so the client can resume. When
+// there are more than the replay limit, the backlog is a single reset event.
+func (s *EventStream) Subscribe(ctx context.Context, userID, lastEventID int64) (*StreamSubscription, []StreamEvent, error) {
+	sub := &StreamSubscription{
+		UserID: userID,
+		Events: make(chan StreamEvent, config.C.Stream.BufferSize),
+		stream: s,
+	}
+	// Register before replaying so nothing committed in between is lost;
+	// the caller drops live events it already got from the backlog.
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+
+	if lastEventID <= 0 {
+		return sub, nil, nil
+	}
+	backlog, err := s.replay(ctx, userID, lastEventID)
+	if err != nil {
+		sub.Close()
+		return nil, nil, ErrInternalServer.Wrap(err)
+	}
+	return sub, backlog, nil
+}
+
+// replay returns the user's events after afterID. The outbox is read in
+// pages and filtered for the user before the replay limit applies; past
+// the limit, or after scanning ReplayScanLimit events, it gives up and
+// returns a reset event at the latest outbox event.
+func (s *EventStream) replay(ctx context.Context, userID, afterID int64) ([]StreamEvent, error) {
+	cfg := config.C.Stream
+	var backlog []StreamEvent
+	scanned := 0
+	for {
+		events, err := s.outboxRepo.GetOutboxEventsAfter(ctx, afterID, cfg.ReplayLimit)
+		if err != nil {
+			return nil, err
+		}
+		for i := range events {
+			afterID = events[i].ID
+			routed, err := s.route(ctx, &events[i])
+			if err != nil {
+				log.Error("EventStream.replay", "failed to route event", err, zap.Int64("event_id", events[i].ID))
+				continue
+			}
+			for _, r := range routed {
+				if r.reaches(userID) {
+					backlog = append(backlog, r.event)
+				}
+			}
+		}
+		if len(events) < cfg.ReplayLimit {
+			if len(backlog) > cfg.ReplayLimit {
+				return s.reset(ctx, "too_many_events")
+			}
+			return backlog, nil
+		}
+		scanned += len(events)
+		if len(backlog) > cfg.ReplayLimit || scanned >= cfg.ReplayScanLimit {
+			return s.reset(ctx, "too_many_events")
+		}
+	}
+}
+
+func (s *EventStream) reset(ctx context.Context, reason string) ([]StreamEvent, error) {
+	latest, err := s.outboxRepo.GetOutboxEvents(ctx, "", 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	var id int64
+	if len(latest) > 0 {
+		id = latest[0].ID
+	}
+	return []StreamEvent{{ID: id, Name: StreamReset, Data: ResetNotice{Reason: reason}}}, nil
+}
+
+// streamTicketAudience marks stream tickets, which are signed with their
+// own key so they are not accepted as bearer tokens.
+const streamTicketAudience = "stream"
+
+// IssueTicket returns a short-lived ticket that opens the event stream for
+// the user. EventSource cannot send headers, so clients put the ticket in
+// the URL instead of their bearer token.
+func (s *EventStream) IssueTicket(userID int64, role string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(config.C.Stream.TicketTTL)
+	ticket, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  userID,
+		"role": role,
+		"aud":  streamTicketAudience,
+		"exp":  expiresAt.Unix(),
+	}).SignedString(ticketKey())
+	if err != nil {
+		return "", time.Time{}, ErrInternalServer.Wrap(err)
+	}
+	return ticket, expiresAt, nil
+}
+
+// VerifyTicket returns the user and role a ticket was issued to.
+func (s *EventStream) VerifyTicket(ticket string) (int64, string, error) {
+	token, err := jwt.Parse(ticket, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return ticketKey(), nil
+	}, jwt.WithAudience(streamTicketAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, "", ErrUnauthorized.Wrap(err)
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	sub, ok := claims["sub"].(float64)
+	role, _ := claims["role"].(string)
+	if !ok || role == "" {
+		return 0, "", ErrUnauthorized.Wrap(errors.New("stream ticket without subject or role"))
+	}
+	return int64(sub), role, nil
+}
+
+func ticketKey() []byte {
+	mac := hmac.New(sha256.New, []byte(config.C.JWT.Secret))
+	mac.Write([]byte("stream-ticket"))
+	return mac.Sum(nil)
+}
+
+// Run listens for new outbox events and dispatches them until ctx is done,
+// reconnecting after failures. It then ends every subscription.
+func (s *EventStream) Run(ctx context.Context) {
+	const op = "EventStream.Run"
+	defer s.closeAll()
+	for {
+		err := s.outboxRepo.ListenOutboxEvents(ctx, func(eventID int64) {
+			s.dispatch(ctx, eventID)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error(op, "outbox listener stopped", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (s *EventStream) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		s.remove(sub)
+	}
+}
+
+func (s *EventStream) dispatch(ctx context.Context, eventID int64) {
+	s.mu.Lock()
+	idle := len(s.subs) == 0
+	s.mu.Unlock()
+	if idle {
+		return
+	}
+
+	event, err := s.outboxRepo.GetOutboxEventByID(ctx, eventID)
+	if err != nil {
+		log.Error("EventStream.dispatch", "failed to load event", err, zap.Int64("event_id", eventID))
+		return
+	}
+	routed, err := s.route(ctx, event)
+	if err != nil {
+		log.Error("EventStream.dispatch", "failed to route event", err, zap.Int64("event_id", eventID))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		for _, r := range routed {
+			if !r.reaches(sub.UserID) {
+				continue
+			}
+			select {
+			case sub.Events <- r.event:
+			default:
+				// Too slow: drop the client rather than the event.
+				s.remove(sub)
+			}
+			if sub.closed {
+				break
+			}
+		}
+	}
+}
+
+// route derives the stream events of an outbox event and who gets them.
+func (s *EventStream) route(ctx context.Context, event *models.OutboxEvent) ([]routedEvent, error) {
+	var out []routedEvent
+	switch event.AggregateType {
+	case "slot":
+		var data SlotEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, err
+		}
+		update, err := s.slotUpdate(ctx, event, data.SlotID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *update)
+
+	case "request":
+		var data RequestEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, err
+		}
+		out = append(out, routedEvent{
+			event:    StreamEvent{ID: event.ID, Name: StreamRequestUpdated, Data: RequestUpdate{Type: event.Type, RequestEvent: data}},
+			audience: map[int64]bool{data.UserID: true},
+		})
+
+		switch event.Type {
+		case models.EventRequestApproved, models.EventRequestWithdrawn, models.EventRequestExpired, models.EventRequestCancelled:
+			// These change how many places are left.
+			update, err := s.slotUpdate(ctx, event, data.SlotID)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, *update)
+		case models.EventRequestCreated, models.EventRequestStepApproved, models.EventRequestPromoted, models.EventRequestEscalated:
+			review, err := s.reviewUpdate(ctx, event, &data)
+			if err != nil {
+				return nil, err
+			}
+			if review != nil {
+				out = append(out, *review)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *EventStream) slotUpdate(ctx context.Context, event *models.OutboxEvent, slotID int64) (*routedEvent, error) {
+	slot, err := s.overtimeRepo.GetSlotByID(ctx, slotID)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := s.overtimeRepo.CountApprovedRequestsForSlot(ctx, slotID)
+	if err != nil {
+		return nil, err
+	}
+	remaining := slot.Capacity - int64(approved)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &routedEvent{
+		event: StreamEvent{ID: event.ID, Name: StreamSlotUpdated, Data: SlotUpdate{
+			SlotID:    slot.ID,
+			Title:     slot.Title,
+			Status:    slot.Status,
+			Capacity:  slot.Capacity,
+			Approved:  approved,
+			Remaining: remaining,
+			Cause:     event.Type,
+		}},
+		all: true,
+	}, nil
+}
+
+// reviewUpdate addresses the reviewers a request is now waiting on, or
+// returns nil when it is not waiting on anyone new.
+func (s *EventStream) reviewUpdate(ctx context.Context, event *models.OutboxEvent, data *RequestEvent) (*routedEvent, error) {
+	request, err := s.overtimeRepo.GetRequestByID(ctx, data.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != models.RequestStatusPending || (data.Step != nil && request.CurrentStep == *data.Step) {
+		return nil, nil
+	}
+	approverIDs, err := pendingApprovers(ctx, s.approvals, s.userRepo, request)
+	if err != nil {
+		return nil, err
+	}
+	audience := make(map[int64]bool, len(approverIDs))
+	for _, id := range approverIDs {
+		audience[id] = true
+	}
+	return &routedEvent{
+		event: StreamEvent{ID: event.ID, Name: StreamReviewPending, Data: ReviewUpdate{
+			Type:      event.Type,
+			RequestID: request.ID,
+			SlotID:    request.SlotID,
+			UserID:    request.UserID,
+		}},
+		audience: audience,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"time"
+)
+
+// EventPublisher writes domain events to the outbox. Call it with the
+// context of the transaction that makes the state change, so the event is
+// stored if and only if the change commits.
+type EventPublisher struct {
+	outboxRepo pg.OutboxRepository
+}
+
+func NewEventPublisher(outboxRepo pg.OutboxRepository) *EventPublisher {
+	return &EventPublisher{outboxRepo: outboxRepo}
+}
+
+func (p *EventPublisher) emit(ctx context.Context, eventType, aggregateType string, aggregateID int64, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.outboxRepo.CreateOutboxEvent(ctx, &models.OutboxEvent{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       payload,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// Event payloads. They carry identifiers and the fields consumers need
+// without exposing whole models.
+
+type SlotEvent struct {
+	SlotID    int64     `json:"slot_id"`
+	Title     string    `json:"title"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Capacity  int64     `json:"capacity"`
+	Status    string    `json:"status"`
+	OldStatus string    `json:"old_status,omitempty"`
+	CreatedBy int64     `json:"created_by"`
+}
+
+type RequestEvent struct {
+	RequestID  int64  `json:"request_id"`
+	UserID     int64  `json:"user_id"`
+	SlotID     int64  `json:"slot_id"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	ActorID    *int64 `json:"actor_id,omitempty"`
+	OnBehalfOf *int64 `json:"on_behalf_of,omitempty"`
+	Step       *int   `json:"step,omitempty"`
+	// EscalatedTo is set on request.escalated.
+	EscalatedTo *int64 `json:"escalated_to,omitempty"`
+	// CommentID is set on request.commented.
+	CommentID *int64 `json:"comment_id,omitempty"`
+}
+
+type UserEvent struct {
+	UserID        int64  `json:"user_id"`
+	PersonnelCode string `json:"personnel_code"`
+	FullName      string `json:"full_name"`
+	TeamID        int64  `json:"team_id"`
+	Role          string `json:"role"`
+}
+
+func slotEvent(slot *models.OvertimeSlot) SlotEvent {
+	return SlotEvent{
+		SlotID:    slot.ID,
+		Title:     slot.Title,
+		StartTime: slot.StartTime,
+		EndTime:   slot.EndTime,
+		Capacity:  slot.Capacity,
+		Status:    slot.Status,
+		CreatedBy: slot.CreatedBy,
+	}
+}
+
+func requestEvent(request *models.OvertimeRequest, actorID *int64) RequestEvent {
+	return RequestEvent{
+		RequestID: request.ID,
+		UserID:    request.UserID,
+		SlotID:    request.SlotID,
+		Status:    request.Status,
+		Reason:    request.DecisionReason,
+		ActorID:   actorID,
+	}
+}
+
+// emitRequestStatus publishes the event that matches the request's current
+// status.
+func (p *EventPublisher) emitRequestStatus(ctx context.Context, request *models.OvertimeRequest, actorID *int64) error {
+	eventType := ""
+	switch request.Status {
+	case models.RequestStatusApproved:
+		eventType = models.EventRequestApproved
+	case models.RequestStatusRejected:
+		eventType = models.EventRequestRejected
+	case models.RequestStatusWaitlisted:
+		eventType = models.EventRequestWaitlisted
+	case models.RequestStatusWithdrawn:
+		eventType = models.EventRequestWithdrawn
+	case models.RequestStatusExpired:
+		eventType = models.EventRequestExpired
+	case models.RequestStatusCancelled:
+		eventType = models.EventRequestCancelled
+	default:
+		return nil
+	}
+	return p.emit(ctx, eventType, "request", request.ID, requestEvent(request, actorID))
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"shiftdony/config"
+	"shiftdony/models"
+	"sort"
+	"time"
+)
+
+// FairnessReport shows how a team's overtime was shared among its members
+// on slots starting in [From, To).
+type FairnessReport struct {
+	TeamID   int64     `json:"team_id"`
+	TeamName string    `json:"team_name"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+
+	Members      int     `json:"members"`
+	OfferedSlots int     `json:"offered_slots"`
+	OfferedHours float64 `json:"offered_hours"` // open to every team member
+	AppliedHours float64 `json:"applied_hours"`
+	// ApprovedHours is the team's total; each member's fair share of it is
+	// FairShare, an equal split.
+	ApprovedHours     float64 `json:"approved_hours"`
+	FairShare         float64 `json:"fair_share"`
+	MeanApprovedHours float64 `json:"mean_approved_hours"`
+	StdDevHours       float64 `json:"stddev_approved_hours"`
+	// The Gini coefficients of the members' hours run from 0, everyone got
+	// the same, to nearly 1, one member got everything.
+	GiniApproved float64 `json:"gini_approved"`
+	GiniApplied  float64 `json:"gini_applied"`
+
+	Shares []MemberShare `json:"shares"` // most approved hours first
+}
+
+// MemberShare is one member's part of a fairness report.
+type MemberShare struct {
+	UserID        int64   `json:"user_id"`
+	PersonnelCode string  `json:"personnel_code"`
+	FullName      string  `json:"full_name"`
+	Applied       int     `json:"applied"`
+	AppliedHours  float64 `json:"applied_hours"`
+	Approved      int     `json:"approved"`
+	ApprovedHours float64 `json:"approved_hours"`
+	// OfferedShare is the part of the offered hours the member worked;
+	// AppliedShare and ApprovedShare are their parts of the team's applied
+	// and approved hours.
+	OfferedShare  float64 `json:"offered_share"`
+	AppliedShare  float64 `json:"applied_share"`
+	ApprovedShare float64 `json:"approved_share"`
+	// Deviation is how many approved hours the member is above, or below,
+	// the team mean; RelativeDeviation is that as a fraction of the mean.
+	Deviation         float64 `json:"deviation"`
+	RelativeDeviation float64 `json:"relative_deviation"`
+}
+
+// fairnessWindow returns window, or the configured one when it is zero.
+func fairnessWindow(window time.Duration) time.Duration {
+	if window <= 0 {
+		return config.C.Fairness.Window
+	}
+	return window
+}
+
+// Fairness reports how the overtime of the last window was shared in the
+// team, the viewer's own team when teamID is 0. A zero window is the
+// configured one.
+func (s *AnalyticsService) Fairness(ctx context.Context, teamID, viewerID int64, window time.Duration) (*FairnessReport, error) {
+	if teamID == 0 {
+		viewer, err := s.userRepo.GetUserByID(ctx, viewerID)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		teamID = viewer.TeamID
+	}
+	team, err := s.teamRepo.GetTeamByID(ctx, teamID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	to := time.Now()
+	from := to.Add(-fairnessWindow(window))
+	members, err := s.analyticsRepo.GetMemberTotals(ctx, team.ID, from, to)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	supply, err := s.analyticsRepo.GetSlotSupply(ctx, from, to)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	report := &FairnessReport{
+		TeamID:       team.ID,
+		TeamName:     team.Name,
+		From:         from,
+		To:           to,
+		Members:      len(members),
+		OfferedSlots: supply.Slots,
+		OfferedHours: round(supply.Hours, 2),
+		Shares:       make([]MemberShare, len(members)),
+	}
+	approved := make([]float64, len(members))
+	applied := make([]float64, len(members))
+	for i, m := range members {
+		approved[i] = m.ApprovedHours
+		applied[i] = m.AppliedHours
+		report.ApprovedHours += m.ApprovedHours
+		report.AppliedHours += m.AppliedHours
+	}
+	var mean float64
+	if len(members) > 0 {
+		mean = report.ApprovedHours / float64(len(members))
+	}
+	var variance float64
+	for i, m := range members {
+		deviation := m.ApprovedHours - mean
+		variance += deviation * deviation
+		report.Shares[i] = MemberShare{
+			UserID:            m.UserID,
+			PersonnelCode:     m.PersonnelCode,
+			FullName:          m.FullName,
+			Applied:           m.Applied,
+			AppliedHours:      round(m.AppliedHours, 2),
+			Approved:          m.Approved,
+			ApprovedHours:     round(m.ApprovedHours, 2),
+			OfferedShare:      ratio(m.ApprovedHours, supply.Hours),
+			AppliedShare:      ratio(m.AppliedHours, report.AppliedHours),
+			ApprovedShare:     ratio(m.ApprovedHours, report.ApprovedHours),
+			Deviation:         round(deviation, 2),
+			RelativeDeviation: ratio(deviation, mean),
+		}
+	}
+	report.ApprovedHours = round(report.ApprovedHours, 2)
+	report.AppliedHours = round(report.AppliedHours, 2)
+	report.FairShare = ratio(1, float64(len(members)))
+	report.MeanApprovedHours = round(mean, 2)
+	if len(members) > 0 {
+		report.StdDevHours = round(math.Sqrt(variance/float64(len(members))), 2)
+	}
+	report.GiniApproved = round(gini(approved), 4)
+	report.GiniApplied = round(gini(applied), 4)
+
+	sort.SliceStable(report.Shares, func(i, j int) bool {
+		return report.Shares[i].ApprovedHours > report.Shares[j].ApprovedHours
+	})
+	return report, nil
+}
+
+// gini returns the Gini coefficient of values, 0 when they are all zero.
+func gini(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var total, weighted float64
+	for i, v := range sorted {
+		total += v
+		weighted += float64(i+1) * v
+	}
+	n := float64(len(sorted))
+	if total == 0 {
+		return 0
+	}
+	return 2*weighted/(n*total) - (n+1)/n
+}
+
+// AnnotateRecentHours sets the approved overtime hours of the fairness
+// window on the applicant of each request, so reviewers can balance who
+// gets overtime.
+func (s *OvertimeService) AnnotateRecentHours(ctx context.Context, requests []models.OvertimeRequest) error {
+	var userIDs []int64
+	seen := make(map[int64]bool)
+	for _, request := range requests {
+		if request.User != nil && !seen[request.User.ID] {
+			seen[request.User.ID] = true
+			userIDs = append(userIDs, request.User.ID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	to := time.Now()
+	hours, err := s.overtimeRepo.GetApprovedHoursByUser(ctx, userIDs, to.Add(-fairnessWindow(0)), to)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	for i := range requests {
+		if user := requests[i].User; user != nil {
+			recent := round(hours[user.ID], 2)
+			user.RecentOvertimeHours = &recent
+		}
+	}
+	return nil
+}
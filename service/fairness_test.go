@@ -0,0 +1,36 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGini(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"no members", nil, 0},
+		{"nobody worked", []float64{0, 0, 0}, 0},
+		{"one member", []float64{12}, 0},
+		{"equal hours", []float64{5, 5, 5, 5}, 0},
+		{"one member has everything", []float64{0, 0, 0, 8}, 0.75},
+		{"two members", []float64{0, 10}, 0.5},
+		{"order does not matter", []float64{3, 1, 2}, 2.0 / 9},
+		{"uneven hours", []float64{1, 2, 3, 4}, 0.25},
+	}
+	for _, tt := range tests {
+		if got := gini(tt.values); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: gini(%v) = %v, want %v", tt.name, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestGiniKeepsValues(t *testing.T) {
+	values := []float64{4, 1, 3}
+	gini(values)
+	if values[0] != 4 || values[1] != 1 || values[2] != 3 {
+		t.Errorf("gini reordered its input to %v", values)
+	}
+}
@@ -0,0 +1,518 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	"shiftdony/ical"
+	"shiftdony/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// dateLayout is how calendar dates are written in the API and queries.
+const dateLayout = "2006-01-02"
+
+// maxHolidaySpan bounds a single holiday entry or imported event.
+const maxHolidaySpan = 366
+
+// HolidayService manages holiday calendars and answers whether a day is a
+// working day for a user.
+type HolidayService struct {
+	holidayRepo pg.HolidayRepository
+	teamRepo    pg.TeamRepository
+	userRepo    pg.UserRepository
+	tx          pg.Transactor
+}
+
+func NewHolidayService(holidayRepo pg.HolidayRepository, teamRepo pg.TeamRepository, userRepo pg.UserRepository, tx pg.Transactor) *HolidayService {
+	return &HolidayService{
+		holidayRepo: holidayRepo,
+		teamRepo:    teamRepo,
+		userRepo:    userRepo,
+		tx:          tx,
+	}
+}
+
+// DayInfo describes one calendar date for a user or slot.
+type DayInfo struct {
+	Date       string          `json:"date"`
+	Weekday    string          `json:"weekday"`
+	CalendarID int64           `json:"calendar_id,omitempty"` // 0 for the built-in fallback
+	Weekend    bool            `json:"weekend"`
+	Holiday    *models.Holiday `json:"holiday,omitempty"`
+}
+
+// Kind returns models.DayHoliday, models.DayWeekend or models.DayWorkday.
+func (d *DayInfo) Kind() string {
+	switch {
+	case d.Holiday != nil:
+		return models.DayHoliday
+	case d.Weekend:
+		return models.DayWeekend
+	default:
+		return models.DayWorkday
+	}
+}
+
+// NonWorking reports whether the day is a weekend or a holiday.
+func (d *DayInfo) NonWorking() bool {
+	return d.Kind() != models.DayWorkday
+}
+
+// Closure reports whether the office is shut on the day.
+func (d *DayInfo) Closure() bool {
+	return d.Holiday != nil && d.Holiday.Closure
+}
+
+// HolidayCalendarUpdate holds the calendar fields to change; nil fields are
+// left alone.
+type HolidayCalendarUpdate struct {
+	Name      *string
+	Timezone  *string
+	Weekend   *[]string
+	IsDefault *bool
+}
+
+// CreateCalendar adds a holiday calendar. A calendar created as default
+// replaces the previous default.
+func (s *HolidayService) CreateCalendar(ctx context.Context, calendar *models.HolidayCalendar) (*models.HolidayCalendar, error) {
+	if calendar.Timezone == "" {
+		calendar.Timezone = config.C.Dates.Timezone
+	}
+	if calendar.Weekend == nil {
+		calendar.Weekend = splitList(config.C.Holidays.Weekend)
+	}
+	if err := normalizeCalendar(calendar); err != nil {
+		return nil, err
+	}
+	calendar.CreatedAt = time.Now()
+
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if calendar.IsDefault {
+			if err := s.holidayRepo.ClearDefaultHolidayCalendar(ctx); err != nil {
+				return err
+			}
+		}
+		return s.holidayRepo.CreateHolidayCalendar(ctx, calendar)
+	})
+	if err != nil {
+		return nil, calendarWriteError(err)
+	}
+	return calendar, nil
+}
+
+// UpdateCalendar changes a holiday calendar.
+func (s *HolidayService) UpdateCalendar(ctx context.Context, calendarID int64, update HolidayCalendarUpdate) (*models.HolidayCalendar, error) {
+	var calendar *models.HolidayCalendar
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		calendar, err = s.holidayRepo.GetHolidayCalendarByID(ctx, calendarID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrHolidayCalendarNotFound
+			}
+			return err
+		}
+		setIf(&calendar.Name, update.Name)
+		setIf(&calendar.Timezone, update.Timezone)
+		setIf(&calendar.Weekend, update.Weekend)
+		if err := normalizeCalendar(calendar); err != nil {
+			return err
+		}
+		if update.IsDefault != nil && *update.IsDefault && !calendar.IsDefault {
+			if err := s.holidayRepo.ClearDefaultHolidayCalendar(ctx); err != nil {
+				return err
+			}
+		}
+		setIf(&calendar.IsDefault, update.IsDefault)
+		return s.holidayRepo.UpdateHolidayCalendar(ctx, calendar)
+	})
+	if err != nil {
+		return nil, calendarWriteError(err)
+	}
+	return calendar, nil
+}
+
+func (s *HolidayService) GetCalendars(ctx context.Context) ([]models.HolidayCalendar, error) {
+	calendars, err := s.holidayRepo.GetHolidayCalendars(ctx)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return calendars, nil
+}
+
+// GetHolidays returns the calendar's holidays between two dates, inclusive.
+func (s *HolidayService) GetHolidays(ctx context.Context, calendarID int64, from, to time.Time) ([]models.Holiday, error) {
+	if _, err := s.calendarByID(ctx, calendarID); err != nil {
+		return nil, err
+	}
+	holidays, err := s.holidayRepo.GetHolidays(ctx, calendarID, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return holidays, nil
+}
+
+// AddHolidays enters a holiday by hand on every date from first to last,
+// replacing what the calendar had on those dates.
+func (s *HolidayService) AddHolidays(ctx context.Context, calendarID int64, name string, first, last time.Time, closure bool) ([]models.Holiday, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrInvalidHoliday
+	}
+	if _, err := s.calendarByID(ctx, calendarID); err != nil {
+		return nil, err
+	}
+	holidays, err := holidayDates(calendarID, name, first, last.AddDate(0, 0, 1), closure, models.HolidaySourceManual)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.holidayRepo.UpsertHolidays(ctx, holidays); err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return holidays, nil
+}
+
+// ImportICS adds every event of an iCalendar file as holidays, on each date
+// it covers in the calendar's time zone. Cancelled events are skipped. It
+// returns how many dates were imported.
+func (s *HolidayService) ImportICS(ctx context.Context, calendarID int64, r io.Reader, closure bool) (int, error) {
+	calendar, err := s.calendarByID(ctx, calendarID)
+	if err != nil {
+		return 0, err
+	}
+	loc := calendar.Location()
+	events, err := ical.Parse(r, loc)
+	if err != nil {
+		return 0, ErrInvalidICS
+	}
+
+	// A date may appear in several events; the last one wins, as one
+	// insert cannot touch the same row twice.
+	byDate := make(map[string]models.Holiday)
+	var order []string
+	for _, event := range events {
+		if event.Cancelled {
+			continue
+		}
+		name := strings.TrimSpace(event.Summary)
+		if name == "" {
+			name = "Holiday"
+		}
+		first, end := event.Start, event.End
+		if !event.AllDay {
+			// Timed events cover every local date they touch.
+			first = localDate(event.Start, loc)
+			end = localDate(event.End.Add(-time.Nanosecond), loc).AddDate(0, 0, 1)
+		}
+		holidays, err := holidayDates(calendarID, name, first, end, closure, models.HolidaySourceICS)
+		if err != nil {
+			return 0, ErrInvalidICS
+		}
+		for _, h := range holidays {
+			key := h.Date.Format(dateLayout)
+			if _, ok := byDate[key]; !ok {
+				order = append(order, key)
+			}
+			byDate[key] = h
+		}
+	}
+
+	holidays := make([]models.Holiday, 0, len(order))
+	for _, key := range order {
+		holidays = append(holidays, byDate[key])
+	}
+	if err := s.holidayRepo.UpsertHolidays(ctx, holidays); err != nil {
+		return 0, ErrInternalServer.Wrap(err)
+	}
+	return len(holidays), nil
+}
+
+func (s *HolidayService) DeleteHoliday(ctx context.Context, calendarID, holidayID int64) error {
+	found, err := s.holidayRepo.DeleteHoliday(ctx, calendarID, holidayID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !found {
+		return ErrHolidayNotFound
+	}
+	return nil
+}
+
+// AssignTeamCalendar sets the team's holiday calendar; nil returns the team
+// to the default calendar.
+func (s *HolidayService) AssignTeamCalendar(ctx context.Context, teamID int64, calendarID *int64) error {
+	if _, err := s.teamRepo.GetTeamByID(ctx, teamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTeamNotFound
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	if calendarID != nil {
+		if _, err := s.calendarByID(ctx, *calendarID); err != nil {
+			return err
+		}
+	}
+	if err := s.teamRepo.UpdateTeamCalendar(ctx, teamID, calendarID); err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+// SetTeamTimezone sets the zone the team's members see times in unless
+// they picked their own; the empty name returns the team to the
+// organization's zone.
+func (s *HolidayService) SetTeamTimezone(ctx context.Context, teamID int64, timezone string) error {
+	if !IsTimezone(timezone) {
+		return ErrInvalidTimezone
+	}
+	if _, err := s.teamRepo.GetTeamByID(ctx, teamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTeamNotFound
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	if err := s.teamRepo.UpdateTeamTimezone(ctx, teamID, timezone); err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+// CheckDay tells whether t falls on a weekend or holiday for the user,
+// according to their team's calendar.
+func (s *HolidayService) CheckDay(ctx context.Context, userID int64, t time.Time) (*DayInfo, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	info, err := newDayLookup(s).forTeam(ctx, user.TeamID, t)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return info, nil
+}
+
+// CheckDefaultDay tells whether t falls on a weekend or holiday of the
+// default calendar, which applies to slots.
+func (s *HolidayService) CheckDefaultDay(ctx context.Context, t time.Time) (*DayInfo, error) {
+	info, err := newDayLookup(s).forDefault(ctx, t)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return info, nil
+}
+
+func (s *HolidayService) calendarByID(ctx context.Context, calendarID int64) (*models.HolidayCalendar, error) {
+	calendar, err := s.holidayRepo.GetHolidayCalendarByID(ctx, calendarID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrHolidayCalendarNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return calendar, nil
+}
+
+// dayLookup answers day questions, caching calendars and holidays so a
+// report does not query them per row.
+type dayLookup struct {
+	s         *HolidayService
+	teams     map[int64]*models.HolidayCalendar
+	def       *models.HolidayCalendar
+	calendars map[int64]*models.HolidayCalendar
+	holidays  map[int64]map[string]*models.Holiday // by calendar, then date
+	years     map[int64]map[int]bool               // years loaded into holidays
+}
+
+func newDayLookup(s *HolidayService) *dayLookup {
+	return &dayLookup{
+		s:         s,
+		teams:     make(map[int64]*models.HolidayCalendar),
+		calendars: make(map[int64]*models.HolidayCalendar),
+		holidays:  make(map[int64]map[string]*models.Holiday),
+		years:     make(map[int64]map[int]bool),
+	}
+}
+
+func (l *dayLookup) forTeam(ctx context.Context, teamID int64, t time.Time) (*DayInfo, error) {
+	calendar, err := l.forTeamCalendar(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return l.day(ctx, calendar, t)
+}
+
+// forTeamCalendar returns the team's holiday calendar, or the default one.
+func (l *dayLookup) forTeamCalendar(ctx context.Context, teamID int64) (*models.HolidayCalendar, error) {
+	calendar, ok := l.teams[teamID]
+	if !ok {
+		team, err := l.s.teamRepo.GetTeamByID(ctx, teamID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil && team.CalendarID != nil {
+			calendar, err = l.calendar(ctx, *team.CalendarID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		l.teams[teamID] = calendar
+	}
+	if calendar == nil {
+		return l.defaultCalendar(ctx)
+	}
+	return calendar, nil
+}
+
+func (l *dayLookup) forDefault(ctx context.Context, t time.Time) (*DayInfo, error) {
+	calendar, err := l.defaultCalendar(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l.day(ctx, calendar, t)
+}
+
+func (l *dayLookup) defaultCalendar(ctx context.Context) (*models.HolidayCalendar, error) {
+	if l.def == nil {
+		calendar, err := l.s.holidayRepo.GetDefaultHolidayCalendar(ctx)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// No calendars set up yet: only the configured weekend counts.
+			calendar = &models.HolidayCalendar{
+				Timezone: config.C.Dates.Timezone,
+				Weekend:  splitList(config.C.Holidays.Weekend),
+			}
+		case err != nil:
+			return nil, err
+		}
+		l.def = calendar
+	}
+	return l.def, nil
+}
+
+func (l *dayLookup) calendar(ctx context.Context, calendarID int64) (*models.HolidayCalendar, error) {
+	if calendar, ok := l.calendars[calendarID]; ok {
+		return calendar, nil
+	}
+	calendar, err := l.s.holidayRepo.GetHolidayCalendarByID(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	l.calendars[calendarID] = calendar
+	return calendar, nil
+}
+
+func (l *dayLookup) day(ctx context.Context, calendar *models.HolidayCalendar, t time.Time) (*DayInfo, error) {
+	local := t.In(calendar.Location())
+	info := &DayInfo{
+		Date:       local.Format(dateLayout),
+		Weekday:    strings.ToLower(local.Weekday().String()),
+		CalendarID: calendar.ID,
+		Weekend:    calendar.IsWeekend(local.Weekday()),
+	}
+	if calendar.ID == 0 {
+		return info, nil
+	}
+
+	// Holidays are loaded a year at a time.
+	byDate, ok := l.holidays[calendar.ID]
+	if !ok {
+		byDate = make(map[string]*models.Holiday)
+		l.holidays[calendar.ID] = byDate
+		l.years[calendar.ID] = make(map[int]bool)
+	}
+	if year := local.Year(); !l.years[calendar.ID][year] {
+		holidays, err := l.s.holidayRepo.GetHolidays(ctx, calendar.ID,
+			time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).Format(dateLayout),
+			time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).Format(dateLayout))
+		if err != nil {
+			return nil, err
+		}
+		for i := range holidays {
+			byDate[holidays[i].Date.Format(dateLayout)] = &holidays[i]
+		}
+		l.years[calendar.ID][year] = true
+	}
+	info.Holiday = byDate[info.Date]
+	return info, nil
+}
+
+// holidayDates returns one holiday per date from first up to end, exclusive.
+func holidayDates(calendarID int64, name string, first, end time.Time, closure bool, source string) ([]models.Holiday, error) {
+	first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC)
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.After(first) || end.Sub(first) > maxHolidaySpan*24*time.Hour {
+		return nil, ErrInvalidHoliday
+	}
+	var holidays []models.Holiday
+	now := time.Now()
+	for d := first; d.Before(end); d = d.AddDate(0, 0, 1) {
+		holidays = append(holidays, models.Holiday{
+			CalendarID: calendarID,
+			Date:       d,
+			Name:       name,
+			Closure:    closure,
+			Source:     source,
+			CreatedAt:  now,
+		})
+	}
+	return holidays, nil
+}
+
+// localDate returns midnight UTC of t's date in loc.
+func localDate(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// normalizeCalendar validates a calendar and lower-cases its weekend days.
+func normalizeCalendar(calendar *models.HolidayCalendar) error {
+	calendar.Name = strings.TrimSpace(calendar.Name)
+	if calendar.Name == "" {
+		return ErrInvalidHolidayCalendar
+	}
+	if _, err := time.LoadLocation(calendar.Timezone); err != nil {
+		return ErrInvalidHolidayCalendar
+	}
+	weekend := make([]string, 0, len(calendar.Weekend))
+	for _, name := range calendar.Weekend {
+		d, ok := models.ParseWeekday(name)
+		if !ok {
+			return ErrInvalidHolidayCalendar
+		}
+		weekend = append(weekend, strings.ToLower(d.String()))
+	}
+	calendar.Weekend = weekend
+	return nil
+}
+
+func calendarWriteError(err error) error {
+	if pgErr, ok := err.(pgdriver.Error); ok && pgErr.IntegrityViolation() {
+		return ErrInvalidHolidayCalendar
+	}
+	switch err {
+	case ErrInvalidHolidayCalendar, ErrHolidayCalendarNotFound:
+		return err
+	}
+	return ErrInternalServer.Wrap(err)
+}
+
+// splitList splits a comma separated config value.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"shiftdony/notify"
+	"strings"
+	"time"
+)
+
+// inboxChannel stores notifications in the user's in-app inbox. It ignores
+// email preferences: the inbox always receives everything.
+type inboxChannel struct {
+	notifyRepo pg.NotificationRepository
+}
+
+// inboxLinks maps message data keys to the keys kept on inbox entries.
+var inboxLinks = map[string]string{
+	"RequestID": "request_id",
+	"SlotID":    "slot_id",
+}
+
+func (c *inboxChannel) Name() string { return "inbox" }
+
+func (c *inboxChannel) Send(ctx context.Context, to notify.Recipient, msg notify.Message) error {
+	// Reset tokens must not outlive the email they were sent in.
+	if msg.Kind == models.NotifyPasswordReset {
+		return notify.ErrSkipped
+	}
+	title, err := notify.RenderText(to.Prefs.Locale, msg.Kind, "subject", msg.Data)
+	if err != nil {
+		return err
+	}
+	body, err := notify.RenderText(to.Prefs.Locale, msg.Kind, "short", msg.Data)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{}
+	for from, key := range inboxLinks {
+		if v, ok := msg.Data[from]; ok {
+			data[key] = v
+		}
+	}
+	return c.notifyRepo.CreateNotification(ctx, &models.Notification{
+		UserID:    to.UserID,
+		Kind:      msg.Kind,
+		Title:     strings.TrimSpace(title),
+		Body:      strings.TrimSpace(body),
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,566 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	"shiftdony/i18n"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"shiftdony/notify"
+	"slices"
+	"time"
+
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/zap"
+)
+
+// notificationConsumer is the outbox consumer name of the notifier.
+const notificationConsumer = "notifications"
+
+type NotificationService struct {
+	notifyRepo   pg.NotificationRepository
+	userRepo     pg.UserRepository
+	overtimeRepo pg.OvertimeRepository
+	outboxRepo   pg.OutboxRepository
+	approvals    *ApprovalService
+	tx           pg.Transactor
+	channels     []notify.Channel
+}
+
+// NewNotificationService returns a notifier that writes to the in-app inbox
+// and to the given extra channels.
+func NewNotificationService(notifyRepo pg.NotificationRepository, userRepo pg.UserRepository, overtimeRepo pg.OvertimeRepository, outboxRepo pg.OutboxRepository, approvals *ApprovalService, tx pg.Transactor, channels ...notify.Channel) *NotificationService {
+	return &NotificationService{
+		notifyRepo:   notifyRepo,
+		userRepo:     userRepo,
+		overtimeRepo: overtimeRepo,
+		outboxRepo:   outboxRepo,
+		approvals:    approvals,
+		tx:           tx,
+		channels:     append([]notify.Channel{&inboxChannel{notifyRepo: notifyRepo}}, channels...),
+	}
+}
+
+// NotificationSettings is what a user sees and edits of their
+// notification setup.
+type NotificationSettings struct {
+	Email string `json:"email"`
+	models.NotificationPreference
+}
+
+// PreferencesUpdate holds the fields to change; nil fields are kept.
+type PreferencesUpdate struct {
+	Email               *string
+	Locale              *string
+	Calendar            *string
+	Timezone            *string
+	EmailEnabled        *bool
+	EmailRequestDecided *bool
+	EmailSlotPublished  *bool
+	EmailReminders      *bool
+	EmailReviewPending  *bool
+	ChatEnabled         *bool
+}
+
+func (s *NotificationService) GetPreferences(ctx context.Context, userID int64) (*NotificationSettings, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	prefs, err := s.preferencesFor(ctx, []int64{userID})
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return &NotificationSettings{Email: user.Email, NotificationPreference: prefs[userID]}, nil
+}
+
+func (s *NotificationService) UpdatePreferences(ctx context.Context, userID int64, in PreferencesUpdate) (*NotificationSettings, error) {
+	if in.Locale != nil && !isSupportedLocale(*in.Locale) {
+		return nil, ErrInvalidLocale
+	}
+	if in.Calendar != nil && !IsCalendar(*in.Calendar) {
+		return nil, ErrInvalidCalendar
+	}
+	if in.Timezone != nil && !IsTimezone(*in.Timezone) {
+		return nil, ErrInvalidTimezone
+	}
+	if in.Email != nil && *in.Email != "" {
+		addr, err := mail.ParseAddress(*in.Email)
+		if err != nil || addr.Name != "" {
+			return nil, ErrInvalidEmail
+		}
+	}
+
+	var settings *NotificationSettings
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		current, err := s.GetPreferences(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if in.Email != nil && *in.Email != current.Email {
+			if *in.Email != "" {
+				taken, err := s.userRepo.EmailInUse(ctx, *in.Email, userID)
+				if err != nil {
+					return err
+				}
+				if taken {
+					return ErrEmailExists
+				}
+			}
+			user, err := s.userRepo.GetUserByID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			user.Email = *in.Email
+			if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+				if pgErr, ok := err.(pgdriver.Error); ok && pgErr.IntegrityViolation() {
+					return ErrEmailExists
+				}
+				return err
+			}
+			current.Email = user.Email
+		}
+
+		pref := &current.NotificationPreference
+		setIf(&pref.Locale, in.Locale)
+		setIf(&pref.Calendar, in.Calendar)
+		setIf(&pref.Timezone, in.Timezone)
+		setIf(&pref.EmailEnabled, in.EmailEnabled)
+		setIf(&pref.EmailRequestDecided, in.EmailRequestDecided)
+		setIf(&pref.EmailSlotPublished, in.EmailSlotPublished)
+		setIf(&pref.EmailReminders, in.EmailReminders)
+		setIf(&pref.EmailReviewPending, in.EmailReviewPending)
+		setIf(&pref.ChatEnabled, in.ChatEnabled)
+		pref.UpdatedAt = time.Now()
+		if err := s.notifyRepo.UpsertPreferences(ctx, pref); err != nil {
+			return err
+		}
+		settings = current
+		return nil
+	})
+	if err != nil {
+		if err == ErrUserNotFound || err == ErrEmailExists {
+			return nil, err
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return settings, nil
+}
+
+// Unsubscribe turns off emails of kind for the owner of token, or every
+// email when kind is empty or unknown.
+func (s *NotificationService) Unsubscribe(ctx context.Context, token, kind string) error {
+	if token == "" {
+		return ErrInvalidUnsubscribe
+	}
+	pref, err := s.notifyRepo.GetPreferencesByToken(ctx, token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidUnsubscribe
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	switch kind {
+	case models.NotifyRequestDecided:
+		pref.EmailRequestDecided = false
+	case models.NotifySlotPublished:
+		pref.EmailSlotPublished = false
+	case models.NotifyReminder:
+		pref.EmailReminders = false
+	case models.NotifyReviewPending:
+		pref.EmailReviewPending = false
+	default:
+		pref.EmailEnabled = false
+	}
+	pref.UpdatedAt = time.Now()
+	if err := s.notifyRepo.UpsertPreferences(ctx, pref); err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+// Inbox is a page of a user's in-app notifications.
+type Inbox struct {
+	UnreadCount   int                   `json:"unread_count"`
+	Notifications []models.Notification `json:"notifications"`
+}
+
+func (s *NotificationService) GetInbox(ctx context.Context, userID int64, unreadOnly bool, beforeID int64, limit int) (*Inbox, error) {
+	notifications, err := s.notifyRepo.GetNotifications(ctx, userID, unreadOnly, beforeID, limit)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	unread, err := s.notifyRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if notifications == nil {
+		notifications = make([]models.Notification, 0)
+	}
+	return &Inbox{UnreadCount: unread, Notifications: notifications}, nil
+}
+
+// MarkRead marks the user's notifications read, or all of them when ids is
+// empty, and returns the remaining unread count.
+func (s *NotificationService) MarkRead(ctx context.Context, userID int64, ids []int64) (int, error) {
+	if _, err := s.notifyRepo.MarkNotificationsRead(ctx, userID, ids, time.Now()); err != nil {
+		return 0, ErrInternalServer.Wrap(err)
+	}
+	unread, err := s.notifyRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return 0, ErrInternalServer.Wrap(err)
+	}
+	return unread, nil
+}
+
+// PruneNotifications deletes inbox entries past their retention.
+func (s *NotificationService) PruneNotifications(ctx context.Context) (int, error) {
+	cfg := config.C.Notify
+	now := time.Now()
+	deleted, err := s.notifyRepo.DeleteNotifications(ctx, now.Add(-cfg.InboxReadRetention), now.Add(-cfg.InboxRetention))
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		log.Gl.Info("Pruned notifications", zap.Int("count", deleted))
+	}
+	return deleted, nil
+}
+
+// Notify sends msg to the users on every channel. Failures are logged and
+// never returned, so callers can fire and forget.
+func (s *NotificationService) Notify(ctx context.Context, userIDs []int64, msg notify.Message) {
+	recipients, err := s.recipients(ctx, userIDs)
+	if err != nil {
+		log.Error("NotificationService.Notify", "failed to load recipients", err, zap.String("kind", msg.Kind))
+		return
+	}
+	for _, to := range recipients {
+		if _, err := s.send(ctx, to, msg, nil); err != nil {
+			log.Error("NotificationService.Notify", "failed to send notification", err,
+				zap.String("kind", msg.Kind),
+				zap.Int64("user_id", to.UserID))
+		}
+	}
+}
+
+// deliver sends msg to one user on the channels not in done, for callers
+// that retry failures. It returns done with the channels that now have the
+// message, or skipped the user, and the errors of the others.
+func (s *NotificationService) deliver(ctx context.Context, userID int64, msg notify.Message, done []string) ([]string, error) {
+	recipients, err := s.recipients(ctx, []int64{userID})
+	if err != nil {
+		return done, err
+	}
+	for _, to := range recipients {
+		done, err = s.send(ctx, to, msg, done)
+	}
+	return done, err
+}
+
+func (s *NotificationService) send(ctx context.Context, to notify.Recipient, msg notify.Message, done []string) ([]string, error) {
+	local := msg.In(to.Location)
+	var errs []error
+	for _, ch := range s.channels {
+		if slices.Contains(done, ch.Name()) {
+			continue
+		}
+		if err := ch.Send(ctx, to, local); err != nil && !errors.Is(err, notify.ErrSkipped) {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+			continue
+		}
+		done = append(done, ch.Name())
+	}
+	return done, errors.Join(errs...)
+}
+
+// ProcessEvents turns new outbox events into notifications. Events are
+// marked consumed before sending, so a notification is sent at most once.
+func (s *NotificationService) ProcessEvents(ctx context.Context) error {
+	cfg := config.C.Notify
+	var events []models.OutboxEvent
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		events, err = s.outboxRepo.GetUnconsumedEvents(ctx, notificationConsumer, cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		ids := make([]int64, len(events))
+		for i := range events {
+			ids[i] = events[i].ID
+		}
+		return s.outboxRepo.MarkEventsConsumed(ctx, notificationConsumer, ids)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range events {
+		userIDs, msg, err := s.messageFor(ctx, &events[i])
+		if err != nil {
+			log.Error("NotificationService.ProcessEvents", "failed to build notification", err, zap.Int64("event_id", events[i].ID))
+			continue
+		}
+		if msg != nil {
+			s.Notify(ctx, userIDs, *msg)
+		}
+	}
+	return nil
+}
+
+// messageFor maps an outbox event to its recipients and message. Events
+// nobody is notified about return a nil message.
+func (s *NotificationService) messageFor(ctx context.Context, event *models.OutboxEvent) ([]int64, *notify.Message, error) {
+	switch event.Type {
+	case models.EventRequestApproved, models.EventRequestRejected, models.EventRequestWaitlisted, models.EventRequestCancelled:
+		var data RequestEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, nil, err
+		}
+		slot, err := s.overtimeRepo.GetSlotByID(ctx, data.SlotID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []int64{data.UserID}, &notify.Message{
+			Kind: models.NotifyRequestDecided,
+			Data: map[string]interface{}{
+				"RequestID": data.RequestID,
+				"SlotID":    data.SlotID,
+				"Status":    data.Status,
+				"Reason":    data.Reason,
+				"SlotTitle": slot.Title,
+				"StartTime": slot.StartTime,
+				"EndTime":   slot.EndTime,
+			},
+		}, nil
+
+	case models.EventRequestCreated, models.EventRequestStepApproved, models.EventRequestPromoted, models.EventRequestEscalated:
+		var data RequestEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, nil, err
+		}
+		return s.reviewPendingMessage(ctx, &data)
+
+	case models.EventPasswordResetRequested:
+		var data UserEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, nil, err
+		}
+		return s.passwordResetMessage(ctx, data.UserID)
+
+	case models.EventSlotCreated, models.EventSlotStatusChanged:
+		var data SlotEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return nil, nil, err
+		}
+		if data.Status != models.SlotStatusOpen || data.OldStatus == models.SlotStatusFull {
+			return nil, nil, nil
+		}
+		users, err := s.userRepo.GetUsersByRole(ctx, models.RoleUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids := make([]int64, len(users))
+		for i := range users {
+			ids[i] = users[i].ID
+		}
+		return ids, &notify.Message{
+			Kind: models.NotifySlotPublished,
+			Data: map[string]interface{}{
+				"SlotID":    data.SlotID,
+				"SlotTitle": data.Title,
+				"StartTime": data.StartTime,
+				"EndTime":   data.EndTime,
+				"Capacity":  data.Capacity,
+			},
+		}, nil
+	}
+	return nil, nil, nil
+}
+
+// reviewPendingMessage notifies the approvers of the step a request is
+// waiting on.
+func (s *NotificationService) reviewPendingMessage(ctx context.Context, data *RequestEvent) ([]int64, *notify.Message, error) {
+	request, err := s.overtimeRepo.GetRequestByID(ctx, data.RequestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.Status != models.RequestStatusPending {
+		return nil, nil, nil
+	}
+	// A step approval only matters once the request moved to the next step;
+	// before that it is still waiting on the same approvers.
+	if data.Step != nil && request.CurrentStep == *data.Step {
+		return nil, nil, nil
+	}
+
+	approverIDs, err := pendingApprovers(ctx, s.approvals, s.userRepo, request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requester, err := s.userRepo.GetUserByID(ctx, request.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	slot, err := s.overtimeRepo.GetSlotByID(ctx, request.SlotID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return approverIDs, &notify.Message{
+		Kind: models.NotifyReviewPending,
+		Data: map[string]interface{}{
+			"RequestID":     request.ID,
+			"SlotID":        slot.ID,
+			"RequesterName": requester.FullName,
+			"SlotTitle":     slot.Title,
+			"StartTime":     slot.StartTime,
+			"EndTime":       slot.EndTime,
+		},
+	}, nil
+}
+
+// passwordResetMessage creates a reset token for the user and sends it.
+// Only the token's hash is stored.
+func (s *NotificationService) passwordResetMessage(ctx context.Context, userID int64) ([]int64, *notify.Message, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	reset := &models.PasswordReset{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(config.C.Notify.PasswordResetTTL),
+		CreatedAt: now,
+	}
+	if err := s.notifyRepo.CreatePasswordReset(ctx, reset); err != nil {
+		return nil, nil, err
+	}
+	return []int64{userID}, &notify.Message{
+		Kind: models.NotifyPasswordReset,
+		Data: map[string]interface{}{
+			"Token":     token,
+			"ExpiresAt": reset.ExpiresAt,
+		},
+	}, nil
+}
+
+func (s *NotificationService) recipients(ctx context.Context, userIDs []int64) ([]notify.Recipient, error) {
+	users, err := s.userRepo.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.preferencesFor(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]notify.Recipient, len(users))
+	for i := range users {
+		u := &users[i]
+		pref := prefs[u.ID]
+		out[i] = notify.Recipient{
+			UserID:   u.ID,
+			FullName: u.FullName,
+			Email:    u.Email,
+			Prefs:    pref,
+			Location: userLocation(u, &pref),
+		}
+	}
+	return out, nil
+}
+
+// preferencesFor returns the preferences of the users, creating default
+// rows (and so unsubscribe tokens) for users who have none yet.
+func (s *NotificationService) preferencesFor(ctx context.Context, userIDs []int64) (map[int64]models.NotificationPreference, error) {
+	prefs, err := s.notifyRepo.GetPreferences(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	var missing []models.NotificationPreference
+	for _, id := range userIDs {
+		if _, ok := prefs[id]; ok {
+			continue
+		}
+		pref := DefaultPreferences(id)
+		if pref.UnsubscribeToken, err = randomToken(); err != nil {
+			return nil, err
+		}
+		missing = append(missing, pref)
+	}
+	if len(missing) == 0 {
+		return prefs, nil
+	}
+	if err := s.notifyRepo.CreateMissingPreferences(ctx, missing); err != nil {
+		return nil, err
+	}
+	return s.notifyRepo.GetPreferences(ctx, userIDs)
+}
+
+// DefaultPreferences returns the preferences of a new user in the
+// configured default locale.
+func DefaultPreferences(userID int64) models.NotificationPreference {
+	pref := models.DefaultNotificationPreference(userID)
+	if isSupportedLocale(config.C.Notify.DefaultLocale) {
+		pref.Locale = config.C.Notify.DefaultLocale
+	}
+	if IsCalendar(config.C.Dates.DefaultCalendar) {
+		pref.Calendar = config.C.Dates.DefaultCalendar
+	}
+	pref.UpdatedAt = time.Now()
+	return pref
+}
+
+// Viewer returns the preferences of the user, for their locale and
+// calendar, and the time zone they read dates in.
+func (s *NotificationService) Viewer(ctx context.Context, userID int64) (*models.NotificationPreference, *time.Location, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefs, err := s.preferencesFor(ctx, []int64{userID})
+	if err != nil {
+		return nil, nil, err
+	}
+	pref := prefs[userID]
+	return &pref, userLocation(user, &pref), nil
+}
+
+// IsCalendar reports whether name is a calendar dates can be shown in.
+func IsCalendar(name string) bool {
+	return name == models.CalendarGregorian || name == models.CalendarJalali
+}
+
+func isSupportedLocale(locale string) bool {
+	for _, l := range i18n.Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func setIf[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
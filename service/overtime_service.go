@@ -2,29 +2,60 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shiftdony/config"
 	pg "shiftdony/database"
+	log "shiftdony/logs"
 	"shiftdony/models"
+	"strings"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 type OvertimeService struct {
 	overtimeRepo pg.OvertimeRepository
+	userRepo     pg.UserRepository
+	teamRepo     pg.TeamRepository
+	approvals    *ApprovalService
+	delegations  *DelegationService
+	holidays     *HolidayService
+	events       *EventPublisher
+	tx           pg.Transactor
 }
 
-func NewOvertimeService(overtimeRepo pg.OvertimeRepository) *OvertimeService {
-	return &OvertimeService{overtimeRepo: overtimeRepo}
+func NewOvertimeService(overtimeRepo pg.OvertimeRepository, userRepo pg.UserRepository, teamRepo pg.TeamRepository, approvals *ApprovalService, delegations *DelegationService, holidays *HolidayService, events *EventPublisher, tx pg.Transactor) *OvertimeService {
+	return &OvertimeService{
+		overtimeRepo: overtimeRepo,
+		userRepo:     userRepo,
+		teamRepo:     teamRepo,
+		approvals:    approvals,
+		delegations:  delegations,
+		holidays:     holidays,
+		events:       events,
+		tx:           tx,
+	}
 }
 
 func (s *OvertimeService) CreateRequest(ctx context.Context, userID, slotID int64) (*models.OvertimeRequest, error) {
 	//Check if slot is open
 	slot, err := s.overtimeRepo.GetOvertimeSlotByID(ctx, slotID)
 	if err != nil {
-		return nil, ErrSlotNotFound
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSlotNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	//Check the application window
+	if !slot.AcceptsApplicationsAt(time.Now()) {
+		return nil, ErrApplicationWindowClosed
 	}
 	//Check for duplicate
 	exists, err := s.overtimeRepo.UserHasPendingRequestForSlot(ctx, userID, slotID)
 	if err != nil {
-		return nil, ErrRequestNotFound
+		return nil, ErrInternalServer.Wrap(err)
 	}
 	if exists {
 		return nil, ErrAlreadyApplied
@@ -33,110 +64,472 @@ func (s *OvertimeService) CreateRequest(ctx context.Context, userID, slotID int6
 	//Check capacity
 	approvedCount, err := s.overtimeRepo.CountApprovedRequestsForSlot(ctx, slotID)
 	if err != nil {
-		return nil, ErrInternalServer
+		return nil, ErrInternalServer.Wrap(err)
 	}
 	if approvedCount >= int(slot.Capacity) {
 		slot.Status = "full"
 		s.overtimeRepo.UpdateOvertimeSlot(ctx, slot)
 		return nil, ErrSlotIsFull
 	}
+	//Pick the approval chain
+	chainID, err := s.approvals.chainForSlot(ctx, slot)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
 	//new Req
 	newRequest := &models.OvertimeRequest{
 		UserID:      userID,
 		SlotID:      slotID,
-		Status:      "pending",
+		Status:      models.RequestStatusPending,
 		RequestTime: time.Now(),
+		ChainID:     chainID,
 	}
-	if err := s.overtimeRepo.CreateOvertimeRequest(ctx, newRequest); err != nil {
-		return nil, ErrInternalServer
+	err = s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := s.overtimeRepo.CreateOvertimeRequest(ctx, newRequest); err != nil {
+			return err
+		}
+		return s.events.emit(ctx, models.EventRequestCreated, "request", newRequest.ID, requestEvent(newRequest, &userID))
+	})
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
 	}
 
 	return newRequest, nil
 }
 
-func (s *OvertimeService) GetMyRequests(ctx context.Context, userID int64) ([]models.OvertimeRequest, error) {
-	return s.overtimeRepo.GetMyOvertimeRequests(ctx, userID)
+// ListRequests returns a page of the requests matching filter.
+func (s *OvertimeService) ListRequests(ctx context.Context, filter models.RequestFilter, opts models.ListOptions) ([]models.OvertimeRequest, *models.PageInfo, error) {
+	requests, info, err := s.overtimeRepo.ListOvertimeRequests(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, ErrInternalServer.Wrap(err)
+	}
+	return requests, info, nil
 }
 
-func (s *OvertimeService) GetAllRequests(ctx context.Context) ([]models.OvertimeRequest, error) {
-	return s.overtimeRepo.GetAllOvertimeRequests(ctx)
+// ListReviewRequests returns a page of the requests matching filter that
+// reviewerID may review. Managers and department heads see every request;
+// delegates only those of the teams their delegations cover.
+func (s *OvertimeService) ListReviewRequests(ctx context.Context, reviewerID int64, filter models.RequestFilter, opts models.ListOptions) ([]models.OvertimeRequest, *models.PageInfo, error) {
+	reviewer, err := s.userRepo.GetUserByID(ctx, reviewerID)
+	if err != nil {
+		return nil, nil, ErrInternalServer.Wrap(err)
+	}
+	if reviewer.Role != models.RoleManager && reviewer.Role != models.RoleDepartmentHead {
+		teamIDs, all, err := s.delegations.coveredTeams(ctx, reviewer.ID)
+		if err != nil {
+			return nil, nil, ErrInternalServer.Wrap(err)
+		}
+		if !all {
+			filter.TeamIDs = teamIDs
+		}
+	}
+	return s.ListRequests(ctx, filter, opts)
 }
 
 func (s *OvertimeService) GetAvailableSlots(ctx context.Context) ([]models.OvertimeSlot, error) {
 	return s.overtimeRepo.GetAvailableOvertimeSlots(ctx)
 }
 
-func (s *OvertimeService) UpdateRequestStatus(ctx context.Context, requestID, managerID int64, status string) error {
-	request, err := s.overtimeRepo.GetOvertimeRequestByID(ctx, requestID)
-	if err != nil {
-		return ErrRequestNotFound
-	}
+// UpdateRequestStatus records a reviewer's decision on the current approval
+// step of a request. A rejection on any step rejects the request; the request
+// is only approved, and only counts toward the slot capacity, once the final
+// step passes.
+func (s *OvertimeService) UpdateRequestStatus(ctx context.Context, requestID, managerID int64, status, reason, comment string) error {
+	_, err := s.reviewRequest(ctx, requestID, managerID, status, reason, comment)
+	return err
+}
 
-	request.Status = status
-	request.ReviewedBy = &managerID
-	if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, request); err != nil {
-		return ErrInternalServer
+// reviewRequest is UpdateRequestStatus returning the status of the request
+// after the decision, which stays pending while later steps remain.
+func (s *OvertimeService) reviewRequest(ctx context.Context, requestID, managerID int64, status, reason, comment string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" && reasonRequired(status) {
+		return "", ErrReasonRequired
 	}
 
-	if status == "approved" {
-		slot, err := s.overtimeRepo.GetOvertimeSlotByID(ctx, request.SlotID)
+	var result string
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		request, err := s.overtimeRepo.GetOvertimeRequestByID(ctx, requestID)
 		if err != nil {
-			return ErrInternalServer
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRequestNotFound
+			}
+			return ErrInternalServer.Wrap(err)
+		}
+		if request.Status != models.RequestStatusPending {
+			return ErrRequestAlreadyDecided
 		}
 
-		approvedCount, err := s.overtimeRepo.CountApprovedRequestsForSlot(ctx, request.SlotID)
+		reviewer, err := s.userRepo.GetUserByID(ctx, managerID)
 		if err != nil {
-			return ErrInternalServer
+			return ErrInternalServer.Wrap(err)
+		}
+
+		chain, err := s.approvals.chainForRequest(ctx, request)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if request.CurrentStep >= len(chain.Steps) {
+			return ErrInternalServer.Wrap(fmt.Errorf("request %d step %d beyond chain %d", request.ID, request.CurrentStep, chain.ID))
+		}
+		onBehalfOf, err := s.actingFor(ctx, request, chain.Steps[request.CurrentStep], reviewer)
+		if err != nil {
+			return err
+		}
+
+		decidedStep := request.CurrentStep
+		if err := s.decideStep(ctx, request, chain, reviewer, onBehalfOf, status, reason, comment); err != nil {
+			return err
+		}
+
+		if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, request); err != nil {
+			return ErrInternalServer.Wrap(err)
 		}
+		result = request.Status
 
-		if approvedCount >= int(slot.Capacity) {
-			slot.Status = "full"
-			if err := s.overtimeRepo.UpdateOvertimeSlot(ctx, slot); err != nil {
-				return ErrInternalServer
+		event := requestEvent(request, &managerID)
+		event.OnBehalfOf = onBehalfOf
+		event.Reason = reason
+		eventType := ""
+		switch request.Status {
+		case models.RequestStatusApproved:
+			eventType = models.EventRequestApproved
+		case models.RequestStatusRejected:
+			eventType = models.EventRequestRejected
+		default:
+			if status != models.RequestStatusApproved {
+				return nil
 			}
+			eventType = models.EventRequestStepApproved
+			event.Step = &decidedStep
+		}
+		if err := s.events.emit(ctx, eventType, "request", request.ID, event); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if request.Status == models.RequestStatusRejected {
+			return s.releaseHeldPlace(ctx, request)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// decideStep records reviewer's decision on the current step of request,
+// taken on behalf of onBehalfOf, and moves the request along chain: a
+// rejection rejects it, and an approval completing the last step approves
+// it. The caller saves the request.
+func (s *OvertimeService) decideStep(ctx context.Context, request *models.OvertimeRequest, chain *models.ApprovalChain, reviewer *models.User, onBehalfOf *int64, status, reason, comment string) error {
+	step := chain.Steps[request.CurrentStep]
+	stepDone, err := s.approvals.recordDecision(ctx, request, step, reviewer, onBehalfOf, status, reason, comment)
+	if err != nil {
+		if err == ErrAlreadyReviewed {
+			return err
 		}
+		return ErrInternalServer.Wrap(err)
+	}
+
+	if reason != "" || status == models.RequestStatusRejected {
+		request.DecisionReason = reason
 	}
 
+	switch {
+	case status == models.RequestStatusRejected:
+		request.Status = models.RequestStatusRejected
+		request.ReviewedBy = &reviewer.ID
+		decidedAt := time.Now()
+		request.DecidedAt = &decidedAt
+	case !stepDone:
+		// Waiting for more parallel approvals on this step.
+	case request.CurrentStep+1 < len(chain.Steps):
+		request.CurrentStep++
+	default:
+		return s.approveFinal(ctx, request, reviewer.ID)
+	}
 	return nil
 }
 
-func (s *OvertimeService) CreateSlot(ctx context.Context, title string, startTime, endTime time.Time, capacity int, creatorID int64) (*models.OvertimeSlot, error) {
-	newSlot := &models.OvertimeSlot{
-		Title:     title,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Capacity:  int64(capacity),
-		CreatedBy: creatorID,
-		Status:    "open",
+// reasonRequired reports whether the configuration makes a reason mandatory
+// for status.
+func reasonRequired(status string) bool {
+	switch status {
+	case models.RequestStatusRejected:
+		return config.C.Review.RequireRejectionReason
+	case models.RequestStatusApproved:
+		return config.C.Review.RequireApprovalReason
+	}
+	return false
+}
+
+// actingFor works out under whose authority reviewer may decide step. It
+// returns nil when reviewers act for themselves, the delegating manager when
+// they hold a delegation, or the step approver when the request was escalated
+// to them. An escalation target acts for themselves when nobody holds the
+// step's role above the applicant. Nobody may decide their own request.
+func (s *OvertimeService) actingFor(ctx context.Context, request *models.OvertimeRequest, step models.ApprovalStep, reviewer *models.User) (*int64, error) {
+	if reviewer.ID == request.UserID {
+		return nil, ErrSelfReview
+	}
+	if canApprove(step, reviewer) {
+		return nil, nil
 	}
 
-	err := s.overtimeRepo.CreateOvertimeSlot(ctx, newSlot)
+	applicant, err := s.userRepo.GetUserByID(ctx, request.UserID)
 	if err != nil {
-		return nil, ErrInternalServer
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	delegators, err := s.delegations.delegatorsFor(ctx, reviewer.ID, applicant.TeamID)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	for i := range delegators {
+		if canApprove(step, &delegators[i]) {
+			return &delegators[i].ID, nil
+		}
 	}
 
-	return newSlot, nil
+	if request.EscalatedTo != nil && *request.EscalatedTo == reviewer.ID {
+		approverID, err := s.stepApprover(ctx, step, applicant)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		if approverID == 0 || approverID == reviewer.ID {
+			return nil, nil
+		}
+		return &approverID, nil
+	}
+	return nil, ErrNotAnApprover
+}
+
+// stepApprover returns the user who would normally decide step for
+// applicant: its named approver, or the nearest manager up the applicant's
+// team hierarchy holding its role. It returns 0 when there is none.
+func (s *OvertimeService) stepApprover(ctx context.Context, step models.ApprovalStep, applicant *models.User) (int64, error) {
+	if step.ApproverUserID != nil {
+		return *step.ApproverUserID, nil
+	}
+	seen := make(map[int64]bool)
+	for teamID := applicant.TeamID; teamID != 0 && !seen[teamID]; {
+		seen[teamID] = true
+		team, err := s.teamRepo.GetTeamByID(ctx, teamID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		if team.ManagerID != 0 && team.ManagerID != applicant.ID {
+			manager, err := s.userRepo.GetUserByID(ctx, team.ManagerID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return 0, err
+			}
+			if err == nil && manager.Role == step.ApproverRole {
+				return manager.ID, nil
+			}
+		}
+		if team.ParentID == nil {
+			break
+		}
+		teamID = *team.ParentID
+	}
+	return 0, nil
 }
 
-func (s *OvertimeService) GetApprovedRequests(ctx context.Context) ([]models.OvertimeRequest, error) {
-	requests, err := s.overtimeRepo.GetApprovedRequests(ctx)
+// EscalateStaleRequests moves every request that has been pending longer
+// than sla one manager up the team hierarchy. It returns how many requests
+// were escalated.
+func (s *OvertimeService) EscalateStaleRequests(ctx context.Context, sla time.Duration) (int, error) {
+	at := time.Now()
+	requests, err := s.overtimeRepo.GetStalePendingRequests(ctx, at.Add(-sla))
 	if err != nil {
-		return nil, ErrInternalServer
+		return 0, err
 	}
 
+	escalated := 0
 	for i := range requests {
-		if requests[i].User != nil {
-			requests[i].User.PasswordHash = ""
+		stale := &requests[i]
+		if stale.User == nil {
+			continue
+		}
+		// A reviewer may have decided the request since it was listed, so it
+		// is locked and checked again before only its escalation is saved.
+		var request *models.OvertimeRequest
+		var managerID int64
+		err = s.tx.RunInTx(ctx, func(ctx context.Context) error {
+			request, err = s.overtimeRepo.GetOvertimeRequestByID(ctx, stale.ID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					request = nil
+					return nil
+				}
+				return err
+			}
+			if request.Status != models.RequestStatusPending {
+				request = nil
+				return nil
+			}
+			managerID, err = s.managerAbove(ctx, stale.User.TeamID, request.EscalationLevel+1)
+			if err != nil {
+				return err
+			}
+			request.EscalatedAt = &at
+			if managerID != 0 {
+				request.EscalatedTo = &managerID
+				request.EscalationLevel++
+			}
+			// Requests already at the top of the hierarchy only have their
+			// clock reset, so they are not picked up again on every run.
+			saved, err := s.overtimeRepo.EscalateOvertimeRequest(ctx, request)
+			if err != nil {
+				return err
+			}
+			if !saved {
+				request = nil
+				return nil
+			}
+			if managerID == 0 {
+				return nil
+			}
+			event := requestEvent(request, nil)
+			event.EscalatedTo = &managerID
+			return s.events.emit(ctx, models.EventRequestEscalated, "request", request.ID, event)
+		})
+		if err != nil {
+			return escalated, err
+		}
+		if request != nil && managerID != 0 {
+			escalated++
+			log.Gl.Info("Escalated pending overtime request",
+				zap.Int64("request_id", request.ID),
+				zap.Int64("escalated_to", managerID),
+				zap.Int("level", request.EscalationLevel))
+		}
+	}
+	return escalated, nil
+}
+
+// managerAbove returns the manager levels steps above teamID in the team
+// hierarchy, or 0 when the hierarchy ends first.
+func (s *OvertimeService) managerAbove(ctx context.Context, teamID int64, levels int) (int64, error) {
+	for i := 0; i < levels; i++ {
+		team, err := s.teamRepo.GetTeamByID(ctx, teamID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, nil
+			}
+			return 0, err
+		}
+		if team.ParentID == nil {
+			return 0, nil
+		}
+		teamID = *team.ParentID
+	}
+	team, err := s.teamRepo.GetTeamByID(ctx, teamID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return team.ManagerID, nil
+}
+
+// approveFinal marks request approved after its last step, making sure the
+// slot still has room, and closes the slot when it becomes full.
+func (s *OvertimeService) approveFinal(ctx context.Context, request *models.OvertimeRequest, managerID int64) error {
+	slot, err := s.overtimeRepo.LockOvertimeSlot(ctx, request.SlotID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+
+	approvedCount, err := s.overtimeRepo.CountApprovedRequestsForSlot(ctx, request.SlotID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if approvedCount >= int(slot.Capacity) {
+		return ErrSlotIsFull
+	}
+
+	request.Status = models.RequestStatusApproved
+	request.ReviewedBy = &managerID
+	decidedAt := time.Now()
+	request.DecidedAt = &decidedAt
+
+	if approvedCount+1 >= int(slot.Capacity) {
+		slot.Status = models.SlotStatusFull
+		if err := s.overtimeRepo.UpdateOvertimeSlot(ctx, slot); err != nil {
+			return ErrInternalServer.Wrap(err)
 		}
 	}
+	return nil
+}
 
-	return requests, nil
+// CreateSlot stores a new slot created by newSlot.CreatedBy. It is open
+// right away unless its application window opens later. Slots touching a
+// weekend or holiday of the default calendar are marked as holiday slots;
+// slots touching a closure day are refused.
+func (s *OvertimeService) CreateSlot(ctx context.Context, newSlot *models.OvertimeSlot) (*models.OvertimeSlot, error) {
+	if newSlot.AllocationStrategy == "" {
+		newSlot.AllocationStrategy = models.AllocationManual
+	}
+	if !IsAllocationStrategy(newSlot.AllocationStrategy) {
+		return nil, ErrInvalidAllocationStrategy
+	}
+	if newSlot.Capacity < 1 {
+		return nil, ErrInvalidCapacity
+	}
+	if !newSlot.EndTime.After(newSlot.StartTime) || newSlot.StartTime.Before(time.Now()) {
+		return nil, ErrInvalidSlotWindow
+	}
+	if max := config.C.Slots.MaxDuration; max > 0 && newSlot.EndTime.Sub(newSlot.StartTime) > max {
+		return nil, ErrInvalidSlotWindow
+	}
+	opens := time.Now()
+	if newSlot.ApplicationOpensAt != nil {
+		opens = *newSlot.ApplicationOpensAt
+	}
+	if !newSlot.ClosesAt().After(opens) || newSlot.ClosesAt().After(newSlot.StartTime) || newSlot.CutoffAt().After(newSlot.StartTime) {
+		return nil, ErrInvalidSlotWindow
+	}
+
+	for _, t := range []time.Time{newSlot.StartTime, newSlot.EndTime.Add(-time.Nanosecond)} {
+		day, err := s.holidays.CheckDefaultDay(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if day.Closure() {
+			return nil, ErrSlotOnClosureDay
+		}
+		if day.NonWorking() {
+			newSlot.IsHoliday = true
+		}
+	}
+
+	newSlot.Status = models.SlotStatusOpen
+	if opens.After(time.Now()) {
+		newSlot.Status = models.SlotStatusScheduled
+	}
+
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := s.overtimeRepo.CreateOvertimeSlot(ctx, newSlot); err != nil {
+			return err
+		}
+		return s.events.emit(ctx, models.EventSlotCreated, "slot", newSlot.ID, slotEvent(newSlot))
+	})
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	return newSlot, nil
 }
 
-func (s *OvertimeService) GetOvertimeSlots(ctx context.Context) ([]models.OvertimeSlot, error) {
-	slots, err := s.overtimeRepo.GetOvertimeSlots(ctx)
+// ListSlots returns a page of the slots matching filter.
+func (s *OvertimeService) ListSlots(ctx context.Context, filter models.SlotFilter, opts models.ListOptions) ([]models.OvertimeSlot, *models.PageInfo, error) {
+	slots, info, err := s.overtimeRepo.ListOvertimeSlots(ctx, filter, opts)
 	if err != nil {
-		return nil, ErrInternalServer
+		return nil, nil, ErrInternalServer.Wrap(err)
 	}
-	return slots, nil
+	return slots, info, nil
 }
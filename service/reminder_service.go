@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"shiftdony/notify"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reminderConsumer is the outbox consumer name of the reminder scheduler.
+const reminderConsumer = "reminders"
+
+// ReminderService reminds approved applicants before their slot starts.
+// Reminders are scheduled and cancelled from outbox events in the same
+// transaction that consumes them, and claimed atomically when due, so
+// replicas running the job never send the same one together.
+type ReminderService struct {
+	reminderRepo  pg.ReminderRepository
+	overtimeRepo  pg.OvertimeRepository
+	outboxRepo    pg.OutboxRepository
+	notifications *NotificationService
+	events        *EventPublisher
+	tx            pg.Transactor
+	offsets       []time.Duration
+	backfilled    bool
+}
+
+func NewReminderService(reminderRepo pg.ReminderRepository, overtimeRepo pg.OvertimeRepository, outboxRepo pg.OutboxRepository, notifications *NotificationService, events *EventPublisher, tx pg.Transactor) (*ReminderService, error) {
+	offsets, err := ParseReminderOffsets(config.C.Reminders.Offsets)
+	if err != nil {
+		return nil, err
+	}
+	return &ReminderService{
+		reminderRepo:  reminderRepo,
+		overtimeRepo:  overtimeRepo,
+		outboxRepo:    outboxRepo,
+		notifications: notifications,
+		events:        events,
+		tx:            tx,
+		offsets:       offsets,
+	}, nil
+}
+
+// ParseReminderOffsets parses a comma separated list of durations such as
+// "24h,1h".
+func ParseReminderOffsets(s string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil || d <= 0 || d%time.Minute != 0 {
+			return nil, fmt.Errorf("invalid reminder offset %q: must be a positive whole number of minutes", part)
+		}
+		offsets = append(offsets, d)
+	}
+	return offsets, nil
+}
+
+// Process schedules and cancels reminders from new events, then sends the
+// ones that are due. The first run also schedules the reminders of
+// requests approved before reminders were sent.
+func (s *ReminderService) Process(ctx context.Context) error {
+	if !s.backfilled {
+		if err := s.backfill(ctx); err != nil {
+			return err
+		}
+		s.backfilled = true
+	}
+	if err := s.scheduleFromEvents(ctx); err != nil {
+		return err
+	}
+	_, err := s.SendDue(ctx)
+	return err
+}
+
+// backfill schedules the reminders of approved requests on upcoming slots
+// that have none. Scheduling is idempotent, so it is safe to repeat.
+func (s *ReminderService) backfill(ctx context.Context) error {
+	now := time.Now()
+	requests, err := s.reminderRepo.GetUnremindedRequests(ctx, now)
+	if err != nil {
+		return err
+	}
+	var reminders []models.Reminder
+	for i := range requests {
+		reminders = append(reminders, s.remindersFor(&requests[i], requests[i].Slot, now)...)
+	}
+	if err := s.reminderRepo.ScheduleReminders(ctx, reminders); err != nil {
+		return err
+	}
+	if len(reminders) > 0 {
+		log.Gl.Info("Backfilled reminders", zap.Int("requests", len(requests)), zap.Int("reminders", len(reminders)))
+	}
+	return nil
+}
+
+// remindersFor returns the reminders of an approved request that are still
+// ahead.
+func (s *ReminderService) remindersFor(request *models.OvertimeRequest, slot *models.OvertimeSlot, now time.Time) []models.Reminder {
+	var reminders []models.Reminder
+	for _, offset := range s.offsets {
+		due := slot.StartTime.Add(-offset)
+		// Approved too late for this one.
+		if !due.After(now) {
+			continue
+		}
+		reminders = append(reminders, models.Reminder{
+			RequestID:     request.ID,
+			SlotID:        slot.ID,
+			UserID:        request.UserID,
+			OffsetMinutes: int(offset / time.Minute),
+			DueAt:         due,
+			Status:        models.ReminderScheduled,
+			CreatedAt:     now,
+		})
+	}
+	return reminders
+}
+
+func (s *ReminderService) scheduleFromEvents(ctx context.Context) error {
+	return s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		events, err := s.outboxRepo.GetUnconsumedEvents(ctx, reminderConsumer, config.C.Reminders.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		ids := make([]int64, len(events))
+		for i := range events {
+			ids[i] = events[i].ID
+			if err := s.apply(ctx, &events[i]); err != nil {
+				return err
+			}
+		}
+		return s.outboxRepo.MarkEventsConsumed(ctx, reminderConsumer, ids)
+	})
+}
+
+// apply updates the reminders affected by one event.
+func (s *ReminderService) apply(ctx context.Context, event *models.OutboxEvent) error {
+	switch event.Type {
+	case models.EventRequestApproved:
+		var data RequestEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return err
+		}
+		slot, err := s.overtimeRepo.GetSlotByID(ctx, data.SlotID)
+		if err != nil {
+			return err
+		}
+		if slot.Status == models.SlotStatusCancelled {
+			return nil
+		}
+		request := &models.OvertimeRequest{ID: data.RequestID, UserID: data.UserID}
+		return s.reminderRepo.ScheduleReminders(ctx, s.remindersFor(request, slot, time.Now()))
+
+	case models.EventRequestWithdrawn, models.EventRequestExpired, models.EventRequestRejected, models.EventRequestCancelled:
+		var data RequestEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return err
+		}
+		return s.reminderRepo.CancelRequestReminders(ctx, data.RequestID)
+
+	case models.EventSlotStatusChanged:
+		var data SlotEvent
+		if err := json.Unmarshal(event.Payload, &data); err != nil {
+			return err
+		}
+		if data.Status == models.SlotStatusCancelled {
+			return s.reminderRepo.CancelSlotReminders(ctx, data.SlotID)
+		}
+	}
+	return nil
+}
+
+// SendDue sends the reminders that are due and returns how many went out.
+// A reminder that fails on some channel is retried on the channels that
+// do not have it yet, until MaxAttempts or its slot starts.
+func (s *ReminderService) SendDue(ctx context.Context) (int, error) {
+	cfg := config.C.Reminders
+	type due struct {
+		reminder models.Reminder
+		slot     *models.OvertimeSlot
+	}
+	var send []due
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		claimed, err := s.reminderRepo.ClaimDueReminders(ctx, now, now.Add(-cfg.ClaimTimeout), cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		for _, r := range claimed {
+			// The scheduling events may still be on their way; check the
+			// current state before reminding.
+			request, err := s.overtimeRepo.GetOvertimeRequestByID(ctx, r.RequestID)
+			if err != nil {
+				return err
+			}
+			slot, err := s.overtimeRepo.GetSlotByID(ctx, r.SlotID)
+			if err != nil {
+				return err
+			}
+			if request.Status != models.RequestStatusApproved || slot.Status == models.SlotStatusCancelled {
+				r.Status = models.ReminderCancelled
+				r.ClaimedAt = nil
+				if err := s.reminderRepo.UpdateReminder(ctx, &r); err != nil {
+					return err
+				}
+				continue
+			}
+			if r.Attempts == 1 {
+				event := requestEvent(request, nil)
+				if err := s.events.emit(ctx, models.EventRequestReminded, "request", request.ID, event); err != nil {
+					return err
+				}
+			}
+			send = append(send, due{reminder: r, slot: slot})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range send {
+		r, slot := &send[i].reminder, send[i].slot
+		delivered, err := s.notifications.deliver(ctx, r.UserID, notify.Message{
+			Kind: models.NotifyReminder,
+			Data: map[string]interface{}{
+				"RequestID": r.RequestID,
+				"SlotID":    slot.ID,
+				"SlotTitle": slot.Title,
+				"StartTime": slot.StartTime,
+				"EndTime":   slot.EndTime,
+			},
+		}, r.Delivered)
+		now := time.Now()
+		r.Delivered = delivered
+		r.ClaimedAt = nil
+		switch {
+		case err == nil:
+			r.Status = models.ReminderSent
+			r.SentAt = &now
+			r.RetryAt = nil
+			r.LastError = ""
+			sent++
+		case r.Attempts >= cfg.MaxAttempts || !now.Before(slot.StartTime):
+			r.Status = models.ReminderFailed
+			r.LastError = err.Error()
+			log.Error("ReminderService.SendDue", "giving up on reminder", err, zap.Int64("reminder_id", r.ID))
+		default:
+			retryAt := now.Add(cfg.RetryBackoff << (r.Attempts - 1))
+			r.Status = models.ReminderScheduled
+			r.RetryAt = &retryAt
+			r.LastError = err.Error()
+			log.Error("ReminderService.SendDue", "failed to send reminder", err,
+				zap.Int64("reminder_id", r.ID), zap.Int("attempt", r.Attempts))
+		}
+		// A lost update leaves the claim to expire, and the reminder is
+		// then tried again.
+		if err := s.reminderRepo.UpdateReminder(ctx, r); err != nil {
+			log.Error("ReminderService.SendDue", "failed to record reminder delivery", err, zap.Int64("reminder_id", r.ID))
+		}
+	}
+	if sent > 0 {
+		log.Gl.Info("Sent reminders", zap.Int("count", sent))
+	}
+	return sent, nil
+}
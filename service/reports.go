@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"shiftdony/jalali"
+	"shiftdony/models"
+	"sort"
+	"time"
+)
+
+// PeriodTotal sums one user's approved overtime in one monthly pay period.
+type PeriodTotal struct {
+	Period        string    `json:"period"` // YYYY-MM in the report's calendar
+	PeriodStart   time.Time `json:"period_start"`
+	UserID        int64     `json:"user_id"`
+	PersonnelCode string    `json:"personnel_code"`
+	FullName      string    `json:"full_name"`
+	TeamID        int64     `json:"team_id"`
+	Requests      int       `json:"requests"`
+	Hours         float64   `json:"hours"`
+	// HolidayHours are the hours falling on weekends and holidays of the
+	// user's holiday calendar; a slot running into a holiday counts only
+	// the hours past midnight.
+	HolidayHours float64 `json:"holiday_hours"`
+}
+
+// MonthlyTotals groups approved overtime on slots starting in [from, to) by
+// user and by month of the given calendar, Gregorian or Jalali. Months
+// follow the organization time zone. A zero from or to is unbounded.
+func (s *OvertimeService) MonthlyTotals(ctx context.Context, calendar string, from, to time.Time) ([]PeriodTotal, error) {
+	loc := OrgLocation()
+	lookup := newDayLookup(s.holidays)
+	def, err := lookup.defaultCalendar(ctx)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	parts, err := s.overtimeRepo.GetApprovedDayParts(ctx, from, to, loc.String(), def.Location().String())
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	type key struct {
+		period string
+		userID int64
+	}
+	totals := make(map[key]*PeriodTotal)
+	for i := range parts {
+		part := &parts[i]
+		day, err := time.ParseInLocation(dateLayout, part.Day, loc)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		period, start := monthOf(calendar, day)
+		k := key{period: period, userID: part.UserID}
+		total, ok := totals[k]
+		if !ok {
+			total = &PeriodTotal{
+				Period:        period,
+				PeriodStart:   start,
+				UserID:        part.UserID,
+				PersonnelCode: part.PersonnelCode,
+				FullName:      part.FullName,
+				TeamID:        part.TeamID,
+			}
+			totals[k] = total
+		}
+		total.Requests += part.Requests
+		total.Hours += part.Hours
+
+		holidays := def
+		if part.CalendarID != 0 {
+			if holidays, err = lookup.calendar(ctx, part.CalendarID); err != nil {
+				return nil, ErrInternalServer.Wrap(err)
+			}
+		}
+		info, err := lookup.day(ctx, holidays, part.PartStart)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		if info.NonWorking() {
+			total.HolidayHours += part.Hours
+		}
+	}
+
+	out := make([]PeriodTotal, 0, len(totals))
+	for _, total := range totals {
+		out = append(out, *total)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].PeriodStart.Equal(out[j].PeriodStart) {
+			return out[i].PeriodStart.Before(out[j].PeriodStart)
+		}
+		return out[i].PersonnelCode < out[j].PersonnelCode
+	})
+	return out, nil
+}
+
+// ReportRow is one request of a streamed report.
+type ReportRow struct {
+	Request *models.OvertimeRequest // User or Slot is nil if it was deleted
+	Hours   float64                 // length of the slot
+	DayKind string                  // kind of the slot's first day for the applicant
+}
+
+// EachReportRow streams the requests matching filter in the order of opts
+// to fn, one row at a time, so a report of any length is built in constant
+// memory. The row is reused, so fn must not keep it. An error from fn stops
+// the report and is returned as is.
+func (s *OvertimeService) EachReportRow(ctx context.Context, filter models.RequestFilter, opts models.ListOptions, fn func(*ReportRow) error) error {
+	lookup := newDayLookup(s.holidays)
+	var fnErr error
+	var row ReportRow
+	err := s.overtimeRepo.EachOvertimeRequest(ctx, filter, opts, func(request *models.OvertimeRequest) error {
+		row = ReportRow{Request: request}
+		if request.Slot != nil {
+			row.Hours = request.Slot.Hours()
+			if request.User != nil {
+				info, err := lookup.forTeam(ctx, request.User.TeamID, request.Slot.StartTime)
+				if err != nil {
+					return err
+				}
+				row.DayKind = info.Kind()
+			}
+		}
+		fnErr = fn(&row)
+		return fnErr
+	})
+	if err != nil {
+		if fnErr != nil {
+			return fnErr
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+// ReportTeams returns the teams a report on filter covers, by name: the
+// team of the filter, or every team.
+func (s *OvertimeService) ReportTeams(ctx context.Context, filter models.RequestFilter) ([]models.Team, error) {
+	if filter.TeamID != 0 {
+		team, err := s.teamRepo.GetTeamByID(ctx, filter.TeamID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrTeamNotFound
+			}
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		return []models.Team{*team}, nil
+	}
+	teams, err := s.teamRepo.GetTeams(ctx)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return teams, nil
+}
+
+// monthOf returns the YYYY-MM label and first instant of t's month in the
+// calendar, in t's location.
+func monthOf(calendar string, t time.Time) (string, time.Time) {
+	if calendar == models.CalendarJalali {
+		d := jalali.FromTime(t)
+		start := jalali.Date{Year: d.Year, Month: d.Month, Day: 1}.Time(0, 0, 0, 0, t.Location())
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month), start
+	}
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return start.Format("2006-01"), start
+}
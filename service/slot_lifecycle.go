@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithdrawRequest lets an applicant take back a pending, waitlisted or
+// approved request before the slot's cancellation cutoff. A place freed by
+// an approved request or an allocation winner goes to the first waitlisted
+// request, or reopens the slot.
+func (s *OvertimeService) WithdrawRequest(ctx context.Context, requestID, userID int64) error {
+	return s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		request, err := s.overtimeRepo.GetOvertimeRequestByID(ctx, requestID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRequestNotFound
+			}
+			return ErrInternalServer.Wrap(err)
+		}
+		if request.UserID != userID {
+			return ErrRequestNotFound
+		}
+		switch request.Status {
+		case models.RequestStatusPending, models.RequestStatusWaitlisted, models.RequestStatusApproved:
+		default:
+			return ErrCannotWithdraw
+		}
+
+		slot, err := s.overtimeRepo.LockOvertimeSlot(ctx, request.SlotID)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		at := time.Now()
+		if at.After(slot.CutoffAt()) {
+			return ErrCancellationCutoffPassed
+		}
+
+		freesPlace := request.Status == models.RequestStatusApproved ||
+			request.Status == models.RequestStatusPending && heldPlace(slot, request)
+		request.Status = models.RequestStatusWithdrawn
+		request.WaitlistPosition = 0
+		if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, request); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if err := s.events.emitRequestStatus(ctx, request, &userID); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if !freesPlace {
+			return nil
+		}
+		return s.fillFreedPlace(ctx, slot, at)
+	})
+}
+
+// heldPlace reports whether request, pending until now, was chosen for a
+// place on slot by an allocation run. Runs decide every pending request, so
+// those made before the last run and still pending are its winners waiting
+// on later approval steps.
+func heldPlace(slot *models.OvertimeSlot, request *models.OvertimeRequest) bool {
+	return slot.AllocatedAt != nil && request.RequestTime.Before(*slot.AllocatedAt)
+}
+
+// releaseHeldPlace hands the place of an allocation winner rejected on a
+// later step to the first waitlisted request, see heldPlace.
+func (s *OvertimeService) releaseHeldPlace(ctx context.Context, request *models.OvertimeRequest) error {
+	slot, err := s.overtimeRepo.LockOvertimeSlot(ctx, request.SlotID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !heldPlace(slot, request) {
+		return nil
+	}
+	return s.fillFreedPlace(ctx, slot, time.Now())
+}
+
+// fillFreedPlace hands a place freed on slot to the first waitlisted request,
+// which goes through its approval chain like an allocation winner with the
+// slot's creator as approver. Without a waitlist a full slot accepts
+// applications again.
+func (s *OvertimeService) fillFreedPlace(ctx context.Context, slot *models.OvertimeSlot, at time.Time) error {
+	next, err := s.overtimeRepo.GetFirstWaitlistedRequest(ctx, slot.ID)
+	if err == nil {
+		step, err := s.approveChosen(ctx, next, slot.CreatedBy, "promoted from the waitlist after a place was freed")
+		if err != nil {
+			return err
+		}
+		if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, next); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if next.Status == models.RequestStatusPending && step == nil {
+			err = s.events.emit(ctx, models.EventRequestPromoted, "request", next.ID, requestEvent(next, nil))
+		} else {
+			err = s.emitChosen(ctx, next, step, nil)
+		}
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return ErrInternalServer.Wrap(err)
+	}
+
+	if slot.Status == models.SlotStatusFull && slot.AcceptsApplicationsAt(at) {
+		if err := s.overtimeRepo.UpdateSlotStatus(ctx, slot.ID, models.SlotStatusOpen); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// CancelSlot calls off a slot that has not started yet. Requests still
+// waiting on a decision are rejected with reason and approved ones are
+// cancelled; their reminders are cancelled by the events this publishes.
+func (s *OvertimeService) CancelSlot(ctx context.Context, slotID int64, reason string, managerID *int64) error {
+	return s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		slot, err := s.overtimeRepo.LockOvertimeSlot(ctx, slotID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSlotNotFound
+			}
+			return ErrInternalServer.Wrap(err)
+		}
+		switch slot.Status {
+		case models.SlotStatusInProgress, models.SlotStatusCompleted, models.SlotStatusCancelled:
+			return ErrCannotCancelSlot
+		}
+
+		event := slotEvent(slot)
+		event.OldStatus, event.Status = slot.Status, models.SlotStatusCancelled
+		if err := s.overtimeRepo.UpdateSlotStatus(ctx, slot.ID, models.SlotStatusCancelled); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if err := s.events.emit(ctx, models.EventSlotStatusChanged, "slot", slot.ID, event); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+
+		// Undecided requests are rejected; approved ones are cancelled, so
+		// they stop counting as approved hours.
+		affected, err := s.overtimeRepo.GetRequestsForSlot(ctx, slot.ID, models.RequestStatusPending, models.RequestStatusWaitlisted, models.RequestStatusApproved)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if reason == "" {
+			reason = "the slot was cancelled"
+		}
+		now := time.Now()
+		for i := range affected {
+			request := &affected[i]
+			if request.Status == models.RequestStatusApproved {
+				request.Status = models.RequestStatusCancelled
+			} else {
+				request.Status = models.RequestStatusRejected
+				request.ReviewedBy = managerID
+				request.DecidedAt = &now
+			}
+			request.WaitlistPosition = 0
+			request.DecisionReason = reason
+			if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, request); err != nil {
+				return ErrInternalServer.Wrap(err)
+			}
+			if err := s.events.emitRequestStatus(ctx, request, managerID); err != nil {
+				return ErrInternalServer.Wrap(err)
+			}
+		}
+		return nil
+	})
+}
+
+// RecordAttendance records whether the applicant of an approved request
+// turned up for its slot, once the slot has started. It may be corrected
+// later.
+func (s *OvertimeService) RecordAttendance(ctx context.Context, requestID int64, attendance string) (*models.OvertimeRequest, error) {
+	var request *models.OvertimeRequest
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		request, err = s.overtimeRepo.GetOvertimeRequestByID(ctx, requestID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrRequestNotFound
+			}
+			return ErrInternalServer.Wrap(err)
+		}
+		if request.Status != models.RequestStatusApproved {
+			return ErrCannotRecordAttendance
+		}
+		slot, err := s.overtimeRepo.GetSlotByID(ctx, request.SlotID)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if time.Now().Before(slot.StartTime) {
+			return ErrCannotRecordAttendance
+		}
+		request.Attendance = attendance
+		if err := s.overtimeRepo.UpdateOvertimeRequest(ctx, request); err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// nextSlotStatus returns the status slot should have at t according to its
+// application window and shift times.
+func nextSlotStatus(slot *models.OvertimeSlot, t time.Time) string {
+	switch {
+	case !t.Before(slot.EndTime):
+		return models.SlotStatusCompleted
+	case !t.Before(slot.StartTime):
+		return models.SlotStatusInProgress
+	case !t.Before(slot.ClosesAt()):
+		return models.SlotStatusClosed
+	case slot.ApplicationOpensAt != nil && t.Before(*slot.ApplicationOpensAt):
+		return models.SlotStatusScheduled
+	case slot.Status == models.SlotStatusFull:
+		return models.SlotStatusFull
+	default:
+		return models.SlotStatusOpen
+	}
+}
+
+// AdvanceSlotStatuses moves every active slot along
+// scheduled → open → closed → in_progress → completed based on the wall
+// clock. Slots with an automatic allocation strategy are allocated as their
+// application window closes. It returns how many slots changed status.
+func (s *OvertimeService) AdvanceSlotStatuses(ctx context.Context) (int, error) {
+	slots, err := s.overtimeRepo.GetActiveSlots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	at := time.Now()
+	changed := 0
+	for i := range slots {
+		slot := &slots[i]
+		status := nextSlotStatus(slot, at)
+
+		// Allocate once applications are closed, whatever the slot moves on
+		// to in this run.
+		if status != models.SlotStatusOpen && status != models.SlotStatusScheduled && status != models.SlotStatusFull &&
+			slot.AllocationStrategy != models.AllocationManual && slot.AllocatedAt == nil {
+			if _, err := s.AllocateSlot(ctx, slot.ID, "", nil); err != nil {
+				log.Gl.Error("Failed to allocate slot", zap.Int64("slot_id", slot.ID), zap.Error(err))
+			}
+		}
+
+		if status == slot.Status {
+			continue
+		}
+		event := slotEvent(slot)
+		event.OldStatus, event.Status = slot.Status, status
+		err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+			if err := s.overtimeRepo.UpdateSlotStatus(ctx, slot.ID, status); err != nil {
+				return err
+			}
+			return s.events.emit(ctx, models.EventSlotStatusChanged, "slot", slot.ID, event)
+		})
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// ExpireStalePendingRequests expires requests that were still pending or
+// waitlisted when their slot started.
+func (s *OvertimeService) ExpireStalePendingRequests(ctx context.Context) (int, error) {
+	var expired []models.OvertimeRequest
+	err := s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		expired, err = s.overtimeRepo.ExpirePendingRequests(ctx, time.Now(), "expired: the slot started before the request was decided")
+		if err != nil {
+			return err
+		}
+		for i := range expired {
+			if err := s.events.emitRequestStatus(ctx, &expired[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(expired), err
+}
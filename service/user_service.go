@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"net/mail"
 	"shiftdony/config"
 	postgres "shiftdony/database"
 	"shiftdony/models"
@@ -14,17 +17,32 @@ import (
 )
 
 type UserService struct {
-	userRepo postgres.UserRepository
+	userRepo      postgres.UserRepository
+	notifyRepo    postgres.NotificationRepository
+	events        *EventPublisher
+	tx            postgres.Transactor
 }
 
-func NewUserService(userRepo postgres.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(userRepo postgres.UserRepository, notifyRepo postgres.NotificationRepository, events *EventPublisher, tx postgres.Transactor) *UserService {
+	return &UserService{userRepo: userRepo, notifyRepo: notifyRepo, events: events, tx: tx}
 }
 
-func (s *UserService) Register(ctx context.Context, personnelCode, fullName, password string, teamID int64) error {
+func (s *UserService) Register(ctx context.Context, personnelCode, fullName, password, email string, teamID int64) error {
+	if email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Name != "" {
+			return ErrInvalidEmail
+		}
+		taken, err := s.userRepo.EmailInUse(ctx, email, 0)
+		if err != nil {
+			return ErrInternalServer.Wrap(err)
+		}
+		if taken {
+			return ErrEmailExists
+		}
+	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return ErrInternalServer
+		return ErrInternalServer.Wrap(err)
 	}
 	newUser := models.User{
 		PersonnelCode: personnelCode,
@@ -33,12 +51,29 @@ func (s *UserService) Register(ctx context.Context, personnelCode, fullName, pas
 		Role: "user",
 		TeamID: teamID,
 		WorkHours: "9-17",
+		Email: email,
 	}
-	if err := s.userRepo.CreateUser(ctx, &newUser); err != nil {
+	err = s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.CreateUser(ctx, &newUser); err != nil {
+			return err
+		}
+		return s.events.emit(ctx, models.EventUserRegistered, "user", newUser.ID, UserEvent{
+			UserID:        newUser.ID,
+			PersonnelCode: newUser.PersonnelCode,
+			FullName:      newUser.FullName,
+			TeamID:        newUser.TeamID,
+			Role:          newUser.Role,
+		})
+	})
+	if err != nil {
 		if pgErr, ok := err.(pgdriver.Error); ok && pgErr.IntegrityViolation() {
+			// Another registration took the email since it was checked.
+			if pgErr.Field('n') == "users_email_idx" {
+				return ErrEmailExists
+			}
 			return ErrPersonnelCodeExists
 		}
-		return ErrInternalServer
+		return ErrInternalServer.Wrap(err)
 	}
 	return nil
 }
@@ -66,7 +101,7 @@ func (s *UserService) Login(ctx context.Context, personnelCode, password string)
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) 
     tokenString, err := token.SignedString([]byte(config.C.JWT.Secret))
     if err != nil {
-        return "", ErrInternalServer
+        return "", ErrInternalServer.Wrap(err)
     }
 
     return tokenString, nil
@@ -79,8 +114,72 @@ func (s *UserService) GetProfile(ctx context.Context, userID int64) (*models.Use
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
 		}
-		return nil, ErrInternalServer
+		return nil, ErrInternalServer.Wrap(err)
 	}
 	user.PasswordHash = ""
 	return user, nil
-}
\ No newline at end of file
+}
+
+// ForgotPassword emails a reset token to the user with personnelCode. It
+// reports success for unknown users too, so it cannot be used to probe
+// accounts. The notifier creates the token and sends it when it picks up
+// the event, so the raw token is never stored.
+func (s *UserService) ForgotPassword(ctx context.Context, personnelCode string) error {
+	user, err := s.userRepo.GetUserByPersonnelCode(ctx, personnelCode)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	if user.Email == "" {
+		return nil
+	}
+	if err := s.events.emit(ctx, models.EventPasswordResetRequested, "user", user.ID, UserEvent{UserID: user.ID}); err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	err = s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		reset, err := s.notifyRepo.GetPasswordResetByHash(ctx, hashToken(token))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		now := time.Now()
+		if reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+		user, err := s.userRepo.GetUserByID(ctx, reset.UserID)
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = string(hashedPassword)
+		if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+			return err
+		}
+		reset.UsedAt = &now
+		return s.notifyRepo.UpdatePasswordReset(ctx, reset)
+	})
+	if err != nil {
+		if err == ErrInvalidResetToken {
+			return err
+		}
+		return ErrInternalServer.Wrap(err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
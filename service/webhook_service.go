@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	log "shiftdony/logs"
+	"shiftdony/models"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// webhookConsumer is the outbox consumer name of the webhook fan-out.
+const webhookConsumer = "webhooks"
+
+type WebhookService struct {
+	webhookRepo pg.WebhookRepository
+	outboxRepo  pg.OutboxRepository
+	tx          pg.Transactor
+	client      *http.Client
+}
+
+func NewWebhookService(webhookRepo pg.WebhookRepository, outboxRepo pg.OutboxRepository, tx pg.Transactor) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		outboxRepo:  outboxRepo,
+		tx:          tx,
+		client:      &http.Client{Timeout: config.C.Webhooks.Timeout},
+	}
+}
+
+// WebhookEnvelope is the JSON body POSTed to subscribers.
+type WebhookEnvelope struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Subscribe registers a webhook endpoint. When secret is empty a random one
+// is generated; it is returned once so the subscriber can verify signatures.
+func (s *WebhookService) Subscribe(ctx context.Context, rawURL, secret string, eventTypes []string, createdBy int64) (*models.WebhookSubscription, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", ErrInvalidWebhookURL
+	}
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", ErrInternalServer.Wrap(err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	sub := &models.WebhookSubscription{
+		URL:        rawURL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, sub); err != nil {
+		return nil, "", ErrInternalServer.Wrap(err)
+	}
+	return sub, secret, nil
+}
+
+func (s *WebhookService) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	subs, err := s.webhookRepo.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return subs, nil
+}
+
+// UpdateSubscription changes the active flag and, when eventTypes is not
+// nil, the event filter of a subscription.
+func (s *WebhookService) UpdateSubscription(ctx context.Context, subID int64, active *bool, eventTypes []string) (*models.WebhookSubscription, error) {
+	sub, err := s.webhookRepo.GetSubscriptionByID(ctx, subID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	if active != nil {
+		sub.Active = *active
+	}
+	if eventTypes != nil {
+		sub.EventTypes = eventTypes
+	}
+	if err := s.webhookRepo.UpdateSubscription(ctx, sub); err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return sub, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, subID int64) error {
+	ok, err := s.webhookRepo.DeleteSubscription(ctx, subID)
+	if err != nil {
+		return ErrInternalServer.Wrap(err)
+	}
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *WebhookService) GetEvents(ctx context.Context, eventType string, beforeID int64, limit int) ([]models.OutboxEvent, error) {
+	events, err := s.outboxRepo.GetOutboxEvents(ctx, eventType, beforeID, limit)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return events, nil
+}
+
+// GetDeliveries lists deliveries, for example the dead letters with status
+// 'dead'.
+func (s *WebhookService) GetDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	deliveries, err := s.webhookRepo.GetDeliveries(ctx, status, limit)
+	if err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+// RetryDelivery puts a dead or failing delivery back in the queue with a
+// fresh attempt budget.
+func (s *WebhookService) RetryDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	delivery, err := s.webhookRepo.GetDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := s.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return delivery, nil
+}
+
+// ReplayEvent queues an event again for one subscription, or for every
+// active subscription that wants it when subID is zero.
+func (s *WebhookService) ReplayEvent(ctx context.Context, eventID, subID int64) ([]models.WebhookDelivery, error) {
+	event, err := s.outboxRepo.GetOutboxEventByID(ctx, eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEventNotFound
+		}
+		return nil, ErrInternalServer.Wrap(err)
+	}
+
+	var subs []models.WebhookSubscription
+	if subID != 0 {
+		sub, err := s.webhookRepo.GetSubscriptionByID(ctx, subID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrWebhookNotFound
+			}
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		subs = append(subs, *sub)
+	} else {
+		all, err := s.webhookRepo.GetSubscriptions(ctx)
+		if err != nil {
+			return nil, ErrInternalServer.Wrap(err)
+		}
+		for _, sub := range all {
+			if sub.Active && sub.Wants(event.Type) {
+				subs = append(subs, sub)
+			}
+		}
+	}
+
+	deliveries := newDeliveries(event, subs, time.Now())
+	if err := s.webhookRepo.CreateDeliveries(ctx, deliveries); err != nil {
+		return nil, ErrInternalServer.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+// Dispatch fans new outbox events out to the subscriptions and sends every
+// delivery that is due.
+func (s *WebhookService) Dispatch(ctx context.Context) error {
+	if err := s.fanOut(ctx); err != nil {
+		return err
+	}
+	return s.deliverDue(ctx)
+}
+
+// fanOut creates a delivery per new event and interested subscription, and
+// marks the events consumed in the same transaction.
+func (s *WebhookService) fanOut(ctx context.Context) error {
+	cfg := config.C.Webhooks
+	return s.tx.RunInTx(ctx, func(ctx context.Context) error {
+		events, err := s.outboxRepo.GetUnconsumedEvents(ctx, webhookConsumer, cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		all, err := s.webhookRepo.GetSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+
+		var deliveries []models.WebhookDelivery
+		ids := make([]int64, len(events))
+		at := time.Now()
+		for i := range events {
+			ids[i] = events[i].ID
+			var subs []models.WebhookSubscription
+			for _, sub := range all {
+				if sub.Active && sub.Wants(events[i].Type) {
+					subs = append(subs, sub)
+				}
+			}
+			deliveries = append(deliveries, newDeliveries(&events[i], subs, at)...)
+		}
+		if err := s.webhookRepo.CreateDeliveries(ctx, deliveries); err != nil {
+			return err
+		}
+		return s.outboxRepo.MarkEventsConsumed(ctx, webhookConsumer, ids)
+	})
+}
+
+func newDeliveries(event *models.OutboxEvent, subs []models.WebhookSubscription, at time.Time) []models.WebhookDelivery {
+	deliveries := make([]models.WebhookDelivery, 0, len(subs))
+	for _, sub := range subs {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  at,
+			CreatedAt:      at,
+		})
+	}
+	return deliveries
+}
+
+func (s *WebhookService) deliverDue(ctx context.Context) error {
+	cfg := config.C.Webhooks
+	deliveries, err := s.webhookRepo.GetDueDeliveries(ctx, time.Now(), cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		d := &deliveries[i]
+		statusCode, sendErr := s.send(ctx, d)
+		d.Attempts++
+		d.LastStatusCode = statusCode
+		if sendErr == nil {
+			at := time.Now()
+			d.Status = models.DeliveryDelivered
+			d.DeliveredAt = &at
+			d.LastError = ""
+		} else {
+			d.LastError = sendErr.Error()
+			if d.Attempts >= cfg.MaxAttempts {
+				d.Status = models.DeliveryDead
+				log.Gl.Warn("Webhook delivery moved to dead letters",
+					zap.Int64("delivery_id", d.ID), zap.Int64("event_id", d.EventID), zap.Error(sendErr))
+			} else {
+				d.NextAttemptAt = time.Now().Add(webhookBackoff(d.Attempts))
+			}
+		}
+		d.Subscription, d.Event = nil, nil
+		if err := s.webhookRepo.UpdateDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookBackoff doubles the wait after every failed attempt, up to the
+// configured maximum.
+func webhookBackoff(attempts int) time.Duration {
+	cfg := config.C.Webhooks
+	wait := cfg.BaseBackoff
+	for i := 1; i < attempts && wait < cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > cfg.MaxBackoff {
+		wait = cfg.MaxBackoff
+	}
+	return wait
+}
+
+// send POSTs a delivery. Subscribers verify the X-Shiftdoni-Signature header,
+// which is "sha256=" followed by the hex HMAC-SHA256 of
+// "<X-Shiftdoni-Timestamp>.<body>" keyed with the subscription secret.
+func (s *WebhookService) send(ctx context.Context, d *models.WebhookDelivery) (int, error) {
+	if d.Subscription == nil || d.Event == nil {
+		return 0, errors.New("subscription or event no longer exists")
+	}
+	body, err := json.Marshal(WebhookEnvelope{
+		ID:         d.Event.ID,
+		Type:       d.Event.Type,
+		OccurredAt: d.Event.CreatedAt,
+		Data:       d.Event.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shiftdoni-webhooks/1")
+	req.Header.Set("X-Shiftdoni-Event", d.Event.Type)
+	req.Header.Set("X-Shiftdoni-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Shiftdoni-Timestamp", timestamp)
+	req.Header.Set("X-Shiftdoni-Signature", "sha256="+SignWebhook(d.Subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 signature of a webhook body.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"shiftdony/config"
+	pg "shiftdony/database"
+	"shiftdony/models"
+	"time"
+)
+
+// OrgLocation returns the organization time zone, or UTC when the
+// configured one is unknown.
+func OrgLocation() *time.Location {
+	loc, err := time.LoadLocation(config.C.Dates.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsTimezone reports whether name is an IANA time zone a user or team can
+// pick. The empty name, meaning "inherit", is accepted too.
+func IsTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// userLocation returns the zone a user sees times in: their own choice,
+// else their team's, else the organization's. user.Team may be nil.
+func userLocation(user *models.User, pref *models.NotificationPreference) *time.Location {
+	if pref != nil && pref.Timezone != "" {
+		if loc, err := time.LoadLocation(pref.Timezone); err == nil {
+			return loc
+		}
+	}
+	if user != nil && user.Team != nil && user.Team.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Team.Timezone); err == nil {
+			return loc
+		}
+	}
+	return OrgLocation()
+}
+
+// zoneFor looks up the zone userID sees times in, see userLocation.
+func zoneFor(ctx context.Context, userRepo pg.UserRepository, notifyRepo pg.NotificationRepository, userID int64) (*time.Location, error) {
+	user, err := userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := notifyRepo.GetPreferences(ctx, []int64{userID})
+	if err != nil {
+		return nil, err
+	}
+	pref, ok := prefs[userID]
+	if !ok {
+		return userLocation(user, nil), nil
+	}
+	return userLocation(user, &pref), nil
+}
+
+// LocalTime returns the instant at which clocks in loc show wall's date
+// and time; wall's own location is ignored. Times skipped by a daylight
+// saving change return ErrNonexistentTime and times that occur twice
+// return ErrAmbiguousTime, rather than silently picking an hour.
+func LocalTime(wall time.Time, loc *time.Location) (time.Time, error) {
+	y, mo, d := wall.Date()
+	h, mi, sec := wall.Clock()
+	naive := time.Date(y, mo, d, h, mi, sec, wall.Nanosecond(), time.UTC)
+
+	// Any offset the wall time can have is in effect within a day of it.
+	var found []time.Time
+	seen := make(map[int]bool)
+	for _, probe := range []time.Time{naive.Add(-24 * time.Hour), naive, naive.Add(24 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		if seen[offset] {
+			continue
+		}
+		seen[offset] = true
+		t := naive.Add(-time.Duration(offset) * time.Second).In(loc)
+		ty, tmo, td := t.Date()
+		th, tmi, tsec := t.Clock()
+		if ty == y && tmo == mo && td == d && th == h && tmi == mi && tsec == sec {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return time.Time{}, ErrNonexistentTime
+	case 1:
+		return found[0], nil
+	}
+	return time.Time{}, ErrAmbiguousTime
+}
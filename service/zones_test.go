@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalTime(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip("time zone data unavailable:", err)
+		}
+		return loc
+	}
+	newYork := load("America/New_York")
+	berlin := load("Europe/Berlin")
+	tehran := load("Asia/Tehran")
+	lordHowe := load("Australia/Lord_Howe")
+	wall := func(y int, mo time.Month, d, h, mi int) time.Time {
+		return time.Date(y, mo, d, h, mi, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		wall time.Time
+		loc  *time.Location
+		want time.Time // UTC
+		err  error
+	}{
+		{"before spring forward", wall(2024, 3, 10, 1, 59), newYork, wall(2024, 3, 10, 6, 59), nil},
+		{"skipped by spring forward", wall(2024, 3, 10, 2, 30), newYork, time.Time{}, ErrNonexistentTime},
+		{"after spring forward", wall(2024, 3, 10, 3, 0), newYork, wall(2024, 3, 10, 7, 0), nil},
+		{"repeated by fall back", wall(2024, 11, 3, 1, 30), newYork, time.Time{}, ErrAmbiguousTime},
+		{"after fall back", wall(2024, 11, 3, 2, 0), newYork, wall(2024, 11, 3, 7, 0), nil},
+		{"skipped in Berlin", wall(2024, 3, 31, 2, 0), berlin, time.Time{}, ErrNonexistentTime},
+		{"repeated in Berlin", wall(2024, 10, 27, 2, 59), berlin, time.Time{}, ErrAmbiguousTime},
+		{"Berlin summer", wall(2024, 7, 1, 9, 0), berlin, wall(2024, 7, 1, 7, 0), nil},
+		// Iran moved clocks at midnight until it dropped DST in 2022.
+		{"skipped Tehran midnight", wall(2022, 3, 22, 0, 30), tehran, time.Time{}, ErrNonexistentTime},
+		{"repeated Tehran evening", wall(2022, 9, 21, 23, 30), tehran, time.Time{}, ErrAmbiguousTime},
+		{"Tehran without DST", wall(2024, 3, 20, 8, 0), tehran, wall(2024, 3, 20, 4, 30), nil},
+		// Lord Howe Island shifts by half an hour.
+		{"skipped half hour", wall(2024, 10, 6, 2, 15), lordHowe, time.Time{}, ErrNonexistentTime},
+		{"after half hour", wall(2024, 10, 6, 2, 30), lordHowe, wall(2024, 10, 5, 15, 30), nil},
+		{"repeated half hour", wall(2024, 4, 7, 1, 45), lordHowe, time.Time{}, ErrAmbiguousTime},
+		{"UTC", wall(2024, 3, 10, 2, 30), time.UTC, wall(2024, 3, 10, 2, 30), nil},
+	}
+	for _, tt := range tests {
+		got, err := LocalTime(tt.wall, tt.loc)
+		if err != tt.err {
+			t.Errorf("%s: LocalTime error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != tt.loc {
+			t.Errorf("%s: LocalTime = %v, want %v in %v", tt.name, got, tt.want, tt.loc)
+		}
+	}
+}
+
+func TestLocalTimeIgnoresWallZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("time zone data unavailable:", err)
+	}
+	wall := time.Date(2024, 11, 3, 9, 15, 30, 500, tokyo)
+	got, err := LocalTime(wall, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 11, 3, 14, 15, 30, 500, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("LocalTime = %v, want %v", got, want)
+	}
+}
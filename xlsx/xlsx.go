@@ -0,0 +1,370 @@
+// Package xlsx writes Office Open XML (Excel) workbooks. Rows are
+// streamed into the archive as they are written, one sheet at a time, so
+// large workbooks do not build up in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Styles of the stylesheet every workbook gets, by cellXfs index.
+const (
+	styleDefault = iota
+	styleHeader
+	styleDateTime
+	stylePersianDateTime
+	styleDecimal
+	styleBold
+	styleBoldDecimal
+)
+
+// kind is the type of a cell.
+type kind int
+
+const (
+	kindEmpty kind = iota
+	kindString
+	kindNumber
+)
+
+// Cell is a typed cell value. Use String, Int, Number and the time
+// constructors to make one; the zero Cell is empty.
+type Cell struct {
+	kind  kind
+	str   string
+	num   float64
+	style int
+}
+
+// String returns a text cell.
+func String(s string) Cell {
+	return Cell{kind: kindString, str: s}
+}
+
+// Int returns an integer cell.
+func Int(v int64) Cell {
+	return Cell{kind: kindNumber, num: float64(v)}
+}
+
+// Number returns a decimal cell shown with two decimals.
+func Number(v float64) Cell {
+	return Cell{kind: kindNumber, num: v, style: styleDecimal}
+}
+
+// Time returns a date and time cell with the wall clock of t. Spreadsheets
+// have no time zones, so convert t to the zone the reader expects first.
+func Time(t time.Time) Cell {
+	return Cell{kind: kindNumber, num: serial(t), style: styleDateTime}
+}
+
+// PersianTime is Time shown in the Solar Hijri (Jalali) calendar, which
+// Excel renders from the same date value.
+func PersianTime(t time.Time) Cell {
+	return Cell{kind: kindNumber, num: serial(t), style: stylePersianDateTime}
+}
+
+// Bold returns the cell in bold.
+func (c Cell) Bold() Cell {
+	switch c.style {
+	case styleDecimal:
+		c.style = styleBoldDecimal
+	case styleDefault:
+		c.style = styleBold
+	}
+	return c
+}
+
+// epoch is day zero of Excel's 1900 date system, allowing for its
+// fictitious 29 February 1900.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+func serial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(epoch).Hours() / 24
+}
+
+// Sheet names are limited to 31 characters and some punctuation.
+const maxSheetName = 31
+
+var sheetNameReplacer = strings.NewReplacer(`\`, "-", "/", "-", "?", "", "*", "", "[", "(", "]", ")", ":", "-")
+
+// ErrClosed is returned for writes after Close.
+var ErrClosed = errors.New("xlsx: workbook closed")
+
+type sheet struct {
+	name string
+	path string
+}
+
+// Writer writes a workbook to an io.Writer.
+type Writer struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer // open sheet, nil between sheets
+	row   int
+
+	sheets []sheet
+	order  []int // sheets by position in the workbook
+	names  map[string]bool
+	closed bool
+	err    error
+
+	// RightToLeft shows sheets from right to left, for Persian readers.
+	RightToLeft bool
+}
+
+// NewWriter starts a workbook.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w), names: make(map[string]bool)}
+}
+
+// AddSheet finishes the current sheet and starts a new one after the
+// others, with the given column widths in characters. The first row
+// written is the header: it is kept in view when scrolling.
+func (w *Writer) AddSheet(name string, widths ...float64) error {
+	return w.InsertSheet(len(w.order), name, widths...)
+}
+
+// InsertSheet is AddSheet placing the sheet at position i of the
+// workbook, so a summary written last can come first.
+func (w *Writer) InsertSheet(i int, name string, widths ...float64) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	name = w.uniqueName(name)
+	w.names[strings.ToLower(name)] = true
+	path := fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)+1)
+	w.sheets = append(w.sheets, sheet{name: name, path: path})
+	i = max(0, min(i, len(w.order)))
+	w.order = append(w.order[:i], append([]int{len(w.sheets) - 1}, w.order[i:]...)...)
+
+	f, err := w.zw.Create(path)
+	if err != nil {
+		return w.fail(err)
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.row = 0
+	rtl := ""
+	if w.RightToLeft {
+		rtl = ` rightToLeft="1"`
+	}
+	w.print(xml.Header)
+	w.print(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	w.print(`<sheetViews><sheetView workbookViewId="0"` + rtl + `><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		w.print("<cols>")
+		for c, width := range widths {
+			w.print(fmt.Sprintf(`<col min="%d" max="%d" width="%s" customWidth="1"/>`, c+1, c+1, strconv.FormatFloat(width, 'f', -1, 64)))
+		}
+		w.print("</cols>")
+	}
+	w.print("<sheetData>")
+	return w.err
+}
+
+// uniqueName makes name a valid sheet name not used yet in the workbook.
+func (w *Writer) uniqueName(name string) string {
+	name = strings.TrimSpace(sheetNameReplacer.Replace(name))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+	base := truncate(name, maxSheetName)
+	name = base
+	for n := 2; w.names[strings.ToLower(name)]; n++ {
+		suffix := " (" + strconv.Itoa(n) + ")"
+		name = truncate(base, maxSheetName-len(suffix)) + suffix
+	}
+	return name
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// WriteRow appends a row to the current sheet. The first row of a sheet
+// is its header and shown in bold.
+func (w *Writer) WriteRow(cells ...Cell) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.sheet == nil {
+		return errors.New("xlsx: no sheet to write to")
+	}
+	w.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.row)
+	for c, cell := range cells {
+		if w.row == 1 && cell.style == styleDefault {
+			cell.style = styleHeader
+		}
+		ref := column(c) + strconv.Itoa(w.row)
+		switch cell.kind {
+		case kindString:
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, cell.style)
+			xml.EscapeText(&b, []byte(clean(cell.str)))
+			b.WriteString("</t></is></c>")
+		case kindNumber:
+			if math.IsNaN(cell.num) || math.IsInf(cell.num, 0) {
+				fmt.Fprintf(&b, `<c r="%s" s="%d"/>`, ref, cell.style)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.style, strconv.FormatFloat(cell.num, 'f', -1, 64))
+		}
+	}
+	b.WriteString("</row>")
+	w.print(b.String())
+	return w.err
+}
+
+// Close finishes the last sheet and writes the workbook parts.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	if len(w.sheets) == 0 {
+		// A workbook needs a sheet.
+		if err := w.AddSheet("Sheet1"); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	var types, sheets, rels strings.Builder
+	for _, s := range w.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/%s" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, s.path)
+	}
+	for pos, i := range w.order {
+		s := w.sheets[i]
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.name), pos+1, i+1)
+	}
+	for i, s := range w.sheets {
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="%s"/>`,
+			i+1, strings.TrimPrefix(s.path, "xl/"))
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheets)+1)
+
+	parts := []struct{ path, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", stylesheet},
+	}
+	for _, part := range parts {
+		f, err := w.zw.Create(part.path)
+		if err != nil {
+			return w.fail(err)
+		}
+		if _, err := io.WriteString(f, xml.Header+part.body); err != nil {
+			return w.fail(err)
+		}
+	}
+	if err := w.zw.Close(); err != nil {
+		return w.fail(err)
+	}
+	return nil
+}
+
+// stylesheet defines the styles above. Number formats 164 and up are
+// custom; [$-fa-IR,16] selects the Solar Hijri calendar.
+const stylesheet = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="3">` +
+	`<numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/>` +
+	`<numFmt numFmtId="165" formatCode="[$-fa-IR,16]yyyy/mm/dd hh:mm"/>` +
+	`<numFmt numFmtId="166" formatCode="0.00"/>` +
+	`</numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFE7E6E6"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="7">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="166" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+func (w *Writer) endSheet() error {
+	if w.sheet == nil {
+		return w.err
+	}
+	w.print("</sheetData></worksheet>")
+	if w.err == nil {
+		w.err = w.sheet.Flush()
+	}
+	w.sheet = nil
+	return w.err
+}
+
+func (w *Writer) print(s string) {
+	if w.err != nil || w.sheet == nil {
+		return
+	}
+	_, w.err = w.sheet.WriteString(s)
+}
+
+func (w *Writer) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// column returns the letters of a zero-based column index: A, B, ..., AA.
+func column(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// clean drops characters XML 1.0 cannot carry.
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || r >= 0x20 && r != 0xFFFE && r != 0xFFFF && r != utf8.RuneError {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}